@@ -0,0 +1,192 @@
+// Package auth signs and verifies the JWT access tokens of the forum. Tokens
+// are signed with asymmetric keys named by their kid header, so that keys can
+// be rotated and other services can verify tokens with the published JWKS.
+package auth
+
+import (
+	"backend/utils"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// AccessTokenTTL is the lifetime of a JWT access token
+const AccessTokenTTL = time.Minute * 10
+
+// DefaultIssuer is the iss and aud claim when JWT_ISSUER and JWT_AUDIENCE are not set
+const DefaultIssuer = "soforum"
+
+// Claims are the claims of an access token, bound to a login session and
+// carrying the user's role and moderated categories
+type Claims struct {
+	SessionID           string   `json:"sid"`
+	Role                string   `json:"role"`
+	ModeratedCategories []string `json:"mod_categories"`
+	jwt.RegisteredClaims
+}
+
+// Service issues access tokens with its signing key and verifies them with any
+// of its keys, which lets tokens signed before a rotation work until they expire
+type Service struct {
+	// Issuer and Audience are the iss and aud claims of the tokens
+	Issuer   string
+	Audience string
+
+	signingKey *Key
+	keys       []*Key
+	keysByID   map[string]*Key
+}
+
+// NewService returns a service signing with the key named signingKeyID, which
+// must have its private part, and verifying with every key
+func NewService(issuer, audience, signingKeyID string, keys []*Key) (*Service, error) {
+	s := &Service{Issuer: issuer, Audience: audience, keys: keys, keysByID: make(map[string]*Key)}
+	for _, key := range keys {
+		if _, exists := s.keysByID[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key ID %s", key.ID)
+		}
+		s.keysByID[key.ID] = key
+	}
+
+	s.signingKey = s.keysByID[signingKeyID]
+	if s.signingKey == nil {
+		return nil, fmt.Errorf("signing key %s not found", signingKeyID)
+	}
+	if s.signingKey.Private == nil {
+		return nil, fmt.Errorf("signing key %s has no private key", signingKeyID)
+	}
+	return s, nil
+}
+
+// Ephemeral returns a service signing with an Ed25519 key generated on the
+// spot, for tests and development. Its tokens stop working on restart.
+func Ephemeral(issuer, audience string) *Service {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	key, err := NewKey("ephemeral", private)
+	if err != nil {
+		panic(err)
+	}
+	s, err := NewService(issuer, audience, key.ID, []*Key{key})
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// FromEnv returns the service using the keys in JWT_KEYS_DIR, signing with the
+// one named by JWT_SIGNING_KEY_ID, which may be left out when a single private
+// key is in the directory. Without JWT_KEYS_DIR it signs with an ephemeral key,
+// except in production where that is an error, as restarts and other instances
+// would reject the tokens.
+func FromEnv() (*Service, error) {
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		issuer = DefaultIssuer
+	}
+	audience := os.Getenv("JWT_AUDIENCE")
+	if audience == "" {
+		audience = DefaultIssuer
+	}
+
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		if os.Getenv("ENV") == "production" {
+			return nil, fmt.Errorf("JWT_KEYS_DIR is required in production")
+		}
+		log.Printf("JWT_KEYS_DIR is not set, signing access tokens with an ephemeral key")
+		return Ephemeral(issuer, audience), nil
+	}
+	keys, err := LoadKeys(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKeyID := os.Getenv("JWT_SIGNING_KEY_ID")
+	if signingKeyID == "" {
+		for _, key := range keys {
+			if key.Private == nil {
+				continue
+			}
+			if signingKeyID != "" {
+				return nil, fmt.Errorf("JWT_SIGNING_KEY_ID is required when JWT_KEYS_DIR has several private keys")
+			}
+			signingKeyID = key.ID
+		}
+	}
+	return NewService(issuer, audience, signingKeyID, keys)
+}
+
+// Issue signs an access token for username bound to a login session
+func (s *Service) Issue(username, sessionID, role string, moderatedCategories []string) (string, error) {
+	tokenID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(s.signingKey.Method, Claims{
+		SessionID:           sessionID,
+		Role:                role,
+		ModeratedCategories: moderatedCategories,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.Issuer,
+			Subject:   username,
+			Audience:  jwt.ClaimStrings{s.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			ID:        tokenID,
+		},
+	})
+	token.Header["kid"] = s.signingKey.ID
+
+	return token.SignedString(s.signingKey.Private)
+}
+
+// Verify checks the signature, expiry, issuer and audience of an access token
+// and returns its claims
+func (s *Service) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		key := s.keysByID[keyID]
+		if key == nil {
+			return nil, fmt.Errorf("unknown key: %q", keyID)
+		}
+		// Only accept the algorithm of the key, so that a public key is never
+		// used as an HMAC secret
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.Public, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ExpiresAt == nil || claims.IssuedAt == nil {
+		return nil, errors.New("token has no expiry or issue time")
+	}
+	if !claims.VerifyIssuer(s.Issuer, true) || !claims.VerifyAudience(s.Audience, true) {
+		return nil, errors.New("token was not issued for this service")
+	}
+	return claims, nil
+}
+
+// JWKS returns the public part of every key, for other services to verify
+// access tokens with
+func (s *Service) JWKS() []JWK {
+	jwks := make([]JWK, 0, len(s.keys))
+	for _, key := range s.keys {
+		jwks = append(jwks, key.JWK())
+	}
+	return jwks
+}
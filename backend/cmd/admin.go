@@ -0,0 +1,38 @@
+package main
+
+import (
+	"backend/config"
+	"backend/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// runPromoteAdmin handles the "promote-admin" subcommand, which makes an
+// existing user an admin. It bootstraps the first admin, who then manages the
+// roles of others under /admin.
+func runPromoteAdmin(args []string) {
+	if len(args) != 1 {
+		log.Fatal("usage: promote-admin <username>")
+	}
+	username := args[0]
+
+	config.ConnectDB()
+	defer config.DB.Close()
+
+	userID, err := models.GetUserIDByUsername(username, config.DB)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Fatalf("User %s not found", username)
+		}
+		log.Fatal(err)
+	}
+	if userID == models.LeftUserID {
+		log.Fatalf("The reserved user %s cannot be promoted", username)
+	}
+	if err := models.SetUserRole(config.DB, username, models.RoleAdmin); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Promoted %s to admin\n", username)
+}
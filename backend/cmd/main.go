@@ -1,14 +1,20 @@
 package main
 
 import (
+	"backend/auth"
 	"backend/config"
 	"backend/controllers"
+	"backend/mail"
 	"backend/middlewares"
+	"backend/models"
+	"backend/realtime"
+	"backend/routes"
+	"backend/utils"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
-	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
 )
 
@@ -16,99 +22,67 @@ func main() {
 	// Load environment variables
 	config.LoadEnv()
 
-	// Initialize the database connection
-	config.InitDB()
+	// Select the password hashing algorithm
+	utils.InitPasswordHasher()
+
+	// Read how long deleted content stays in the trash
+	initTrashRetention()
+
+	// Run a subcommand instead of the server if requested
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		case "reconcile":
+			runReconcile(os.Args[2:])
+			return
+		case "purge":
+			runPurge(os.Args[2:])
+			return
+		case "promote-admin":
+			runPromoteAdmin(os.Args[2:])
+			return
+		}
+	}
 
-	// Set up the Gin router
-	router := gin.Default()
+	// Anyone could forge email and download links signed with an empty key
+	if os.Getenv("JWT_SECRET_KEY") == "" {
+		log.Fatalf("JWT_SECRET_KEY must be set to sign email and download links")
+	}
 
-	// Enable CORS for frontend localhost
-	router.Use(middlewares.SetupCORS())
+	// Initialize the database connection
+	config.InitDB()
 
-	// Define routes and pass the db connection
-	router.GET("/", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"message": "Welcome to the API!",
-		})
-	})
-	userGroup := router.Group("/user")
-	{
-		userGroup.PUT("/:username", middlewares.JWTAuthMiddleware(), func(c *gin.Context) {
-			controllers.UpdateUser(c, config.DB)
-		})
-		userGroup.GET("/:username", func(c *gin.Context) {
-			controllers.GetUser(c, config.DB)
-		})
-		userGroup.GET("/:username/saved_threads", middlewares.JWTAuthMiddleware(), func(c *gin.Context) {
-			controllers.GetSavedThreads(c, config.DB)
-		})
-		userGroup.GET("/:username/saved_state/:thread_id", middlewares.JWTAuthMiddleware(), func(c *gin.Context) {
-			controllers.CheckSavedState(c, config.DB)
-		})
-		userGroup.POST("/:username/save_thread/:thread_id", middlewares.JWTAuthMiddleware(), func(c *gin.Context) {
-			controllers.SaveThread(c, config.DB)
-		})
-		userGroup.DELETE("/:username/unsave_thread/:thread_id", middlewares.JWTAuthMiddleware(), func(c *gin.Context) {
-			controllers.RemoveSavedThread(c, config.DB)
-		})
+	// Set up the Gin router backed by Postgres
+	store := models.NewPostgresStore(config.DB)
+	mailer, err := mail.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to set up the mailer: %v", err)
 	}
-	threadGroup := router.Group("/threads")
-	threadGroup.Use(middlewares.JWTAuthMiddleware())
-	{
-		threadGroup.POST("/post", func(c *gin.Context) {
-			controllers.PostThread(c, config.DB)
-		})
-		threadGroup.PUT("/:thread_id", func(c *gin.Context) {
-			controllers.EditThread(c, config.DB)
-		})
-		threadGroup.DELETE("/:thread_id", func(c *gin.Context) {
-			controllers.DeleteThread(c, config.DB)
-		})
+	store.Mailer = mailer
+	store.JWT, err = auth.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load the JWT keys: %v", err)
 	}
-	commentGroup := router.Group("/threads/:thread_id/comments")
-	commentGroup.Use(middlewares.JWTAuthMiddleware())
-	{
-		commentGroup.POST("", func(c *gin.Context) {
-			controllers.AddComment(c, config.DB)
-		})
-		commentGroup.PUT("/:comment_id", func(c *gin.Context) {
-			controllers.EditComment(c, config.DB)
-		})
-		commentGroup.DELETE("/:comment_id", func(c *gin.Context) {
-			controllers.DeleteComment(c, config.DB)
-		})
+	controllers.RequireVerifiedEmail = os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+	middlewares.RequireTwoFactorForPrivileged = os.Getenv("REQUIRE_2FA_FOR_PRIVILEGED") == "true"
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		for _, proxy := range strings.Split(proxies, ",") {
+			routes.TrustedProxies = append(routes.TrustedProxies, strings.TrimSpace(proxy))
+		}
 	}
-	voteGroup := router.Group("/threads/:thread_id/votes")
-	voteGroup.Use(middlewares.JWTAuthMiddleware())
-	{
-		voteGroup.POST("", func(c *gin.Context) {
-			controllers.CastVote(c, config.DB)
-		})
-		voteGroup.DELETE("", func(c *gin.Context) {
-			controllers.DeleteVote(c, config.DB)
-		})
+	router := routes.SetupRouter(store)
+
+	// Share real-time events with the other instances through Postgres
+	if os.Getenv("REALTIME_PG_NOTIFY") == "true" {
+		if _, err := realtime.ListenPostgres(store.Events, config.DB, config.ConnString()); err != nil {
+			log.Fatalf("Failed to listen for real-time events: %v", err)
+		}
 	}
-	router.POST("/signup", func(c *gin.Context) {
-		controllers.UserSignup(c, config.DB)
-	})
-	router.POST("/login", func(c *gin.Context) {
-		controllers.UserLogin(c, config.DB)
-	})
-	router.GET("/threads", func(c *gin.Context) {
-		controllers.GetThreads(c, config.DB)
-	})
-	router.GET("/threads/:thread_id", func(c *gin.Context) {
-		controllers.GetSingleThread(c, config.DB)
-	})
-	router.GET("/threads/:thread_id/comments", func(c *gin.Context) {
-		controllers.GetComments(c, config.DB)
-	})
-	router.GET("/threads/:thread_id/votes", func(c *gin.Context) {
-		controllers.CountVotes(c, config.DB)
-	})
-	router.GET("/:username/:thread_id/vote_state", func(c *gin.Context) {
-		controllers.GetVoteState(c, config.DB)
-	})
+
+	// Remove deleted content for good once it leaves the retention window
+	startPurgeJob(config.DB)
 
 	// Run the server
 	fmt.Println(`
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"backend/config"
+	"backend/migrations"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrate handles the "migrate" subcommand
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	config.ConnectDB()
+	defer config.DB.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrations.Up(config.DB)
+		for _, migration := range applied {
+			fmt.Printf("Applied migration %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatal(migrateUsage)
+			}
+		}
+		reverted, err := migrations.Down(config.DB, steps)
+		for _, migration := range reverted {
+			fmt.Printf("Reverted migration %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case "status":
+		statuses, err := migrations.GetStatus(config.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, status := range statuses {
+			switch {
+			case status.Missing:
+				fmt.Printf("%04d  %-30s  applied %s (missing from binary)\n", status.Version, "?", status.AppliedAt.Format("2006-01-02 15:04:05"))
+			case status.AppliedAt != nil:
+				fmt.Printf("%04d  %-30s  applied %s\n", status.Version, status.Name, status.AppliedAt.Format("2006-01-02 15:04:05"))
+			default:
+				fmt.Printf("%04d  %-30s  pending\n", status.Version, status.Name)
+			}
+		}
+
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
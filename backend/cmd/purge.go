@@ -0,0 +1,98 @@
+package main
+
+import (
+	"backend/config"
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// purgeInterval is how often the server purges the trash
+const purgeInterval = time.Hour
+
+// initTrashRetention reads how many days deleted content can be restored from
+// TRASH_RETENTION_DAYS, defaulting to models.TrashRetention
+func initTrashRetention() {
+	daysStr := os.Getenv("TRASH_RETENTION_DAYS")
+	if daysStr == "" {
+		return
+	}
+	days, err := strconv.Atoi(daysStr)
+	if err != nil || days < 1 {
+		log.Fatalf("Invalid TRASH_RETENTION_DAYS: %s", daysStr)
+	}
+	models.TrashRetention = time.Duration(days) * 24 * time.Hour
+}
+
+// purgeTrash removes the content that stayed in the trash past the retention window
+func purgeTrash(db *sql.DB) (int64, int64, error) {
+	return models.PurgeDeleted(db, time.Now().Add(-models.TrashRetention))
+}
+
+// purgeExports drops the archives of the data exports whose download link expired
+func purgeExports(db *sql.DB) (int64, error) {
+	return models.PurgeDataExports(db, time.Now())
+}
+
+// purgeLoginFailures forgets the failed logins that no longer count
+func purgeLoginFailures(db *sql.DB) (int64, error) {
+	return models.PurgeLoginFailures(db, time.Now().Add(-max(models.AccountLoginPolicy.Window, models.IPLoginPolicy.Window)))
+}
+
+// startPurgeJob purges the trash, expired data exports and stale login failures
+// in the background every purgeInterval, starting right away
+func startPurgeJob(db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			if _, err := purgeLoginFailures(db); err != nil {
+				log.Printf("Error purging login failures: %v", err)
+			}
+
+			if exports, err := purgeExports(db); err != nil {
+				log.Printf("Error purging data exports: %v", err)
+			} else if exports > 0 {
+				log.Printf("Purged %d expired data exports", exports)
+			}
+
+			threads, comments, err := purgeTrash(db)
+			if err != nil {
+				log.Printf("Error purging the trash: %v", err)
+				continue
+			}
+			if threads > 0 || comments > 0 {
+				log.Printf("Purged %d threads and %d comments from the trash", threads, comments)
+			}
+		}
+	}()
+}
+
+// runPurge handles the "purge" subcommand, which purges the trash, expired data
+// exports and stale login failures once
+func runPurge(args []string) {
+	if len(args) != 0 {
+		log.Fatal("usage: purge")
+	}
+
+	config.ConnectDB()
+	defer config.DB.Close()
+
+	threads, comments, err := purgeTrash(config.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exports, err := purgeExports(config.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	failures, err := purgeLoginFailures(config.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Purged %d threads, %d comments, %d expired data exports and %d stale login failures\n", threads, comments, exports, failures)
+}
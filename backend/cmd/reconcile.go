@@ -0,0 +1,25 @@
+package main
+
+import (
+	"backend/config"
+	"backend/models"
+	"fmt"
+	"log"
+)
+
+// runReconcile handles the "reconcile" subcommand, which recomputes the
+// denormalized thread counters in case they drifted from votes and comments
+func runReconcile(args []string) {
+	if len(args) != 0 {
+		log.Fatal("usage: reconcile")
+	}
+
+	config.ConnectDB()
+	defer config.DB.Close()
+
+	updated, err := models.ReconcileThreadCounters(config.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Reconciled counters of %d threads\n", updated)
+}
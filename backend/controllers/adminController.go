@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"backend/models"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetUserRole handles requests to change the site-wide role of a user
+func SetUserRole(c *gin.Context, store *models.Store) {
+	username := c.Param("username")
+
+	var roleData struct {
+		Role   models.Role `json:"role"`
+		Reason string      `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&roleData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if !roleData.Role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+		return
+	}
+
+	// Stop admins from locking everyone out by demoting themselves
+	if username == c.GetString("username") && roleData.Role != models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot change your own role"})
+		return
+	}
+
+	user, err := store.Users.GetUserByUsername(username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return
+	}
+
+	if err := store.Users.SetUserRole(username, roleData.Role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update role"})
+		return
+	}
+
+	audit(c, store, models.AuditRoleChange, models.AuditTargetUser, user.ID, strings.TrimSpace(roleData.Reason),
+		gin.H{"role": user.Role}, gin.H{"role": roleData.Role})
+
+	c.JSON(http.StatusOK, gin.H{"message": "role updated successfully"})
+}
+
+// auditModerators records a change to the categories a user moderates
+func auditModerators(c *gin.Context, store *models.Store, action models.AuditAction, username string, userID int, reason string, before *models.Grants) {
+	after, err := store.Users.GetUserGrants(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+	}
+	audit(c, store, action, models.AuditTargetUser, userID, reason, before, after)
+}
+
+// AddCategoryModerator handles requests to make a user moderator of a category
+func AddCategoryModerator(c *gin.Context, store *models.Store) {
+	category := c.Param("category")
+
+	var moderatorData struct {
+		Username string `json:"username"`
+		Reason   string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&moderatorData); err != nil || moderatorData.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+
+	if _, err := store.Threads.GetCategoryIDByName(category); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	}
+	userID, err := store.Users.GetUserIDByUsername(moderatorData.Username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	before, err := store.Users.GetUserGrants(moderatorData.Username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return
+	}
+
+	if err := store.Users.AddCategoryModerator(moderatorData.Username, category); err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add moderator"})
+		return
+	}
+
+	auditModerators(c, store, models.AuditModeratorAdd, moderatorData.Username, userID, strings.TrimSpace(moderatorData.Reason), before)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "moderator added successfully"})
+}
+
+// RemoveCategoryModerator handles requests to revoke a user's moderator rights in a category
+func RemoveCategoryModerator(c *gin.Context, store *models.Store) {
+	category := c.Param("category")
+	username := c.Param("username")
+
+	if _, err := store.Threads.GetCategoryIDByName(category); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	}
+	userID, err := store.Users.GetUserIDByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	before, err := store.Users.GetUserGrants(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return
+	}
+
+	if err := store.Users.RemoveCategoryModerator(username, category); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user or category not found"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove moderator"})
+		return
+	}
+
+	auditModerators(c, store, models.AuditModeratorRemove, username, userID, c.Query("reason"), before)
+
+	c.JSON(http.StatusOK, gin.H{"message": "moderator removed successfully"})
+}
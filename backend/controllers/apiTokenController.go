@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"backend/middlewares"
+	"backend/models"
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultAPITokenDays is how long API tokens work when no expiry is given
+	defaultAPITokenDays = 30
+	// maxAPITokenDays is the longest API tokens may work
+	maxAPITokenDays = 365
+	// maxAPITokenNameLength is the column size of token names
+	maxAPITokenNameLength = 64
+)
+
+// GetAPITokens handles requests for the current user's personal API tokens,
+// without their secrets
+func GetAPITokens(c *gin.Context, store *models.Store) {
+	username := c.Param("username")
+	if c.GetString("username") != username {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		return
+	}
+
+	tokens, err := store.APITokens.GetAPITokens(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// CreateAPIToken handles requests for a new personal API token, confirmed with
+// the user's password. The token is only shown in the response. Only users
+// whose login currently grants them more than user rights may create tokens
+// with the moderate scope.
+func CreateAPIToken(c *gin.Context, store *models.Store) {
+	username := c.Param("username")
+	if c.GetString("username") != username {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		return
+	}
+	var tokenData struct {
+		Password      string              `json:"password"`
+		Name          string              `json:"name"`
+		Scopes        []models.TokenScope `json:"scopes"`
+		ExpiresInDays int                 `json:"expires_in_days"`
+	}
+	if err := c.ShouldBindJSON(&tokenData); err != nil || tokenData.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+
+	name := strings.TrimSpace(tokenData.Name)
+	if name == "" || len(name) > maxAPITokenNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token name must be between 1 and 64 characters"})
+		return
+	}
+	if len(tokenData.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one scope is required"})
+		return
+	}
+	var scopes []models.TokenScope
+	for _, scope := range tokenData.Scopes {
+		if !scope.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scope: " + string(scope)})
+			return
+		}
+		if !models.HasScope(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if tokenData.ExpiresInDays == 0 {
+		tokenData.ExpiresInDays = defaultAPITokenDays
+	}
+	if tokenData.ExpiresInDays < 1 || tokenData.ExpiresInDays > maxAPITokenDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tokens must expire within 1 to 365 days"})
+		return
+	}
+	if models.HasScope(scopes, models.ScopeModerate) && !middlewares.GetGrants(c).Privileged() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only moderators and admins can create tokens with the moderate scope"})
+		return
+	}
+	if !confirmPassword(c, store, username, tokenData.Password) {
+		return
+	}
+
+	existing, err := store.APITokens.GetAPITokens(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tokens"})
+		return
+	}
+	if len(existing) >= models.MaxAPITokens {
+		c.JSON(http.StatusConflict, gin.H{"error": "too many tokens, revoke one first"})
+		return
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+	secret = models.APITokenPrefix + secret
+	expiresAt := time.Now().AddDate(0, 0, tokenData.ExpiresInDays)
+	token, err := store.APITokens.CreateAPIToken(username, name, scopes, expiresAt, utils.HashToken(secret))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": token, "secret": secret})
+}
+
+// DeleteAPIToken handles requests to revoke one of the current user's personal
+// API tokens
+func DeleteAPIToken(c *gin.Context, store *models.Store) {
+	username := c.Param("username")
+	if c.GetString("username") != username {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		return
+	}
+	tokenID, err := strconv.Atoi(c.Param("token_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token ID"})
+		return
+	}
+
+	if err := store.APITokens.DeleteAPIToken(username, tokenID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "token revoked"})
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"backend/models"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// snapshot encodes the state of an audit target, nil for none
+func snapshot(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return nil
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+// audit records a privileged or destructive action of the current user in the
+// audit log, with the target as it was before and after. Failures are logged
+// rather than failing the request that already acted.
+func audit(c *gin.Context, store *models.Store, action models.AuditAction, targetType string, targetID int, reason string, before, after interface{}) {
+	err := store.Audit.CreateAuditEntry(&models.AuditEntry{
+		Actor:      c.GetString("username"),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Reason:     reason,
+		Before:     snapshot(before),
+		After:      snapshot(after),
+		IP:         c.ClientIP(),
+	})
+	if err != nil {
+		log.Printf("Error auditing %s on %s %d: %v", action, targetType, targetID, err)
+	}
+}
+
+// parseAuditTime reads an optional RFC 3339 timestamp from the query
+func parseAuditTime(c *gin.Context, key string) (*time.Time, bool) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, true
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + key})
+		return nil, false
+	}
+	return &t, true
+}
+
+// GetAuditLog lists the audit log newest first. It can be filtered with
+// ?actor=, ?action=, ?target_type=, ?target_id= and a ?since= / ?until= range
+// of RFC 3339 timestamps.
+func GetAuditLog(c *gin.Context, store *models.Store) {
+	// Parse query parameters for pagination
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page number"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit number"})
+		return
+	}
+
+	filter := models.AuditFilter{
+		Actor:      c.Query("actor"),
+		Action:     models.AuditAction(c.Query("action")),
+		TargetType: c.Query("target_type"),
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		if filter.TargetID, err = strconv.Atoi(targetID); err != nil || filter.TargetID < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid target_id"})
+			return
+		}
+	}
+	var ok bool
+	if filter.Since, ok = parseAuditTime(c, "since"); !ok {
+		return
+	}
+	if filter.Until, ok = parseAuditTime(c, "until"); !ok {
+		return
+	}
+
+	entries, err := store.Audit.GetAuditEntries(filter, page, limit)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
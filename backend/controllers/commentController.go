@@ -1,17 +1,33 @@
 package controllers
 
 import (
+	"backend/middlewares"
 	"backend/models"
 	"database/sql"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 )
 
+// maxCommentContent is how many characters a comment may have, which also
+// bounds the size of its revisions
+const maxCommentContent = 10000
+
+// checkCommentContent responds with 400 and reports false when content is too long
+func checkCommentContent(c *gin.Context, content string) bool {
+	if utf8.RuneCountInString(content) > maxCommentContent {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("content must be at most %d characters", maxCommentContent)})
+		return false
+	}
+	return true
+}
+
 // AddComment handles creating a new comment
-func AddComment(c *gin.Context, db *sql.DB) {
+func AddComment(c *gin.Context, store *models.Store) {
 	// Get the username from JWT middleware
 	username := c.GetString("username")
 
@@ -22,51 +38,190 @@ func AddComment(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	// Suspended and banned users cannot comment
+	if !checkThreadSanctions(c, store, threadID) {
+		return
+	}
+
 	// Parse the request body for the comment content
 	var newComment models.Comment
 	if err := c.ShouldBindJSON(&newComment); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
 		return
 	}
+	if !checkCommentContent(c, newComment.Content) {
+		return
+	}
+
+	// Replies must answer a live comment in the same thread
+	if newComment.ParentID != nil {
+		parent, err := store.Comments.GetCommentByID(*newComment.ParentID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid parent comment ID"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch parent comment"})
+			return
+		}
+		if parent.ThreadID != threadID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid parent comment ID"})
+			return
+		}
+		if parent.Deleted {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot reply to a deleted comment"})
+			return
+		}
+	}
 
 	// Set ThreadID and Username
 	newComment.ThreadID = threadID
 	newComment.Username = username
 
 	// Add comment to table
-	createdComment, err := models.CreateComment(db, &newComment)
+	createdComment, err := store.Comments.CreateComment(&newComment)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create comment"})
 		return
 	}
 
+	publishComment(store, "comment_created", createdComment)
+	notifyNewComment(store, createdComment)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "comment created successfully",
 		"comment": createdComment,
 	})
 }
 
-// GetComments handles requests to fetch comments for a specific thread
-func GetComments(c *gin.Context, db *sql.DB) {
+// parseCommentDepth reads the max_depth query parameter
+func parseCommentDepth(c *gin.Context) (int, error) {
+	depth, err := strconv.Atoi(c.DefaultQuery("max_depth", strconv.Itoa(models.DefaultCommentDepth)))
+	if err != nil || depth < 0 {
+		return 0, errors.New("invalid max_depth")
+	}
+	if depth > models.MaxCommentDepth {
+		depth = models.MaxCommentDepth
+	}
+	return depth, nil
+}
+
+// respondWithCommentTree sends the comments under rootID either nested or as a depth-first list
+func respondWithCommentTree(c *gin.Context, comments []models.Comment, rootID int) {
+	maxDepth, err := parseCommentDepth(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order := c.DefaultQuery("sort", models.CommentSortOld)
+	if !models.ValidCommentSort(order) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort"})
+		return
+	}
+
+	tree := models.BuildCommentTree(comments, rootID, maxDepth)
+	models.SortCommentTree(tree, order)
+	if c.Query("nested") == "true" {
+		if tree == nil {
+			tree = []*models.Comment{}
+		}
+		c.JSON(http.StatusOK, gin.H{"comments": tree})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"comments": models.FlattenCommentTree(tree)})
+}
+
+// GetComments handles requests to fetch the comments of a thread. Comments are
+// listed depth-first with their depth, or nested under "replies" with ?nested=true.
+// Branches deeper than max_depth are cut off and flagged with has_more_replies.
+// Siblings are ordered by ?sort=old (default), new or score, and signed in users
+// get their own vote on each comment as user_vote. Hidden comments are redacted
+// for everyone but their author and the moderators reviewing reports, and
+// shadowbanned users' comments are only listed for themselves. Threads the
+// user may not see have no comments to list either.
+func GetComments(c *gin.Context, store *models.Store) {
 	// Parse thread ID from URL
 	threadID, err := strconv.Atoi(c.Param("thread_id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread ID"})
 		return
 	}
+	if _, ok := viewableThread(c, store, threadID); !ok {
+		return
+	}
 
 	// Get comments from database
-	comments, err := models.GetCommentsByThreadID(db, threadID)
+	comments, err := store.Comments.GetCommentsByThreadID(threadID, c.GetString("username"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comments"})
 		return
 	}
+	if err := redactHiddenComments(c, store, threadID, comments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comments"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"comments": comments})
+	respondWithCommentTree(c, comments, 0)
 }
 
-// EditComment handles requests to edit a comment
-func EditComment(c *gin.Context, db *sql.DB) {
+// GetCommentReplies handles requests to fetch a single comment and its replies,
+// used to load branches cut off by max_depth
+func GetCommentReplies(c *gin.Context, store *models.Store) {
+	// Parse thread and comment ID from URL
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread ID"})
+		return
+	}
+	commentID, err := strconv.Atoi(c.Param("comment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid comment ID"})
+		return
+	}
+	if _, ok := viewableThread(c, store, threadID); !ok {
+		return
+	}
+
+	comment, err := store.Comments.GetCommentByID(commentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comment"})
+		return
+	}
+	if comment.ThreadID != threadID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return
+	}
+
+	comments, err := store.Comments.GetCommentsByThreadID(threadID, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comments"})
+		return
+	}
+	if err := redactHiddenComments(c, store, threadID, comments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comments"})
+		return
+	}
+
+	respondWithCommentTree(c, comments, commentID)
+}
+
+// canModerateComment reports whether the current user holds perm in the category of the comment's thread
+func canModerateComment(c *gin.Context, store *models.Store, commentID int, perm models.Permission) (bool, error) {
+	category, err := store.Comments.GetCommentCategory(commentID)
+	if err != nil {
+		return false, err
+	}
+	return middlewares.GetGrants(c).Can(perm, category), nil
+}
+
+// EditComment handles requests to edit a comment. Every edit is kept as a
+// revision, and moderators' edits are audited with an optional ?reason=.
+func EditComment(c *gin.Context, store *models.Store) {
 	// Parse comment ID from URL
 	commentID, err := strconv.Atoi(c.Param("comment_id"))
 	if err != nil {
@@ -77,8 +232,8 @@ func EditComment(c *gin.Context, db *sql.DB) {
 	// Get the username from JWT middleware
 	username := c.GetString("username")
 
-	// Check if user is comment owner
-	owner, err := models.GetCommentOwnerUsername(db, commentID)
+	// Check if user is comment owner or moderates the category
+	owner, err := store.Comments.GetCommentOwnerUsername(commentID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid comment ID"})
@@ -88,7 +243,28 @@ func EditComment(c *gin.Context, db *sql.DB) {
 		return
 	}
 	if owner != username {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		allowed, err := canModerateComment(c, store, commentID, models.PermEditAnyComment)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comment category"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+			return
+		}
+	}
+
+	// Deleted comments only remain as placeholders for their replies
+	existing, err := store.Comments.GetCommentByID(commentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comment"})
+		return
+	}
+	if existing.Deleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot edit a deleted comment"})
+		return
+	}
+	if !checkThreadSanctions(c, store, existing.ThreadID) {
 		return
 	}
 
@@ -98,18 +274,31 @@ func EditComment(c *gin.Context, db *sql.DB) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
 		return
 	}
+	if !checkCommentContent(c, updatedComment.Content) {
+		return
+	}
 
 	// Edit the comment
-	if err := models.EditComment(db, commentID, updatedComment.Content); err != nil {
+	if err := store.Comments.EditComment(commentID, updatedComment.Content, username); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to edit comment"})
 		return
 	}
 
+	edited, err := store.Comments.GetCommentByID(commentID)
+	if err == nil {
+		publishComment(store, "comment_updated", edited)
+	}
+	if owner != username {
+		audit(c, store, models.AuditCommentEdit, models.AuditTargetComment, commentID, c.Query("reason"), existing, edited)
+		notifyModeration(store, owner, username, &existing.ThreadID, &commentID, "A moderator edited your comment")
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "comment updated successfully"})
 }
 
-// DeleteComment handles requests to delete a comment
-func DeleteComment(c *gin.Context, db *sql.DB) {
+// DeleteComment handles requests to delete a comment, which moves it to the
+// trash. Moderators may give a ?reason=, which is audited and passed on to the owner.
+func DeleteComment(c *gin.Context, store *models.Store) {
 	// Parse comment ID from URL
 	commentID, err := strconv.Atoi(c.Param("comment_id"))
 	if err != nil {
@@ -121,7 +310,7 @@ func DeleteComment(c *gin.Context, db *sql.DB) {
 	username := c.GetString("username")
 
 	// Get owner username
-	ownername, err := models.GetCommentOwnerUsername(db, commentID)
+	ownername, err := store.Comments.GetCommentOwnerUsername(commentID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid comment ID"})
@@ -131,17 +320,46 @@ func DeleteComment(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	// Check if user is comment owner
+	// Check if user is comment owner or moderates the category
 	if ownername != username {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		allowed, err := canModerateComment(c, store, commentID, models.PermDeleteAnyComment)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comment category"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+			return
+		}
+	}
+
+	// Keep the thread to tell the owner where a moderator removed their comment
+	existing, err := store.Comments.GetCommentByID(commentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comment"})
+		return
+	}
+	if existing.Deleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "comment already deleted"})
 		return
 	}
 
 	// Delete the comment
-	if err := models.DeleteComment(db, commentID); err != nil {
+	if err := store.Comments.DeleteComment(commentID, username); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete comment"})
 		return
 	}
 
+	publishCommentDeleted(store, existing.ThreadID, commentID)
+	reason := c.Query("reason")
+	audit(c, store, models.AuditCommentDelete, models.AuditTargetComment, commentID, reason, existing, nil)
+	if ownername != username {
+		message := "A moderator removed your comment"
+		if reason != "" {
+			message += ": " + reason
+		}
+		notifyModeration(store, ownername, username, &existing.ThreadID, nil, message)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "comment deleted successfully"})
 }
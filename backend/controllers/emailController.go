@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"backend/mail"
+	"backend/models"
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireVerifiedEmail blocks users who have not verified their email address
+// from posting, commenting and voting
+var RequireVerifiedEmail = false
+
+// appLink returns the link to a page of the frontend at APP_URL carrying token
+func appLink(page, token string) string {
+	base := os.Getenv("APP_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return fmt.Sprintf("%s/%s?token=%s", base, page, url.QueryEscape(token))
+}
+
+// issueUserToken stores a new single-use token for a user and returns it
+func issueUserToken(store *models.Store, userID int, purpose models.TokenPurpose, ttl time.Duration) (string, error) {
+	expiresAt := time.Now().Add(ttl)
+	token, err := utils.SignToken(string(purpose), expiresAt)
+	if err != nil {
+		return "", err
+	}
+	if err := store.Users.CreateUserToken(userID, purpose, utils.HashToken(token), expiresAt); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// sendVerificationEmail emails a user the link that verifies their address.
+// It runs in the background, so failures are only logged.
+func sendVerificationEmail(store *models.Store, userID int, username, email string) {
+	token, err := issueUserToken(store, userID, models.TokenVerifyEmail, models.VerifyEmailTTL)
+	if err != nil {
+		log.Printf("Error issuing verification token for %s: %v", username, err)
+		return
+	}
+	err = store.Mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link to verify your email address:\n\n%s\n\nThe link works for %s. If you did not sign up, you can ignore this email.\n",
+			username, appLink("verify-email", token), models.VerifyEmailTTL),
+	})
+	if err != nil {
+		log.Printf("Error: %v", err)
+	}
+}
+
+// sendPasswordReset emails the link that resets the password of the account
+// with an email address, if there is one. It runs in the background, so that
+// the response does not reveal whether the address is registered.
+func sendPasswordReset(store *models.Store, email string) {
+	userID, err := store.Users.GetUserIDByEmail(email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error: %v", err)
+		}
+		return
+	}
+	if userID == models.LeftUserID {
+		return
+	}
+	token, err := issueUserToken(store, userID, models.TokenResetPassword, models.ResetPasswordTTL)
+	if err != nil {
+		log.Printf("Error issuing password reset token for user %d: %v", userID, err)
+		return
+	}
+	err = store.Mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi,\n\nOpen this link to choose a new password:\n\n%s\n\nThe link works once within %s. If you did not ask for it, you can ignore this email.\n",
+			appLink("reset-password", token), models.ResetPasswordTTL),
+	})
+	if err != nil {
+		log.Printf("Error: %v", err)
+	}
+}
+
+// checkEmailVerified responds with 403 and reports false when verified email
+// addresses are required and the current user has not verified theirs
+func checkEmailVerified(c *gin.Context, store *models.Store) bool {
+	if !RequireVerifiedEmail {
+		return true
+	}
+	user, err := store.Users.GetUserByUsername(c.GetString("username"))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return false
+	}
+	if !user.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "verify your email address first"})
+		return false
+	}
+	return true
+}
+
+// VerifyEmail handles the token of an email verification link
+func VerifyEmail(c *gin.Context, store *models.Store) {
+	var verifyData struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&verifyData); err != nil || verifyData.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if !utils.VerifyToken(string(models.TokenVerifyEmail), verifyData.Token) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+		return
+	}
+
+	username, err := store.Users.ConsumeUserToken(models.TokenVerifyEmail, utils.HashToken(verifyData.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+		return
+	}
+	if err := store.Users.SetEmailVerified(username); err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email verified successfully"})
+}
+
+// ResendVerificationEmail handles requests from the current user for a new
+// verification link, which replaces the previous one
+func ResendVerificationEmail(c *gin.Context, store *models.Store) {
+	user, err := store.Users.GetUserByUsername(c.GetString("username"))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusConflict, gin.H{"error": "email already verified"})
+		return
+	}
+	go sendVerificationEmail(store, user.ID, user.Username, user.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "verification email sent"})
+}
+
+// ForgotPassword handles requests for a password reset link. It answers the
+// same whether or not the address is registered.
+func ForgotPassword(c *gin.Context, store *models.Store) {
+	var forgotData struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&forgotData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if err := utils.ValidateEmail(forgotData.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	go sendPasswordReset(store, forgotData.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the email is registered, a password reset link was sent to it"})
+}
+
+// ResetPassword handles the token of a password reset link along with the new
+// password. Every session and personal API token of the user is revoked, and
+// since the link reached them their address counts as verified.
+func ResetPassword(c *gin.Context, store *models.Store) {
+	var resetData struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&resetData); err != nil || resetData.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if err := utils.ValidatePassword(resetData.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !utils.VerifyToken(string(models.TokenResetPassword), resetData.Token) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+		return
+	}
+
+	// Hash first so that a failure does not use up the token
+	passwordHash, err := utils.HashPassword(resetData.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		return
+	}
+	username, err := store.Users.ConsumeUserToken(models.TokenResetPassword, utils.HashToken(resetData.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+	if err := store.Users.UpdateUserPassword(username, passwordHash); err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+	if err := store.Sessions.RevokeUserSessions(username); err != nil {
+		log.Printf("Error revoking sessions of %s: %v", username, err)
+	}
+	if err := store.APITokens.DeleteUserAPITokens(username); err != nil {
+		log.Printf("Error revoking API tokens of %s: %v", username, err)
+	}
+	if err := store.Users.SetEmailVerified(username); err != nil {
+		log.Printf("Error: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset successfully"})
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"backend/models"
+	"backend/realtime"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EventHeartbeat is how often idle event streams send a ping, so that proxies
+// do not close them
+var EventHeartbeat = 15 * time.Second
+
+// streamEvents sends a ready event and then every event of sub as Server-Sent
+// Events, until the client disconnects
+func streamEvents(c *gin.Context, sub *realtime.Subscription, ready any) {
+	defer sub.Close()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("ready", ready)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(EventHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event.Data)
+			return true
+		case <-heartbeat.C:
+			c.SSEvent("ping", gin.H{"time": time.Now().Unix()})
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// StreamThreadEvents streams the changes to a thread as Server-Sent Events:
+// comment_created, comment_updated, comment_deleted, comment_restored, comment_votes
+// and thread_votes
+func StreamThreadEvents(c *gin.Context, store *models.Store) {
+	// Parse thread ID from URL
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread ID"})
+		return
+	}
+
+	if _, ok := viewableThread(c, store, threadID); !ok {
+		return
+	}
+
+	// Subscribe before responding so that no event after the ready event is missed
+	sub := store.Events.Subscribe(realtime.ThreadTopic(threadID))
+	streamEvents(c, sub, gin.H{"thread_id": threadID})
+}
+
+// StreamNotifications streams the current user's new notifications and unread
+// count as Server-Sent Events
+func StreamNotifications(c *gin.Context, store *models.Store) {
+	// Get the username from JWT middleware
+	username := c.GetString("username")
+
+	sub := store.Events.Subscribe(realtime.UserTopic(username))
+	unread, err := store.Notifications.CountUnreadNotifications(username)
+	if err != nil {
+		sub.Close()
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count notifications"})
+		return
+	}
+
+	streamEvents(c, sub, gin.H{"unread_count": unread})
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"archive/zip"
+	"backend/models"
+	"backend/utils"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportTimeout is how long an export may stay pending before another one can
+// be requested, in case the instance generating it stopped
+const exportTimeout = 10 * time.Minute
+
+// buildExportArchive writes a user's data as a ZIP archive of JSON files
+func buildExportArchive(data *models.UserData) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", data.Profile},
+		{"threads.json", data.Threads},
+		{"comments.json", data.Comments},
+		{"votes.json", data.Votes},
+		{"comment_votes.json", data.CommentVotes},
+		{"saved_threads.json", data.SavedThreads},
+		{"tags.json", data.Tags},
+	} {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.content); err != nil {
+			return nil, fmt.Errorf("error encoding %s: %v", file.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// generateDataExport collects a user's data into the archive of a pending export
+func generateDataExport(store *models.Store, exportID int, username string) {
+	data, err := store.Exports.GetUserData(username)
+	var archive []byte
+	if err == nil {
+		archive, err = buildExportArchive(data)
+	}
+	if err != nil {
+		log.Printf("Error generating data export %d: %v", exportID, err)
+		if err := store.Exports.FailDataExport(exportID, "failed to collect your data"); err != nil {
+			log.Printf("Error: %v", err)
+		}
+		return
+	}
+
+	if err := store.Exports.CompleteDataExport(exportID, archive, time.Now().Add(models.ExportTTL)); err != nil {
+		log.Printf("Error storing data export %d: %v", exportID, err)
+	}
+}
+
+// exportDownloadPath is the path of the archive of an export
+func exportDownloadPath(exportID int) string {
+	return fmt.Sprintf("/exports/%d/download", exportID)
+}
+
+// exportDownloadURL returns the signed link to the archive of a ready export,
+// which stops working when the export expires
+func exportDownloadURL(export *models.DataExport) string {
+	path := exportDownloadPath(export.ID)
+	expires := export.ExpiresAt.Unix()
+	return fmt.Sprintf("%s?expires=%d&signature=%s", path, expires, utils.SignLink(path, expires))
+}
+
+// RequestDataExport handles requests for a copy of the current user's data.
+// The archive is generated in the background, GetDataExport reports when it
+// is ready.
+func RequestDataExport(c *gin.Context, store *models.Store) {
+	username := c.Param("username")
+	if c.GetString("username") != username {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		return
+	}
+
+	latest, err := store.Exports.GetLatestDataExport(username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch data exports"})
+		return
+	}
+	if err == nil && latest.Status == models.ExportPending && time.Since(latest.CreatedAt) < exportTimeout {
+		c.JSON(http.StatusConflict, gin.H{"error": "an export is already in progress", "export": latest})
+		return
+	}
+
+	export, err := store.Exports.CreateDataExport(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create data export"})
+		return
+	}
+	go generateDataExport(store, export.ID, username)
+
+	c.JSON(http.StatusAccepted, gin.H{"export": export})
+}
+
+// GetDataExport handles requests for the status of one of the current user's
+// exports, with its download link once it is ready and until it expires
+func GetDataExport(c *gin.Context, store *models.Store) {
+	username := c.Param("username")
+	if c.GetString("username") != username {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		return
+	}
+	exportID, err := strconv.Atoi(c.Param("export_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid export ID"})
+		return
+	}
+
+	export, err := store.Exports.GetDataExport(exportID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch data export"})
+		return
+	}
+	if err != nil || export.Username != username {
+		c.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+		return
+	}
+
+	response := gin.H{"export": export}
+	if export.Status == models.ExportReady && time.Now().Before(*export.ExpiresAt) {
+		response["download_url"] = exportDownloadURL(export)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DownloadDataExport handles the signed download links of data exports, which
+// need no login so that they can be opened in any client
+func DownloadDataExport(c *gin.Context, store *models.Store) {
+	exportID, err := strconv.Atoi(c.Param("export_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid export ID"})
+		return
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || !utils.VerifyLink(exportDownloadPath(exportID), expires, c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid download link"})
+		return
+	}
+	if time.Now().Unix() >= expires {
+		c.JSON(http.StatusGone, gin.H{"error": "the download link has expired"})
+		return
+	}
+
+	archive, err := store.Exports.GetDataExportArchive(exportID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusGone, gin.H{"error": "the download link has expired"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch data export"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%d.zip"`, exportID))
+	c.Data(http.StatusOK, "application/zip", archive)
+}
@@ -0,0 +1,370 @@
+package controllers
+
+import (
+	"backend/middlewares"
+	"backend/models"
+	"backend/realtime"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// GatewayHeartbeat is how often the gateway pings its clients and checks that
+// their session or API token is still valid. Clients that send nothing, not
+// even a pong, for two heartbeats are disconnected.
+var GatewayHeartbeat = 30 * time.Second
+
+// TypingTimeout clears a typing indicator that the client did not refresh
+var TypingTimeout = 6 * time.Second
+
+const (
+	gatewayMaxRooms     = 20               // threads a connection may follow at once
+	gatewayMaxMessage   = 4096             // largest message accepted from clients, in bytes
+	gatewaySendBuffer   = 64               // messages queued for a client before it counts as too slow
+	gatewayWriteTimeout = 10 * time.Second // time a client gets to accept a message
+)
+
+// gatewayMessage is a message sent over the gateway in either direction
+type gatewayMessage struct {
+	Type     string          `json:"type"`
+	ThreadID int             `json:"thread_id,omitempty"`
+	Username string          `json:"username,omitempty"`
+	Status   string          `json:"status,omitempty"` // "joined" or "left" in presence messages
+	Typing   *bool           `json:"typing,omitempty"`
+	Members  []string        `json:"members,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// gatewayRoom is a thread followed by a connection
+type gatewayRoom struct {
+	subscriptions []*realtime.Subscription
+	typing        *time.Timer // running while the user is typing
+}
+
+// gatewayConn is the state of one WebSocket connection
+type gatewayConn struct {
+	store     *models.Store
+	ws        *websocket.Conn
+	username  string
+	grants    models.Grants
+	session   string // session of a login JWT
+	token     string // hash of an API token
+	heartbeat time.Duration
+	send      chan gatewayMessage
+	done      chan struct{}
+	once      sync.Once
+
+	mu    sync.Mutex
+	rooms map[int]*gatewayRoom
+}
+
+// ServeGateway upgrades the request to a WebSocket carrying live thread updates,
+// presence and typing indicators. Clients send JSON messages of these types:
+//
+//	{"type": "subscribe", "thread_id": 1}                   follow a thread, answered with "subscribed" and its members
+//	{"type": "unsubscribe", "thread_id": 1}                 stop following a thread
+//	{"type": "typing", "thread_id": 1, "typing": true}      start or stop typing a reply, repeat to keep typing
+//	{"type": "ping"} / {"type": "pong"}                     heartbeats, answered with "pong" / nothing
+//
+// and receive "presence", "typing", the thread events also sent over Server-Sent
+// Events with the event under "data", "ping" heartbeats and "error" messages.
+// Clients that cannot keep up with their messages, or whose session or API
+// token is revoked, are disconnected.
+func ServeGateway(c *gin.Context, store *models.Store) {
+	server := websocket.Server{
+		Handshake: checkGatewayOrigin,
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = gatewayMaxMessage
+			conn := &gatewayConn{
+				store:     store,
+				ws:        ws,
+				username:  c.GetString("username"),
+				grants:    middlewares.GetGrants(c),
+				session:   c.GetString("session_id"),
+				token:     c.GetString("token_hash"),
+				heartbeat: GatewayHeartbeat,
+				send:      make(chan gatewayMessage, gatewaySendBuffer),
+				done:      make(chan struct{}),
+				rooms:     map[int]*gatewayRoom{},
+			}
+			go conn.writeLoop()
+			conn.readLoop()
+			conn.close()
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// checkGatewayOrigin only lets browsers connect from the allowed frontends,
+// other clients send no Origin
+func checkGatewayOrigin(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	if !slices.Contains(middlewares.AllowedOrigins, origin) {
+		return fmt.Errorf("origin %s not allowed", origin)
+	}
+	return nil
+}
+
+// readLoop handles the client's messages until it disconnects or stays silent too long
+func (conn *gatewayConn) readLoop() {
+	for {
+		conn.ws.SetReadDeadline(time.Now().Add(2 * conn.heartbeat))
+
+		var msg gatewayMessage
+		if err := websocket.JSON.Receive(conn.ws, &msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				conn.enqueue(gatewayMessage{Type: "error", Error: "invalid message"})
+				continue
+			}
+			return
+		}
+
+		switch msg.Type {
+		case "subscribe":
+			conn.join(msg.ThreadID)
+		case "unsubscribe":
+			conn.leave(msg.ThreadID)
+		case "typing":
+			conn.setTyping(msg.ThreadID, msg.Typing != nil && *msg.Typing, true)
+		case "ping":
+			conn.enqueue(gatewayMessage{Type: "pong"})
+		case "pong":
+		default:
+			conn.enqueue(gatewayMessage{Type: "error", Error: "unknown message type"})
+		}
+	}
+}
+
+// writeLoop sends queued messages and heartbeats until the connection closes
+func (conn *gatewayConn) writeLoop() {
+	heartbeat := time.NewTicker(conn.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var msg gatewayMessage
+		revoked := false
+		select {
+		case msg = <-conn.send:
+		case <-heartbeat.C:
+			msg = gatewayMessage{Type: "ping"}
+			if revoked = !conn.authorized(); revoked {
+				msg = gatewayMessage{Type: "error", Error: "session has been revoked"}
+			}
+		case <-conn.done:
+			return
+		}
+
+		conn.ws.SetWriteDeadline(time.Now().Add(gatewayWriteTimeout))
+		if err := websocket.JSON.Send(conn.ws, msg); err != nil || revoked {
+			conn.close()
+			return
+		}
+	}
+}
+
+// authorized reports whether the session or API token the client connected
+// with is still valid
+func (conn *gatewayConn) authorized() bool {
+	if conn.session != "" {
+		active, err := conn.store.Sessions.IsSessionActive(conn.session, conn.username)
+		if err != nil {
+			log.Printf("Error checking session: %v", err)
+			return false
+		}
+		return active
+	}
+
+	username, _, err := conn.store.APITokens.UseAPIToken(conn.token)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error checking API token: %v", err)
+		}
+		return false
+	}
+	return username == conn.username
+}
+
+// enqueue queues a message for the client, disconnecting clients whose queue is full
+func (conn *gatewayConn) enqueue(msg gatewayMessage) {
+	select {
+	case <-conn.done:
+		return
+	default:
+	}
+
+	select {
+	case conn.send <- msg:
+	default:
+		log.Printf("Disconnecting %s from the gateway: too slow to receive messages", conn.username)
+		conn.close()
+	}
+}
+
+// close ends the connection and leaves every room
+func (conn *gatewayConn) close() {
+	conn.once.Do(func() {
+		close(conn.done)
+		conn.ws.Close()
+
+		conn.mu.Lock()
+		threadIDs := make([]int, 0, len(conn.rooms))
+		for threadID := range conn.rooms {
+			threadIDs = append(threadIDs, threadID)
+		}
+		conn.mu.Unlock()
+
+		for _, threadID := range threadIDs {
+			conn.leave(threadID)
+		}
+	})
+}
+
+// join follows a thread, announcing the user unless they were already there
+func (conn *gatewayConn) join(threadID int) {
+	thread, err := conn.store.Threads.GetThreadByID(threadID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error: %v", err)
+	}
+	if err != nil || !threadVisible(conn.store, conn.username, conn.grants, thread) {
+		conn.enqueue(gatewayMessage{Type: "error", ThreadID: threadID, Error: "thread not found"})
+		return
+	}
+
+	room := realtime.PresenceTopic(threadID)
+	conn.mu.Lock()
+	select {
+	case <-conn.done:
+		// close already left every room and would miss this one
+		conn.mu.Unlock()
+		return
+	default:
+	}
+	if _, ok := conn.rooms[threadID]; ok {
+		conn.mu.Unlock()
+		conn.enqueue(gatewayMessage{Type: "subscribed", ThreadID: threadID, Members: conn.store.Presence.Members(room)})
+		return
+	}
+	if len(conn.rooms) >= gatewayMaxRooms {
+		conn.mu.Unlock()
+		conn.enqueue(gatewayMessage{Type: "error", ThreadID: threadID, Error: "too many subscriptions"})
+		return
+	}
+	threadEvents := conn.store.Events.Subscribe(realtime.ThreadTopic(threadID))
+	presenceEvents := conn.store.Events.Subscribe(room)
+	conn.rooms[threadID] = &gatewayRoom{subscriptions: []*realtime.Subscription{threadEvents, presenceEvents}}
+	conn.mu.Unlock()
+
+	go conn.forwardThreadEvents(threadID, threadEvents)
+	go conn.forwardPresenceEvents(presenceEvents)
+
+	// Shadowbanned users only see themselves in the room
+	if isShadowbanned(conn.store, conn.username) {
+		members := append(conn.store.Presence.Members(room), conn.username)
+		slices.Sort(members)
+		conn.enqueue(gatewayMessage{Type: "subscribed", ThreadID: threadID, Members: slices.Compact(members)})
+		return
+	}
+	if conn.store.Presence.Join(room, conn.username) {
+		conn.store.Events.Publish(room, "presence", gatewayMessage{
+			Type: "presence", ThreadID: threadID, Username: conn.username, Status: "joined",
+		})
+	}
+	conn.enqueue(gatewayMessage{Type: "subscribed", ThreadID: threadID, Members: conn.store.Presence.Members(room)})
+}
+
+// leave stops following a thread, announcing the user if it was their last connection there
+func (conn *gatewayConn) leave(threadID int) {
+	conn.setTyping(threadID, false, false)
+
+	conn.mu.Lock()
+	room, ok := conn.rooms[threadID]
+	delete(conn.rooms, threadID)
+	conn.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	for _, sub := range room.subscriptions {
+		sub.Close()
+	}
+	topic := realtime.PresenceTopic(threadID)
+	if conn.store.Presence.Leave(topic, conn.username) {
+		conn.store.Events.Publish(topic, "presence", gatewayMessage{
+			Type: "presence", ThreadID: threadID, Username: conn.username, Status: "left",
+		})
+	}
+}
+
+// setTyping starts, refreshes or stops the user's typing indicator in a thread.
+// Only changes are announced, and indicators that are not refreshed expire.
+func (conn *gatewayConn) setTyping(threadID int, typing bool, fromClient bool) {
+	conn.mu.Lock()
+	room, ok := conn.rooms[threadID]
+	if !ok {
+		conn.mu.Unlock()
+		if fromClient {
+			conn.enqueue(gatewayMessage{Type: "error", ThreadID: threadID, Error: "not subscribed to thread"})
+		}
+		return
+	}
+
+	changed := false
+	if typing {
+		if room.typing == nil {
+			changed = true
+			room.typing = time.AfterFunc(TypingTimeout, func() {
+				conn.setTyping(threadID, false, false)
+			})
+		} else {
+			room.typing.Reset(TypingTimeout)
+		}
+	} else if room.typing != nil {
+		changed = true
+		room.typing.Stop()
+		room.typing = nil
+	}
+	conn.mu.Unlock()
+
+	if changed && !isShadowbanned(conn.store, conn.username) {
+		conn.store.Events.Publish(realtime.PresenceTopic(threadID), "typing", gatewayMessage{
+			Type: "typing", ThreadID: threadID, Username: conn.username, Typing: &typing,
+		})
+	}
+}
+
+// forwardThreadEvents passes the events of a thread on to the client
+func (conn *gatewayConn) forwardThreadEvents(threadID int, sub *realtime.Subscription) {
+	for event := range sub.Events {
+		conn.enqueue(gatewayMessage{Type: event.Type, ThreadID: threadID, Data: event.Data})
+	}
+}
+
+// forwardPresenceEvents passes on the presence and typing of other users
+func (conn *gatewayConn) forwardPresenceEvents(sub *realtime.Subscription) {
+	for event := range sub.Events {
+		var msg gatewayMessage
+		if err := json.Unmarshal(event.Data, &msg); err != nil {
+			log.Printf("Error decoding %s event: %v", event.Type, err)
+			continue
+		}
+		if msg.Username == conn.username {
+			continue
+		}
+		conn.enqueue(msg)
+	}
+}
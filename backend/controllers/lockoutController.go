@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"backend/models"
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dummyPasswordHash is checked when a login names no account, so that the
+// response takes as long as for a wrong password
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := utils.HashPassword("not anyone's password")
+	if err != nil {
+		log.Printf("Error hashing the dummy password: %v", err)
+	}
+	return hash
+})
+
+// loginSubjects are what the failed logins of a request count against
+func loginSubjects(c *gin.Context, username string) map[models.LoginScope]string {
+	return map[models.LoginScope]string{
+		models.LoginScopeAccount: username,
+		models.LoginScopeIP:      c.ClientIP(),
+	}
+}
+
+// reserveLoginAttempt counts a login as failed against the attempted username
+// and the client IP before its password is checked, and responds with 429 and
+// reports false while logins are locked for either. The response is the same
+// whether or not the account exists.
+func reserveLoginAttempt(c *gin.Context, store *models.Store, username string) bool {
+	reserved := map[models.LoginScope]string{}
+	for scope, subject := range loginSubjects(c, username) {
+		lockedUntil, err := store.LoginFailures.ReserveLoginAttempt(scope, subject)
+		if err == nil && lockedUntil == nil {
+			reserved[scope] = subject
+			continue
+		}
+
+		// Take back what was counted, the attempt is not made
+		for scope, subject := range reserved {
+			if err := store.LoginFailures.RefundLoginAttempt(scope, subject); err != nil {
+				log.Printf("Error: %v", err)
+			}
+		}
+		if err != nil {
+			log.Printf("Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return false
+		}
+		retryAfter := int(math.Ceil(time.Until(*lockedUntil).Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "too many failed login attempts, try again later",
+			"retry_after": retryAfter,
+		})
+		return false
+	}
+	return true
+}
+
+// refundIPLoginAttempt takes back the attempt counted against the client IP,
+// failures are logged
+func refundIPLoginAttempt(c *gin.Context, store *models.Store) {
+	if err := store.LoginFailures.RefundLoginAttempt(models.LoginScopeIP, c.ClientIP()); err != nil {
+		log.Printf("Error: %v", err)
+	}
+}
+
+// clearLoginFailures forgets the failed logins of the attempted username and
+// takes back the attempt counted against the client IP once every factor was
+// right, failures are logged
+func clearLoginFailures(c *gin.Context, store *models.Store, username string) {
+	if err := store.LoginFailures.ClearLoginFailures(models.LoginScopeAccount, username); err != nil {
+		log.Printf("Error: %v", err)
+	}
+	refundIPLoginAttempt(c, store)
+}
+
+// UnlockUser handles requests from admins to lift the login lockout of an
+// account, with an optional ?reason= for the audit log
+func UnlockUser(c *gin.Context, store *models.Store) {
+	username := c.Param("username")
+
+	user, err := store.Users.GetUserByUsername(username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return
+	}
+	lockedUntil, err := store.LoginFailures.GetLoginLock(models.LoginScopeAccount, username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch lockout"})
+		return
+	}
+
+	if err := store.LoginFailures.ClearLoginFailures(models.LoginScopeAccount, username); err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock user"})
+		return
+	}
+
+	audit(c, store, models.AuditUserUnlock, models.AuditTargetUser, user.ID, strings.TrimSpace(c.Query("reason")),
+		gin.H{"locked_until": lockedUntil}, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "user unlocked successfully"})
+}
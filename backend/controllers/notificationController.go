@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"backend/models"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetNotifications lists the current user's notifications, newest first, with
+// their unread count. ?unread=true only lists unread notifications.
+func GetNotifications(c *gin.Context, store *models.Store) {
+	// Get the username from JWT middleware
+	username := c.GetString("username")
+
+	// Parse query parameters for pagination
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page number"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit number"})
+		return
+	}
+	unreadOnly := c.Query("unread") == "true"
+
+	notifications, err := store.Notifications.GetNotifications(username, unreadOnly, page, limit)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch notifications"})
+		return
+	}
+	unread, err := store.Notifications.CountUnreadNotifications(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"unread_count":  unread,
+	})
+}
+
+// GetUnreadNotificationCount returns how many notifications the current user has not read
+func GetUnreadNotificationCount(c *gin.Context, store *models.Store) {
+	// Get the username from JWT middleware
+	username := c.GetString("username")
+
+	unread, err := store.Notifications.CountUnreadNotifications(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unread_count": unread})
+}
+
+// MarkNotificationRead marks one of the current user's notifications as read
+func MarkNotificationRead(c *gin.Context, store *models.Store) {
+	// Get the username from JWT middleware
+	username := c.GetString("username")
+
+	// Parse notification ID from URL
+	notificationID, err := strconv.Atoi(c.Param("notification_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid notification ID"})
+		return
+	}
+
+	if err := store.Notifications.MarkNotificationRead(username, notificationID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to mark notification as read"})
+		return
+	}
+
+	publishUnreadCount(store, username)
+
+	c.JSON(http.StatusOK, gin.H{"message": "notification marked as read"})
+}
+
+// MarkAllNotificationsRead marks every notification of the current user as read
+func MarkAllNotificationsRead(c *gin.Context, store *models.Store) {
+	// Get the username from JWT middleware
+	username := c.GetString("username")
+
+	if err := store.Notifications.MarkAllNotificationsRead(username); err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to mark notifications as read"})
+		return
+	}
+
+	publishUnreadCount(store, username)
+
+	c.JSON(http.StatusOK, gin.H{"message": "all notifications marked as read"})
+}
+
+// GetNotificationPreferences returns which notification types the current user receives
+func GetNotificationPreferences(c *gin.Context, store *models.Store) {
+	// Get the username from JWT middleware
+	username := c.GetString("username")
+
+	preferences, err := store.Notifications.GetNotificationPreferences(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": preferences})
+}
+
+// UpdateNotificationPreferences turns notification types on or off for the
+// current user, the body maps types to whether they are enabled
+func UpdateNotificationPreferences(c *gin.Context, store *models.Store) {
+	// Get the username from JWT middleware
+	username := c.GetString("username")
+
+	var updates map[models.NotificationType]bool
+	if err := c.ShouldBindJSON(&updates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	for t := range updates {
+		if !t.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown notification type: " + string(t)})
+			return
+		}
+	}
+
+	for t, enabled := range updates {
+		if err := store.Notifications.SetNotificationPreference(username, t, enabled); err != nil {
+			log.Printf("Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update notification preferences"})
+			return
+		}
+	}
+
+	preferences, err := store.Notifications.GetNotificationPreferences(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "notification preferences updated successfully",
+		"preferences": preferences,
+	})
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"backend/models"
+	"backend/realtime"
+	"backend/utils"
+	"fmt"
+	"log"
+)
+
+// notify records a notification for n.Username unless they caused it themselves
+// or the actor is shadowbanned, pushes it to their open streams and reports whether it was stored. Failures
+// are logged rather than failing the request that triggered them.
+func notify(store *models.Store, n *models.Notification) bool {
+	if n.Username == "" || n.Username == n.Actor {
+		return false
+	}
+	// Nobody hears from shadowbanned users
+	if n.Actor != "" && isShadowbanned(store, n.Actor) {
+		return false
+	}
+	created, err := store.Notifications.CreateNotification(n)
+	if err != nil {
+		log.Printf("Error notifying %s: %v", n.Username, err)
+	}
+	if created {
+		store.Events.Publish(realtime.UserTopic(n.Username), "notification", n)
+		publishUnreadCount(store, n.Username)
+	}
+	return created
+}
+
+// notifyMentions notifies the users mentioned in text, except those in skip
+func notifyMentions(store *models.Store, actor, text string, threadID int, commentID *int, skip ...string) {
+	skipped := map[string]bool{}
+	for _, username := range skip {
+		skipped[username] = true
+	}
+
+	where := "a thread"
+	if commentID != nil {
+		where = "a comment"
+	}
+	for _, username := range utils.ExtractMentions(text) {
+		if skipped[username] {
+			continue
+		}
+		notify(store, &models.Notification{
+			Username:  username,
+			Type:      models.NotifyMention,
+			Actor:     actor,
+			ThreadID:  &threadID,
+			CommentID: commentID,
+			Message:   fmt.Sprintf("%s mentioned you in %s", actor, where),
+		})
+	}
+}
+
+// notifyNewComment tells the author of the parent comment, or of the thread for
+// top-level comments, about a new comment, and notifies mentioned users
+func notifyNewComment(store *models.Store, comment *models.Comment) {
+	commentID := comment.ID
+	n := &models.Notification{
+		Actor:     comment.Username,
+		ThreadID:  &comment.ThreadID,
+		CommentID: &commentID,
+	}
+
+	var err error
+	if comment.ParentID != nil {
+		n.Type = models.NotifyCommentReply
+		n.Message = fmt.Sprintf("%s replied to your comment", comment.Username)
+		n.Username, err = store.Comments.GetCommentOwnerUsername(*comment.ParentID)
+	} else {
+		n.Type = models.NotifyThreadReply
+		n.Message = fmt.Sprintf("%s commented on your thread", comment.Username)
+		n.Username, err = store.Threads.GetThreadOwnerUsername(comment.ThreadID)
+	}
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return
+	}
+	// Whoever was just notified of the reply does not need a second notification for a mention
+	var skip []string
+	if notify(store, n) {
+		skip = append(skip, n.Username)
+	}
+	notifyMentions(store, comment.Username, comment.Content, comment.ThreadID, &commentID, skip...)
+}
+
+// reachedMilestone returns the highest vote milestone at or below score, or 0 if none
+func reachedMilestone(score int) int {
+	reached := 0
+	for _, milestone := range models.VoteMilestones {
+		if score >= milestone && milestone > reached {
+			reached = milestone
+		}
+	}
+	return reached
+}
+
+// notifyThreadVoteMilestone tells a thread's author when its score reaches a
+// milestone, at most once per milestone
+func notifyThreadVoteMilestone(store *models.Store, threadID int) {
+	score, err := store.Votes.CountVote(threadID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return
+	}
+	milestone := reachedMilestone(score)
+	if milestone == 0 {
+		return
+	}
+	owner, err := store.Threads.GetThreadOwnerUsername(threadID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return
+	}
+
+	notify(store, &models.Notification{
+		Username:  owner,
+		Type:      models.NotifyVoteMilestone,
+		ThreadID:  &threadID,
+		Message:   fmt.Sprintf("Your thread reached %d points", milestone),
+		DedupeKey: fmt.Sprintf("vote_milestone:thread:%d:%d", threadID, milestone),
+	})
+}
+
+// notifyCommentVoteMilestone tells a comment's author when its score reaches a
+// milestone, at most once per milestone
+func notifyCommentVoteMilestone(store *models.Store, comment *models.Comment) {
+	score, err := store.Votes.CountCommentVote(comment.ID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return
+	}
+	milestone := reachedMilestone(score)
+	if milestone == 0 {
+		return
+	}
+
+	commentID := comment.ID
+	notify(store, &models.Notification{
+		Username:  comment.Username,
+		Type:      models.NotifyVoteMilestone,
+		ThreadID:  &comment.ThreadID,
+		CommentID: &commentID,
+		Message:   fmt.Sprintf("Your comment reached %d points", milestone),
+		DedupeKey: fmt.Sprintf("vote_milestone:comment:%d:%d", comment.ID, milestone),
+	})
+}
+
+// notifyModeration tells a user that a moderator acted on their content
+func notifyModeration(store *models.Store, owner, moderator string, threadID, commentID *int, message string) {
+	notify(store, &models.Notification{
+		Username:  owner,
+		Type:      models.NotifyModeration,
+		Actor:     moderator,
+		ThreadID:  threadID,
+		CommentID: commentID,
+		Message:   message,
+	})
+}
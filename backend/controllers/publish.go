@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"backend/models"
+	"backend/realtime"
+	"log"
+)
+
+// publishComment sends a created, edited or restored comment to the clients
+// following its thread, redacted while it is hidden. Shadowbanned users'
+// comments are not sent.
+func publishComment(store *models.Store, eventType string, comment *models.Comment) {
+	if isShadowbanned(store, comment.Username) {
+		return
+	}
+	if comment.Hidden {
+		redacted := *comment
+		redacted.RedactHidden()
+		comment = &redacted
+	}
+	store.Events.Publish(realtime.ThreadTopic(comment.ThreadID), eventType, comment)
+}
+
+// publishCommentDeleted tells the clients following a thread that a comment is gone
+func publishCommentDeleted(store *models.Store, threadID, commentID int) {
+	store.Events.Publish(realtime.ThreadTopic(threadID), "comment_deleted", map[string]int{
+		"id":        commentID,
+		"thread_id": threadID,
+	})
+}
+
+// publishThreadVotes sends the vote counters of a thread after they changed
+func publishThreadVotes(store *models.Store, threadID int) {
+	thread, err := store.Threads.GetThreadByID(threadID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return
+	}
+	store.Events.Publish(realtime.ThreadTopic(threadID), "thread_votes", map[string]int{
+		"thread_id": threadID,
+		"votes":     thread.Votes,
+		"upvotes":   thread.Upvotes,
+		"downvotes": thread.Downvotes,
+	})
+}
+
+// publishCommentVotes sends the score of a comment after it changed
+func publishCommentVotes(store *models.Store, comment *models.Comment) {
+	score, err := store.Votes.CountCommentVote(comment.ID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return
+	}
+	store.Events.Publish(realtime.ThreadTopic(comment.ThreadID), "comment_votes", map[string]int{
+		"comment_id": comment.ID,
+		"thread_id":  comment.ThreadID,
+		"score":      score,
+	})
+}
+
+// publishUnreadCount sends a user's unread notification count to their open streams
+func publishUnreadCount(store *models.Store, username string) {
+	unread, err := store.Notifications.CountUnreadNotifications(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return
+	}
+	store.Events.Publish(realtime.UserTopic(username), "unread_count", map[string]int{"unread_count": unread})
+}
@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	"backend/middlewares"
+	"backend/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxReportDetails is the longest explanation a report may carry
+const maxReportDetails = 1000
+
+// canSeeHidden reports whether the current user may see hidden content, which
+// is left to its author and the moderators who review reports in its category
+func canSeeHidden(c *gin.Context, author, category string) bool {
+	if username := c.GetString("username"); username != "" && username == author {
+		return true
+	}
+	return middlewares.GetGrants(c).Can(models.PermReviewReports, category)
+}
+
+// redactHiddenComments hides the hidden comments of a thread from readers who may not see them
+func redactHiddenComments(c *gin.Context, store *models.Store, threadID int, comments []models.Comment) error {
+	category := ""
+	for i := range comments {
+		if !comments[i].Hidden {
+			continue
+		}
+		if category == "" {
+			var err error
+			if category, err = store.Threads.GetThreadCategory(threadID); err != nil {
+				return err
+			}
+		}
+		if !canSeeHidden(c, comments[i].Username, category) {
+			comments[i].RedactHidden()
+		}
+	}
+	return nil
+}
+
+// bindReport reads and validates the reason and details of a report
+func bindReport(c *gin.Context) (*models.Report, bool) {
+	var report models.Report
+	if err := c.ShouldBindJSON(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return nil, false
+	}
+	report.Details = strings.TrimSpace(report.Details)
+	if !report.Reason.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reason"})
+		return nil, false
+	}
+	if report.Reason == models.ReportOther && report.Details == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "details are required for reason other"})
+		return nil, false
+	}
+	if utf8.RuneCountInString(report.Details) > maxReportDetails {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("details must be at most %d characters", maxReportDetails)})
+		return nil, false
+	}
+	return &report, true
+}
+
+// fileReport stores a report and tells the author when it hid their content
+func fileReport(c *gin.Context, store *models.Store, report *models.Report, author string) {
+	if author == report.Reporter {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot report your own content"})
+		return
+	}
+
+	hidden, err := store.Reports.CreateReport(report)
+	if err != nil {
+		if errors.Is(err, models.ErrAlreadyReported) {
+			c.JSON(http.StatusConflict, gin.H{"error": "you already reported this"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to submit report"})
+		return
+	}
+
+	if hidden {
+		what := "thread"
+		if report.CommentID != nil {
+			what = "comment"
+		}
+		notifyModeration(store, author, "", &report.ThreadID, report.CommentID,
+			fmt.Sprintf("Your %s was hidden after several reports and is waiting for a moderator", what))
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "report submitted successfully",
+		"report":  report,
+	})
+}
+
+// ReportThread handles requests to report a thread to the moderators
+func ReportThread(c *gin.Context, store *models.Store) {
+	// Parse thread ID from URL
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread ID"})
+		return
+	}
+
+	owner, err := store.Threads.GetThreadOwnerUsername(threadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread"})
+		return
+	}
+
+	report, ok := bindReport(c)
+	if !ok {
+		return
+	}
+	report.ThreadID = threadID
+	report.CommentID = nil
+	report.Reporter = c.GetString("username")
+
+	fileReport(c, store, report, owner)
+}
+
+// ReportComment handles requests to report a comment to the moderators
+func ReportComment(c *gin.Context, store *models.Store) {
+	comment, ok := threadComment(c, store)
+	if !ok {
+		return
+	}
+	if comment.Deleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot report a deleted comment"})
+		return
+	}
+
+	report, ok := bindReport(c)
+	if !ok {
+		return
+	}
+	commentID := comment.ID
+	report.ThreadID = comment.ThreadID
+	report.CommentID = &commentID
+	report.Reporter = c.GetString("username")
+
+	fileReport(c, store, report, comment.Username)
+}
+
+// reviewableCategories returns the categories whose reports the current user
+// reviews, nil meaning all of them, or false if they review none
+func reviewableCategories(c *gin.Context) ([]string, bool) {
+	grants := middlewares.GetGrants(c)
+	if grants.Role.HasPermission(models.PermReviewReports) {
+		return nil, true
+	}
+	if len(grants.ModeratedCategories) == 0 {
+		return nil, false
+	}
+	return grants.ModeratedCategories, true
+}
+
+// GetReportCases lists the moderation queue: open report cases oldest first, or
+// with ?status=resolved the most recently resolved. ?claimed_by= only lists the
+// cases claimed by a moderator. Category moderators only see their categories.
+func GetReportCases(c *gin.Context, store *models.Store) {
+	categories, ok := reviewableCategories(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		return
+	}
+
+	// Parse query parameters for pagination
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page number"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit number"})
+		return
+	}
+	status := c.DefaultQuery("status", models.ReportStatusOpen)
+	if status != models.ReportStatusOpen && status != models.ReportStatusResolved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+		return
+	}
+
+	filter := models.ReportFilter{Status: status, Categories: categories, ClaimedBy: c.Query("claimed_by")}
+	cases, err := store.Reports.GetReportCases(filter, page, limit)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch reports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reports": cases})
+}
+
+// reviewableCase loads the report case in the URL, responding with an error
+// unless the current user reviews reports in its category
+func reviewableCase(c *gin.Context, store *models.Store) (*models.ReportCase, bool) {
+	caseID, err := strconv.Atoi(c.Param("case_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid report ID"})
+		return nil, false
+	}
+
+	rc, err := store.Reports.GetReportCase(caseID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "report not found"})
+			return nil, false
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch report"})
+		return nil, false
+	}
+	if !middlewares.GetGrants(c).Can(models.PermReviewReports, rc.Category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		return nil, false
+	}
+
+	return rc, true
+}
+
+// respondCaseError answers a failed change to a report case
+func respondCaseError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "report not found"})
+	case errors.Is(err, models.ErrReportCaseClaimed):
+		c.JSON(http.StatusConflict, gin.H{"error": "report is claimed by another moderator"})
+	case errors.Is(err, models.ErrReportCaseResolved):
+		c.JSON(http.StatusConflict, gin.H{"error": "report is already resolved"})
+	default:
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to " + action + " report"})
+	}
+}
+
+// GetReportCase returns a report case with each report filed in it
+func GetReportCase(c *gin.Context, store *models.Store) {
+	rc, ok := reviewableCase(c, store)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": rc})
+}
+
+// ClaimReportCase assigns a report case to the current moderator so that others leave it to them
+func ClaimReportCase(c *gin.Context, store *models.Store) {
+	rc, ok := reviewableCase(c, store)
+	if !ok {
+		return
+	}
+
+	if err := store.Reports.ClaimReportCase(rc.ID, c.GetString("username")); err != nil {
+		respondCaseError(c, err, "claim")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "report claimed successfully"})
+}
+
+// ReleaseReportCase gives up the current moderator's claim on a report case
+func ReleaseReportCase(c *gin.Context, store *models.Store) {
+	rc, ok := reviewableCase(c, store)
+	if !ok {
+		return
+	}
+
+	if err := store.Reports.ReleaseReportCase(rc.ID, c.GetString("username")); err != nil {
+		respondCaseError(c, err, "release")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "report released successfully"})
+}
+
+// reportedContent returns the thread or comment of a report case, or neither
+// if it is already gone
+func reportedContent(store *models.Store, rc *models.ReportCase) (*models.Thread, *models.Comment, error) {
+	if rc.CommentID != nil {
+		comment, err := store.Comments.GetCommentByID(*rc.CommentID)
+		if errors.Is(err, sql.ErrNoRows) || err == nil && comment.Deleted {
+			return nil, nil, nil
+		}
+		return nil, comment, err
+	}
+	if rc.TargetType == models.ReportTargetThread && rc.ThreadID != nil {
+		thread, err := store.Threads.GetThreadByID(*rc.ThreadID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, nil
+		}
+		return thread, nil, err
+	}
+	return nil, nil, nil
+}
+
+// ResolveReportCase closes a report case with one of three actions: dismiss shows
+// the content again, warn shows it again and warns its author, and remove deletes it
+func ResolveReportCase(c *gin.Context, store *models.Store) {
+	username := c.GetString("username")
+
+	rc, ok := reviewableCase(c, store)
+	if !ok {
+		return
+	}
+
+	var resolveData struct {
+		Action models.ReportResolution `json:"action"`
+		Note   string                  `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&resolveData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if !resolveData.Action.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid action"})
+		return
+	}
+	note := strings.TrimSpace(resolveData.Note)
+
+	// The store moves the content to the trash along with closing the case,
+	// fetch it beforehand for the audit log
+	var thread *models.Thread
+	var comment *models.Comment
+	if resolveData.Action == models.ResolveRemove {
+		var err error
+		thread, comment, err = reportedContent(store, rc)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch reported content"})
+			return
+		}
+	}
+	if err := store.Reports.ResolveReportCase(rc.ID, username, resolveData.Action, note); err != nil {
+		respondCaseError(c, err, "resolve")
+		return
+	}
+	if comment != nil {
+		publishCommentDeleted(store, comment.ThreadID, comment.ID)
+		audit(c, store, models.AuditCommentDelete, models.AuditTargetComment, comment.ID, note, comment, nil)
+	}
+	if thread != nil {
+		audit(c, store, models.AuditThreadDelete, models.AuditTargetThread, thread.ID, note, thread, nil)
+	}
+
+	if resolved, err := store.Reports.GetReportCase(rc.ID); err == nil {
+		audit(c, store, models.AuditReportResolve, models.AuditTargetReport, rc.ID, note, rc, resolved)
+	} else {
+		log.Printf("Error: %v", err)
+	}
+
+	what := rc.TargetType
+	switch resolveData.Action {
+	case models.ResolveRemove:
+		message := fmt.Sprintf("A moderator removed your %s after it was reported", what)
+		if note != "" {
+			message += ": " + note
+		}
+		// The thread is gone when it was the removed content
+		threadID := rc.ThreadID
+		if rc.TargetType == models.ReportTargetThread {
+			threadID = nil
+		}
+		notifyModeration(store, rc.Author, username, threadID, nil, message)
+	case models.ResolveWarn:
+		message := fmt.Sprintf("A moderator warned you about your %s", what)
+		if note != "" {
+			message += ": " + note
+		}
+		notifyModeration(store, rc.Author, username, rc.ThreadID, rc.CommentID, message)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "report resolved successfully"})
+}
@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"backend/middlewares"
+	"backend/models"
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// revisionName names a revision in the header of a diff
+func revisionName(revision int) string {
+	return fmt.Sprintf("revision %d", revision)
+}
+
+// revisionDiff returns the unified diff between two revisions, and whether
+// they were too large to diff
+func revisionDiff(from, to int, a, b string) (string, bool) {
+	diff, err := utils.UnifiedDiff(revisionName(from), revisionName(to), a, b)
+	return diff, errors.Is(err, utils.ErrDiffTooLarge)
+}
+
+// parseRevisionRange reads the ?from= and ?to= revisions to compare out of
+// count, returning 0 for both when neither is given
+func parseRevisionRange(c *gin.Context, count int) (int, int, bool) {
+	if c.Query("from") == "" && c.Query("to") == "" {
+		return 0, 0, true
+	}
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from revision"})
+		return 0, 0, false
+	}
+	to, err := strconv.Atoi(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to revision"})
+		return 0, 0, false
+	}
+	if from < 1 || from > count || to < 1 || to > count {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+// GetThreadRevisions handles requests to fetch the edit history of a thread,
+// oldest first, each revision with its unified diff from the previous one.
+// ?from= and ?to= return the diff between two revisions instead.
+func GetThreadRevisions(c *gin.Context, store *models.Store) {
+	// Parse thread ID from URL
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread ID"})
+		return
+	}
+	if _, ok := viewableThread(c, store, threadID); !ok {
+		return
+	}
+
+	revisions, err := store.Revisions.GetThreadRevisions(threadID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch revisions"})
+		return
+	}
+
+	from, to, ok := parseRevisionRange(c, len(revisions))
+	if !ok {
+		return
+	}
+	if from != 0 {
+		diff, tooLarge := revisionDiff(from, to, revisions[from-1].Text(), revisions[to-1].Text())
+		c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "diff": diff, "diff_too_large": tooLarge})
+		return
+	}
+
+	for i := 1; i < len(revisions); i++ {
+		prev, cur := revisions[i-1], revisions[i]
+		revisions[i].Diff, revisions[i].DiffTooLarge = revisionDiff(prev.Revision, cur.Revision, prev.Text(), cur.Text())
+	}
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// GetCommentRevisions handles requests to fetch the edit history of a comment,
+// like GetThreadRevisions. The history of a deleted comment is only shown to
+// moderators who may restore it.
+func GetCommentRevisions(c *gin.Context, store *models.Store) {
+	// Parse thread and comment ID from URL
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread ID"})
+		return
+	}
+	commentID, err := strconv.Atoi(c.Param("comment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid comment ID"})
+		return
+	}
+	thread, ok := viewableThread(c, store, threadID)
+	if !ok {
+		return
+	}
+
+	comment, err := store.Comments.GetCommentByID(commentID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comment"})
+		return
+	}
+	if err != nil || comment.ThreadID != threadID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return
+	}
+	if comment.Deleted && !middlewares.GetGrants(c).Can(models.PermDeleteAnyComment, thread.Category) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return
+	}
+	owner, err := store.Comments.GetCommentOwnerUsername(commentID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch owner username"})
+		return
+	}
+	if comment.Hidden && !canSeeHidden(c, owner, thread.Category) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return
+	}
+	if owner != c.GetString("username") && isShadowbanned(store, owner) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return
+	}
+
+	revisions, err := store.Revisions.GetCommentRevisions(commentID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch revisions"})
+		return
+	}
+
+	from, to, ok := parseRevisionRange(c, len(revisions))
+	if !ok {
+		return
+	}
+	if from != 0 {
+		diff, tooLarge := revisionDiff(from, to, revisions[from-1].Content, revisions[to-1].Content)
+		c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "diff": diff, "diff_too_large": tooLarge})
+		return
+	}
+
+	for i := 1; i < len(revisions); i++ {
+		prev, cur := revisions[i-1], revisions[i]
+		revisions[i].Diff, revisions[i].DiffTooLarge = revisionDiff(prev.Revision, cur.Revision, prev.Content, cur.Content)
+	}
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// RevertThreadRevision handles requests from moderators to restore a thread to
+// one of its revisions, which is kept as a new revision. Reverts are audited
+// with an optional ?reason=.
+func RevertThreadRevision(c *gin.Context, store *models.Store) {
+	// Parse thread ID and revision from URL
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread ID"})
+		return
+	}
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision"})
+		return
+	}
+
+	username := c.GetString("username")
+
+	before, err := store.Threads.GetThreadByID(threadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread"})
+		return
+	}
+	if !middlewares.GetGrants(c).Can(models.PermEditAnyThread, before.Category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		return
+	}
+	if !checkSanctions(c, store, before.Category) {
+		return
+	}
+
+	if err := store.Revisions.RevertThread(threadID, revision, username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revert thread"})
+		return
+	}
+
+	after, err := store.Threads.GetThreadByID(threadID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+	}
+	audit(c, store, models.AuditThreadRevert, models.AuditTargetThread, threadID, c.Query("reason"), before, after)
+	if before.Username != username {
+		notifyModeration(store, before.Username, username, &threadID, nil, fmt.Sprintf("A moderator reverted your thread to revision %d", revision))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "thread reverted successfully", "thread": after})
+}
+
+// RevertCommentRevision handles requests from moderators to restore a comment
+// to one of its revisions, on the same terms as RevertThreadRevision
+func RevertCommentRevision(c *gin.Context, store *models.Store) {
+	// Parse thread ID, comment ID and revision from URL
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread ID"})
+		return
+	}
+	commentID, err := strconv.Atoi(c.Param("comment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid comment ID"})
+		return
+	}
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision"})
+		return
+	}
+
+	username := c.GetString("username")
+
+	before, err := store.Comments.GetCommentByID(commentID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comment"})
+		return
+	}
+	if err != nil || before.ThreadID != threadID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return
+	}
+	category, err := store.Threads.GetThreadCategory(threadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread category"})
+		return
+	}
+	if !middlewares.GetGrants(c).Can(models.PermEditAnyComment, category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		return
+	}
+	if before.Deleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot revert a deleted comment"})
+		return
+	}
+	if !checkSanctions(c, store, category) {
+		return
+	}
+	owner, err := store.Comments.GetCommentOwnerUsername(commentID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch owner username"})
+		return
+	}
+
+	if err := store.Revisions.RevertComment(commentID, revision, username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revert comment"})
+		return
+	}
+
+	after, err := store.Comments.GetCommentByID(commentID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+	} else {
+		publishComment(store, "comment_updated", after)
+	}
+	audit(c, store, models.AuditCommentRevert, models.AuditTargetComment, commentID, c.Query("reason"), before, after)
+	if owner != username {
+		notifyModeration(store, owner, username, &threadID, &commentID, fmt.Sprintf("A moderator reverted your comment to revision %d", revision))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "comment reverted successfully", "comment": after})
+}
@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"backend/middlewares"
+	"backend/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSanctionReason is the longest reason a sanction may carry
+const maxSanctionReason = 500
+
+// describeSanction words a sanction for the sanctioned user, such as
+// "suspended from music until 2026-01-02 15:04 UTC"
+func describeSanction(s *models.Sanction) string {
+	verb := "banned"
+	switch s.Type {
+	case models.SanctionSuspension:
+		verb = "suspended"
+	case models.SanctionShadowban:
+		verb = "shadowbanned"
+	}
+	if s.Category != "" {
+		verb += " from " + s.Category
+	}
+	if s.ExpiresAt != nil {
+		verb += " until " + s.ExpiresAt.UTC().Format("2006-01-02 15:04 MST")
+	}
+	return verb
+}
+
+// checkSanctions responds with 403 and reports false when the current user is
+// suspended or banned site-wide or in category, or still has to verify their
+// email address
+func checkSanctions(c *gin.Context, store *models.Store, category string) bool {
+	if !checkEmailVerified(c, store) {
+		return false
+	}
+	sanctions, err := store.Sanctions.GetSanctions(c.GetString("username"), true)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check sanctions"})
+		return false
+	}
+	if s := models.RestrictingSanction(sanctions, category); s != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":    fmt.Sprintf("you are %s: %s", describeSanction(s), s.Reason),
+			"sanction": s,
+		})
+		return false
+	}
+	return true
+}
+
+// checkThreadSanctions is checkSanctions for the category of a thread,
+// responding with 404 if the thread does not exist or was deleted
+func checkThreadSanctions(c *gin.Context, store *models.Store, threadID int) bool {
+	category, err := store.Threads.GetThreadCategory(threadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
+			return false
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread category"})
+		return false
+	}
+	return checkSanctions(c, store, category)
+}
+
+// isShadowbanned reports whether a user is shadowbanned, failures are logged
+// and treated as not shadowbanned
+func isShadowbanned(store *models.Store, username string) bool {
+	sanctions, err := store.Sanctions.GetSanctions(username, true)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return false
+	}
+	return models.Shadowbanned(sanctions)
+}
+
+// IssueSanction handles requests to suspend, ban or shadowban a user. Category
+// moderators may only suspend and ban in their categories, shadowbans are
+// site-wide. Moderators cannot be sanctioned where they moderate.
+func IssueSanction(c *gin.Context, store *models.Store) {
+	moderator := c.GetString("username")
+	username := c.Param("username")
+
+	var sanctionData struct {
+		Type      models.SanctionType `json:"type"`
+		Category  string              `json:"category"`
+		Reason    string              `json:"reason"`
+		ExpiresAt *time.Time          `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&sanctionData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	reason := strings.TrimSpace(sanctionData.Reason)
+	switch {
+	case !sanctionData.Type.Valid():
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sanction type"})
+		return
+	case reason == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a reason is required"})
+		return
+	case utf8.RuneCountInString(reason) > maxSanctionReason:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("reason must be at most %d characters", maxSanctionReason)})
+		return
+	case sanctionData.Type == models.SanctionSuspension && sanctionData.ExpiresAt == nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "suspensions require expires_at"})
+		return
+	case sanctionData.Type == models.SanctionBan && sanctionData.ExpiresAt != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bans are permanent, use a suspension instead"})
+		return
+	case sanctionData.Type == models.SanctionShadowban && sanctionData.Category != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "shadowbans are site-wide"})
+		return
+	case sanctionData.ExpiresAt != nil && !sanctionData.ExpiresAt.After(time.Now()):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	if !middlewares.GetGrants(c).Can(models.PermSanctionUsers, sanctionData.Category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		return
+	}
+	if sanctionData.Category != "" {
+		if _, err := store.Threads.GetCategoryIDByName(sanctionData.Category); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+			return
+		}
+	}
+	if username == moderator {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot sanction yourself"})
+		return
+	}
+	userID, err := store.Users.GetUserIDByUsername(username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return
+	}
+	grants, err := store.Users.GetUserGrants(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return
+	}
+	if grants.Can(models.PermSanctionUsers, sanctionData.Category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "cannot sanction a moderator"})
+		return
+	}
+
+	sanction, err := store.Sanctions.CreateSanction(&models.Sanction{
+		Username:  username,
+		Type:      sanctionData.Type,
+		Category:  sanctionData.Category,
+		Reason:    reason,
+		IssuedBy:  moderator,
+		ExpiresAt: sanctionData.ExpiresAt,
+	})
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create sanction"})
+		return
+	}
+
+	audit(c, store, models.AuditSanctionCreate, models.AuditTargetUser, userID, reason, nil, sanction)
+
+	// Shadowbanned users are not told, or they would simply start a new account
+	if sanction.Type != models.SanctionShadowban {
+		notifyModeration(store, username, moderator, nil, nil,
+			fmt.Sprintf("A moderator %s you: %s", describeSanction(sanction), reason))
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "sanction created successfully",
+		"sanction": sanction,
+	})
+}
+
+// GetUserSanctions lists the sanctions of a user, newest first, to moderators
+// and to the user themselves. Users do not see their shadowbans.
+// ?active=true only lists the sanctions in force.
+func GetUserSanctions(c *gin.Context, store *models.Store) {
+	username := c.Param("username")
+	self := username == c.GetString("username")
+
+	grants := middlewares.GetGrants(c)
+	moderator := grants.Role.HasPermission(models.PermSanctionUsers) || len(grants.ModeratedCategories) > 0
+	if !self && !moderator {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		return
+	}
+
+	sanctions, err := store.Sanctions.GetSanctions(username, c.Query("active") == "true")
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch sanctions"})
+		return
+	}
+	if !moderator {
+		visible := []models.Sanction{}
+		for _, s := range sanctions {
+			if s.Type != models.SanctionShadowban {
+				visible = append(visible, s)
+			}
+		}
+		sanctions = visible
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sanctions": sanctions})
+}
+
+// RevokeSanction handles requests to lift a sanction before it expires, with
+// an optional ?reason= for the audit log
+func RevokeSanction(c *gin.Context, store *models.Store) {
+	moderator := c.GetString("username")
+
+	sanctionID, err := strconv.Atoi(c.Param("sanction_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sanction ID"})
+		return
+	}
+
+	sanction, err := store.Sanctions.GetSanction(sanctionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "sanction not found"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch sanction"})
+		return
+	}
+	if !middlewares.GetGrants(c).Can(models.PermSanctionUsers, sanction.Category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		return
+	}
+
+	if err := store.Sanctions.RevokeSanction(sanctionID, moderator); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "sanction not found"})
+		case errors.Is(err, models.ErrSanctionInactive):
+			c.JSON(http.StatusConflict, gin.H{"error": "sanction already expired or revoked"})
+		default:
+			log.Printf("Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sanction"})
+		}
+		return
+	}
+
+	revoked, err := store.Sanctions.GetSanction(sanctionID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+	}
+	if userID, err := store.Users.GetUserIDByUsername(sanction.Username); err == nil {
+		audit(c, store, models.AuditSanctionRevoke, models.AuditTargetUser, userID, c.Query("reason"), sanction, revoked)
+	} else {
+		log.Printf("Error: %v", err)
+	}
+
+	if sanction.Type != models.SanctionShadowban {
+		notifyModeration(store, sanction.Username, moderator, nil, nil,
+			fmt.Sprintf("A moderator lifted your %s", sanction.Type))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "sanction revoked successfully"})
+}
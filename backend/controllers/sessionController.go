@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"backend/middlewares"
+	"backend/models"
+	"backend/utils"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createSession starts a login session for username and returns an access and refresh token pair
+func createSession(c *gin.Context, store *models.Store, username string) (string, string, error) {
+	sessionID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Keep the user agent within the column size
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	session := models.Session{
+		ID:        sessionID,
+		Username:  username,
+		UserAgent: userAgent,
+		IPAddress: c.ClientIP(),
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL),
+	}
+	if _, err := store.Sessions.CreateSession(&session, utils.HashToken(refreshToken)); err != nil {
+		return "", "", err
+	}
+
+	token, err := generateAccessToken(store, username, sessionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, refreshToken, nil
+}
+
+// completeLogin starts a session for a user who passed every login step and
+// responds with its tokens
+func completeLogin(c *gin.Context, store *models.Store, username string) bool {
+	token, refreshToken, err := createSession(c, store, username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate JWT token"})
+		return false
+	}
+
+	response := gin.H{
+		"message":       "login successful",
+		"token":         token,
+		"refresh_token": refreshToken,
+	}
+	if grants, err := store.Users.GetUserGrants(username); err != nil {
+		log.Printf("Error: %v", err)
+	} else if missing, err := middlewares.TwoFactorMissing(store, username, grants); err != nil {
+		log.Printf("Error: %v", err)
+	} else if missing {
+		response["two_factor_setup_required"] = true
+	}
+	c.JSON(http.StatusOK, response)
+	return true
+}
+
+// generateAccessToken signs a JWT carrying the user's current role and moderated
+// categories, which privileged users only get with 2FA when it is required
+func generateAccessToken(store *models.Store, username string, sessionID string) (string, error) {
+	grants, err := store.Users.GetUserGrants(username)
+	if err != nil {
+		return "", err
+	}
+	missing, err := middlewares.TwoFactorMissing(store, username, grants)
+	if err != nil {
+		return "", err
+	}
+	if missing {
+		grants = &models.Grants{Role: models.RoleUser, ModeratedCategories: []string{}}
+	}
+	return store.JWT.Issue(username, sessionID, string(grants.Role), grants.ModeratedCategories)
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a rotated refresh token
+func RefreshToken(c *gin.Context, store *models.Store) {
+	var refreshData struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&refreshData); err != nil || refreshData.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh token is required"})
+		return
+	}
+
+	newRefreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate refresh token"})
+		return
+	}
+
+	session, err := store.Sessions.RotateRefreshToken(utils.HashToken(refreshData.RefreshToken), utils.HashToken(newRefreshToken))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRefreshTokenReused):
+			log.Printf("Refresh token reuse detected, session revoked")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected, please log in again"})
+		case errors.Is(err, models.ErrRefreshTokenNotFound),
+			errors.Is(err, models.ErrSessionRevoked),
+			errors.Is(err, models.ErrSessionExpired):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired refresh token"})
+		default:
+			log.Printf("Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
+		}
+		return
+	}
+
+	token, err := generateAccessToken(store, session.Username, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate JWT token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "token refreshed successfully",
+		"token":         token,
+		"refresh_token": newRefreshToken,
+	})
+}
+
+// Logout revokes the session of the current access token
+func Logout(c *gin.Context, store *models.Store) {
+	sessionID := c.GetString("session_id")
+
+	if err := store.Sessions.RevokeSession(sessionID); err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
+}
+
+// LogoutAll revokes every session and personal API token of the current user
+func LogoutAll(c *gin.Context, store *models.Store) {
+	username := c.GetString("username")
+
+	if err := store.Sessions.RevokeUserSessions(username); err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log out of all sessions"})
+		return
+	}
+	if err := store.APITokens.DeleteUserAPITokens(username); err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke API tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out of all sessions successfully"})
+}
+
+// GetJWKS publishes the public keys that verify access tokens, so that other
+// services can authenticate forum users
+func GetJWKS(c *gin.Context, store *models.Store) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": store.JWT.JWKS()})
+}
@@ -1,18 +1,34 @@
 package controllers
 
 import (
+	"backend/middlewares"
 	"backend/models"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 )
 
+// maxThreadContent is how many characters the content of a thread may have,
+// which also bounds the size of its revisions
+const maxThreadContent = 20000
+
+// checkThreadContent responds with 400 and reports false when content is too long
+func checkThreadContent(c *gin.Context, content string) bool {
+	if utf8.RuneCountInString(content) > maxThreadContent {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("content must be at most %d characters", maxThreadContent)})
+		return false
+	}
+	return true
+}
+
 // PostThread handles the HTTP request to post a thread
-func PostThread(c *gin.Context, db *sql.DB) {
+func PostThread(c *gin.Context, store *models.Store) {
 	// Get the username from JWT middleware
 	username := c.GetString("username")
 
@@ -22,12 +38,20 @@ func PostThread(c *gin.Context, db *sql.DB) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
 		return
 	}
+	if !checkThreadContent(c, newThread.Content) {
+		return
+	}
+
+	// Suspended and banned users cannot post
+	if !checkSanctions(c, store, newThread.Category) {
+		return
+	}
 
 	// Set Username
 	newThread.Username = username
 
 	// Add thread to table
-	createdThread, err := models.CreateThread(db, &newThread)
+	createdThread, err := store.Threads.CreateThread(&newThread)
 	if err != nil {
 		log.Printf("Error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create thread"})
@@ -37,18 +61,20 @@ func PostThread(c *gin.Context, db *sql.DB) {
 	// Associate thread with tags
 	var tagIDs []int
 	for _, tag := range newThread.Tags {
-		tagID, err := models.GetOrCreateTagID(db, tag)
+		tagID, err := store.Tags.GetOrCreateTagID(tag)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create tags"})
 			return
 		}
 		tagIDs = append(tagIDs, tagID)
 	}
-	if err := models.AssociateThreadTags(db, createdThread.ID, tagIDs); err != nil {
+	if err := store.Tags.AssociateThreadTags(createdThread.ID, tagIDs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to associate thread with tags"})
 		return
 	}
 
+	notifyMentions(store, username, createdThread.Title+"\n"+createdThread.Content, createdThread.ID, nil)
+
 	// Respond with the thread ID
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "thread created successfully",
@@ -57,7 +83,7 @@ func PostThread(c *gin.Context, db *sql.DB) {
 }
 
 // GetThreads handles requests to fetch threads.
-func GetThreads(c *gin.Context, db *sql.DB) {
+func GetThreads(c *gin.Context, store *models.Store) {
 	// Parse query parameters for pagination and category
 	pageStr := c.DefaultQuery("page", "1")    // Default to 1 if not provided
 	limitStr := c.DefaultQuery("limit", "10") // Default to 10 if not provided
@@ -65,6 +91,7 @@ func GetThreads(c *gin.Context, db *sql.DB) {
 	search := c.DefaultQuery("search", "")
 	username := c.DefaultQuery("username", "")
 	sort := c.DefaultQuery("sort", "")
+	period := c.DefaultQuery("t", "all")
 
 	// Convert page and limit to integers
 	page, err := strconv.Atoi(pageStr)
@@ -79,21 +106,22 @@ func GetThreads(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	// Get threads from database
-	threads, err := models.GetThreads(db, page, limit, category, search, username, sort)
+	searchQuery, err := models.ParseSearchQuery(search)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve threads"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Count votes for each thread
-	for i := range threads {
-		netVotes, err := models.CountVote(db, threads[i].ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count votes"})
-			return
-		}
-		threads[i].Votes = netVotes
+	if _, ok := models.ThreadPeriods[period]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid time period"})
+		return
+	}
+
+	// Get threads from database, ranked by sort (relevance, new, top, hot, rising or controversial)
+	threads, err := store.Threads.GetThreads(page, limit, category, searchQuery, username, sort, period, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve threads"})
+		return
 	}
 
 	// Return the threads as a JSON response
@@ -101,7 +129,7 @@ func GetThreads(c *gin.Context, db *sql.DB) {
 }
 
 // GetSingleThread handles requests to fetch a single thread based on ID
-func GetSingleThread(c *gin.Context, db *sql.DB) {
+func GetSingleThread(c *gin.Context, store *models.Store) {
 	// Parse thread ID from URL
 	threadID, err := strconv.Atoi(c.Param("thread_id"))
 	if err != nil {
@@ -109,25 +137,62 @@ func GetSingleThread(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	thread, err := models.GetThreadByID(db, threadID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread"})
+	thread, ok := viewableThread(c, store, threadID)
+	if !ok {
 		return
 	}
 
-	netVotes, err := models.CountVote(db, thread.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count votes"})
-		return
+	c.JSON(http.StatusOK, gin.H{"thread": thread})
+}
+
+// threadVisible reports whether a user with grants may see a thread, which is
+// not the case when it is hidden from them or written by a shadowbanned user
+func threadVisible(store *models.Store, username string, grants models.Grants, thread *models.Thread) bool {
+	if thread.Hidden && thread.Username != username && !grants.Can(models.PermReviewReports, thread.Category) {
+		return false
 	}
+	// Shadowbanned users' threads and comments only exist for themselves
+	return thread.Username == username || !isShadowbanned(store, thread.Username)
+}
 
-	thread.Votes = netVotes
+// viewableThread fetches a thread the current user may see, responding with
+// 404 if it is missing, hidden from them or written by a shadowbanned user
+func viewableThread(c *gin.Context, store *models.Store, threadID int) (*models.Thread, bool) {
+	thread, err := store.Threads.GetThreadByID(threadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread"})
+		return nil, false
+	}
+	if !threadVisible(store, c.GetString("username"), middlewares.GetGrants(c), thread) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
+		return nil, false
+	}
+	shadowbanned, err := store.Comments.CountShadowbannedComments(threadID, c.GetString("username"))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread"})
+		return nil, false
+	}
+	thread.CommentCount -= shadowbanned
+	return thread, true
+}
 
-	c.JSON(http.StatusOK, gin.H{"thread": thread})
+// canModerateThread reports whether the current user holds perm in the thread's category
+func canModerateThread(c *gin.Context, store *models.Store, threadID int, perm models.Permission) (bool, error) {
+	category, err := store.Threads.GetThreadCategory(threadID)
+	if err != nil {
+		return false, err
+	}
+	return middlewares.GetGrants(c).Can(perm, category), nil
 }
 
-// EditThread handles requests to edit thread
-func EditThread(c *gin.Context, db *sql.DB) {
+// EditThread handles requests to edit thread. Every edit is kept as a revision,
+// and moderators' edits are audited with an optional ?reason=.
+func EditThread(c *gin.Context, store *models.Store) {
 	// Parse thread ID from URL
 	threadID, err := strconv.Atoi(c.Param("thread_id"))
 	if err != nil {
@@ -139,7 +204,7 @@ func EditThread(c *gin.Context, db *sql.DB) {
 	username := c.GetString("username")
 
 	// Check if user is thread owner
-	ownername, err := models.GetThreadOwnerUsername(db, threadID)
+	ownername, err := store.Threads.GetThreadOwnerUsername(threadID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread ID"})
@@ -148,9 +213,22 @@ func EditThread(c *gin.Context, db *sql.DB) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread owner"})
 		return
 	}
+	var before *models.Thread
 	if ownername != username {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
-		return
+		allowed, err := canModerateThread(c, store, threadID, models.PermEditAnyThread)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread category"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+			return
+		}
+		// Moderators' edits are audited
+		if before, err = store.Threads.GetThreadByID(threadID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread"})
+			return
+		}
 	}
 
 	// Parse the thread data from the request body
@@ -159,18 +237,46 @@ func EditThread(c *gin.Context, db *sql.DB) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
+	if !checkThreadContent(c, updatedThread.Content) {
+		return
+	}
+
+	// Moderators may only move threads into categories they moderate
+	if before != nil && updatedThread.Category != "" && updatedThread.Category != before.Category &&
+		!middlewares.GetGrants(c).Can(models.PermEditAnyThread, updatedThread.Category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		return
+	}
+
+	// Suspended and banned users cannot edit, nor move threads into a category they are banned from
+	if !checkThreadSanctions(c, store, threadID) {
+		return
+	}
+	if updatedThread.Category != "" && !checkSanctions(c, store, updatedThread.Category) {
+		return
+	}
 
 	// Edit the thread
-	if err := models.EditThread(db, threadID, &updatedThread); err != nil {
+	if err := store.Threads.EditThread(threadID, &updatedThread, username); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to edit thread"})
 		return
 	}
 
+	if ownername != username {
+		after, err := store.Threads.GetThreadByID(threadID)
+		if err != nil {
+			log.Printf("Error: %v", err)
+		}
+		audit(c, store, models.AuditThreadEdit, models.AuditTargetThread, threadID, c.Query("reason"), before, after)
+		notifyModeration(store, ownername, username, &threadID, nil, "A moderator edited your thread")
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "thread updated successfully"})
 }
 
-// DeleteThread handles requests to delete thread
-func DeleteThread(c *gin.Context, db *sql.DB) {
+// DeleteThread handles requests to delete thread, which moves it to the trash.
+// Moderators may give a ?reason=, which is audited and passed on to the owner.
+func DeleteThread(c *gin.Context, store *models.Store) {
 	// Parse thread ID from URL
 	threadID, err := strconv.Atoi(c.Param("thread_id"))
 	if err != nil {
@@ -182,7 +288,7 @@ func DeleteThread(c *gin.Context, db *sql.DB) {
 	username := c.GetString("username")
 
 	// Check if the thread belongs to the user
-	ownername, err := models.GetThreadOwnerUsername(db, threadID)
+	ownername, err := store.Threads.GetThreadOwnerUsername(threadID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread ID"})
@@ -192,21 +298,45 @@ func DeleteThread(c *gin.Context, db *sql.DB) {
 		return
 	}
 	if ownername != username {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		allowed, err := canModerateThread(c, store, threadID, models.PermDeleteAnyThread)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread category"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+			return
+		}
+	}
+
+	// Keep the title to tell the owner which thread a moderator removed
+	thread, err := store.Threads.GetThreadByID(threadID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread"})
 		return
 	}
 
 	// Delete the thread
-	err = models.DeleteThread(db, threadID)
+	err = store.Threads.DeleteThread(threadID, username)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete thread"})
 		return
 	}
 
+	reason := c.Query("reason")
+	audit(c, store, models.AuditThreadDelete, models.AuditTargetThread, threadID, reason, thread, nil)
+	if ownername != username {
+		message := fmt.Sprintf("A moderator removed your thread %q", thread.Title)
+		if reason != "" {
+			message += ": " + reason
+		}
+		notifyModeration(store, ownername, username, nil, nil, message)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "thread deleted successfully"})
 }
 
-func SaveThread(c *gin.Context, db *sql.DB) {
+func SaveThread(c *gin.Context, store *models.Store) {
 	// Get the username from JWT middleware
 	username := c.GetString("username")
 	if username == "" {
@@ -227,7 +357,11 @@ func SaveThread(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	err = models.SaveThread(db, username, threadID)
+	if !checkThreadSanctions(c, store, threadID) {
+		return
+	}
+
+	err = store.Threads.SaveThread(username, threadID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -242,7 +376,7 @@ func SaveThread(c *gin.Context, db *sql.DB) {
 	})
 }
 
-func RemoveSavedThread(c *gin.Context, db *sql.DB) {
+func RemoveSavedThread(c *gin.Context, store *models.Store) {
 	// Get the username from JWT middleware
 	username := c.GetString("username")
 	if username == "" {
@@ -263,7 +397,7 @@ func RemoveSavedThread(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	err = models.RemoveSavedThread(db, username, threadID)
+	err = store.Threads.RemoveSavedThread(username, threadID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -278,7 +412,7 @@ func RemoveSavedThread(c *gin.Context, db *sql.DB) {
 	})
 }
 
-func GetSavedThreads(c *gin.Context, db *sql.DB) {
+func GetSavedThreads(c *gin.Context, store *models.Store) {
 	username := c.Param("username") // Directly retrieve the username from the URL
 
 	if username == "" {
@@ -314,7 +448,7 @@ func GetSavedThreads(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	threads, err := models.GetSavedThreads(db, username, page, limit)
+	threads, err := store.Threads.GetSavedThreads(username, page, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -329,7 +463,7 @@ func GetSavedThreads(c *gin.Context, db *sql.DB) {
 	})
 }
 
-func CheckSavedState(c *gin.Context, db *sql.DB) {
+func CheckSavedState(c *gin.Context, store *models.Store) {
 	// Get the username from JWT middleware
 	username := c.GetString("username")
 	if username == "" {
@@ -350,7 +484,7 @@ func CheckSavedState(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	saved, err := models.CheckSavedState(db, username, threadID)
+	saved, err := store.Threads.CheckSavedState(username, threadID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
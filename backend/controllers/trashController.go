@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"backend/middlewares"
+	"backend/models"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// restorable reports whether content deleted at deletedAt is still within the
+// retention window, responding with 410 if it is not
+func restorable(c *gin.Context, deletedAt *time.Time) bool {
+	if deletedAt != nil && time.Since(*deletedAt) > models.TrashRetention {
+		c.JSON(http.StatusGone, gin.H{"error": "the retention window has passed"})
+		return false
+	}
+	return true
+}
+
+// GetTrash lists the threads and comments the current user deleted themselves
+// and can still restore, most recently deleted first. Content removed by a
+// moderator is not listed as only moderators can restore it.
+func GetTrash(c *gin.Context, store *models.Store) {
+	username := c.GetString("username")
+	since := time.Now().Add(-models.TrashRetention)
+
+	threads, err := store.Threads.GetDeletedThreads(username, since)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch deleted threads"})
+		return
+	}
+	comments, err := store.Comments.GetDeletedComments(username, since)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch deleted comments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"threads": threads, "comments": comments})
+}
+
+// RestoreThread handles requests to take a thread out of the trash within the
+// retention window. Owners may restore the threads they deleted themselves and
+// moderators any thread in their categories, with an optional ?reason= for the
+// audit log.
+func RestoreThread(c *gin.Context, store *models.Store) {
+	// Parse thread ID from URL
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread ID"})
+		return
+	}
+
+	username := c.GetString("username")
+
+	thread, err := store.Threads.GetDeletedThread(threadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "thread not found in the trash"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread"})
+		return
+	}
+	selfDeleted := thread.Username == username && thread.DeletedBy == username
+	if !selfDeleted && !middlewares.GetGrants(c).Can(models.PermDeleteAnyThread, thread.Category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		return
+	}
+	if !restorable(c, thread.DeletedAt) || !checkSanctions(c, store, thread.Category) {
+		return
+	}
+
+	if err := store.Threads.RestoreThread(threadID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "thread not found in the trash"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore thread"})
+		return
+	}
+
+	restored, err := store.Threads.GetThreadByID(threadID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+	}
+	audit(c, store, models.AuditThreadRestore, models.AuditTargetThread, threadID, c.Query("reason"), nil, restored)
+	if thread.Username != username {
+		notifyModeration(store, thread.Username, username, &threadID, nil, "A moderator restored your thread")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "thread restored successfully"})
+}
+
+// RestoreComment handles requests to take a comment out of the trash within the
+// retention window, on the same terms as RestoreThread. Comments of a deleted
+// thread come back with the thread.
+func RestoreComment(c *gin.Context, store *models.Store) {
+	// Parse thread and comment ID from URL
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread ID"})
+		return
+	}
+	commentID, err := strconv.Atoi(c.Param("comment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid comment ID"})
+		return
+	}
+
+	username := c.GetString("username")
+
+	comment, err := store.Comments.GetCommentByID(commentID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comment"})
+		return
+	}
+	if err != nil || comment.ThreadID != threadID || !comment.Deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found in the trash"})
+		return
+	}
+	owner, err := store.Comments.GetCommentOwnerUsername(commentID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch owner username"})
+		return
+	}
+	category, err := store.Threads.GetThreadCategory(threadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusConflict, gin.H{"error": "the thread is deleted, restore it first"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch thread category"})
+		return
+	}
+	selfDeleted := owner == username && comment.DeletedBy == username
+	if !selfDeleted && !middlewares.GetGrants(c).Can(models.PermDeleteAnyComment, category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		return
+	}
+	if !restorable(c, comment.DeletedAt) || !checkSanctions(c, store, category) {
+		return
+	}
+
+	if err := store.Comments.RestoreComment(commentID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "comment not found in the trash"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore comment"})
+		return
+	}
+
+	restored, err := store.Comments.GetCommentByID(commentID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+	} else {
+		publishComment(store, "comment_restored", restored)
+	}
+	audit(c, store, models.AuditCommentRestore, models.AuditTargetComment, commentID, c.Query("reason"), nil, restored)
+	if owner != username {
+		notifyModeration(store, owner, username, &threadID, &commentID, "A moderator restored your comment")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "comment restored successfully"})
+}
@@ -0,0 +1,374 @@
+package controllers
+
+import (
+	"backend/middlewares"
+	"backend/models"
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// totpIssuer names the forum in authenticator apps
+	totpIssuer = "Soforum"
+	// recoveryCodeCount is how many recovery codes users get at a time
+	recoveryCodeCount = 10
+	// loginChallengeTTL is how long users have to enter their second factor
+	loginChallengeTTL = 5 * time.Minute
+	// maxChallengeAttempts is how many codes can be tried against a challenge
+	maxChallengeAttempts = 5
+)
+
+// issueLoginChallenge returns the token a user who entered their password
+// exchanges for a session along with their second factor
+func issueLoginChallenge(store *models.Store, username string) (string, error) {
+	userID, err := store.Users.GetUserIDByUsername(username)
+	if err != nil {
+		return "", err
+	}
+	challenge, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := store.Users.CreateUserToken(userID, models.TokenLoginChallenge, utils.HashToken(challenge), time.Now().Add(loginChallengeTTL)); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// generateRecoveryCodes returns a new set of recovery codes and their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+// secondFactor is the proof of a user's second factor, either a TOTP code or
+// one of their recovery codes
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// verify checks the second factor of a user with 2FA enabled and uses it up,
+// so that neither a code nor a recovery code works twice
+func (f secondFactor) verify(store *models.Store, username string, twoFactor *models.TwoFactor) (bool, error) {
+	if f.Code != "" {
+		step, ok := utils.VerifyTOTP(twoFactor.Secret, f.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return store.TwoFactor.UseTOTPStep(username, step)
+	}
+	if f.RecoveryCode != "" {
+		return store.TwoFactor.UseRecoveryCode(username, utils.HashToken(utils.NormalizeRecoveryCode(f.RecoveryCode)))
+	}
+	return false, nil
+}
+
+// checkSecondFactor responds and reports false unless the second factor of a
+// user with 2FA enabled is right. Callers reserve a login attempt first, so
+// that codes are guessed no faster than passwords.
+func checkSecondFactor(c *gin.Context, store *models.Store, username string, twoFactor *models.TwoFactor, factor secondFactor) bool {
+	valid, err := factor.verify(store, username, twoFactor)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check two-factor code"})
+		return false
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid two-factor code"})
+		return false
+	}
+	return true
+}
+
+// currentTwoFactor fetches the 2FA enrollment of the user in the URL, who must
+// be the current user
+func currentTwoFactor(c *gin.Context, store *models.Store) (string, *models.TwoFactor, bool) {
+	username := c.Param("username")
+	if c.GetString("username") != username {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		return "", nil, false
+	}
+	twoFactor, err := store.TwoFactor.GetTwoFactor(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch two-factor authentication"})
+		return "", nil, false
+	}
+	return username, twoFactor, true
+}
+
+// GetTwoFactorStatus handles requests for whether the current user has 2FA,
+// how many recovery codes they have left and whether their role requires it
+func GetTwoFactorStatus(c *gin.Context, store *models.Store) {
+	username, twoFactor, ok := currentTwoFactor(c, store)
+	if !ok {
+		return
+	}
+	grants, err := store.Users.GetUserGrants(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user grants"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":             twoFactor.Enabled,
+		"recovery_codes_left": twoFactor.RecoveryCodesLeft,
+		"required":            middlewares.RequireTwoFactorForPrivileged && grants.Privileged(),
+	})
+}
+
+// StartTwoFactorEnrollment handles requests from the current user to set up
+// 2FA, confirmed with their password. It returns a new secret and the
+// otpauth:// URI to scan, which EnableTwoFactor then checks a code against.
+func StartTwoFactorEnrollment(c *gin.Context, store *models.Store) {
+	username, twoFactor, ok := currentTwoFactor(c, store)
+	if !ok {
+		return
+	}
+	var enrollData struct {
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&enrollData); err != nil || enrollData.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if twoFactor.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	if !confirmPassword(c, store, username, enrollData.Password) {
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+		return
+	}
+	if err := store.TwoFactor.SetTOTPSecret(username, secret); err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI(totpIssuer, username, secret),
+	})
+}
+
+// EnableTwoFactor handles the first code from the current user's authenticator,
+// which turns 2FA on. The recovery codes are only shown in the response.
+func EnableTwoFactor(c *gin.Context, store *models.Store) {
+	username, twoFactor, ok := currentTwoFactor(c, store)
+	if !ok {
+		return
+	}
+	var enableData struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&enableData); err != nil || enableData.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if twoFactor.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	if twoFactor.Secret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start enrolling first"})
+		return
+	}
+	step, ok := utils.VerifyTOTP(twoFactor.Secret, enableData.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid two-factor code"})
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+	if err := store.TwoFactor.EnableTwoFactor(username, step, hashes); err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor handles requests from the current user to turn 2FA off,
+// confirmed with their password and second factor, which count against the
+// login lockout. Users whose role requires 2FA cannot turn it off.
+func DisableTwoFactor(c *gin.Context, store *models.Store) {
+	username, twoFactor, ok := currentTwoFactor(c, store)
+	if !ok {
+		return
+	}
+	var disableData struct {
+		Password string `json:"password"`
+		secondFactor
+	}
+	if err := c.ShouldBindJSON(&disableData); err != nil || disableData.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if !twoFactor.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	grants, err := store.Users.GetUserGrants(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user grants"})
+		return
+	}
+	if middlewares.RequireTwoFactorForPrivileged && grants.Privileged() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "two-factor authentication is required for your role"})
+		return
+	}
+	if !reserveLoginAttempt(c, store, username) {
+		return
+	}
+	if !confirmPassword(c, store, username, disableData.Password) ||
+		!checkSecondFactor(c, store, username, twoFactor, disableData.secondFactor) {
+		return
+	}
+	clearLoginFailures(c, store, username)
+
+	if err := store.TwoFactor.DisableTwoFactor(username); err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes handles requests from the current user for a new
+// set of recovery codes, confirmed with their password and second factor,
+// which count against the login lockout
+func RegenerateRecoveryCodes(c *gin.Context, store *models.Store) {
+	username, twoFactor, ok := currentTwoFactor(c, store)
+	if !ok {
+		return
+	}
+	var regenerateData struct {
+		Password string `json:"password"`
+		secondFactor
+	}
+	if err := c.ShouldBindJSON(&regenerateData); err != nil || regenerateData.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if !twoFactor.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	if !reserveLoginAttempt(c, store, username) {
+		return
+	}
+	if !confirmPassword(c, store, username, regenerateData.Password) ||
+		!checkSecondFactor(c, store, username, twoFactor, regenerateData.secondFactor) {
+		return
+	}
+	clearLoginFailures(c, store, username)
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+	if err := store.TwoFactor.ReplaceRecoveryCodes(username, hashes); err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// CompleteTwoFactorLogin handles the second step of logging in with 2FA,
+// exchanging the challenge token from UserLogin and a TOTP or recovery code
+// for a session. A challenge allows maxChallengeAttempts codes, and every
+// wrong code counts against the login lockout like a wrong password, which
+// is only lifted once the login is complete.
+func CompleteTwoFactorLogin(c *gin.Context, store *models.Store) {
+	var loginData struct {
+		ChallengeToken string `json:"challenge_token"`
+		secondFactor
+	}
+	if err := c.ShouldBindJSON(&loginData); err != nil || loginData.ChallengeToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if loginData.Code == "" && loginData.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a code or a recovery code is required"})
+		return
+	}
+
+	challengeHash := utils.HashToken(loginData.ChallengeToken)
+	username, err := store.Users.AttemptUserToken(models.TokenLoginChallenge, challengeHash, maxChallengeAttempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge, please log in again"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	twoFactor, err := store.TwoFactor.GetTwoFactor(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if !twoFactor.Enabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge, please log in again"})
+		return
+	}
+	if !reserveLoginAttempt(c, store, username) {
+		return
+	}
+	if !checkSecondFactor(c, store, username, twoFactor, loginData.secondFactor) {
+		return
+	}
+
+	// Use up the challenge, losing a race with another request for it is a failure
+	if _, err := store.Users.ConsumeUserToken(models.TokenLoginChallenge, challengeHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge, please log in again"})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	if completeLogin(c, store, username) {
+		clearLoginFailures(c, store, username)
+	}
+}
@@ -12,7 +12,7 @@ import (
 )
 
 // UserSignup handles the HTTP request to create a new user
-func UserSignup(c *gin.Context, db *sql.DB) {
+func UserSignup(c *gin.Context, store *models.Store) {
 	var newUser models.User
 
 	// Bind the JSON payload to newUser
@@ -37,31 +37,51 @@ func UserSignup(c *gin.Context, db *sql.DB) {
 	}
 
 	// Check if the username / email is already taken
-	_, err := models.GetUserIDByUsername(newUser.Username, db)
+	_, err := store.Users.GetUserIDByUsername(newUser.Username)
 	if err == nil {
 		log.Printf("Error: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "username already taken"})
 		return
 	}
-	_, err = models.GetUserIDByEmail(newUser.Email, db)
+	_, err = store.Users.GetUserIDByEmail(newUser.Email)
 	if err == nil {
 		log.Printf("Error: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "email already signed up"})
 		return
 	}
 
+	// Hash the password before it touches the database
+	passwordHash, err := utils.HashPassword(newUser.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		return
+	}
+
 	// Insert the new user into the database
-	err = models.CreateUser(db, newUser.Username, newUser.Password, newUser.Email)
+	err = store.Users.CreateUser(newUser.Username, passwordHash, newUser.Email)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert user", "message": err.Error()})
 		return
 	}
 
+	// Ask the new user to verify their address
+	userID, err := store.Users.GetUserIDByUsername(newUser.Username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+	} else {
+		go sendVerificationEmail(store, userID, newUser.Username, newUser.Email)
+	}
+
+	// Never echo the password back, new users always start with the user role
+	// and an unverified address
+	newUser.EmailVerified = false
+	newUser.Password = ""
+	newUser.Role = models.RoleUser
 	c.IndentedJSON(http.StatusCreated, newUser)
 }
 
 // UserLogin handles the HTTP request to login a user
-func UserLogin(c *gin.Context, db *sql.DB) {
+func UserLogin(c *gin.Context, store *models.Store) {
 	var loginData struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
@@ -73,47 +93,98 @@ func UserLogin(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	// Check validity of username and password
-	usernameError := utils.ValidateUsername(loginData.Username)
-	passwordError := utils.ValidatePassword(loginData.Password)
-	if usernameError != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": usernameError.Error()})
+	// Check validity of the username. The password rules only apply to new
+	// passwords, older ones may not meet them.
+	if err := utils.ValidateUsername(loginData.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
-	} else if passwordError != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": passwordError.Error()})
+	}
+	if loginData.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password is required"})
 		return
 	}
 
-	// User authentication (!! hash password with bcrpt !!)
-	Password, err := models.GetUserPasswordByUsername(loginData.Username, db)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "username does not exist"})
-			return
-		}
+	// Count the attempt as failed until the password is known to be right, and
+	// refuse guesses while the account or the client is locked out
+	if !reserveLoginAttempt(c, store, loginData.Username) {
+		return
+	}
+
+	// User authentication, unknown usernames fail like wrong passwords
+	storedPassword, err := store.Users.GetUserPasswordByUsername(loginData.Username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		c.Error(err).SetMeta("Authentication failed")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		return
 	}
-	if Password != loginData.Password {
+	var match, needsRehash bool
+	if err == nil {
+		match, needsRehash, err = utils.VerifyPassword(storedPassword, loginData.Password)
+		if err != nil {
+			log.Printf("Error verifying password: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+	} else {
+		utils.VerifyPassword(dummyPasswordHash(), loginData.Password)
+	}
+	// The reserved "left" user only holds the content of deleted accounts
+	if match {
+		userID, err := store.Users.GetUserIDByUsername(loginData.Username)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+		match = userID != models.LeftUserID
+	}
+	if !match {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(loginData.Username)
+	// Upgrade legacy plaintext rows and outdated hashes now that we know the password
+	if needsRehash {
+		passwordHash, err := utils.HashPassword(loginData.Password)
+		if err == nil {
+			err = store.Users.UpdateUserPassword(loginData.Username, passwordHash)
+		}
+		if err != nil {
+			log.Printf("Error rehashing password for %s: %v", loginData.Username, err)
+		}
+	}
+
+	// With 2FA the password only earns a challenge for the second factor
+	twoFactor, err := store.TwoFactor.GetTwoFactor(loginData.Username)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate JWT token"})
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if twoFactor.Enabled {
+		// The account keeps the attempt counted until the second factor is
+		// right too, so that codes cannot be guessed by logging in again
+		refundIPLoginAttempt(c, store)
+		challenge, err := issueLoginChallenge(store, loginData.Username)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not start two-factor authentication"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":             "two-factor authentication required",
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "login successful",
-		"token":   token,
-	})
+	if completeLogin(c, store, loginData.Username) {
+		clearLoginFailures(c, store, loginData.Username)
+	}
 }
 
-func UpdateUser(c *gin.Context, db *sql.DB) {
+func UpdateUser(c *gin.Context, store *models.Store) {
 	username := c.Param("username") // Directly retrieve the username from the URL
 
 	if username == "" {
@@ -136,7 +207,7 @@ func UpdateUser(c *gin.Context, db *sql.DB) {
 	}
 
 	// Edit the user
-	if err := models.UpdateUser(db, currentUsername, updatedUser.Username, updatedUser.Bio); err != nil {
+	if err := store.Users.UpdateUser(currentUsername, updatedUser.Username, updatedUser.Bio); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user"})
 		return
 	}
@@ -144,12 +215,12 @@ func UpdateUser(c *gin.Context, db *sql.DB) {
 	c.JSON(http.StatusOK, gin.H{"message": "user updated successfully"})
 }
 
-func GetUser(c *gin.Context, db *sql.DB) {
+func GetUser(c *gin.Context, store *models.Store) {
 	// Get the username from the URL parameter
 	username := c.Param("username")
 
 	// Call the model to fetch user details
-	user, err := models.GetUserByUsername(db, username)
+	user, err := store.Users.GetUserByUsername(username)
 	if err != nil {
 		// Handle error if user not found or any other error
 		log.Println("Error fetching user:", err)
@@ -159,9 +230,80 @@ func GetUser(c *gin.Context, db *sql.DB) {
 
 	// Return user profile info
 	c.JSON(http.StatusOK, gin.H{
-		"username": user.Username,
-		"email":    user.Email,
-		"bio":      user.Bio,
-		"joined":   user.CreatedAt,
+		"username":       user.Username,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"bio":            user.Bio,
+		"role":           user.Role,
+		"joined":         user.CreatedAt,
 	})
 }
+
+// confirmPassword responds with 401 and reports false unless password is the
+// one of username, for actions that ask a logged in user to type it again
+func confirmPassword(c *gin.Context, store *models.Store, username, password string) bool {
+	storedPassword, err := store.Users.GetUserPasswordByUsername(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return false
+	}
+	match, _, err := utils.VerifyPassword(storedPassword, password)
+	if err != nil {
+		log.Printf("Error verifying password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return false
+	}
+	if !match {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return false
+	}
+	return true
+}
+
+// DeleteUser handles requests to delete the current user's account, confirmed
+// with their password. Their threads and comments are kept under the reserved
+// "left" user unless they ask for them to be deleted with "delete_content".
+func DeleteUser(c *gin.Context, store *models.Store) {
+	username := c.Param("username")
+
+	// Get the username from JWT middleware
+	if c.GetString("username") != username {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorised user"})
+		return
+	}
+
+	var deleteData struct {
+		Password      string `json:"password"`
+		DeleteContent bool   `json:"delete_content"`
+	}
+	if err := c.ShouldBindJSON(&deleteData); err != nil || deleteData.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+
+	if !confirmPassword(c, store, username, deleteData.Password) {
+		return
+	}
+
+	userID, err := store.Users.GetUserIDByUsername(username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return
+	}
+	if err := store.Users.DeleteUser(username, deleteData.DeleteContent); err != nil {
+		if errors.Is(err, models.ErrReservedUser) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete user"})
+		return
+	}
+
+	// The entry records what happened to the content, not the profile
+	audit(c, store, models.AuditUserDelete, models.AuditTargetUser, userID, "", nil, gin.H{"delete_content": deleteData.DeleteContent})
+
+	c.JSON(http.StatusOK, gin.H{"message": "account deleted successfully"})
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"backend/models"
 	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -10,7 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func CastVote(c *gin.Context, db *sql.DB) {
+func CastVote(c *gin.Context, store *models.Store) {
 	// Get the username from JWT middleware
 	username := c.GetString("username")
 
@@ -21,6 +22,11 @@ func CastVote(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	// Suspended and banned users cannot vote
+	if !checkThreadSanctions(c, store, threadID) {
+		return
+	}
+
 	// Bind the request body to a Thread struct
 	var newVote models.Vote
 	if err := c.ShouldBindJSON(&newVote); err != nil {
@@ -31,13 +37,18 @@ func CastVote(c *gin.Context, db *sql.DB) {
 	newVote.Username = username
 	newVote.ThreadID = threadID
 
-	createdVote, err := models.CreateVote(db, &newVote)
+	createdVote, err := store.Votes.CreateVote(&newVote)
 	if err != nil {
 		log.Printf("Error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cast vote"})
 		return
 	}
 
+	publishThreadVotes(store, threadID)
+	if createdVote.Vote > 0 {
+		notifyThreadVoteMilestone(store, threadID)
+	}
+
 	// Respond with the thread ID
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "vote casted successfully",
@@ -45,7 +56,7 @@ func CastVote(c *gin.Context, db *sql.DB) {
 	})
 }
 
-func DeleteVote(c *gin.Context, db *sql.DB) {
+func DeleteVote(c *gin.Context, store *models.Store) {
 	// Get the username from JWT middleware
 	username := c.GetString("username")
 
@@ -56,13 +67,19 @@ func DeleteVote(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	// Suspended and banned users cannot take their votes back either
+	if !checkThreadSanctions(c, store, threadID) {
+		return
+	}
+
 	// Call the model function to delete the vote
-	err = models.DeleteVote(db, threadID, username)
+	err = store.Votes.DeleteVote(threadID, username)
 	if err != nil {
 		log.Printf("Error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete vote"})
 		return
 	}
+	publishThreadVotes(store, threadID)
 
 	// Respond with success message
 	c.JSON(http.StatusOK, gin.H{
@@ -70,7 +87,7 @@ func DeleteVote(c *gin.Context, db *sql.DB) {
 	})
 }
 
-func CountVotes(c *gin.Context, db *sql.DB) {
+func CountVotes(c *gin.Context, store *models.Store) {
 	// Parse thread ID from URL
 	threadID, err := strconv.Atoi(c.Param("thread_id"))
 	if err != nil {
@@ -79,7 +96,7 @@ func CountVotes(c *gin.Context, db *sql.DB) {
 	}
 
 	// Call the CountVote function to get the net votes
-	netVotes, err := models.CountVote(db, threadID)
+	netVotes, err := store.Votes.CountVote(threadID)
 	if err != nil {
 		log.Printf("Error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count vote"})
@@ -91,7 +108,7 @@ func CountVotes(c *gin.Context, db *sql.DB) {
 	})
 }
 
-func GetVoteState(c *gin.Context, db *sql.DB) {
+func GetVoteState(c *gin.Context, store *models.Store) {
 	// Parse thread ID from URL
 	threadID, err := strconv.Atoi(c.Param("thread_id"))
 	if err != nil {
@@ -105,14 +122,14 @@ func GetVoteState(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	userID, err := models.GetUserIDByUsername(username, db)
+	userID, err := store.Users.GetUserIDByUsername(username)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user_id"})
 		return
 	}
 
 	// Fetch vote state
-	voteState, err := models.GetVoteStateByUserID(db, threadID, userID)
+	voteState, err := store.Votes.GetVoteStateByUserID(threadID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve vote state"})
 	}
@@ -120,3 +137,107 @@ func GetVoteState(c *gin.Context, db *sql.DB) {
 	// Respond with vote state
 	c.JSON(http.StatusOK, voteState)
 }
+
+// threadComment loads the comment in the URL, responding with an error unless it belongs to the thread in the URL
+func threadComment(c *gin.Context, store *models.Store) (*models.Comment, bool) {
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread ID"})
+		return nil, false
+	}
+	commentID, err := strconv.Atoi(c.Param("comment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid comment ID"})
+		return nil, false
+	}
+
+	comment, err := store.Comments.GetCommentByID(commentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+			return nil, false
+		}
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comment"})
+		return nil, false
+	}
+	if comment.ThreadID != threadID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return nil, false
+	}
+
+	return comment, true
+}
+
+// CastCommentVote upvotes (1) or downvotes (-1) a comment, replacing any previous vote
+func CastCommentVote(c *gin.Context, store *models.Store) {
+	// Get the username from JWT middleware
+	username := c.GetString("username")
+
+	comment, ok := threadComment(c, store)
+	if !ok {
+		return
+	}
+	if comment.Deleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot vote on a deleted comment"})
+		return
+	}
+	if !checkThreadSanctions(c, store, comment.ThreadID) {
+		return
+	}
+
+	var newVote models.CommentVote
+	if err := c.ShouldBindJSON(&newVote); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if newVote.Vote != 1 && newVote.Vote != -1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "vote must be 1 or -1"})
+		return
+	}
+
+	newVote.Username = username
+	newVote.CommentID = comment.ID
+
+	createdVote, err := store.Votes.CreateCommentVote(&newVote)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cast vote"})
+		return
+	}
+
+	publishCommentVotes(store, comment)
+	if createdVote.Vote > 0 {
+		notifyCommentVoteMilestone(store, comment)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "vote casted successfully",
+		"vote":    createdVote,
+	})
+}
+
+// DeleteCommentVote removes the user's vote on a comment
+func DeleteCommentVote(c *gin.Context, store *models.Store) {
+	// Get the username from JWT middleware
+	username := c.GetString("username")
+
+	comment, ok := threadComment(c, store)
+	if !ok {
+		return
+	}
+	if !checkThreadSanctions(c, store, comment.ThreadID) {
+		return
+	}
+
+	if err := store.Votes.DeleteCommentVote(comment.ID, username); err != nil {
+		log.Printf("Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete vote"})
+		return
+	}
+	publishCommentVotes(store, comment)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "vote deleted successfully",
+	})
+}
@@ -5,17 +5,17 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// AllowedOrigins are the frontends allowed to call the API from a browser
+var AllowedOrigins = []string{
+	"http://localhost:3000",      // Development frontend
+	"https://soforum.vercel.app", // Production frontend
+}
+
 // SetupCORS returns a GIN middleware handler that sets up the CORS configuration
 func SetupCORS() gin.HandlerFunc {
-	// Define allowed origins
-	allowedOrigins := []string{
-		"http://localhost:3000",      // Development frontend
-		"https://soforum.vercel.app", // Production frontend
-	}
-
 	// Create the CORS configuration
 	corsConfig := cors.Config{
-		AllowOrigins:     allowedOrigins,                                      // Allowed origins
+		AllowOrigins:     AllowedOrigins,                                      // Allowed origins
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}, // Allowed HTTP methods
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"}, // Allowed headers
 		AllowCredentials: true,                                                // Allow cookies/authorization headers
@@ -1,79 +1,162 @@
 package middlewares
 
 import (
+	"backend/models"
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"log"
 	"net/http"
-	"os"
 	"strings"
 
-	"fmt"
-
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 )
 
-// JWT middleware to validate the token
-func JWTAuthMiddleware() gin.HandlerFunc {
+// JWT middleware to validate the token and the session it belongs to. Personal
+// API tokens are accepted instead when they have one of scopes, routes without
+// scopes only accept login JWTs.
+func JWTAuthMiddleware(store *models.Store, scopes ...models.TokenScope) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get the "Authorization" header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			// If no Authorization header is found, return 401
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+		if status, message := authenticate(c, store, scopes); status != 0 {
+			c.JSON(status, gin.H{"error": message})
 			c.Abort()
 			return
 		}
 
-		// Split the header into the "Bearer" token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader { // "Bearer" not present
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Bearer token is required"})
-			c.Abort()
-			return
-		}
+		// Proceed to the next handler
+		c.Next()
+	}
+}
 
-		// Parse and validate the JWT token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-
-			// Return the secret key used to sign the token (this can be configured elsewhere)
-			jwtSecretKey := os.Getenv("JWT_SECRET_KEY")
-			if jwtSecretKey == "" {
-				return nil, fmt.Errorf("JWT_SECRET_KEY is not set")
-			}
-
-			// Return the secret key for validation
-			return []byte(jwtSecretKey), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
-			return
+// OptionalJWTAuthMiddleware identifies the user when a valid token is sent, but
+// lets anonymous requests and requests with invalid tokens through as guests.
+// Personal API tokens without one of scopes are treated as invalid.
+func OptionalJWTAuthMiddleware(store *models.Store, scopes ...models.TokenScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" {
+			authenticate(c, store, scopes)
 		}
+		c.Next()
+	}
+}
 
-		// Extract username from JWT "sub" claim
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
-			return
+// TokenFromQuery accepts the access token as the access_token query parameter
+// when no Authorization header is sent, for clients such as EventSource that
+// cannot set headers. Only use it on streaming routes, since URLs end up in logs.
+func TokenFromQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := c.Query("access_token"); token != "" && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
 		}
+		c.Next()
+	}
+}
 
-		// Set the username in the context
-		username, exists := claims["sub"].(string)
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Username not found in token"})
-			c.Abort()
-			return
+// authenticate validates the bearer token of the request and stores the user in the
+// context. It returns a non-zero HTTP status and an error message on failure.
+func authenticate(c *gin.Context, store *models.Store, scopes []models.TokenScope) (int, string) {
+	// Get the "Authorization" header
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		// If no Authorization header is found, return 401
+		return http.StatusUnauthorized, "Authorization header is required"
+	}
+
+	// Split the header into the "Bearer" token
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader { // "Bearer" not present
+		return http.StatusUnauthorized, "Bearer token is required"
+	}
+	if strings.HasPrefix(tokenString, models.APITokenPrefix) {
+		return authenticateAPIToken(c, store, tokenString, scopes)
+	}
+
+	// Verify the signature, expiry, issuer and audience of the token
+	claims, err := store.JWT.Verify(tokenString)
+	if err != nil {
+		return http.StatusUnauthorized, "Invalid or expired token"
+	}
+
+	// Extract username from JWT "sub" claim
+	username := claims.Subject
+	if username == "" {
+		return http.StatusUnauthorized, "Username not found in token"
+	}
+
+	// Reject tokens whose session was revoked by logout or refresh token reuse
+	sessionID := claims.SessionID
+	if sessionID == "" {
+		return http.StatusUnauthorized, "Session not found in token"
+	}
+	active, err := store.Sessions.IsSessionActive(sessionID, username)
+	if err != nil {
+		log.Printf("Error checking session: %v", err)
+		return http.StatusInternalServerError, "failed to validate session"
+	}
+	if !active {
+		return http.StatusUnauthorized, "Session has been revoked"
+	}
+
+	// Extract the role and moderated categories, tokens without them only get user rights
+	grants := models.Grants{Role: models.RoleUser, ModeratedCategories: []string{}}
+	if role := models.Role(claims.Role); role.Valid() {
+		grants.Role = role
+	}
+	grants.ModeratedCategories = append(grants.ModeratedCategories, claims.ModeratedCategories...)
+
+	// Add the username, session and grants to the context for further use in the handler
+	c.Set("username", username)
+	c.Set("session_id", sessionID)
+	c.Set("grants", grants)
+
+	return 0, ""
+}
+
+// authenticateAPIToken validates a personal API token sent instead of a login
+// JWT. It only carries the role and moderated categories of the user with the
+// moderate scope, as long as they have 2FA when it is required, and user
+// rights otherwise.
+func authenticateAPIToken(c *gin.Context, store *models.Store, token string, scopes []models.TokenScope) (int, string) {
+	username, tokenScopes, err := store.APITokens.UseAPIToken(utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return http.StatusUnauthorized, "Invalid or expired token"
 		}
+		log.Printf("Error checking API token: %v", err)
+		return http.StatusInternalServerError, "failed to validate token"
+	}
 
-		// Add the username to the context for further use in the handler
-		c.Set("username", username)
+	allowed := false
+	for _, scope := range scopes {
+		if models.HasScope(tokenScopes, scope) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return http.StatusForbidden, "token does not have the required scope"
+	}
 
-		// Proceed to the next handler
-		c.Next()
+	grants := models.Grants{Role: models.RoleUser, ModeratedCategories: []string{}}
+	if models.HasScope(tokenScopes, models.ScopeModerate) {
+		userGrants, err := store.Users.GetUserGrants(username)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return http.StatusInternalServerError, "failed to validate token"
+		}
+		missing, err := TwoFactorMissing(store, username, userGrants)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return http.StatusInternalServerError, "failed to validate token"
+		}
+		if !missing {
+			grants = *userGrants
+		}
 	}
+
+	c.Set("username", username)
+	c.Set("token_hash", utils.HashToken(token))
+	c.Set("grants", grants)
+
+	return 0, ""
 }
@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"backend/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireTwoFactorForPrivileged withholds the rights of moderators, category
+// moderators and admins from their access and API tokens until they enable 2FA
+var RequireTwoFactorForPrivileged = false
+
+// TwoFactorMissing reports whether a user with grants may not use them because
+// 2FA is required for privileged users and they have not enabled it
+func TwoFactorMissing(store *models.Store, username string, grants *models.Grants) (bool, error) {
+	if !RequireTwoFactorForPrivileged || !grants.Privileged() {
+		return false, nil
+	}
+	twoFactor, err := store.TwoFactor.GetTwoFactor(username)
+	if err != nil {
+		return false, err
+	}
+	return !twoFactor.Enabled, nil
+}
+
+// GetGrants returns the grants set by JWTAuthMiddleware, or plain user rights if there are none
+func GetGrants(c *gin.Context) models.Grants {
+	if grants, ok := c.Get("grants"); ok {
+		if g, ok := grants.(models.Grants); ok {
+			return g
+		}
+	}
+	return models.Grants{Role: models.RoleUser, ModeratedCategories: []string{}}
+}
+
+// RequirePermission returns a middleware that only lets through users whose role
+// grants perm site-wide. It must run after JWTAuthMiddleware.
+func RequirePermission(perm models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !GetGrants(c).Role.HasPermission(perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
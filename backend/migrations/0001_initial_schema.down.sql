@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS user_threads;
+DROP TABLE IF EXISTS thread_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS votes;
+DROP TABLE IF EXISTS threads;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS users;
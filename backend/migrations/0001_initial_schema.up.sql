@@ -0,0 +1,106 @@
+-- Baseline schema, written with IF NOT EXISTS so it adopts databases
+-- that were created by the old createTables bootstrap
+CREATE EXTENSION IF NOT EXISTS citext;
+
+-- Users table
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	username VARCHAR(50) NOT NULL UNIQUE,
+	password VARCHAR(255) NOT NULL,
+	email VARCHAR(100) NOT NULL UNIQUE,
+	bio VARCHAR(500) DEFAULT 'This user is too cool to add a bio.',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Insert reserved "left" user
+INSERT INTO users (id, username, password, email)
+VALUES (1, 'left', 'leftpass123', 'deleted@example.com')
+ON CONFLICT (id) DO NOTHING;
+
+-- Insert reserved "admin" user
+INSERT INTO users (id, username, password, email)
+VALUES (2, 'admin', 'adminpass123', 'admin@example.com')
+ON CONFLICT (id) DO NOTHING;
+
+-- Insert reserved "guest" user
+INSERT INTO users (id, username, password, email)
+VALUES (3, 'guest', 'guestpass123', 'guest@example.com')
+ON CONFLICT (id) DO NOTHING;
+
+-- Keep the id sequence ahead of the reserved users
+SELECT setval(pg_get_serial_sequence('users', 'id'), GREATEST((SELECT MAX(id) FROM users), 3));
+
+-- Categories table
+CREATE TABLE IF NOT EXISTS categories (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) UNIQUE NOT NULL
+);
+
+-- Insert initial entries into the categories table
+INSERT INTO categories (name)
+VALUES
+	('general'),
+	('technology'),
+	('science'),
+	('gaming'),
+	('movies'),
+	('music'),
+	('sports'),
+	('books'),
+	('art'),
+	('travel'),
+	('food'),
+	('academics')
+ON CONFLICT (name) DO NOTHING;
+
+-- Threads table
+CREATE TABLE IF NOT EXISTS threads (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id),
+	title VARCHAR(255) NOT NULL,
+	content TEXT NOT NULL,
+	category_id INT NOT NULL REFERENCES categories(id) ON DELETE SET NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Votes table
+CREATE TABLE IF NOT EXISTS votes (
+	id SERIAL PRIMARY KEY,
+	thread_id INT NOT NULL REFERENCES threads(id) ON DELETE CASCADE,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	vote SMALLINT NOT NULL CHECK (vote IN (-1, 1)), -- -1 for downvote, +1 for upvote
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (thread_id, user_id) -- Each user can vote on a thread only once
+);
+
+-- Comments table
+CREATE TABLE IF NOT EXISTS comments (
+	id SERIAL PRIMARY KEY,
+	thread_id INT NOT NULL REFERENCES threads(id) ON DELETE CASCADE,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	content TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Tags table
+CREATE TABLE IF NOT EXISTS tags (
+	id SERIAL PRIMARY KEY,
+	name CITEXT UNIQUE NOT NULL
+);
+
+-- Thread-Tags table
+CREATE TABLE IF NOT EXISTS thread_tags (
+	thread_id INT NOT NULL REFERENCES threads(id) ON DELETE CASCADE,
+	tag_id INT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+	PRIMARY KEY (thread_id, tag_id)
+);
+
+-- User-Threads table
+CREATE TABLE IF NOT EXISTS user_threads (
+	user_id INT NOT NULL,
+	thread_id INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, thread_id),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+-- Site-wide role: user, moderator or admin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+
+-- Give the reserved "admin" user its powers
+UPDATE users SET role = 'admin' WHERE id = 2 AND username = 'admin';
+
+-- Category moderators table, moderator rights limited to one category
+CREATE TABLE IF NOT EXISTS category_moderators (
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	category_id INT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, category_id)
+);
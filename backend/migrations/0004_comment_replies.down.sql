@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS comments_parent_id_idx;
+DROP INDEX IF EXISTS comments_thread_id_idx;
+
+-- Flatten replies before removing deleted placeholders so the cascade cannot reach them
+ALTER TABLE comments DROP COLUMN parent_id;
+DELETE FROM comments WHERE deleted_at IS NOT NULL;
+ALTER TABLE comments DROP COLUMN deleted_at;
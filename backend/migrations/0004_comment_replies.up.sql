@@ -0,0 +1,8 @@
+-- Replies point at the comment they answer, top-level comments have no parent
+ALTER TABLE comments ADD COLUMN parent_id INT REFERENCES comments(id) ON DELETE CASCADE;
+
+-- Comments with replies are only marked as deleted so the replies stay visible
+ALTER TABLE comments ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX comments_thread_id_idx ON comments (thread_id);
+CREATE INDEX comments_parent_id_idx ON comments (parent_id);
@@ -0,0 +1,9 @@
+-- Votes on comments, with the same semantics as votes on threads
+CREATE TABLE IF NOT EXISTS comment_votes (
+	id SERIAL PRIMARY KEY,
+	comment_id INT NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	vote SMALLINT NOT NULL CHECK (vote IN (-1, 1)), -- -1 for downvote, +1 for upvote
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (comment_id, user_id) -- Each user can vote on a comment only once
+);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS threads_score_idx;
+
+ALTER TABLE threads
+	DROP COLUMN comment_count,
+	DROP COLUMN downvotes,
+	DROP COLUMN upvotes,
+	DROP COLUMN score;
@@ -0,0 +1,14 @@
+-- Denormalized counters kept up to date by votes and comments, see models.ReconcileThreadCounters
+ALTER TABLE threads
+	ADD COLUMN score INT NOT NULL DEFAULT 0,
+	ADD COLUMN upvotes INT NOT NULL DEFAULT 0,
+	ADD COLUMN downvotes INT NOT NULL DEFAULT 0,
+	ADD COLUMN comment_count INT NOT NULL DEFAULT 0;
+
+UPDATE threads t
+SET upvotes = (SELECT COUNT(*) FROM votes v WHERE v.thread_id = t.id AND v.vote = 1),
+	downvotes = (SELECT COUNT(*) FROM votes v WHERE v.thread_id = t.id AND v.vote = -1),
+	comment_count = (SELECT COUNT(*) FROM comments c WHERE c.thread_id = t.id AND c.deleted_at IS NULL);
+UPDATE threads SET score = upvotes - downvotes;
+
+CREATE INDEX threads_score_idx ON threads (score DESC, created_at DESC);
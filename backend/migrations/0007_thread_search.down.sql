@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS threads_search_vector_idx;
+
+DROP TRIGGER IF EXISTS thread_tags_search_vector_update ON thread_tags;
+DROP TRIGGER IF EXISTS threads_search_vector_update ON threads;
+DROP FUNCTION IF EXISTS thread_tags_search_vector_trigger();
+DROP FUNCTION IF EXISTS threads_search_vector_trigger();
+DROP FUNCTION IF EXISTS thread_search_vector(INT, TEXT, TEXT);
+
+ALTER TABLE threads DROP COLUMN search_vector;
@@ -0,0 +1,49 @@
+-- Full-text search over threads, weighting the title above tags above the content
+ALTER TABLE threads ADD COLUMN search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION thread_search_vector(p_thread_id INT, p_title TEXT, p_content TEXT) RETURNS tsvector AS $$
+	SELECT setweight(to_tsvector('english', COALESCE(p_title, '')), 'A')
+		|| setweight(to_tsvector('english', COALESCE((
+			SELECT string_agg(tg.name::text, ' ')
+			FROM thread_tags tt
+			INNER JOIN tags tg ON tt.tag_id = tg.id
+			WHERE tt.thread_id = p_thread_id
+		), '')), 'B')
+		|| setweight(to_tsvector('english', COALESCE(p_content, '')), 'C')
+$$ LANGUAGE SQL STABLE;
+
+-- Recompute the vector when the title or content changes
+CREATE OR REPLACE FUNCTION threads_search_vector_trigger() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector := thread_search_vector(NEW.id, NEW.title, NEW.content);
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER threads_search_vector_update
+	BEFORE INSERT OR UPDATE OF title, content ON threads
+	FOR EACH ROW EXECUTE FUNCTION threads_search_vector_trigger();
+
+-- Recompute the vector when tags are attached or removed
+CREATE OR REPLACE FUNCTION thread_tags_search_vector_trigger() RETURNS trigger AS $$
+DECLARE
+	changed_thread_id INT;
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		changed_thread_id := OLD.thread_id;
+	ELSE
+		changed_thread_id := NEW.thread_id;
+	END IF;
+
+	UPDATE threads SET search_vector = thread_search_vector(id, title, content) WHERE id = changed_thread_id;
+	RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER thread_tags_search_vector_update
+	AFTER INSERT OR DELETE ON thread_tags
+	FOR EACH ROW EXECUTE FUNCTION thread_tags_search_vector_trigger();
+
+UPDATE threads SET search_vector = thread_search_vector(id, title, content);
+
+CREATE INDEX threads_search_vector_idx ON threads USING GIN (search_vector);
@@ -0,0 +1,26 @@
+-- In-app notifications, actor_id is the user whose action caused the notification.
+-- Notifications outlive the thread or comment they link to.
+CREATE TABLE IF NOT EXISTS notifications (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	actor_id INT REFERENCES users(id) ON DELETE SET NULL,
+	type VARCHAR(32) NOT NULL,
+	thread_id INT REFERENCES threads(id) ON DELETE SET NULL,
+	comment_id INT REFERENCES comments(id) ON DELETE SET NULL,
+	message TEXT NOT NULL,
+	dedupe_key VARCHAR(255), -- events with a key notify each user at most once
+	read_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, created_at DESC);
+CREATE INDEX notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
+CREATE UNIQUE INDEX notifications_dedupe_key_idx ON notifications (user_id, dedupe_key) WHERE dedupe_key IS NOT NULL;
+
+-- Notification types a user turned off, types without a row are enabled
+CREATE TABLE IF NOT EXISTS notification_preferences (
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	type VARCHAR(32) NOT NULL,
+	enabled BOOLEAN NOT NULL,
+	PRIMARY KEY (user_id, type)
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS reports;
+DROP TABLE IF EXISTS report_cases;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS hidden_at;
+ALTER TABLE threads DROP COLUMN IF EXISTS hidden_at;
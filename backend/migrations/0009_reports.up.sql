@@ -0,0 +1,39 @@
+-- Content hidden after enough users reported it, until a moderator reviews it
+ALTER TABLE threads ADD COLUMN hidden_at TIMESTAMPTZ;
+ALTER TABLE comments ADD COLUMN hidden_at TIMESTAMPTZ;
+
+-- A report case collects the reports on one thread or comment until a moderator
+-- resolves it. The target is kept by type and ID, with a copy of its author,
+-- category and content, so that cases outlive removed content.
+CREATE TABLE IF NOT EXISTS report_cases (
+	id SERIAL PRIMARY KEY,
+	target_type VARCHAR(16) NOT NULL CHECK (target_type IN ('thread', 'comment')),
+	target_id INT NOT NULL,
+	thread_id INT REFERENCES threads(id) ON DELETE SET NULL,
+	comment_id INT REFERENCES comments(id) ON DELETE SET NULL,
+	category_id INT REFERENCES categories(id) ON DELETE SET NULL,
+	author_id INT REFERENCES users(id) ON DELETE SET NULL,
+	excerpt TEXT NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved')),
+	claimed_by INT REFERENCES users(id) ON DELETE SET NULL,
+	claimed_at TIMESTAMPTZ,
+	resolution VARCHAR(16) CHECK (resolution IN ('dismiss', 'remove', 'warn')),
+	resolved_by INT REFERENCES users(id) ON DELETE SET NULL,
+	resolved_at TIMESTAMPTZ,
+	note TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX report_cases_open_target_idx ON report_cases (target_type, target_id) WHERE status = 'open';
+CREATE INDEX report_cases_status_idx ON report_cases (status, created_at);
+
+-- Each user reports a case at most once
+CREATE TABLE IF NOT EXISTS reports (
+	id SERIAL PRIMARY KEY,
+	case_id INT NOT NULL REFERENCES report_cases(id) ON DELETE CASCADE,
+	reporter_id INT REFERENCES users(id) ON DELETE SET NULL,
+	reason VARCHAR(32) NOT NULL,
+	details TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (case_id, reporter_id)
+);
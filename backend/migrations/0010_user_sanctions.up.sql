@@ -0,0 +1,21 @@
+-- Suspensions and bans stop a user from posting, voting and saving threads,
+-- site-wide or in one category. Shadowbans are site-wide and leave the user
+-- able to post, but hide their content from everyone else. A sanction lasts
+-- until it expires, never for a NULL expires_at, or until it is revoked.
+CREATE TABLE IF NOT EXISTS user_sanctions (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	type VARCHAR(16) NOT NULL CHECK (type IN ('suspension', 'ban', 'shadowban')),
+	category_id INT REFERENCES categories(id) ON DELETE CASCADE,
+	reason TEXT NOT NULL,
+	issued_by INT REFERENCES users(id) ON DELETE SET NULL,
+	expires_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	revoked_by INT REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	CHECK (type <> 'suspension' OR expires_at IS NOT NULL),
+	CHECK (type <> 'ban' OR expires_at IS NULL),
+	CHECK (type <> 'shadowban' OR category_id IS NULL)
+);
+
+CREATE INDEX user_sanctions_active_idx ON user_sanctions (user_id, type) WHERE revoked_at IS NULL;
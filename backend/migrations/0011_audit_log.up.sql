@@ -0,0 +1,34 @@
+-- Append-only record of privileged and destructive actions. The actor and the
+-- target are kept by name and ID rather than by foreign key, so that entries
+-- outlive the accounts and content they describe and are never rewritten.
+CREATE TABLE IF NOT EXISTS audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	actor_id INT,
+	actor VARCHAR(255) NOT NULL,
+	action VARCHAR(64) NOT NULL,
+	target_type VARCHAR(32) NOT NULL,
+	target_id INT NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	before JSONB,
+	after JSONB,
+	ip VARCHAR(64) NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at DESC, id DESC);
+CREATE INDEX audit_log_target_idx ON audit_log (target_type, target_id);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor_id);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only_trigger() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+	BEFORE UPDATE OR DELETE ON audit_log
+	FOR EACH ROW EXECUTE FUNCTION audit_log_append_only_trigger();
+
+CREATE TRIGGER audit_log_no_truncate
+	BEFORE TRUNCATE ON audit_log
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only_trigger();
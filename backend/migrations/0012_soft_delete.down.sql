@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS comments_deleted_at_idx;
+DROP INDEX IF EXISTS threads_deleted_at_idx;
+
+-- Threads in the trash cannot be told apart from live ones without the column
+DELETE FROM threads WHERE deleted_at IS NOT NULL;
+ALTER TABLE comments DROP COLUMN deleted_by;
+ALTER TABLE threads DROP COLUMN deleted_by;
+ALTER TABLE threads DROP COLUMN deleted_at;
@@ -0,0 +1,10 @@
+-- Deleted threads and comments stay in the trash for the retention window, in
+-- which their owner or a moderator can restore them, before the purge job
+-- removes them for good. deleted_by tells whether the owner deleted their own
+-- content, which they may restore, or a moderator removed it.
+ALTER TABLE threads ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE threads ADD COLUMN deleted_by INT REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE comments ADD COLUMN deleted_by INT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX threads_deleted_at_idx ON threads (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX comments_deleted_at_idx ON comments (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE comments DROP COLUMN edited_at;
+ALTER TABLE threads DROP COLUMN edited_at;
+
+DROP TABLE IF EXISTS comment_revisions;
+DROP TABLE IF EXISTS thread_revisions;
@@ -0,0 +1,39 @@
+-- Every version of a thread or comment, the original included as revision 1,
+-- so that edits can be compared and reverted. edited_at is set by the first
+-- edit after posting.
+CREATE TABLE IF NOT EXISTS thread_revisions (
+	id SERIAL PRIMARY KEY,
+	thread_id INT NOT NULL REFERENCES threads(id) ON DELETE CASCADE,
+	revision INT NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	content TEXT NOT NULL,
+	category_id INT NOT NULL REFERENCES categories(id),
+	tags TEXT[] NOT NULL DEFAULT '{}',
+	edited_by INT REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (thread_id, revision)
+);
+
+CREATE TABLE IF NOT EXISTS comment_revisions (
+	id SERIAL PRIMARY KEY,
+	comment_id INT NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+	revision INT NOT NULL,
+	content TEXT NOT NULL,
+	edited_by INT REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (comment_id, revision)
+);
+
+ALTER TABLE threads ADD COLUMN edited_at TIMESTAMPTZ;
+ALTER TABLE comments ADD COLUMN edited_at TIMESTAMPTZ;
+
+-- What was posted before this migration is the first revision
+INSERT INTO thread_revisions (thread_id, revision, title, content, category_id, tags, edited_by, created_at)
+SELECT t.id, 1, t.title, t.content, t.category_id,
+	ARRAY(SELECT tg.name::TEXT FROM thread_tags tt INNER JOIN tags tg ON tt.tag_id = tg.id WHERE tt.thread_id = t.id),
+	t.user_id, t.created_at
+FROM threads t;
+
+INSERT INTO comment_revisions (comment_id, revision, content, edited_by, created_at)
+SELECT c.id, 1, c.content, c.user_id, c.created_at
+FROM comments c;
@@ -0,0 +1,15 @@
+-- Copies of everything a user posted, generated in the background and kept as
+-- a ZIP archive until their download link expires
+CREATE TABLE IF NOT EXISTS data_exports (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+	archive BYTEA,
+	error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMPTZ,
+	expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id, created_at DESC);
+CREATE INDEX data_exports_expires_at_idx ON data_exports (expires_at) WHERE archive IS NOT NULL;
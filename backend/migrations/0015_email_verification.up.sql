@@ -0,0 +1,18 @@
+-- When users proved they own their email address, accounts that predate
+-- verification are trusted as verified
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+UPDATE users SET email_verified_at = COALESCE(created_at, NOW());
+
+-- Single-use tokens of the links emailed to users, stored as SHA-256 digests
+-- like refresh tokens. A token only works for the address it was sent to.
+CREATE TABLE IF NOT EXISTS user_tokens (
+	token_hash CHAR(64) PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	purpose VARCHAR(32) NOT NULL CHECK (purpose IN ('verify_email', 'reset_password')),
+	email VARCHAR(100) NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ
+);
+
+CREATE INDEX user_tokens_user_id_idx ON user_tokens (user_id, purpose) WHERE used_at IS NULL;
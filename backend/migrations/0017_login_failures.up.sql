@@ -0,0 +1,13 @@
+-- Recent failed logins per attempted username and per client IP, which slow
+-- down and then lock out password guessing. Usernames are tracked whether or
+-- not the account exists, so that lockouts do not reveal which ones do.
+CREATE TABLE IF NOT EXISTS login_failures (
+	scope VARCHAR(16) NOT NULL CHECK (scope IN ('account', 'ip')),
+	subject VARCHAR(64) NOT NULL,
+	failures INT NOT NULL,
+	last_failure_at TIMESTAMPTZ NOT NULL,
+	locked_until TIMESTAMPTZ,
+	PRIMARY KEY (scope, subject)
+);
+
+CREATE INDEX login_failures_last_failure_at_idx ON login_failures (last_failure_at);
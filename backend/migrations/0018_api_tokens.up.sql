@@ -0,0 +1,14 @@
+-- Personal API tokens that bots and scripts send instead of a login JWT. Only
+-- the hash of a token is kept, and its scopes limit what it may be used for.
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(64) NOT NULL,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	scopes TEXT[] NOT NULL CHECK (scopes <@ ARRAY['read', 'post', 'vote', 'moderate']::TEXT[]),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX api_tokens_user_id_idx ON api_tokens (user_id);
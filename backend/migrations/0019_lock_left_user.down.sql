@@ -0,0 +1,2 @@
+-- The seeded password of the reserved "left" user is not restored
+SELECT 1;
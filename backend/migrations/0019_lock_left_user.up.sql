@@ -0,0 +1,3 @@
+-- Nobody may log in as the reserved "left" user, which only holds the content
+-- of deleted accounts. '!' matches no password.
+UPDATE users SET password = '!' WHERE id = 1 AND username = 'left';
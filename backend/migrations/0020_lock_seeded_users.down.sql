@@ -0,0 +1,2 @@
+-- The published passwords and the admin role are not restored
+SELECT 1;
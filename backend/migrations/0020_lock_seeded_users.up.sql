@@ -0,0 +1,5 @@
+-- The reserved "admin" and "guest" users were seeded with passwords published
+-- in this repository. '!' matches no password, and the admin role given by
+-- 0003 goes too: the first admin is promoted with the promote-admin command.
+UPDATE users SET password = '!' WHERE (id, username) IN ((2, 'admin'), (3, 'guest'));
+UPDATE users SET role = 'user' WHERE id = 2 AND username = 'admin';
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TokenScope is what a personal API token may be used for
+type TokenScope string
+
+const (
+	ScopeRead     TokenScope = "read"     // read threads, comments and notifications
+	ScopePost     TokenScope = "post"     // post, edit, delete and report threads and comments
+	ScopeVote     TokenScope = "vote"     // vote on threads and comments
+	ScopeModerate TokenScope = "moderate" // use the role and moderated categories of the user
+)
+
+// Valid reports whether s is a known scope
+func (s TokenScope) Valid() bool {
+	switch s {
+	case ScopeRead, ScopePost, ScopeVote, ScopeModerate:
+		return true
+	}
+	return false
+}
+
+// HasScope reports whether scopes include scope
+func HasScope(scopes []TokenScope, scope TokenScope) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenPrefix starts every personal API token, which tells them apart from
+// login JWTs and lets secret scanners find leaked ones
+const APITokenPrefix = "sfp_"
+
+// MaxAPITokens is how many personal API tokens a user may have at once
+const MaxAPITokens = 20
+
+// APIToken is a personal API token, without its secret
+type APIToken struct {
+	ID         int          `json:"id"`
+	Name       string       `json:"name"`
+	Scopes     []TokenScope `json:"scopes"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	LastUsedAt *time.Time   `json:"last_used_at"`
+}
+
+// scanAPIToken scans the columns of an api_tokens row
+func scanAPIToken(row rowScanner) (*APIToken, error) {
+	var token APIToken
+	var scopes []string
+	err := row.Scan(&token.ID, &token.Name, pq.Array(&scopes), &token.CreatedAt, &token.ExpiresAt, &token.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	token.Scopes = toScopes(scopes)
+	return &token, nil
+}
+
+// toScopes converts the scopes scanned with pq.Array
+func toScopes(strs []string) []TokenScope {
+	scopes := make([]TokenScope, len(strs))
+	for i, str := range strs {
+		scopes[i] = TokenScope(str)
+	}
+	return scopes
+}
+
+// scopeStrings converts scopes for pq.Array
+func scopeStrings(scopes []TokenScope) []string {
+	strs := make([]string, len(scopes))
+	for i, scope := range scopes {
+		strs[i] = string(scope)
+	}
+	return strs
+}
+
+// CreateAPIToken stores a personal API token of a user by the hash of its secret
+func CreateAPIToken(db *sql.DB, username, name string, scopes []TokenScope, expiresAt time.Time, tokenHash string) (*APIToken, error) {
+	token, err := scanAPIToken(db.QueryRow(`
+		INSERT INTO api_tokens (user_id, name, token_hash, scopes, expires_at)
+		SELECT id, $2, $3, $4, $5 FROM users WHERE username = $1
+		RETURNING id, name, scopes, created_at, expires_at, last_used_at
+	`, username, name, tokenHash, pq.Array(scopeStrings(scopes)), expiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("error creating API token: %v", err)
+	}
+	return token, nil
+}
+
+// GetAPITokens lists the personal API tokens of a user, newest first, expired
+// ones included
+func GetAPITokens(db *sql.DB, username string) ([]APIToken, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.name, t.scopes, t.created_at, t.expires_at, t.last_used_at
+		FROM api_tokens t
+		INNER JOIN users u ON t.user_id = u.id
+		WHERE u.username = $1
+		ORDER BY t.created_at DESC, t.id DESC
+	`, username)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving API tokens: %v", err)
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning API token: %v", err)
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+// UseAPIToken records that a personal API token was used and returns the
+// username it belongs to with its scopes. It returns sql.ErrNoRows if the
+// token is unknown, was revoked or expired.
+func UseAPIToken(db *sql.DB, tokenHash string) (string, []TokenScope, error) {
+	var username string
+	var scopes []string
+	err := db.QueryRow(`
+		UPDATE api_tokens t
+		SET last_used_at = NOW()
+		FROM users u
+		WHERE t.user_id = u.id AND t.token_hash = $1 AND t.expires_at > NOW()
+		RETURNING u.username, t.scopes
+	`, tokenHash).Scan(&username, pq.Array(&scopes))
+	if err != nil {
+		return "", nil, err
+	}
+	return username, toScopes(scopes), nil
+}
+
+// DeleteAPIToken revokes a personal API token of a user, returning
+// sql.ErrNoRows if they have no token with that ID
+func DeleteAPIToken(db *sql.DB, username string, tokenID int) error {
+	result, err := db.Exec(`
+		DELETE FROM api_tokens t
+		USING users u
+		WHERE t.user_id = u.id AND u.username = $1 AND t.id = $2
+	`, username, tokenID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteUserAPITokens revokes every personal API token of a user
+func DeleteUserAPITokens(db *sql.DB, username string) error {
+	_, err := db.Exec(`
+		DELETE FROM api_tokens t
+		USING users u
+		WHERE t.user_id = u.id AND u.username = $1
+	`, username)
+	return err
+}
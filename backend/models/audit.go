@@ -0,0 +1,122 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditThreadEdit      AuditAction = "thread.edit" // by a moderator
+	AuditThreadDelete    AuditAction = "thread.delete"
+	AuditThreadRestore   AuditAction = "thread.restore"
+	AuditThreadRevert    AuditAction = "thread.revert"
+	AuditCommentEdit     AuditAction = "comment.edit" // by a moderator
+	AuditCommentDelete   AuditAction = "comment.delete"
+	AuditCommentRestore  AuditAction = "comment.restore"
+	AuditCommentRevert   AuditAction = "comment.revert"
+	AuditReportResolve   AuditAction = "report.resolve"
+	AuditSanctionCreate  AuditAction = "sanction.create"
+	AuditSanctionRevoke  AuditAction = "sanction.revoke"
+	AuditRoleChange      AuditAction = "user.role"
+	AuditUserDelete      AuditAction = "user.delete"
+	AuditUserUnlock      AuditAction = "user.unlock"
+	AuditModeratorAdd    AuditAction = "category.moderator_add"
+	AuditModeratorRemove AuditAction = "category.moderator_remove"
+)
+
+const (
+	AuditTargetThread   = "thread"
+	AuditTargetComment  = "comment"
+	AuditTargetReport   = "report"
+	AuditTargetSanction = "sanction"
+	AuditTargetUser     = "user"
+)
+
+// AuditEntry records one privileged or destructive action. Before and After
+// snapshot the target as JSON, null when it did not exist before or after.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	Actor      string          `json:"actor"` // the actor's name when they acted
+	Action     AuditAction     `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   int             `json:"target_id"`
+	Reason     string          `json:"reason"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	IP         string          `json:"ip"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditFilter selects audit entries, zero values match everything
+type AuditFilter struct {
+	Actor      string // matches the name at the time or the actor's current name
+	Action     AuditAction
+	TargetType string
+	TargetID   int
+	Since      *time.Time
+	Until      *time.Time
+}
+
+// nullJSON turns an empty snapshot into SQL NULL
+func nullJSON(snapshot json.RawMessage) interface{} {
+	if len(snapshot) == 0 {
+		return nil
+	}
+	return []byte(snapshot)
+}
+
+// CreateAuditEntry appends an entry to the audit log
+func CreateAuditEntry(db *sql.DB, entry *AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (actor_id, actor, action, target_type, target_id, reason, before, after, ip)
+		VALUES ((SELECT id FROM users WHERE username = $1), $1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+	err := db.QueryRow(query, entry.Actor, entry.Action, entry.TargetType, entry.TargetID, entry.Reason,
+		nullJSON(entry.Before), nullJSON(entry.After), entry.IP).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating audit entry: %v", err)
+	}
+	return nil
+}
+
+// GetAuditEntries lists the audit entries matching filter, newest first
+func GetAuditEntries(db *sql.DB, filter AuditFilter, page, limit int) ([]AuditEntry, error) {
+	query := `
+		SELECT a.id, a.actor, a.action, a.target_type, a.target_id, a.reason, a.before, a.after, a.ip, a.created_at
+		FROM audit_log a
+		WHERE ($1 = '' OR a.actor = $1 OR a.actor_id = (SELECT id FROM users WHERE username = $1))
+			AND ($2 = '' OR a.action = $2)
+			AND ($3 = '' OR a.target_type = $3)
+			AND ($4 = 0 OR a.target_id = $4)
+			AND ($5::timestamptz IS NULL OR a.created_at >= $5)
+			AND ($6::timestamptz IS NULL OR a.created_at < $6)
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT $7 OFFSET $8
+	`
+	rows, err := db.Query(query, filter.Actor, filter.Action, filter.TargetType, filter.TargetID,
+		filter.Since, filter.Until, limit, (page-1)*limit)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving audit entries: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after []byte
+		err := rows.Scan(&entry.ID, &entry.Actor, &entry.Action, &entry.TargetType, &entry.TargetID,
+			&entry.Reason, &before, &after, &entry.IP, &entry.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning audit entry: %v", err)
+		}
+		entry.Before = before
+		entry.After = after
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -2,22 +2,93 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
 )
 
 type Comment struct {
-	ID        int       `json:"id"`
-	ThreadID  int       `json:"thread_id"`
-	Username  string    `json:"username"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	ID             int        `json:"id"`
+	ThreadID       int        `json:"thread_id"`
+	ParentID       *int       `json:"parent_id"`
+	Username       string     `json:"username"`
+	Content        string     `json:"content"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Deleted        bool       `json:"deleted"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy      string     `json:"-"`
+	Hidden         bool       `json:"hidden"` // reported by several users and waiting for a moderator
+	EditedAt       *time.Time `json:"edited_at"`
+	RevisionCount  int        `json:"revision_count"` // the original counts as the first revision
+	Score          int        `json:"score"`
+	UserVote       int        `json:"user_vote"` // the viewer's vote, 1, -1 or 0 for none
+	Depth          int        `json:"depth"`
+	ReplyCount     int        `json:"reply_count"`
+	HasMoreReplies bool       `json:"has_more_replies"`
+	Replies        []*Comment `json:"replies,omitempty"`
 }
 
-// CreateComment inserts a new comment into the database
+// DeletedPlaceholder replaces the author and content of deleted comments that still have replies
+const DeletedPlaceholder = "[deleted]"
+
+// HiddenPlaceholder replaces the author and content of hidden comments for readers who may not review them
+const HiddenPlaceholder = "[hidden]"
+
+// Redact hides the author and content of a deleted comment
+func (c *Comment) Redact() {
+	if c.Deleted {
+		c.Username = DeletedPlaceholder
+		c.Content = DeletedPlaceholder
+	}
+}
+
+// RedactHidden hides the author and content of a hidden comment
+func (c *Comment) RedactHidden() {
+	if c.Hidden && !c.Deleted {
+		c.Username = HiddenPlaceholder
+		c.Content = HiddenPlaceholder
+	}
+}
+
+// PruneComments removes deleted comments and those whose ID is in shadowbanned
+// from a thread's comments, which are ordered oldest first. Comments that still
+// have visible replies are kept as deleted placeholders instead, so that the
+// tree under them stays intact.
+func PruneComments(comments []Comment, shadowbanned map[int]bool) []Comment {
+	// Replies come after their parent, so walking backwards settles every
+	// reply before the comment it answers
+	hasReplies := map[int]bool{}
+	keep := make([]bool, len(comments))
+	for i := len(comments) - 1; i >= 0; i-- {
+		comment := &comments[i]
+		if comment.Deleted || shadowbanned[comment.ID] {
+			if !hasReplies[comment.ID] {
+				continue
+			}
+			comment.Deleted = true
+			comment.Score = 0
+			comment.UserVote = 0
+			comment.Redact()
+		}
+		keep[i] = true
+		if comment.ParentID != nil {
+			hasReplies[*comment.ParentID] = true
+		}
+	}
+
+	visible := comments[:0]
+	for i, comment := range comments {
+		if keep[i] {
+			visible = append(visible, comment)
+		}
+	}
+	return visible
+}
+
+// CreateComment inserts a new comment into the database and counts it on its thread
 func CreateComment(db *sql.DB, comment *Comment) (*Comment, error) {
 	query := `
-		INSERT INTO comments (thread_id, user_id, content)
-		VALUES ($1, $2, $3)
+		INSERT INTO comments (thread_id, parent_id, user_id, content)
+		VALUES ($1, $2, $3, $4)
 		RETURNING id, created_at
 	`
 	userID, err := GetUserIDByUsername(comment.Username, db)
@@ -25,62 +96,234 @@ func CreateComment(db *sql.DB, comment *Comment) (*Comment, error) {
 		return nil, err
 	}
 
-	err = db.QueryRow(query, comment.ThreadID, userID, comment.Content).Scan(&comment.ID, &comment.CreatedAt)
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := adjustCommentCount(tx, comment.ThreadID, 1); err != nil {
+		return nil, err
+	}
+	err = tx.QueryRow(query, comment.ThreadID, comment.ParentID, userID, comment.Content).Scan(&comment.ID, &comment.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
+	if err := recordCommentRevision(tx, comment.ID, comment.Username); err != nil {
+		return nil, err
+	}
+	comment.RevisionCount = 1
 
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return comment, nil
 }
 
-// GetCommentsByThreadID retrieves all comments for a given thread
-func GetCommentsByThreadID(db *sql.DB, threadID int) ([]Comment, error) {
-	query := `
-		SELECT c.id, c.thread_id, u.username, c.content, c.created_at
+// GetCommentsByThreadID retrieves all comments for a given thread in ascending order
+// with their scores and the vote of viewer, who may be empty for anonymous requests.
+// Deleted comments are left out or redacted when they are kept for their replies,
+// and comments of shadowbanned users are left out unless viewer wrote them. The
+// comments of deleted threads are not listed.
+func GetCommentsByThreadID(db *sql.DB, threadID int, viewer string) ([]Comment, error) {
+	query := fmt.Sprintf(`
+		SELECT c.id, c.thread_id, c.parent_id, u.username, c.content, c.created_at, c.deleted_at IS NOT NULL, c.deleted_at, c.hidden_at IS NOT NULL,
+			(SELECT COALESCE(SUM(cv.vote), 0) FROM comment_votes cv WHERE cv.comment_id = c.id),
+			COALESCE((
+				SELECT cv.vote
+				FROM comment_votes cv
+				INNER JOIN users vu ON cv.user_id = vu.id
+				WHERE cv.comment_id = c.id AND vu.username = $2
+			), 0),
+			u.username <> $2 AND %s,
+			c.edited_at, (SELECT COUNT(*) FROM comment_revisions r WHERE r.comment_id = c.id)
 		FROM comments c
 		INNER JOIN users u ON c.user_id = u.id
-		WHERE c.thread_id = $1
-		ORDER BY c.created_at ASC
-	`
+		INNER JOIN threads t ON c.thread_id = t.id
+		WHERE c.thread_id = $1 AND t.deleted_at IS NULL
+		ORDER BY c.created_at ASC, c.id ASC
+	`, fmt.Sprintf(shadowbannedSQL, "c.user_id"))
 
-	rows, err := db.Query(query, threadID)
+	rows, err := db.Query(query, threadID, viewer)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	var comments []Comment
+	shadowbanned := map[int]bool{}
 	for rows.Next() {
 		var comment Comment
-		if err := rows.Scan(&comment.ID, &comment.ThreadID, &comment.Username, &comment.Content, &comment.CreatedAt); err != nil {
+		var parentID sql.NullInt64
+		var hide bool
+		if err := rows.Scan(&comment.ID, &comment.ThreadID, &parentID, &comment.Username, &comment.Content, &comment.CreatedAt, &comment.Deleted, &comment.DeletedAt, &comment.Hidden, &comment.Score, &comment.UserVote, &hide,
+			&comment.EditedAt, &comment.RevisionCount); err != nil {
 			return nil, err
 		}
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			comment.ParentID = &id
+		}
+		if hide {
+			shadowbanned[comment.ID] = true
+		}
+		comment.Redact()
 		comments = append(comments, comment)
 	}
 
-	return comments, nil
+	return PruneComments(comments, shadowbanned), nil
+}
+
+// GetCommentByID retrieves a single comment, redacted if it was deleted
+func GetCommentByID(db *sql.DB, commentID int) (*Comment, error) {
+	query := `
+		SELECT c.id, c.thread_id, c.parent_id, u.username, c.content, c.created_at, c.deleted_at IS NOT NULL, c.deleted_at,
+			COALESCE(du.username, ''), c.hidden_at IS NOT NULL,
+			c.edited_at, (SELECT COUNT(*) FROM comment_revisions r WHERE r.comment_id = c.id)
+		FROM comments c
+		INNER JOIN users u ON c.user_id = u.id
+		LEFT JOIN users du ON c.deleted_by = du.id
+		WHERE c.id = $1
+	`
+
+	var comment Comment
+	var parentID sql.NullInt64
+	err := db.QueryRow(query, commentID).Scan(&comment.ID, &comment.ThreadID, &parentID, &comment.Username, &comment.Content, &comment.CreatedAt,
+		&comment.Deleted, &comment.DeletedAt, &comment.DeletedBy, &comment.Hidden, &comment.EditedAt, &comment.RevisionCount)
+	if err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		comment.ParentID = &id
+	}
+	comment.Redact()
+
+	return &comment, nil
 }
 
-// EditComment updates the content of an existing comment
-func EditComment(db *sql.DB, commentID int, newContent string) error {
+// EditComment updates the content of an existing comment and records it as a
+// new revision by editedBy
+func EditComment(db *sql.DB, commentID int, newContent string, editedBy string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		UPDATE comments
 		SET content = $1
 		WHERE id = $2
 	`
-	_, err := db.Exec(query, newContent, commentID)
+	if _, err := tx.Exec(query, newContent, commentID); err != nil {
+		return err
+	}
+	if err := recordCommentRevision(tx, commentID, editedBy); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteComment moves a comment to the trash. It stays in its thread as a
+// placeholder while it has replies and no longer counts towards the thread's
+// comment count.
+func DeleteComment(db *sql.DB, commentID int, deletedBy string) error {
+	return setCommentDeleted(db, commentID, true, deletedBy)
+}
+
+// RestoreComment takes a comment out of the trash, or returns sql.ErrNoRows if
+// it is not in the trash
+func RestoreComment(db *sql.DB, commentID int) error {
+	return setCommentDeleted(db, commentID, false, "")
+}
+
+// setCommentDeleted moves a comment in or out of the trash and adjusts its
+// thread's comment count, returning sql.ErrNoRows if it already was there
+func setCommentDeleted(db *sql.DB, commentID int, deleted bool, deletedBy string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the thread before the comment, in the order of every other writer.
+	// Comments never move between threads, so the unlocked read is safe.
+	var threadID int
+	if err := tx.QueryRow(`SELECT thread_id FROM comments WHERE id = $1`, commentID).Scan(&threadID); err != nil {
+		return err
+	}
+	if err := lockThread(tx, threadID); err != nil {
+		return err
+	}
+	if err := setCommentDeletedTx(tx, commentID, threadID, deleted, deletedBy); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setCommentDeletedTx is setCommentDeleted within a transaction that holds the
+// lock of the comment's thread
+func setCommentDeletedTx(tx *sql.Tx, commentID, threadID int, deleted bool, deletedBy string) error {
+	var wasDeleted bool
+	err := tx.QueryRow(`SELECT deleted_at IS NOT NULL FROM comments WHERE id = $1 FOR UPDATE`, commentID).Scan(&wasDeleted)
+	if err != nil {
+		return err
+	}
+	if wasDeleted == deleted {
+		return sql.ErrNoRows
+	}
+
+	delta := 1
+	query := `UPDATE comments SET deleted_at = NULL, deleted_by = NULL WHERE id = $1`
+	args := []interface{}{commentID}
+	if deleted {
+		delta = -1
+		query = `UPDATE comments SET deleted_at = NOW(), deleted_by = (SELECT id FROM users WHERE username = $2) WHERE id = $1`
+		args = append(args, deletedBy)
+	}
+	if err := adjustCommentCount(tx, threadID, delta); err != nil {
+		return err
+	}
+	_, err = tx.Exec(query, args...)
 	return err
 }
 
-// DeleteComment deletes a comment by its ID and ensures the user is the owner
-func DeleteComment(db *sql.DB, commentID int) error {
+// GetDeletedComments lists the comments a user deleted themselves since the
+// given time in threads that are not deleted, most recently deleted first
+func GetDeletedComments(db *sql.DB, username string, since time.Time) ([]Comment, error) {
 	query := `
-		DELETE FROM comments
-		WHERE id = $1
+		SELECT c.id, c.thread_id, c.parent_id, u.username, c.content, c.created_at, c.deleted_at
+		FROM comments c
+		INNER JOIN users u ON c.user_id = u.id
+		INNER JOIN threads t ON c.thread_id = t.id
+		WHERE u.username = $1 AND c.deleted_by = c.user_id AND c.deleted_at >= $2 AND t.deleted_at IS NULL
+		ORDER BY c.deleted_at DESC, c.id DESC
 	`
+	rows, err := db.Query(query, username, since)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving deleted comments: %v", err)
+	}
+	defer rows.Close()
 
-	_, err := db.Exec(query, commentID)
-	return err
+	comments := []Comment{}
+	for rows.Next() {
+		var comment Comment
+		var parentID sql.NullInt64
+		if err := rows.Scan(&comment.ID, &comment.ThreadID, &parentID, &comment.Username, &comment.Content, &comment.CreatedAt, &comment.DeletedAt); err != nil {
+			return nil, fmt.Errorf("error scanning deleted comment: %v", err)
+		}
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			comment.ParentID = &id
+		}
+		comment.Deleted = true
+		comment.DeletedBy = username
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
 }
 
 func GetCommentOwnerUsername(db *sql.DB, commentID int) (string, error) {
@@ -99,3 +342,38 @@ func GetCommentOwnerUsername(db *sql.DB, commentID int) (string, error) {
 
 	return username, nil
 }
+
+// CountShadowbannedComments counts the undeleted comments on a thread that are
+// left out for viewer because their authors are shadowbanned, which the thread's
+// comment count still includes
+func CountShadowbannedComments(db *sql.DB, threadID int, viewer string) (int, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM comments c
+		INNER JOIN users u ON c.user_id = u.id
+		WHERE c.thread_id = $1 AND c.deleted_at IS NULL AND u.username <> $2 AND %s
+	`, fmt.Sprintf(shadowbannedSQL, "c.user_id"))
+
+	var count int
+	err := db.QueryRow(query, threadID, viewer).Scan(&count)
+	return count, err
+}
+
+// GetCommentCategory returns the category name of the thread a comment belongs to
+func GetCommentCategory(db *sql.DB, commentID int) (string, error) {
+	query := `
+		SELECT cat.name
+		FROM comments c
+		INNER JOIN threads t ON c.thread_id = t.id
+		INNER JOIN categories cat ON t.category_id = cat.id
+		WHERE c.id = $1
+	`
+
+	var category string
+	err := db.QueryRow(query, commentID).Scan(&category)
+	if err != nil {
+		return "", err
+	}
+
+	return category, nil
+}
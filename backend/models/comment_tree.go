@@ -0,0 +1,144 @@
+package models
+
+import "sort"
+
+// DefaultCommentDepth is how many levels of replies are returned below the requested root
+const DefaultCommentDepth = 5
+
+// MaxCommentDepth caps the depth a client may request at once
+const MaxCommentDepth = 20
+
+// BuildCommentTree nests a thread's comments under their parents. The returned
+// roots are the top-level comments when rootID is 0, or the single comment
+// rootID otherwise. Depth is counted from the top of the thread, and branches
+// more than maxDepth levels below the roots are cut off, with HasMoreReplies
+// set on the last comment kept so the client can load them separately.
+func BuildCommentTree(comments []Comment, rootID int, maxDepth int) []*Comment {
+	byID := make(map[int]*Comment, len(comments))
+	for i := range comments {
+		comment := comments[i]
+		comment.Replies = nil
+		byID[comment.ID] = &comment
+	}
+
+	// comments are in ascending order, so replies keep their chronological order
+	var roots []*Comment
+	for i := range comments {
+		comment := byID[comments[i].ID]
+		if comment.ParentID == nil {
+			if rootID == 0 {
+				roots = append(roots, comment)
+			}
+		} else if parent, ok := byID[*comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, comment)
+			parent.ReplyCount++
+		}
+		if comment.ID == rootID {
+			roots = append(roots, comment)
+		}
+	}
+
+	// Absolute depth of a subtree root is its number of ancestors
+	startDepth := 0
+	if rootID != 0 && len(roots) == 1 {
+		for parentID := roots[0].ParentID; parentID != nil; {
+			parent, ok := byID[*parentID]
+			if !ok {
+				break
+			}
+			startDepth++
+			parentID = parent.ParentID
+		}
+	}
+
+	var prune func(comment *Comment, depth, remaining int)
+	prune = func(comment *Comment, depth, remaining int) {
+		comment.Depth = depth
+		if remaining == 0 {
+			comment.HasMoreReplies = len(comment.Replies) > 0
+			comment.Replies = nil
+			return
+		}
+		for _, reply := range comment.Replies {
+			prune(reply, depth+1, remaining-1)
+		}
+	}
+	for _, root := range roots {
+		prune(root, startDepth, maxDepth)
+	}
+
+	return roots
+}
+
+// Comment sort orders, applied to the replies of every comment separately
+const (
+	CommentSortOld   = "old"   // oldest first, the default
+	CommentSortNew   = "new"   // newest first
+	CommentSortScore = "score" // highest score first, oldest first among ties
+)
+
+// ValidCommentSort reports whether order is a known comment sort order
+func ValidCommentSort(order string) bool {
+	return order == CommentSortOld || order == CommentSortNew || order == CommentSortScore
+}
+
+// SortCommentTree orders the roots and, recursively, the replies of each comment.
+// Replies are only ever reordered among their siblings.
+func SortCommentTree(roots []*Comment, order string) {
+	less := func(a, b *Comment) bool {
+		if a.CreatedAt.Equal(b.CreatedAt) {
+			return a.ID < b.ID
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	switch order {
+	case CommentSortNew:
+		less = func(a, b *Comment) bool {
+			if a.CreatedAt.Equal(b.CreatedAt) {
+				return a.ID > b.ID
+			}
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+	case CommentSortScore:
+		oldest := less
+		less = func(a, b *Comment) bool {
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+			return oldest(a, b)
+		}
+	}
+
+	var sortLevel func(comments []*Comment)
+	sortLevel = func(comments []*Comment) {
+		sort.SliceStable(comments, func(i, j int) bool {
+			return less(comments[i], comments[j])
+		})
+		for _, comment := range comments {
+			sortLevel(comment.Replies)
+		}
+	}
+	sortLevel(roots)
+}
+
+// FlattenCommentTree lists a comment tree depth-first, so clients that do not
+// handle nesting can indent each comment by its Depth
+func FlattenCommentTree(roots []*Comment) []Comment {
+	flat := []Comment{}
+
+	var walk func(comment *Comment)
+	walk = func(comment *Comment) {
+		replies := comment.Replies
+		flatComment := *comment
+		flatComment.Replies = nil
+		flat = append(flat, flatComment)
+		for _, reply := range replies {
+			walk(reply)
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+
+	return flat
+}
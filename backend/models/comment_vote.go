@@ -0,0 +1,62 @@
+package models
+
+import "database/sql"
+
+type CommentVote struct {
+	ID        int    `json:"id"`
+	CommentID int    `json:"comment_id"`
+	Username  string `json:"username"`
+	Vote      int    `json:"vote"`
+	CreatedAt string `json:"created_at"`
+}
+
+// CreateCommentVote casts a vote on a comment, replacing the user's previous vote
+func CreateCommentVote(db *sql.DB, vote *CommentVote) (*CommentVote, error) {
+	query := `
+		INSERT INTO comment_votes (user_id, comment_id, vote)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (comment_id, user_id) DO UPDATE
+		SET vote = EXCLUDED.vote
+		RETURNING id
+	`
+	userID, err := GetUserIDByUsername(vote.Username, db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRow(query, userID, vote.CommentID, vote.Vote).Scan(&vote.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return vote, nil
+}
+
+// DeleteCommentVote removes the user's vote on a comment
+func DeleteCommentVote(db *sql.DB, commentID int, username string) error {
+	query := `
+		DELETE FROM comment_votes
+		WHERE comment_id = $1 AND user_id = $2
+	`
+
+	userID, err := GetUserIDByUsername(username, db)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(query, commentID, userID)
+	return err
+}
+
+// CountCommentVote returns the net score of a comment
+func CountCommentVote(db *sql.DB, commentID int) (int, error) {
+	query := `
+		SELECT COALESCE(SUM(vote), 0)
+		FROM comment_votes
+		WHERE comment_id = $1
+	`
+
+	var score int
+	err := db.QueryRow(query, commentID).Scan(&score)
+	return score, err
+}
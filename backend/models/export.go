@@ -0,0 +1,300 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ExportStatus is the progress of a data export
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportReady   ExportStatus = "ready"
+	ExportFailed  ExportStatus = "failed"
+)
+
+// ExportTTL is how long the archive of a finished export can be downloaded
+var ExportTTL = 48 * time.Hour
+
+// DataExport is a request for a copy of a user's data, whose ZIP archive is
+// generated in the background
+type DataExport struct {
+	ID          int          `json:"id"`
+	Username    string       `json:"username"`
+	Status      ExportStatus `json:"status"`
+	Error       string       `json:"error,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CompletedAt *time.Time   `json:"completed_at"`
+	ExpiresAt   *time.Time   `json:"expires_at"`
+}
+
+// UserData is everything a user has posted, as included in their data export
+type UserData struct {
+	Profile      *User             `json:"profile"`
+	Threads      []ExportedThread  `json:"threads"`
+	Comments     []ExportedComment `json:"comments"`
+	Votes        []ExportedVote    `json:"votes"`
+	CommentVotes []ExportedVote    `json:"comment_votes"`
+	SavedThreads []SavedThread     `json:"saved_threads"`
+	Tags         []string          `json:"tags"` // the tags of the user's threads
+}
+
+// ExportedThread is a thread written by the exporting user, deleted ones included
+type ExportedThread struct {
+	ID        int        `json:"id"`
+	Title     string     `json:"title"`
+	Content   string     `json:"content"`
+	Category  string     `json:"category"`
+	Tags      []string   `json:"tags"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ExportedComment is a comment written by the exporting user
+type ExportedComment struct {
+	ID        int        `json:"id"`
+	ThreadID  int        `json:"thread_id"`
+	ParentID  *int       `json:"parent_id"`
+	Content   string     `json:"content"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ExportedVote is a vote the exporting user cast on a thread or a comment
+type ExportedVote struct {
+	ThreadID  int       `json:"thread_id,omitempty"`
+	CommentID int       `json:"comment_id,omitempty"`
+	Vote      int       `json:"vote"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SavedThread is a thread the exporting user saved
+type SavedThread struct {
+	ThreadID int       `json:"thread_id"`
+	Title    string    `json:"title"`
+	SavedAt  time.Time `json:"saved_at"`
+}
+
+const dataExportColumns = `
+	e.id, u.username, e.status, e.error, e.created_at, e.completed_at, e.expires_at
+	FROM data_exports e
+	INNER JOIN users u ON e.user_id = u.id
+`
+
+func scanDataExport(row rowScanner) (*DataExport, error) {
+	var export DataExport
+	err := row.Scan(&export.ID, &export.Username, &export.Status, &export.Error, &export.CreatedAt, &export.CompletedAt, &export.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// CreateDataExport queues a pending export of a user's data
+func CreateDataExport(db *sql.DB, username string) (*DataExport, error) {
+	var id int
+	err := db.QueryRow(`
+		INSERT INTO data_exports (user_id)
+		SELECT id FROM users WHERE username = $1
+		RETURNING id
+	`, username).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("error creating data export: %v", err)
+	}
+	return GetDataExport(db, id)
+}
+
+// GetDataExport looks up an export, returning sql.ErrNoRows if there is none
+func GetDataExport(db *sql.DB, exportID int) (*DataExport, error) {
+	return scanDataExport(db.QueryRow(`SELECT `+dataExportColumns+` WHERE e.id = $1`, exportID))
+}
+
+// GetLatestDataExport looks up the most recent export of a user, returning
+// sql.ErrNoRows if they never asked for one
+func GetLatestDataExport(db *sql.DB, username string) (*DataExport, error) {
+	return scanDataExport(db.QueryRow(`SELECT `+dataExportColumns+` WHERE u.username = $1 ORDER BY e.created_at DESC, e.id DESC LIMIT 1`, username))
+}
+
+// CompleteDataExport stores the archive of a pending export, which can be
+// downloaded until expiresAt
+func CompleteDataExport(db *sql.DB, exportID int, archive []byte, expiresAt time.Time) error {
+	_, err := db.Exec(`
+		UPDATE data_exports
+		SET status = 'ready', archive = $2, completed_at = NOW(), expires_at = $3
+		WHERE id = $1 AND status = 'pending'
+	`, exportID, archive, expiresAt)
+	return err
+}
+
+// FailDataExport marks a pending export as failed with an error message
+func FailDataExport(db *sql.DB, exportID int, message string) error {
+	_, err := db.Exec(`
+		UPDATE data_exports
+		SET status = 'failed', error = $2, completed_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+	`, exportID, message)
+	return err
+}
+
+// GetDataExportArchive returns the archive of a ready export, or sql.ErrNoRows
+// once it has been purged
+func GetDataExportArchive(db *sql.DB, exportID int) ([]byte, error) {
+	var archive []byte
+	err := db.QueryRow(`SELECT archive FROM data_exports WHERE id = $1 AND archive IS NOT NULL`, exportID).Scan(&archive)
+	if err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// PurgeDataExports drops the archives of the exports that expired before the
+// given time and returns how many were dropped
+func PurgeDataExports(db *sql.DB, before time.Time) (int64, error) {
+	result, err := db.Exec(`UPDATE data_exports SET archive = NULL WHERE expires_at < $1 AND archive IS NOT NULL`, before)
+	if err != nil {
+		return 0, fmt.Errorf("error purging data exports: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetUserData collects everything a user has posted for their data export
+func GetUserData(db *sql.DB, username string) (*UserData, error) {
+	profile, err := GetUserByUsername(db, username)
+	if err != nil {
+		return nil, err
+	}
+	data := &UserData{
+		Profile:      profile,
+		Threads:      []ExportedThread{},
+		Comments:     []ExportedComment{},
+		Votes:        []ExportedVote{},
+		CommentVotes: []ExportedVote{},
+		SavedThreads: []SavedThread{},
+		Tags:         []string{},
+	}
+
+	rows, err := db.Query(`
+		SELECT t.id, t.title, t.content, c.name, t.created_at, t.edited_at, t.deleted_at,
+			ARRAY(SELECT tg.name::TEXT FROM thread_tags tt INNER JOIN tags tg ON tt.tag_id = tg.id WHERE tt.thread_id = t.id ORDER BY tg.name)
+		FROM threads t
+		INNER JOIN categories c ON t.category_id = c.id
+		WHERE t.user_id = $1
+		ORDER BY t.created_at, t.id
+	`, profile.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving threads: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t ExportedThread
+		if err := rows.Scan(&t.ID, &t.Title, &t.Content, &t.Category, &t.CreatedAt, &t.EditedAt, &t.DeletedAt, pq.Array(&t.Tags)); err != nil {
+			return nil, fmt.Errorf("error scanning thread: %v", err)
+		}
+		data.Threads = append(data.Threads, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT id, thread_id, parent_id, content, created_at, edited_at, deleted_at
+		FROM comments
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`, profile.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving comments: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c ExportedComment
+		if err := rows.Scan(&c.ID, &c.ThreadID, &c.ParentID, &c.Content, &c.CreatedAt, &c.EditedAt, &c.DeletedAt); err != nil {
+			return nil, fmt.Errorf("error scanning comment: %v", err)
+		}
+		data.Comments = append(data.Comments, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT thread_id, vote, created_at FROM votes WHERE user_id = $1 ORDER BY created_at, id`, profile.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving votes: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v ExportedVote
+		if err := rows.Scan(&v.ThreadID, &v.Vote, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning vote: %v", err)
+		}
+		data.Votes = append(data.Votes, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT comment_id, vote, created_at FROM comment_votes WHERE user_id = $1 ORDER BY created_at, id`, profile.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving comment votes: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v ExportedVote
+		if err := rows.Scan(&v.CommentID, &v.Vote, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning comment vote: %v", err)
+		}
+		data.CommentVotes = append(data.CommentVotes, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT ut.thread_id, t.title, ut.created_at
+		FROM user_threads ut
+		INNER JOIN threads t ON ut.thread_id = t.id
+		WHERE ut.user_id = $1
+		ORDER BY ut.created_at, ut.thread_id
+	`, profile.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving saved threads: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var saved SavedThread
+		if err := rows.Scan(&saved.ThreadID, &saved.Title, &saved.SavedAt); err != nil {
+			return nil, fmt.Errorf("error scanning saved thread: %v", err)
+		}
+		data.SavedThreads = append(data.SavedThreads, saved)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT DISTINCT tg.name::TEXT
+		FROM tags tg
+		INNER JOIN thread_tags tt ON tt.tag_id = tg.id
+		INNER JOIN threads t ON tt.thread_id = t.id
+		WHERE t.user_id = $1
+		ORDER BY 1
+	`, profile.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving tags: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning tag: %v", err)
+		}
+		data.Tags = append(data.Tags, name)
+	}
+	return data, rows.Err()
+}
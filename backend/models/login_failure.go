@@ -0,0 +1,192 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LoginScope is what failed logins are counted against
+type LoginScope string
+
+const (
+	LoginScopeAccount LoginScope = "account" // the attempted username
+	LoginScopeIP      LoginScope = "ip"      // the client IP address
+)
+
+// LoginPolicy is how failed logins in a scope are slowed down. Past
+// FreeAttempts every failure locks the scope for twice as long as the one
+// before, starting at a second, up to a lockout of Lockout at MaxFailures.
+type LoginPolicy struct {
+	FreeAttempts int
+	MaxFailures  int
+	Lockout      time.Duration
+	Window       time.Duration // failures older than this are forgotten
+}
+
+// AccountLoginPolicy slows down guessing the password of one account
+var AccountLoginPolicy = LoginPolicy{FreeAttempts: 3, MaxFailures: 10, Lockout: 15 * time.Minute, Window: time.Hour}
+
+// IPLoginPolicy slows down clients guessing the passwords of many accounts
+var IPLoginPolicy = LoginPolicy{FreeAttempts: 10, MaxFailures: 50, Lockout: 15 * time.Minute, Window: time.Hour}
+
+// LoginPolicyFor returns the policy of a scope
+func LoginPolicyFor(scope LoginScope) LoginPolicy {
+	if scope == LoginScopeIP {
+		return IPLoginPolicy
+	}
+	return AccountLoginPolicy
+}
+
+// Fail returns the failure count after another failure at now, and until when
+// it locks the scope, if it does
+func (p LoginPolicy) Fail(failures int, lastFailure, now time.Time) (int, *time.Time) {
+	if now.Sub(lastFailure) > p.Window {
+		failures = 0
+	}
+	failures++
+	return failures, p.lock(failures, now)
+}
+
+// Refund returns the failure count once a failure turned out to be a success,
+// and until when the remaining failures lock the scope, if they do
+func (p LoginPolicy) Refund(failures int, lastFailure time.Time) (int, *time.Time) {
+	failures = max(failures-1, 0)
+	return failures, p.lock(failures, lastFailure)
+}
+
+// lock returns until when a failure count reached at the given time locks the
+// scope, or nil if it does not
+func (p LoginPolicy) lock(failures int, at time.Time) *time.Time {
+	var delay time.Duration
+	switch {
+	case failures >= p.MaxFailures:
+		delay = p.Lockout
+	case failures > p.FreeAttempts:
+		delay = min(time.Second<<(failures-p.FreeAttempts-1), p.Lockout)
+	default:
+		return nil
+	}
+	lockedUntil := at.Add(delay)
+	return &lockedUntil
+}
+
+// GetLoginLock returns until when logins are locked for a subject, or nil if
+// they are not
+func GetLoginLock(db *sql.DB, scope LoginScope, subject string) (*time.Time, error) {
+	var lockedUntil time.Time
+	err := db.QueryRow(`
+		SELECT locked_until FROM login_failures
+		WHERE scope = $1 AND subject = $2 AND locked_until > NOW()
+	`, scope, subject).Scan(&lockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &lockedUntil, nil
+}
+
+// ReserveLoginAttempt counts a login attempt against a subject as a failure
+// under the policy of its scope before its password is checked, so that
+// concurrent guesses cannot all slip in before the first one is counted. It
+// returns until when logins are locked for the subject without counting the
+// attempt if they are, or nil once the attempt is counted.
+func ReserveLoginAttempt(db *sql.DB, scope LoginScope, subject string) (*time.Time, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Create the row first, so that the first attempts of a subject wait for
+	// each other on its lock too
+	_, err = tx.Exec(`
+		INSERT INTO login_failures (scope, subject, failures, last_failure_at)
+		VALUES ($1, $2, 0, NOW())
+		ON CONFLICT (scope, subject) DO NOTHING
+	`, scope, subject)
+	if err != nil {
+		return nil, fmt.Errorf("error reserving login attempt: %v", err)
+	}
+	var failures int
+	var lastFailure time.Time
+	var lockedUntil *time.Time
+	err = tx.QueryRow(`
+		SELECT failures, last_failure_at, locked_until FROM login_failures
+		WHERE scope = $1 AND subject = $2
+		FOR UPDATE
+	`, scope, subject).Scan(&failures, &lastFailure, &lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if lockedUntil != nil && lockedUntil.After(now) {
+		return lockedUntil, nil
+	}
+	failures, lockedUntil = LoginPolicyFor(scope).Fail(failures, lastFailure, now)
+	_, err = tx.Exec(`
+		UPDATE login_failures SET failures = $3, last_failure_at = $4, locked_until = $5
+		WHERE scope = $1 AND subject = $2
+	`, scope, subject, failures, now, lockedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("error reserving login attempt: %v", err)
+	}
+	return nil, tx.Commit()
+}
+
+// RefundLoginAttempt takes back a login attempt reserved against a subject
+// once its password turned out to be right
+func RefundLoginAttempt(db *sql.DB, scope LoginScope, subject string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var failures int
+	var lastFailure time.Time
+	err = tx.QueryRow(`
+		SELECT failures, last_failure_at FROM login_failures
+		WHERE scope = $1 AND subject = $2
+		FOR UPDATE
+	`, scope, subject).Scan(&failures, &lastFailure)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	failures, lockedUntil := LoginPolicyFor(scope).Refund(failures, lastFailure)
+	_, err = tx.Exec(`
+		UPDATE login_failures SET failures = $3, locked_until = $4
+		WHERE scope = $1 AND subject = $2
+	`, scope, subject, failures, lockedUntil)
+	if err != nil {
+		return fmt.Errorf("error refunding login attempt: %v", err)
+	}
+	return tx.Commit()
+}
+
+// ClearLoginFailures forgets the failed logins of a subject, lifting its lock
+func ClearLoginFailures(db *sql.DB, scope LoginScope, subject string) error {
+	_, err := db.Exec(`DELETE FROM login_failures WHERE scope = $1 AND subject = $2`, scope, subject)
+	return err
+}
+
+// PurgeLoginFailures forgets the failures of subjects that last failed before
+// the given time and are not locked, and returns how many were forgotten
+func PurgeLoginFailures(db *sql.DB, before time.Time) (int64, error) {
+	result, err := db.Exec(`
+		DELETE FROM login_failures
+		WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < NOW())
+	`, before)
+	if err != nil {
+		return 0, fmt.Errorf("error purging login failures: %v", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// copyAPIToken returns a token that does not share its scopes with the store
+func copyAPIToken(t *apiToken) models.APIToken {
+	token := t.APIToken
+	token.Scopes = append([]models.TokenScope(nil), t.Scopes...)
+	return token
+}
+
+func (s *Store) CreateAPIToken(username, name string, scopes []models.TokenScope, expiresAt time.Time, tokenHash string) (*models.APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return nil, fmt.Errorf("error creating API token: %v", err)
+	}
+	for _, t := range s.apiTokens {
+		if t.tokenHash == tokenHash {
+			return nil, fmt.Errorf("error creating API token: duplicate key value violates unique constraint \"api_tokens_token_hash_key\"")
+		}
+	}
+
+	t := &apiToken{
+		APIToken: models.APIToken{
+			ID:        s.nextID("api_tokens"),
+			Name:      name,
+			Scopes:    append([]models.TokenScope(nil), scopes...),
+			CreatedAt: time.Now(),
+			ExpiresAt: expiresAt,
+		},
+		userID:    u.id,
+		tokenHash: tokenHash,
+	}
+	s.apiTokens[t.ID] = t
+	token := copyAPIToken(t)
+	return &token, nil
+}
+
+func (s *Store) GetAPITokens(username string) ([]models.APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := []models.APIToken{}
+	u, err := s.userByName(username)
+	if err != nil {
+		return tokens, nil
+	}
+	for _, t := range s.apiTokens {
+		if t.userID == u.id {
+			tokens = append(tokens, copyAPIToken(t))
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+		}
+		return tokens[i].ID > tokens[j].ID
+	})
+	return tokens, nil
+}
+
+func (s *Store) UseAPIToken(tokenHash string) (string, []models.TokenScope, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range s.apiTokens {
+		if t.tokenHash != tokenHash || !t.ExpiresAt.After(now) {
+			continue
+		}
+		u, ok := s.users[t.userID]
+		if !ok {
+			break
+		}
+		t.LastUsedAt = &now
+		return u.username, append([]models.TokenScope(nil), t.Scopes...), nil
+	}
+	return "", nil, sql.ErrNoRows
+}
+
+func (s *Store) DeleteAPIToken(username string, tokenID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return sql.ErrNoRows
+	}
+	t, ok := s.apiTokens[tokenID]
+	if !ok || t.userID != u.id {
+		return sql.ErrNoRows
+	}
+	delete(s.apiTokens, tokenID)
+	return nil
+}
+
+func (s *Store) DeleteUserAPITokens(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID := s.userID(username)
+	for id, t := range s.apiTokens {
+		if t.userID == userID {
+			delete(s.apiTokens, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"backend/models"
+	"bytes"
+	"time"
+)
+
+func (s *Store) CreateAuditEntry(entry *models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := auditEntry{AuditEntry: *entry}
+	if u, err := s.userByName(entry.Actor); err == nil {
+		stored.actorID = u.id
+	}
+	stored.ID = int64(s.nextID("audit_log"))
+	stored.CreatedAt = time.Now()
+	// Snapshots are copied so that callers cannot rewrite history
+	stored.Before = bytes.Clone(entry.Before)
+	stored.After = bytes.Clone(entry.After)
+	s.auditLog = append(s.auditLog, stored)
+
+	entry.ID = stored.ID
+	entry.CreatedAt = stored.CreatedAt
+	return nil
+}
+
+func (s *Store) GetAuditEntries(filter models.AuditFilter, page, limit int) ([]models.AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	actorID := 0
+	if filter.Actor != "" {
+		if u, err := s.userByName(filter.Actor); err == nil {
+			actorID = u.id
+		}
+	}
+
+	// The log is appended in order, so walking it backwards lists the newest first
+	entries := []models.AuditEntry{}
+	offset := (page - 1) * limit
+	for i := len(s.auditLog) - 1; i >= 0 && len(entries) < limit; i-- {
+		e := s.auditLog[i]
+		if filter.Actor != "" && e.Actor != filter.Actor && (actorID == 0 || e.actorID != actorID) {
+			continue
+		}
+		if filter.Action != "" && e.Action != filter.Action {
+			continue
+		}
+		if filter.TargetType != "" && e.TargetType != filter.TargetType {
+			continue
+		}
+		if filter.TargetID != 0 && e.TargetID != filter.TargetID {
+			continue
+		}
+		if filter.Since != nil && e.CreatedAt.Before(*filter.Since) {
+			continue
+		}
+		if filter.Until != nil && !e.CreatedAt.Before(*filter.Until) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		entry := e.AuditEntry
+		entry.Before = bytes.Clone(e.Before)
+		entry.After = bytes.Clone(e.After)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,227 @@
+package memory
+
+import (
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+func (s *Store) CreateComment(c *models.Comment) (*models.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(c.Username)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.threads[c.ThreadID]; !ok {
+		return nil, fmt.Errorf("thread %d does not exist", c.ThreadID)
+	}
+
+	if c.ParentID != nil {
+		if _, ok := s.comments[*c.ParentID]; !ok {
+			return nil, fmt.Errorf("parent comment %d does not exist", *c.ParentID)
+		}
+	}
+
+	stored := &comment{
+		id:        s.nextID("comments"),
+		threadID:  c.ThreadID,
+		parentID:  c.ParentID,
+		userID:    u.id,
+		content:   c.Content,
+		createdAt: time.Now(),
+	}
+	s.comments[stored.id] = stored
+	s.recordCommentRevision(stored, u.id)
+
+	c.ID = stored.id
+	c.CreatedAt = stored.createdAt
+	c.RevisionCount = 1
+	return c, nil
+}
+
+// commentScore sums the votes of a comment, callers must hold s.mu
+func (s *Store) commentScore(commentID int) int {
+	total := 0
+	for key, v := range s.commentVotes {
+		if key[0] == commentID {
+			total += v.vote
+		}
+	}
+	return total
+}
+
+// commentModel converts a stored comment to its API representation, callers must hold s.mu
+func (s *Store) commentModel(c *comment) models.Comment {
+	model := models.Comment{
+		ID:            c.id,
+		ThreadID:      c.threadID,
+		ParentID:      c.parentID,
+		Username:      s.users[c.userID].username,
+		Content:       c.content,
+		CreatedAt:     c.createdAt,
+		Deleted:       c.deletedAt != nil,
+		DeletedAt:     c.deletedAt,
+		DeletedBy:     s.username(c.deletedBy),
+		Hidden:        c.hiddenAt != nil,
+		EditedAt:      c.editedAt,
+		RevisionCount: len(s.commentRevisions[c.id]),
+	}
+	model.Redact()
+	return model
+}
+
+func (s *Store) GetCommentsByThreadID(threadID int, viewer string) ([]models.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.threads[threadID]; ok && t.deletedAt != nil {
+		return nil, nil
+	}
+	viewerID := s.userID(viewer)
+
+	now := time.Now()
+	var comments []models.Comment
+	shadowbanned := map[int]bool{}
+	for _, c := range s.comments {
+		if c.threadID == threadID {
+			model := s.commentModel(c)
+			model.Score = s.commentScore(c.id)
+			if v, ok := s.commentVotes[pair{c.id, viewerID}]; ok {
+				model.UserVote = v.vote
+			}
+			if c.userID != viewerID && s.shadowbanned(c.userID, now) {
+				shadowbanned[c.id] = true
+			}
+			comments = append(comments, model)
+		}
+	}
+
+	sort.Slice(comments, func(i, j int) bool {
+		if comments[i].CreatedAt.Equal(comments[j].CreatedAt) {
+			return comments[i].ID < comments[j].ID
+		}
+		return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+	})
+	return models.PruneComments(comments, shadowbanned), nil
+}
+
+func (s *Store) GetCommentByID(commentID int) (*models.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[commentID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	model := s.commentModel(c)
+	return &model, nil
+}
+
+func (s *Store) EditComment(commentID int, newContent string, editedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.comments[commentID]; ok {
+		c.content = newContent
+		s.recordCommentRevision(c, s.userID(editedBy))
+	}
+	return nil
+}
+
+func (s *Store) DeleteComment(commentID int, deletedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[commentID]
+	if !ok || c.deletedAt != nil {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	c.deletedAt = &now
+	c.deletedBy = s.userID(deletedBy)
+	return nil
+}
+
+func (s *Store) RestoreComment(commentID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[commentID]
+	if !ok || c.deletedAt == nil {
+		return sql.ErrNoRows
+	}
+	c.deletedAt = nil
+	c.deletedBy = 0
+	return nil
+}
+
+func (s *Store) GetDeletedComments(username string, since time.Time) ([]models.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comments := []models.Comment{}
+	for _, c := range s.comments {
+		if c.deletedAt == nil || c.deletedBy != c.userID || c.deletedAt.Before(since) || s.users[c.userID].username != username {
+			continue
+		}
+		if _, ok := s.liveThread(c.threadID); !ok {
+			continue
+		}
+		model := s.commentModel(c)
+		model.Username = username
+		model.Content = c.content
+		comments = append(comments, model)
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		if comments[i].DeletedAt.Equal(*comments[j].DeletedAt) {
+			return comments[i].ID > comments[j].ID
+		}
+		return comments[i].DeletedAt.After(*comments[j].DeletedAt)
+	})
+	return comments, nil
+}
+
+func (s *Store) GetCommentOwnerUsername(commentID int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[commentID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return s.users[c.userID].username, nil
+}
+
+func (s *Store) GetCommentCategory(commentID int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[commentID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return s.categoryName(s.threads[c.threadID].categoryID), nil
+}
+
+func (s *Store) CountShadowbannedComments(threadID int, viewer string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.shadowbannedComments(threadID, s.userID(viewer), time.Now()), nil
+}
+
+// shadowbannedComments counts the undeleted comments on a thread by users other
+// than viewerID who are shadowbanned at now, callers must hold s.mu
+func (s *Store) shadowbannedComments(threadID, viewerID int, now time.Time) int {
+	count := 0
+	for _, c := range s.comments {
+		if c.threadID == threadID && c.deletedAt == nil && c.userID != viewerID && s.shadowbanned(c.userID, now) {
+			count++
+		}
+	}
+	return count
+}
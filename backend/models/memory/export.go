@@ -0,0 +1,184 @@
+package memory
+
+import (
+	"backend/models"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dataExportModel converts a stored export to its API representation, callers must hold s.mu
+func (s *Store) dataExportModel(e *dataExport) *models.DataExport {
+	model := e.DataExport
+	model.Username = s.username(e.userID)
+	return &model
+}
+
+func (s *Store) CreateDataExport(username string) (*models.DataExport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return nil, fmt.Errorf("error creating data export: %v", err)
+	}
+	stored := &dataExport{userID: u.id}
+	stored.ID = s.nextID("data_exports")
+	stored.Status = models.ExportPending
+	stored.CreatedAt = time.Now()
+	s.dataExports[stored.ID] = stored
+	return s.dataExportModel(stored), nil
+}
+
+func (s *Store) GetDataExport(exportID int) (*models.DataExport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.dataExports[exportID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return s.dataExportModel(e), nil
+}
+
+func (s *Store) GetLatestDataExport(username string) (*models.DataExport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID := s.userID(username)
+	var latest *dataExport
+	for _, e := range s.dataExports {
+		if e.userID == userID && (latest == nil || e.ID > latest.ID) {
+			latest = e
+		}
+	}
+	if latest == nil {
+		return nil, sql.ErrNoRows
+	}
+	return s.dataExportModel(latest), nil
+}
+
+func (s *Store) CompleteDataExport(exportID int, archive []byte, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.dataExports[exportID]; ok && e.Status == models.ExportPending {
+		now := time.Now()
+		e.Status = models.ExportReady
+		e.archive = bytes.Clone(archive)
+		e.CompletedAt = &now
+		e.ExpiresAt = &expiresAt
+	}
+	return nil
+}
+
+func (s *Store) FailDataExport(exportID int, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.dataExports[exportID]; ok && e.Status == models.ExportPending {
+		now := time.Now()
+		e.Status = models.ExportFailed
+		e.Error = message
+		e.CompletedAt = &now
+	}
+	return nil
+}
+
+func (s *Store) GetDataExportArchive(exportID int) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.dataExports[exportID]
+	if !ok || e.archive == nil {
+		return nil, sql.ErrNoRows
+	}
+	return bytes.Clone(e.archive), nil
+}
+
+func (s *Store) GetUserData(username string) (*models.UserData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return nil, err
+	}
+	data := &models.UserData{
+		Profile:      s.userModel(u),
+		Threads:      []models.ExportedThread{},
+		Comments:     []models.ExportedComment{},
+		Votes:        []models.ExportedVote{},
+		CommentVotes: []models.ExportedVote{},
+		SavedThreads: []models.SavedThread{},
+		Tags:         []string{},
+	}
+
+	tags := map[string]bool{}
+	for _, t := range s.threads {
+		if t.userID != u.id {
+			continue
+		}
+		names := s.threadTagNames(t.id)
+		sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+		for _, name := range names {
+			tags[name] = true
+		}
+		data.Threads = append(data.Threads, models.ExportedThread{
+			ID:        t.id,
+			Title:     t.title,
+			Content:   t.content,
+			Category:  s.categoryName(t.categoryID),
+			Tags:      names,
+			CreatedAt: t.createdAt,
+			EditedAt:  t.editedAt,
+			DeletedAt: t.deletedAt,
+		})
+	}
+	sort.Slice(data.Threads, func(i, j int) bool { return data.Threads[i].ID < data.Threads[j].ID })
+	for name := range tags {
+		data.Tags = append(data.Tags, name)
+	}
+	sort.Slice(data.Tags, func(i, j int) bool { return strings.ToLower(data.Tags[i]) < strings.ToLower(data.Tags[j]) })
+
+	for _, c := range s.comments {
+		if c.userID != u.id {
+			continue
+		}
+		data.Comments = append(data.Comments, models.ExportedComment{
+			ID:        c.id,
+			ThreadID:  c.threadID,
+			ParentID:  c.parentID,
+			Content:   c.content,
+			CreatedAt: c.createdAt,
+			EditedAt:  c.editedAt,
+			DeletedAt: c.deletedAt,
+		})
+	}
+	sort.Slice(data.Comments, func(i, j int) bool { return data.Comments[i].ID < data.Comments[j].ID })
+
+	for key, v := range s.votes {
+		if key[1] == u.id {
+			data.Votes = append(data.Votes, models.ExportedVote{ThreadID: v.threadID, Vote: v.vote, CreatedAt: v.createdAt})
+		}
+	}
+	sort.Slice(data.Votes, func(i, j int) bool { return data.Votes[i].ThreadID < data.Votes[j].ThreadID })
+	for key, v := range s.commentVotes {
+		if key[1] == u.id {
+			data.CommentVotes = append(data.CommentVotes, models.ExportedVote{CommentID: v.commentID, Vote: v.vote, CreatedAt: v.createdAt})
+		}
+	}
+	sort.Slice(data.CommentVotes, func(i, j int) bool { return data.CommentVotes[i].CommentID < data.CommentVotes[j].CommentID })
+
+	for key, savedAt := range s.savedThreads {
+		if key[0] == u.id {
+			data.SavedThreads = append(data.SavedThreads, models.SavedThread{ThreadID: key[1], Title: s.threads[key[1]].title, SavedAt: savedAt})
+		}
+	}
+	sort.Slice(data.SavedThreads, func(i, j int) bool { return data.SavedThreads[i].ThreadID < data.SavedThreads[j].ThreadID })
+
+	return data, nil
+}
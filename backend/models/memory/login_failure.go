@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"backend/models"
+	"time"
+)
+
+func (s *Store) GetLoginLock(scope models.LoginScope, subject string) (*time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.loginFailures[loginSubject{scope, subject}]
+	if !ok || f.lockedUntil == nil || !f.lockedUntil.After(time.Now()) {
+		return nil, nil
+	}
+	lockedUntil := *f.lockedUntil
+	return &lockedUntil, nil
+}
+
+func (s *Store) ReserveLoginAttempt(scope models.LoginScope, subject string) (*time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := loginSubject{scope, subject}
+	f, ok := s.loginFailures[key]
+	if !ok {
+		f = &loginFailure{}
+		s.loginFailures[key] = f
+	}
+	now := time.Now()
+	if f.lockedUntil != nil && f.lockedUntil.After(now) {
+		lockedUntil := *f.lockedUntil
+		return &lockedUntil, nil
+	}
+	f.failures, f.lockedUntil = models.LoginPolicyFor(scope).Fail(f.failures, f.lastFailureAt, now)
+	f.lastFailureAt = now
+	return nil, nil
+}
+
+func (s *Store) RefundLoginAttempt(scope models.LoginScope, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.loginFailures[loginSubject{scope, subject}]; ok {
+		f.failures, f.lockedUntil = models.LoginPolicyFor(scope).Refund(f.failures, f.lastFailureAt)
+	}
+	return nil
+}
+
+func (s *Store) ClearLoginFailures(scope models.LoginScope, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loginFailures, loginSubject{scope, subject})
+	return nil
+}
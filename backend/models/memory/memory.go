@@ -0,0 +1,345 @@
+// Package memory implements every models store in process memory. It mirrors
+// the Postgres behaviour closely enough to run the HTTP handlers in tests
+// without a database.
+package memory
+
+import (
+	"backend/auth"
+	"backend/mail"
+	"backend/models"
+	"backend/realtime"
+	"backend/utils"
+	"sync"
+	"time"
+)
+
+type user struct {
+	id              int
+	username        string
+	password        string
+	email           string
+	emailVerifiedAt *time.Time
+	totpSecret      string
+	totpEnabledAt   *time.Time
+	totpLastStep    int64
+	bio             string
+	role            models.Role
+	createdAt       time.Time
+}
+
+type category struct {
+	id   int
+	name string
+}
+
+type thread struct {
+	id         int
+	userID     int
+	title      string
+	content    string
+	categoryID int
+	createdAt  time.Time
+	hiddenAt   *time.Time
+	deletedAt  *time.Time
+	deletedBy  int // 0 when the account that deleted it is gone
+	editedAt   *time.Time
+}
+
+type comment struct {
+	id        int
+	threadID  int
+	parentID  *int
+	userID    int
+	content   string
+	createdAt time.Time
+	deletedAt *time.Time
+	deletedBy int
+	hiddenAt  *time.Time
+	editedAt  *time.Time
+}
+
+type vote struct {
+	id        int
+	threadID  int
+	userID    int
+	vote      int
+	createdAt time.Time
+}
+
+type commentVote struct {
+	id        int
+	commentID int
+	userID    int
+	vote      int
+	createdAt time.Time
+}
+
+type tag struct {
+	id   int
+	name string
+}
+
+type session struct {
+	models.Session
+	userID int
+}
+
+type refreshToken struct {
+	sessionID string
+	usedAt    *time.Time
+}
+
+type notification struct {
+	id        int
+	userID    int
+	actorID   int // 0 when the actor's account is gone
+	typ       models.NotificationType
+	threadID  *int
+	commentID *int
+	message   string
+	dedupeKey string
+	readAt    *time.Time
+	createdAt time.Time
+}
+
+// notificationPreference is keyed by (user_id, type)
+type notificationPreference struct {
+	userID int
+	typ    models.NotificationType
+}
+
+type reportCase struct {
+	id         int
+	targetType string
+	targetID   int
+	threadID   *int
+	commentID  *int
+	categoryID int
+	authorID   int
+	excerpt    string
+	status     string
+	claimedBy  int // 0 when unclaimed
+	claimedAt  *time.Time
+	resolution models.ReportResolution
+	resolvedBy int
+	resolvedAt *time.Time
+	note       string
+	createdAt  time.Time
+}
+
+type report struct {
+	id         int
+	caseID     int
+	reporterID int
+	reason     models.ReportReason
+	details    string
+	createdAt  time.Time
+}
+
+type sanction struct {
+	id         int
+	userID     int
+	typ        models.SanctionType
+	categoryID int // 0 for site-wide sanctions
+	reason     string
+	issuedBy   int
+	expiresAt  *time.Time
+	revokedAt  *time.Time
+	revokedBy  int
+	createdAt  time.Time
+}
+
+type threadRevision struct {
+	title      string
+	content    string
+	categoryID int
+	tags       []string
+	editedBy   int // 0 when the editor's account is gone
+	createdAt  time.Time
+}
+
+type commentRevision struct {
+	content   string
+	editedBy  int
+	createdAt time.Time
+}
+
+type dataExport struct {
+	models.DataExport
+	userID  int
+	archive []byte
+}
+
+type userToken struct {
+	userID    int
+	purpose   models.TokenPurpose
+	email     string
+	expiresAt time.Time
+	usedAt    *time.Time
+	attempts  int
+}
+
+type recoveryCode struct {
+	hash   string
+	usedAt *time.Time
+}
+
+// loginSubject is keyed by (scope, subject)
+type loginSubject struct {
+	scope   models.LoginScope
+	subject string
+}
+
+type loginFailure struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   *time.Time
+}
+
+type apiToken struct {
+	models.APIToken
+	userID    int
+	tokenHash string
+}
+
+type auditEntry struct {
+	models.AuditEntry
+	actorID int // 0 when the actor had no account
+}
+
+// pair is a composite key such as (user_id, thread_id)
+type pair [2]int
+
+// Store holds every table in maps guarded by a single mutex
+type Store struct {
+	mu sync.Mutex
+
+	users              map[int]*user
+	categories         []category
+	threads            map[int]*thread
+	comments           map[int]*comment
+	votes              map[pair]*vote        // (thread_id, user_id)
+	commentVotes       map[pair]*commentVote // (comment_id, user_id)
+	tags               map[int]*tag
+	threadTags         map[int][]int      // thread_id -> tag_ids in insertion order
+	savedThreads       map[pair]time.Time // (user_id, thread_id)
+	categoryModerators map[pair]bool      // (user_id, category_id)
+	sessions           map[string]*session
+	refreshTokens      map[string]*refreshToken
+	notifications      map[int]*notification
+	notificationPrefs  map[notificationPreference]bool
+	reportCases        map[int]*reportCase
+	reports            map[int]*report
+	sanctions          map[int]*sanction
+	auditLog           []auditEntry              // append-only
+	threadRevisions    map[int][]threadRevision  // thread_id -> revisions, revision 1 first
+	commentRevisions   map[int][]commentRevision // comment_id -> revisions, revision 1 first
+	dataExports        map[int]*dataExport
+	userTokens         map[string]*userToken  // token_hash -> token
+	recoveryCodes      map[int][]recoveryCode // user_id -> codes
+	loginFailures      map[loginSubject]*loginFailure
+	apiTokens          map[int]*apiToken
+
+	lastID map[string]int
+}
+
+// New returns an empty in-memory store seeded like a freshly migrated database
+func New() *Store {
+	s := &Store{
+		users:              map[int]*user{},
+		threads:            map[int]*thread{},
+		comments:           map[int]*comment{},
+		votes:              map[pair]*vote{},
+		commentVotes:       map[pair]*commentVote{},
+		tags:               map[int]*tag{},
+		threadTags:         map[int][]int{},
+		savedThreads:       map[pair]time.Time{},
+		categoryModerators: map[pair]bool{},
+		sessions:           map[string]*session{},
+		refreshTokens:      map[string]*refreshToken{},
+		notifications:      map[int]*notification{},
+		notificationPrefs:  map[notificationPreference]bool{},
+		reportCases:        map[int]*reportCase{},
+		reports:            map[int]*report{},
+		sanctions:          map[int]*sanction{},
+		threadRevisions:    map[int][]threadRevision{},
+		commentRevisions:   map[int][]commentRevision{},
+		dataExports:        map[int]*dataExport{},
+		userTokens:         map[string]*userToken{},
+		recoveryCodes:      map[int][]recoveryCode{},
+		loginFailures:      map[loginSubject]*loginFailure{},
+		apiTokens:          map[int]*apiToken{},
+		lastID:             map[string]int{},
+	}
+
+	// Reserved users, verified like every account that predates verification
+	now := time.Now()
+	for _, reserved := range []struct {
+		username, password, email string
+		role                      models.Role
+	}{
+		{"left", utils.LockedPassword, "deleted@example.com", models.RoleUser},
+		{"admin", utils.LockedPassword, "admin@example.com", models.RoleUser},
+		{"guest", utils.LockedPassword, "guest@example.com", models.RoleUser},
+	} {
+		id := s.nextID("users")
+		s.users[id] = &user{
+			id:              id,
+			username:        reserved.username,
+			password:        reserved.password,
+			email:           reserved.email,
+			emailVerifiedAt: &now,
+			bio:             defaultBio,
+			role:            reserved.role,
+			createdAt:       now,
+		}
+	}
+
+	for _, name := range []string{
+		"general", "technology", "science", "gaming", "movies", "music",
+		"sports", "books", "art", "travel", "food", "academics",
+	} {
+		s.categories = append(s.categories, category{id: s.nextID("categories"), name: name})
+	}
+
+	return s
+}
+
+// NewStore returns a models.Store backed by a fresh in-memory store
+func NewStore() *models.Store {
+	s := New()
+	return &models.Store{
+		Threads:       s,
+		Comments:      s,
+		Votes:         s,
+		Users:         s,
+		Tags:          s,
+		Sessions:      s,
+		Notifications: s,
+		Reports:       s,
+		Sanctions:     s,
+		Audit:         s,
+		Revisions:     s,
+		Exports:       s,
+		TwoFactor:     s,
+		LoginFailures: s,
+		APITokens:     s,
+		Events:        realtime.NewHub(),
+		Presence:      realtime.NewPresence(),
+		Mailer:        &mail.Outbox{},
+		JWT:           auth.Ephemeral(auth.DefaultIssuer, auth.DefaultIssuer),
+	}
+}
+
+const defaultBio = "This user is too cool to add a bio."
+
+// nextID emulates a SERIAL column
+func (s *Store) nextID(table string) int {
+	s.lastID[table]++
+	return s.lastID[table]
+}
+
+// formatTime formats timestamps the way lib/pq does when scanning into a string
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
@@ -0,0 +1,183 @@
+package memory
+
+import (
+	"backend/models"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+func (s *Store) CreateNotification(n *models.Notification) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(n.Username)
+	if err != nil {
+		return false, nil
+	}
+	if enabled, ok := s.notificationPrefs[notificationPreference{u.id, n.Type}]; ok && !enabled {
+		return false, nil
+	}
+
+	// ON CONFLICT (user_id, dedupe_key) DO NOTHING
+	if n.DedupeKey != "" {
+		for _, existing := range s.notifications {
+			if existing.userID == u.id && existing.dedupeKey == n.DedupeKey {
+				return false, nil
+			}
+		}
+	}
+
+	stored := &notification{
+		id:        s.nextID("notifications"),
+		userID:    u.id,
+		typ:       n.Type,
+		threadID:  n.ThreadID,
+		commentID: n.CommentID,
+		message:   n.Message,
+		dedupeKey: n.DedupeKey,
+		createdAt: time.Now(),
+	}
+	if actor, err := s.userByName(n.Actor); err == nil {
+		stored.actorID = actor.id
+	}
+	s.notifications[stored.id] = stored
+
+	n.ID = stored.id
+	n.CreatedAt = stored.createdAt
+	return true, nil
+}
+
+func (s *Store) GetNotifications(username string, unreadOnly bool, page, limit int) ([]models.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return []models.Notification{}, nil
+	}
+
+	var stored []*notification
+	for _, n := range s.notifications {
+		if n.userID == u.id && (!unreadOnly || n.readAt == nil) {
+			stored = append(stored, n)
+		}
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		if stored[i].createdAt.Equal(stored[j].createdAt) {
+			return stored[i].id > stored[j].id
+		}
+		return stored[i].createdAt.After(stored[j].createdAt)
+	})
+
+	offset := (page - 1) * limit
+	notifications := []models.Notification{}
+	for i := offset; i >= 0 && i < len(stored) && i < offset+limit; i++ {
+		n := stored[i]
+		actor := ""
+		if a, ok := s.users[n.actorID]; ok {
+			actor = a.username
+		}
+		notifications = append(notifications, models.Notification{
+			ID:        n.id,
+			Username:  username,
+			Type:      n.typ,
+			Actor:     actor,
+			ThreadID:  n.threadID,
+			CommentID: n.commentID,
+			Message:   n.message,
+			Read:      n.readAt != nil,
+			CreatedAt: n.createdAt,
+		})
+	}
+	return notifications, nil
+}
+
+func (s *Store) CountUnreadNotifications(username string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return 0, nil
+	}
+
+	count := 0
+	for _, n := range s.notifications {
+		if n.userID == u.id && n.readAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) MarkNotificationRead(username string, notificationID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return sql.ErrNoRows
+	}
+	n, ok := s.notifications[notificationID]
+	if !ok || n.userID != u.id {
+		return sql.ErrNoRows
+	}
+	if n.readAt == nil {
+		now := time.Now()
+		n.readAt = &now
+	}
+	return nil
+}
+
+func (s *Store) MarkAllNotificationsRead(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	for _, n := range s.notifications {
+		if n.userID == u.id && n.readAt == nil {
+			n.readAt = &now
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetNotificationPreferences(username string) (map[models.NotificationType]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	preferences := map[models.NotificationType]bool{}
+	for _, t := range models.NotificationTypes {
+		preferences[t] = true
+	}
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return preferences, nil
+	}
+	for key, enabled := range s.notificationPrefs {
+		if key.userID == u.id {
+			preferences[key.typ] = enabled
+		}
+	}
+	return preferences, nil
+}
+
+func (s *Store) SetNotificationPreference(username string, t models.NotificationType, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+
+	s.notificationPrefs[notificationPreference{u.id, t}] = enabled
+	return nil
+}
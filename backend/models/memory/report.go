@@ -0,0 +1,305 @@
+package memory
+
+import (
+	"backend/models"
+	"database/sql"
+	"slices"
+	"sort"
+	"time"
+)
+
+// excerpt cuts content to the length report cases keep
+func excerpt(content string) string {
+	runes := []rune(content)
+	if len(runes) > 500 {
+		runes = runes[:500]
+	}
+	return string(runes)
+}
+
+func (s *Store) CreateReport(r *models.Report) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reporter, err := s.userByName(r.Reporter)
+	if err != nil {
+		return false, sql.ErrNoRows
+	}
+	t, ok := s.threads[r.ThreadID]
+	if !ok {
+		return false, sql.ErrNoRows
+	}
+
+	targetType, targetID := models.ReportTargetThread, t.id
+	authorID, content, hiddenAt := t.userID, t.title+"\n\n"+t.content, &t.hiddenAt
+	if r.CommentID != nil {
+		c, ok := s.comments[*r.CommentID]
+		if !ok || c.threadID != t.id {
+			return false, sql.ErrNoRows
+		}
+		targetType, targetID = models.ReportTargetComment, c.id
+		authorID, content, hiddenAt = c.userID, c.content, &c.hiddenAt
+	}
+
+	var rc *reportCase
+	for _, existing := range s.reportCases {
+		if existing.targetType == targetType && existing.targetID == targetID && existing.status == models.ReportStatusOpen {
+			rc = existing
+		}
+	}
+	if rc == nil {
+		threadID := t.id
+		rc = &reportCase{
+			id:         s.nextID("report_cases"),
+			targetType: targetType,
+			targetID:   targetID,
+			threadID:   &threadID,
+			commentID:  r.CommentID,
+			categoryID: t.categoryID,
+			authorID:   authorID,
+			excerpt:    excerpt(content),
+			status:     models.ReportStatusOpen,
+			createdAt:  time.Now(),
+		}
+		s.reportCases[rc.id] = rc
+	}
+	r.CaseID = rc.id
+
+	// UNIQUE (case_id, reporter_id)
+	count := 0
+	for _, existing := range s.reports {
+		if existing.caseID == rc.id {
+			if existing.reporterID == reporter.id {
+				return false, models.ErrAlreadyReported
+			}
+			count++
+		}
+	}
+
+	stored := &report{
+		id:         s.nextID("reports"),
+		caseID:     rc.id,
+		reporterID: reporter.id,
+		reason:     r.Reason,
+		details:    r.Details,
+		createdAt:  time.Now(),
+	}
+	s.reports[stored.id] = stored
+	r.ID = stored.id
+	r.CreatedAt = stored.createdAt
+	count++
+
+	if *hiddenAt == nil && models.ReportHideThreshold > 0 && count >= models.ReportHideThreshold {
+		now := time.Now()
+		*hiddenAt = &now
+		return true, nil
+	}
+	return false, nil
+}
+
+// reportCaseModel converts a stored case to its API representation, callers must hold s.mu
+func (s *Store) reportCaseModel(rc *reportCase) models.ReportCase {
+	model := models.ReportCase{
+		ID:         rc.id,
+		TargetType: rc.targetType,
+		TargetID:   rc.targetID,
+		ThreadID:   rc.threadID,
+		CommentID:  rc.commentID,
+		Category:   s.categoryName(rc.categoryID),
+		Author:     s.username(rc.authorID),
+		Excerpt:    rc.excerpt,
+		Status:     rc.status,
+		Reasons:    map[models.ReportReason]int{},
+		ClaimedBy:  s.username(rc.claimedBy),
+		ClaimedAt:  rc.claimedAt,
+		Resolution: rc.resolution,
+		ResolvedBy: s.username(rc.resolvedBy),
+		ResolvedAt: rc.resolvedAt,
+		Note:       rc.note,
+		CreatedAt:  rc.createdAt,
+	}
+	if rc.targetType == models.ReportTargetThread {
+		if t, ok := s.threads[rc.targetID]; ok && rc.threadID != nil {
+			model.Hidden = t.hiddenAt != nil
+		}
+	} else if c, ok := s.comments[rc.targetID]; ok && rc.commentID != nil {
+		model.Hidden = c.hiddenAt != nil
+	}
+	for _, r := range s.reports {
+		if r.caseID == rc.id {
+			model.ReportCount++
+			model.Reasons[r.reason]++
+		}
+	}
+	return model
+}
+
+// username returns the name of a user, or an empty string for 0 or a removed user
+func (s *Store) username(userID int) string {
+	if u, ok := s.users[userID]; ok {
+		return u.username
+	}
+	return ""
+}
+
+func (s *Store) GetReportCases(filter models.ReportFilter, page, limit int) ([]models.ReportCase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stored []*reportCase
+	for _, rc := range s.reportCases {
+		if rc.status != filter.Status {
+			continue
+		}
+		if filter.Categories != nil && !slices.Contains(filter.Categories, s.categoryName(rc.categoryID)) {
+			continue
+		}
+		if filter.ClaimedBy != "" && s.username(rc.claimedBy) != filter.ClaimedBy {
+			continue
+		}
+		stored = append(stored, rc)
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		if filter.Status == models.ReportStatusResolved {
+			if !stored[i].resolvedAt.Equal(*stored[j].resolvedAt) {
+				return stored[i].resolvedAt.After(*stored[j].resolvedAt)
+			}
+			return stored[i].id > stored[j].id
+		}
+		if !stored[i].createdAt.Equal(stored[j].createdAt) {
+			return stored[i].createdAt.Before(stored[j].createdAt)
+		}
+		return stored[i].id < stored[j].id
+	})
+
+	cases := []models.ReportCase{}
+	offset := (page - 1) * limit
+	for i := offset; i < len(stored) && i < offset+limit; i++ {
+		cases = append(cases, s.reportCaseModel(stored[i]))
+	}
+	return cases, nil
+}
+
+func (s *Store) GetReportCase(caseID int) (*models.ReportCase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rc, ok := s.reportCases[caseID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	model := s.reportCaseModel(rc)
+
+	var stored []*report
+	for _, r := range s.reports {
+		if r.caseID == caseID {
+			stored = append(stored, r)
+		}
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].id < stored[j].id })
+
+	model.Reports = []models.Report{}
+	for _, r := range stored {
+		report := models.Report{
+			ID:        r.id,
+			CaseID:    caseID,
+			CommentID: rc.commentID,
+			Reporter:  s.username(r.reporterID),
+			Reason:    r.reason,
+			Details:   r.details,
+			CreatedAt: r.createdAt,
+		}
+		if rc.threadID != nil {
+			report.ThreadID = *rc.threadID
+		}
+		model.Reports = append(model.Reports, report)
+	}
+	return &model, nil
+}
+
+// openReportCase returns an open case the moderator may act on, callers must hold s.mu
+func (s *Store) openReportCase(caseID int, username string) (*reportCase, *user, error) {
+	moderator, err := s.userByName(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	rc, ok := s.reportCases[caseID]
+	if !ok {
+		return nil, nil, sql.ErrNoRows
+	}
+	if rc.status == models.ReportStatusResolved {
+		return nil, nil, models.ErrReportCaseResolved
+	}
+	if rc.claimedBy != 0 && rc.claimedBy != moderator.id {
+		return nil, nil, models.ErrReportCaseClaimed
+	}
+	return rc, moderator, nil
+}
+
+func (s *Store) ClaimReportCase(caseID int, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rc, moderator, err := s.openReportCase(caseID, username)
+	if err != nil {
+		return err
+	}
+	rc.claimedBy = moderator.id
+	if rc.claimedAt == nil {
+		now := time.Now()
+		rc.claimedAt = &now
+	}
+	return nil
+}
+
+func (s *Store) ReleaseReportCase(caseID int, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rc, _, err := s.openReportCase(caseID, username)
+	if err != nil {
+		return err
+	}
+	rc.claimedBy = 0
+	rc.claimedAt = nil
+	return nil
+}
+
+func (s *Store) ResolveReportCase(caseID int, username string, resolution models.ReportResolution, note string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rc, moderator, err := s.openReportCase(caseID, username)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	rc.status = models.ReportStatusResolved
+	rc.resolution = resolution
+	rc.resolvedBy = moderator.id
+	rc.resolvedAt = &now
+	rc.note = note
+	if rc.claimedBy == 0 {
+		rc.claimedBy = moderator.id
+		rc.claimedAt = &now
+	}
+
+	if rc.targetType == models.ReportTargetThread {
+		if t, ok := s.threads[rc.targetID]; ok {
+			if resolution != models.ResolveRemove {
+				t.hiddenAt = nil
+			} else if t.deletedAt == nil {
+				t.deletedAt = &now
+				t.deletedBy = moderator.id
+			}
+		}
+	} else if c, ok := s.comments[rc.targetID]; ok {
+		if resolution != models.ResolveRemove {
+			c.hiddenAt = nil
+		} else if c.deletedAt == nil {
+			c.deletedAt = &now
+			c.deletedBy = moderator.id
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"backend/models"
+	"database/sql"
+	"time"
+)
+
+// recordThreadRevision stores the current state of a thread as its next
+// revision, setting its editedAt after the first. Callers must hold s.mu.
+func (s *Store) recordThreadRevision(t *thread, editedBy int) {
+	now := time.Now()
+	s.threadRevisions[t.id] = append(s.threadRevisions[t.id], threadRevision{
+		title:      t.title,
+		content:    t.content,
+		categoryID: t.categoryID,
+		tags:       s.threadTagNames(t.id),
+		editedBy:   editedBy,
+		createdAt:  now,
+	})
+	if len(s.threadRevisions[t.id]) > 1 {
+		t.editedAt = &now
+	}
+}
+
+// recordCommentRevision stores the current content of a comment as its next
+// revision, setting its editedAt after the first. Callers must hold s.mu.
+func (s *Store) recordCommentRevision(c *comment, editedBy int) {
+	now := time.Now()
+	s.commentRevisions[c.id] = append(s.commentRevisions[c.id], commentRevision{
+		content:   c.content,
+		editedBy:  editedBy,
+		createdAt: now,
+	})
+	if len(s.commentRevisions[c.id]) > 1 {
+		c.editedAt = &now
+	}
+}
+
+func (s *Store) GetThreadRevisions(threadID int) ([]models.ThreadRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revisions := []models.ThreadRevision{}
+	for i, r := range s.threadRevisions[threadID] {
+		revisions = append(revisions, models.ThreadRevision{
+			Revision:  i + 1,
+			Title:     r.title,
+			Content:   r.content,
+			Category:  s.categoryName(r.categoryID),
+			Tags:      append([]string{}, r.tags...),
+			EditedBy:  s.username(r.editedBy),
+			CreatedAt: r.createdAt,
+		})
+	}
+	return revisions, nil
+}
+
+func (s *Store) RevertThread(threadID, revision int, editedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.threads[threadID]
+	revisions := s.threadRevisions[threadID]
+	if !ok || revision < 1 || revision > len(revisions) {
+		return sql.ErrNoRows
+	}
+	r := revisions[revision-1]
+	t.title = r.title
+	t.content = r.content
+	t.categoryID = r.categoryID
+	s.threadTags[threadID] = nil
+	for _, name := range r.tags {
+		s.attachTag(threadID, s.getOrCreateTag(name))
+	}
+
+	s.recordThreadRevision(t, s.userID(editedBy))
+	return nil
+}
+
+func (s *Store) GetCommentRevisions(commentID int) ([]models.CommentRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revisions := []models.CommentRevision{}
+	for i, r := range s.commentRevisions[commentID] {
+		revisions = append(revisions, models.CommentRevision{
+			Revision:  i + 1,
+			Content:   r.content,
+			EditedBy:  s.username(r.editedBy),
+			CreatedAt: r.createdAt,
+		})
+	}
+	return revisions, nil
+}
+
+func (s *Store) RevertComment(commentID, revision int, editedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[commentID]
+	revisions := s.commentRevisions[commentID]
+	if !ok || revision < 1 || revision > len(revisions) {
+		return sql.ErrNoRows
+	}
+	c.content = revisions[revision-1].content
+
+	s.recordCommentRevision(c, s.userID(editedBy))
+	return nil
+}
@@ -0,0 +1,150 @@
+package memory
+
+import (
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// active reports whether a sanction is in force at now
+func (sn *sanction) active(now time.Time) bool {
+	return sn.revokedAt == nil && (sn.expiresAt == nil || sn.expiresAt.After(now))
+}
+
+// shadowbanned reports whether a user is shadowbanned at now, callers must hold s.mu
+func (s *Store) shadowbanned(userID int, now time.Time) bool {
+	for _, sn := range s.sanctions {
+		if sn.userID == userID && sn.typ == models.SanctionShadowban && sn.active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanctionModel converts a stored sanction to its API representation, callers must hold s.mu
+func (s *Store) sanctionModel(sn *sanction, now time.Time) models.Sanction {
+	model := models.Sanction{
+		ID:        sn.id,
+		Username:  s.username(sn.userID),
+		Type:      sn.typ,
+		Reason:    sn.reason,
+		IssuedBy:  s.username(sn.issuedBy),
+		ExpiresAt: sn.expiresAt,
+		RevokedAt: sn.revokedAt,
+		RevokedBy: s.username(sn.revokedBy),
+		Active:    sn.active(now),
+		CreatedAt: sn.createdAt,
+	}
+	if sn.categoryID != 0 {
+		model.Category = s.categoryName(sn.categoryID)
+	}
+	return model
+}
+
+func (s *Store) CreateSanction(model *models.Sanction) (*models.Sanction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(model.Username)
+	if err != nil {
+		return nil, err
+	}
+	categoryID := 0
+	if model.Category != "" {
+		if categoryID, err = s.categoryID(model.Category); err != nil {
+			return nil, err
+		}
+	}
+	issuedBy := 0
+	if moderator, err := s.userByName(model.IssuedBy); err == nil {
+		issuedBy = moderator.id
+	}
+
+	// CHECK constraints of user_sanctions
+	switch {
+	case model.Type == models.SanctionSuspension && model.ExpiresAt == nil,
+		model.Type == models.SanctionBan && model.ExpiresAt != nil,
+		model.Type == models.SanctionShadowban && categoryID != 0:
+		return nil, fmt.Errorf("new row for relation \"user_sanctions\" violates check constraint")
+	}
+
+	stored := &sanction{
+		id:         s.nextID("user_sanctions"),
+		userID:     u.id,
+		typ:        model.Type,
+		categoryID: categoryID,
+		reason:     model.Reason,
+		issuedBy:   issuedBy,
+		expiresAt:  model.ExpiresAt,
+		createdAt:  time.Now(),
+	}
+	s.sanctions[stored.id] = stored
+
+	model.ID = stored.id
+	model.CreatedAt = stored.createdAt
+	model.Active = true
+	return model, nil
+}
+
+func (s *Store) GetSanctions(username string, activeOnly bool) ([]models.Sanction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sanctions := []models.Sanction{}
+	u, err := s.userByName(username)
+	if err != nil {
+		return sanctions, nil
+	}
+
+	now := time.Now()
+	var stored []*sanction
+	for _, sn := range s.sanctions {
+		if sn.userID == u.id && (!activeOnly || sn.active(now)) {
+			stored = append(stored, sn)
+		}
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		if !stored[i].createdAt.Equal(stored[j].createdAt) {
+			return stored[i].createdAt.After(stored[j].createdAt)
+		}
+		return stored[i].id > stored[j].id
+	})
+
+	for _, sn := range stored {
+		sanctions = append(sanctions, s.sanctionModel(sn, now))
+	}
+	return sanctions, nil
+}
+
+func (s *Store) GetSanction(sanctionID int) (*models.Sanction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sn, ok := s.sanctions[sanctionID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	model := s.sanctionModel(sn, time.Now())
+	return &model, nil
+}
+
+func (s *Store) RevokeSanction(sanctionID int, revokedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sn, ok := s.sanctions[sanctionID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	if !sn.active(now) {
+		return models.ErrSanctionInactive
+	}
+	sn.revokedAt = &now
+	if moderator, err := s.userByName(revokedBy); err == nil {
+		sn.revokedBy = moderator.id
+	}
+	return nil
+}
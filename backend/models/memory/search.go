@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"backend/models"
+	"html"
+	"strings"
+)
+
+// Weights of the title, tags and content, the ts_rank defaults for weights A, B and C
+const (
+	titleWeight   = 1.0
+	tagWeight     = 0.4
+	contentWeight = 0.2
+)
+
+// snippetWords is how many words of the content a snippet shows, like ts_headline's MaxWords
+const snippetWords = 35
+
+// searchTerms splits the free text of a search into the terms that must match
+// and the words that must not, all in lower case
+func searchTerms(q models.SearchQuery) (include, exclude []string) {
+	for _, word := range q.Words {
+		word = strings.ToLower(word)
+		if strings.HasPrefix(word, "-") {
+			exclude = append(exclude, strings.TrimPrefix(word, "-"))
+		} else {
+			include = append(include, word)
+		}
+	}
+	for _, phrase := range q.Phrases {
+		include = append(include, strings.ToLower(phrase))
+	}
+	return include, exclude
+}
+
+// matchSearch reports whether a thread matches a search and ranks it like
+// ts_rank, callers must hold s.mu. Terms match case-insensitive substrings
+// rather than stemmed lexemes, which is close enough for tests.
+func (s *Store) matchSearch(t *thread, q models.SearchQuery) (float64, bool) {
+	tags := s.threadTagNames(t.id)
+
+	for _, tag := range q.Tags {
+		found := false
+		for _, name := range tags {
+			found = found || strings.EqualFold(name, tag)
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	if len(q.Authors) > 0 && !contains(q.Authors, s.users[t.userID].username) {
+		return 0, false
+	}
+	if len(q.Categories) > 0 && !contains(q.Categories, s.categoryName(t.categoryID)) {
+		return 0, false
+	}
+	if q.Before != nil && !t.createdAt.Before(*q.Before) {
+		return 0, false
+	}
+	if q.After != nil && t.createdAt.Before(*q.After) {
+		return 0, false
+	}
+
+	title := strings.ToLower(t.title)
+	tagText := strings.ToLower(strings.Join(tags, " "))
+	content := strings.ToLower(t.content)
+
+	include, exclude := searchTerms(q)
+	for _, term := range exclude {
+		if strings.Contains(title, term) || strings.Contains(tagText, term) || strings.Contains(content, term) {
+			return 0, false
+		}
+	}
+
+	rank := 0.0
+	for _, term := range include {
+		termRank := float64(strings.Count(title, term))*titleWeight +
+			float64(strings.Count(tagText, term))*tagWeight +
+			float64(strings.Count(content, term))*contentWeight
+		if termRank == 0 {
+			return 0, false
+		}
+		rank += termRank
+	}
+	return rank, true
+}
+
+// searchSnippet excerpts the content around the first matching word and marks
+// every matching word like ts_headline
+func searchSnippet(content string, q models.SearchQuery) string {
+	include, _ := searchTerms(q)
+	var terms []string
+	for _, term := range include {
+		terms = append(terms, strings.Fields(term)...)
+	}
+	matches := func(word string) bool {
+		for _, term := range terms {
+			if strings.Contains(strings.ToLower(word), term) {
+				return true
+			}
+		}
+		return false
+	}
+
+	words := strings.Fields(content)
+	start := 0
+	for i, word := range words {
+		if matches(word) {
+			start = max(0, i-snippetWords/3)
+			break
+		}
+	}
+	end := min(len(words), start+snippetWords)
+
+	excerpt := make([]string, 0, end-start)
+	for _, word := range words[start:end] {
+		if matches(word) {
+			word = "<mark>" + html.EscapeString(word) + "</mark>"
+		} else {
+			word = html.EscapeString(word)
+		}
+		excerpt = append(excerpt, word)
+	}
+	return strings.Join(excerpt, " ")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"backend/models"
+	"fmt"
+	"time"
+)
+
+func (s *Store) CreateSession(sess *models.Session, refreshTokenHash string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(sess.Username)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := s.sessions[sess.ID]; exists {
+		return nil, fmt.Errorf("error creating session: duplicate session ID")
+	}
+
+	now := time.Now()
+	sess.CreatedAt = now
+	sess.LastUsedAt = now
+
+	s.sessions[sess.ID] = &session{Session: *sess, userID: u.id}
+	s.refreshTokens[refreshTokenHash] = &refreshToken{sessionID: sess.ID}
+	return sess, nil
+}
+
+func (s *Store) RotateRefreshToken(oldTokenHash, newTokenHash string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.refreshTokens[oldTokenHash]
+	if !ok {
+		return nil, models.ErrRefreshTokenNotFound
+	}
+	sess := s.sessions[token.sessionID]
+
+	now := time.Now()
+	if sess.RevokedAt != nil {
+		return nil, models.ErrSessionRevoked
+	}
+	if token.usedAt != nil {
+		sess.RevokedAt = &now
+		return nil, models.ErrRefreshTokenReused
+	}
+	if now.After(sess.ExpiresAt) {
+		return nil, models.ErrSessionExpired
+	}
+
+	token.usedAt = &now
+	s.refreshTokens[newTokenHash] = &refreshToken{sessionID: sess.ID}
+	sess.LastUsedAt = now
+
+	result := sess.Session
+	result.Username = s.users[sess.userID].username
+	return &result, nil
+}
+
+func (s *Store) IsSessionActive(sessionID, username string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return false, nil
+	}
+	return s.users[sess.userID].username == username && sess.RevokedAt == nil && time.Now().Before(sess.ExpiresAt), nil
+}
+
+func (s *Store) RevokeSession(sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sess, ok := s.sessions[sessionID]; ok && sess.RevokedAt == nil {
+		now := time.Now()
+		sess.RevokedAt = &now
+	}
+	return nil
+}
+
+func (s *Store) RevokeUserSessions(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, sess := range s.sessions {
+		if sess.userID == u.id && sess.RevokedAt == nil {
+			sess.RevokedAt = &now
+		}
+	}
+	return nil
+}
@@ -0,0 +1,487 @@
+package memory
+
+import (
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// categoryID looks up a category by name, callers must hold s.mu
+func (s *Store) categoryID(name string) (int, error) {
+	for _, c := range s.categories {
+		if c.name == name {
+			return c.id, nil
+		}
+	}
+	return 0, fmt.Errorf("category does not exist")
+}
+
+// categoryName looks up a category by ID, callers must hold s.mu
+func (s *Store) categoryName(id int) string {
+	for _, c := range s.categories {
+		if c.id == id {
+			return c.name
+		}
+	}
+	return ""
+}
+
+// threadTagNames returns the tag names of a thread, callers must hold s.mu
+func (s *Store) threadTagNames(threadID int) []string {
+	names := []string{}
+	for _, tagID := range s.threadTags[threadID] {
+		names = append(names, s.tags[tagID].name)
+	}
+	return names
+}
+
+// netVotes sums the votes of a thread, callers must hold s.mu
+func (s *Store) netVotes(threadID int) int {
+	total := 0
+	for key, v := range s.votes {
+		if key[0] == threadID {
+			total += v.vote
+		}
+	}
+	return total
+}
+
+// voteCounts counts the upvotes and downvotes of a thread, callers must hold s.mu
+func (s *Store) voteCounts(threadID int) (int, int) {
+	upvotes, downvotes := 0, 0
+	for key, v := range s.votes {
+		if key[0] != threadID {
+			continue
+		}
+		if v.vote > 0 {
+			upvotes++
+		} else {
+			downvotes++
+		}
+	}
+	return upvotes, downvotes
+}
+
+// liveThread looks up a thread that is not in the trash, callers must hold s.mu
+func (s *Store) liveThread(threadID int) (*thread, bool) {
+	t, ok := s.threads[threadID]
+	if !ok || t.deletedAt != nil {
+		return nil, false
+	}
+	return t, true
+}
+
+// toModel converts a stored thread to its API representation, callers must hold s.mu
+func (s *Store) toModel(t *thread) models.Thread {
+	tags := s.threadTagNames(t.id)
+	sort.Slice(tags, func(i, j int) bool {
+		return strings.ToLower(tags[i]) < strings.ToLower(tags[j])
+	})
+
+	upvotes, downvotes := s.voteCounts(t.id)
+	commentCount := 0
+	for _, c := range s.comments {
+		if c.threadID == t.id && c.deletedAt == nil {
+			commentCount++
+		}
+	}
+
+	return models.Thread{
+		ID:            t.id,
+		Username:      s.users[t.userID].username,
+		Title:         t.title,
+		Content:       t.content,
+		Category:      s.categoryName(t.categoryID),
+		Tags:          tags,
+		Votes:         upvotes - downvotes,
+		Upvotes:       upvotes,
+		Downvotes:     downvotes,
+		CommentCount:  commentCount,
+		CreatedAt:     formatTime(t.createdAt),
+		EditedAt:      t.editedAt,
+		RevisionCount: len(s.threadRevisions[t.id]),
+		Hidden:        t.hiddenAt != nil,
+	}
+}
+
+// paginate applies LIMIT/OFFSET semantics to a sorted slice
+func paginate(threads []models.Thread, page, limit int) ([]models.Thread, error) {
+	offset := (page - 1) * limit
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("error executing query: OFFSET and LIMIT must not be negative")
+	}
+	if offset >= len(threads) {
+		return nil, nil
+	}
+	end := offset + limit
+	if end > len(threads) {
+		end = len(threads)
+	}
+	return threads[offset:end], nil
+}
+
+// newestFirst orders threads by creation time, newest first
+func newestFirst(threads []models.Thread, created map[int]time.Time) {
+	sort.SliceStable(threads, func(i, j int) bool {
+		a, b := created[threads[i].ID], created[threads[j].ID]
+		if a.Equal(b) {
+			return threads[i].ID > threads[j].ID
+		}
+		return a.After(b)
+	})
+}
+
+// attachTag links a tag to a thread unless it is already linked, callers must hold s.mu
+func (s *Store) attachTag(threadID, tagID int) {
+	for _, existing := range s.threadTags[threadID] {
+		if existing == tagID {
+			return
+		}
+	}
+	s.threadTags[threadID] = append(s.threadTags[threadID], tagID)
+}
+
+// getOrCreateTag emulates the CITEXT unique tag name, callers must hold s.mu
+func (s *Store) getOrCreateTag(name string) int {
+	for _, t := range s.tags {
+		if strings.EqualFold(t.name, name) {
+			return t.id
+		}
+	}
+	id := s.nextID("tags")
+	s.tags[id] = &tag{id: id, name: name}
+	return id
+}
+
+func (s *Store) CreateThread(t *models.Thread) (*models.Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(t.Username)
+	if err != nil {
+		return nil, err
+	}
+	categoryID, err := s.categoryID(t.Category)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &thread{
+		id:         s.nextID("threads"),
+		userID:     u.id,
+		title:      t.Title,
+		content:    t.Content,
+		categoryID: categoryID,
+		createdAt:  time.Now(),
+	}
+	s.threads[stored.id] = stored
+
+	for _, name := range t.Tags {
+		s.attachTag(stored.id, s.getOrCreateTag(name))
+	}
+	s.recordThreadRevision(stored, u.id)
+
+	t.ID = stored.id
+	t.CreatedAt = formatTime(stored.createdAt)
+	t.RevisionCount = 1
+	return t, nil
+}
+
+func (s *Store) GetThreads(page int, limit int, category string, search models.SearchQuery, username string, sortBy string, period string, viewer string) ([]models.Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	viewerID := s.userID(viewer)
+	ranking := models.GetThreadRanking(sortBy)
+	maxAge := models.ThreadMaxAge(ranking, period)
+
+	hasText := search.Text() != ""
+	byRelevance := hasText && (sortBy == "" || sortBy == models.RelevanceSort)
+	created := map[int]time.Time{}
+	ranks := map[int]float64{}
+	var threads []models.Thread
+	for _, t := range s.threads {
+		if t.hiddenAt != nil || t.deletedAt != nil {
+			continue
+		}
+		model := s.toModel(t)
+		if model.Username != viewer && s.shadowbanned(t.userID, now) {
+			continue
+		}
+		model.CommentCount -= s.shadowbannedComments(t.id, viewerID, now)
+		if category != "" && model.Category != category {
+			continue
+		}
+		relevance, ok := s.matchSearch(t, search)
+		if !ok {
+			continue
+		}
+		if username != "" && model.Username != username {
+			continue
+		}
+		if maxAge > 0 && now.Sub(t.createdAt) > maxAge {
+			continue
+		}
+		if hasText {
+			model.Snippet = searchSnippet(t.content, search)
+		}
+		upvotes, downvotes := s.voteCounts(t.id)
+		created[t.id] = t.createdAt
+		ranks[t.id] = ranking.Rank(upvotes, downvotes, t.createdAt, now)
+		if byRelevance {
+			ranks[t.id] = relevance
+		}
+		threads = append(threads, model)
+	}
+
+	newestFirst(threads, created)
+	sort.SliceStable(threads, func(i, j int) bool {
+		return ranks[threads[i].ID] > ranks[threads[j].ID]
+	})
+
+	return paginate(threads, page, limit)
+}
+
+func (s *Store) GetThreadByID(threadID int) (*models.Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.liveThread(threadID)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	model := s.toModel(t)
+	model.Tags = s.threadTagNames(t.id)
+	return &model, nil
+}
+
+func (s *Store) GetThreadOwnerUsername(threadID int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.liveThread(threadID)
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return s.users[t.userID].username, nil
+}
+
+func (s *Store) GetThreadCategory(threadID int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.liveThread(threadID)
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return s.categoryName(t.categoryID), nil
+}
+
+func (s *Store) EditThread(threadID int, updated *models.Thread, editedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.threads[threadID]
+	if !ok {
+		return nil
+	}
+
+	if updated.Category != "" {
+		categoryID, err := s.categoryID(updated.Category)
+		if err != nil {
+			return err
+		}
+		t.categoryID = categoryID
+	}
+	if updated.Title != "" {
+		t.title = updated.Title
+	}
+	if updated.Content != "" {
+		t.content = updated.Content
+	}
+
+	if len(updated.Tags) > 0 {
+		s.threadTags[threadID] = nil
+		for _, name := range updated.Tags {
+			s.attachTag(threadID, s.getOrCreateTag(name))
+		}
+	}
+
+	s.recordThreadRevision(t, s.userID(editedBy))
+	return nil
+}
+
+func (s *Store) DeleteThread(threadID int, deletedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.liveThread(threadID); ok {
+		now := time.Now()
+		t.deletedAt = &now
+		t.deletedBy = s.userID(deletedBy)
+	}
+	return nil
+}
+
+// deletedThreadModel converts a thread in the trash to its API representation,
+// callers must hold s.mu
+func (s *Store) deletedThreadModel(t *thread) models.Thread {
+	model := s.toModel(t)
+	model.DeletedAt = t.deletedAt
+	model.DeletedBy = s.username(t.deletedBy)
+	return model
+}
+
+func (s *Store) GetDeletedThread(threadID int) (*models.Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.threads[threadID]
+	if !ok || t.deletedAt == nil {
+		return nil, sql.ErrNoRows
+	}
+	model := s.deletedThreadModel(t)
+	return &model, nil
+}
+
+func (s *Store) GetDeletedThreads(username string, since time.Time) ([]models.Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := map[int]time.Time{}
+	threads := []models.Thread{}
+	for _, t := range s.threads {
+		if t.deletedAt == nil || t.deletedBy != t.userID || t.deletedAt.Before(since) || s.users[t.userID].username != username {
+			continue
+		}
+		deleted[t.id] = *t.deletedAt
+		threads = append(threads, s.deletedThreadModel(t))
+	}
+	newestFirst(threads, deleted)
+	return threads, nil
+}
+
+func (s *Store) RestoreThread(threadID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.threads[threadID]
+	if !ok || t.deletedAt == nil {
+		return sql.ErrNoRows
+	}
+	t.deletedAt = nil
+	t.deletedBy = 0
+	return nil
+}
+
+func (s *Store) GetCategoryIDByName(name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.categoryID(name)
+}
+
+func (s *Store) SaveThread(username string, threadID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.threads[threadID]; !ok {
+		return fmt.Errorf("error saving thread: thread %d does not exist", threadID)
+	}
+	if _, saved := s.savedThreads[pair{u.id, threadID}]; saved {
+		return fmt.Errorf("error saving thread: thread %d is already saved", threadID)
+	}
+
+	s.savedThreads[pair{u.id, threadID}] = time.Now()
+	return nil
+}
+
+func (s *Store) RemoveSavedThread(username string, threadID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+
+	delete(s.savedThreads, pair{u.id, threadID})
+	return nil
+}
+
+func (s *Store) GetSavedThreads(username string, page, limit int) ([]models.Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user ID: %v", err)
+	}
+
+	now := time.Now()
+	created := map[int]time.Time{}
+	var threads []models.Thread
+	for key := range s.savedThreads {
+		if key[0] != u.id {
+			continue
+		}
+		t := s.threads[key[1]]
+		if t.deletedAt != nil || t.hiddenAt != nil {
+			continue
+		}
+		if t.userID != u.id && s.shadowbanned(t.userID, now) {
+			continue
+		}
+		model := s.toModel(t)
+		model.CommentCount -= s.shadowbannedComments(t.id, u.id, now)
+		created[t.id] = t.createdAt
+		threads = append(threads, model)
+	}
+	newestFirst(threads, created)
+
+	return paginate(threads, page, limit)
+}
+
+func (s *Store) CheckSavedState(username string, threadID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return false, err
+	}
+
+	_, saved := s.savedThreads[pair{u.id, threadID}]
+	return saved, nil
+}
+
+func (s *Store) GetOrCreateTagID(tagName string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getOrCreateTag(tagName), nil
+}
+
+func (s *Store) AssociateThreadTags(threadID int, tagIDs []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.threads[threadID]; !ok {
+		return fmt.Errorf("failed to associate thread with tag: thread %d does not exist", threadID)
+	}
+	for _, tagID := range tagIDs {
+		if _, ok := s.tags[tagID]; !ok {
+			return fmt.Errorf("failed to associate thread with tag: tag %d does not exist", tagID)
+		}
+		s.attachTag(threadID, tagID)
+	}
+	return nil
+}
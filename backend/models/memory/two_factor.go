@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"backend/models"
+	"database/sql"
+	"time"
+)
+
+func (s *Store) GetTwoFactor(username string) (*models.TwoFactor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return nil, err
+	}
+	tf := &models.TwoFactor{Secret: u.totpSecret, Enabled: u.totpEnabledAt != nil, LastStep: u.totpLastStep}
+	for _, code := range s.recoveryCodes[u.id] {
+		if code.usedAt == nil {
+			tf.RecoveryCodesLeft++
+		}
+	}
+	return tf, nil
+}
+
+func (s *Store) SetTOTPSecret(username, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, err := s.userByName(username); err == nil && u.totpEnabledAt == nil {
+		u.totpSecret = secret
+	}
+	return nil
+}
+
+// setRecoveryCodes replaces the recovery codes of a user, callers must hold s.mu
+func (s *Store) setRecoveryCodes(userID int, codeHashes []string) {
+	codes := make([]recoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, recoveryCode{hash: hash})
+	}
+	s.recoveryCodes[userID] = codes
+}
+
+func (s *Store) EnableTwoFactor(username string, step int64, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+	if u.totpSecret == "" {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	u.totpEnabledAt = &now
+	u.totpLastStep = step
+	s.setRecoveryCodes(u.id, codeHashes)
+	return nil
+}
+
+func (s *Store) DisableTwoFactor(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+	u.totpSecret = ""
+	u.totpEnabledAt = nil
+	u.totpLastStep = 0
+	delete(s.recoveryCodes, u.id)
+	return nil
+}
+
+func (s *Store) UseTOTPStep(username string, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil || u.totpLastStep >= step {
+		return false, nil
+	}
+	u.totpLastStep = step
+	return true, nil
+}
+
+func (s *Store) UseRecoveryCode(username, codeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return false, nil
+	}
+	codes := s.recoveryCodes[u.id]
+	for i := range codes {
+		if codes[i].hash == codeHash && codes[i].usedAt == nil {
+			now := time.Now()
+			codes[i].usedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) ReplaceRecoveryCodes(username string, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+	s.setRecoveryCodes(u.id, codeHashes)
+	return nil
+}
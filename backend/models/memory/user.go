@@ -0,0 +1,392 @@
+package memory
+
+import (
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// userByName looks up a user by username, callers must hold s.mu
+func (s *Store) userByName(username string) (*user, error) {
+	for _, u := range s.users {
+		if u.username == username {
+			return u, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// userID returns the ID of a user, or 0 if there is no such user, callers must hold s.mu
+func (s *Store) userID(username string) int {
+	if u, err := s.userByName(username); err == nil {
+		return u.id
+	}
+	return 0
+}
+
+func (s *Store) CreateUser(username, passwordHash, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.username == username {
+			return fmt.Errorf("duplicate key value violates unique constraint \"users_username_key\"")
+		}
+		if u.email == email {
+			return fmt.Errorf("duplicate key value violates unique constraint \"users_email_key\"")
+		}
+	}
+
+	id := s.nextID("users")
+	s.users[id] = &user{
+		id:        id,
+		username:  username,
+		password:  passwordHash,
+		email:     email,
+		bio:       defaultBio,
+		role:      models.RoleUser,
+		createdAt: time.Now(),
+	}
+	return nil
+}
+
+func (s *Store) GetUserIDByUsername(username string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return 0, err
+	}
+	return u.id, nil
+}
+
+func (s *Store) GetUserIDByEmail(email string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.email == email {
+			return u.id, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (s *Store) GetUserPasswordByUsername(username string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return "", err
+	}
+	return u.password, nil
+}
+
+func (s *Store) UpdateUserPassword(username, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, err := s.userByName(username); err == nil {
+		u.password = passwordHash
+	}
+	return nil
+}
+
+func (s *Store) UpdateUser(oldname, newname, bio string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(oldname)
+	if err != nil {
+		return err
+	}
+	if other, err := s.userByName(newname); err == nil && other.id != u.id {
+		return fmt.Errorf("duplicate key value violates unique constraint \"users_username_key\"")
+	}
+
+	u.username = newname
+	u.bio = bio
+	return nil
+}
+
+func (s *Store) GetUserByUsername(username string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return nil, err
+	}
+	return s.userModel(u), nil
+}
+
+// userModel converts a stored user to its API representation, callers must hold s.mu
+func (s *Store) userModel(u *user) *models.User {
+	return &models.User{
+		ID:            u.id,
+		Username:      u.username,
+		Email:         u.email,
+		EmailVerified: u.emailVerifiedAt != nil,
+		Bio:           u.bio,
+		Role:          u.role,
+		CreatedAt:     formatTime(u.createdAt),
+	}
+}
+
+func (s *Store) GetUserGrants(username string) (*models.Grants, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := models.Grants{Role: u.role, ModeratedCategories: []string{}}
+	for _, c := range s.categories {
+		if s.categoryModerators[pair{u.id, c.id}] {
+			grants.ModeratedCategories = append(grants.ModeratedCategories, c.name)
+		}
+	}
+	sort.Strings(grants.ModeratedCategories)
+	return &grants, nil
+}
+
+func (s *Store) SetUserRole(username string, role models.Role) error {
+	if !role.Valid() {
+		return fmt.Errorf("invalid role: %s", role)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+	u.role = role
+	return nil
+}
+
+func (s *Store) AddCategoryModerator(username, category string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+	categoryID, err := s.categoryID(category)
+	if err != nil {
+		return err
+	}
+
+	s.categoryModerators[pair{u.id, categoryID}] = true
+	return nil
+}
+
+func (s *Store) RemoveCategoryModerator(username, category string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+	categoryID, err := s.categoryID(category)
+	if err != nil {
+		return err
+	}
+
+	delete(s.categoryModerators, pair{u.id, categoryID})
+	return nil
+}
+
+func (s *Store) DeleteUser(username string, deleteContent bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+	if u.id == models.LeftUserID {
+		return models.ErrReservedUser
+	}
+
+	for key := range s.votes {
+		if key[1] == u.id {
+			delete(s.votes, key)
+		}
+	}
+	for key := range s.commentVotes {
+		if key[1] == u.id {
+			delete(s.commentVotes, key)
+		}
+	}
+	for key := range s.savedThreads {
+		if key[0] == u.id {
+			delete(s.savedThreads, key)
+		}
+	}
+
+	if deleteContent {
+		now := time.Now()
+		for _, t := range s.threads {
+			if t.userID == u.id && t.deletedAt == nil {
+				t.deletedAt = &now
+				t.deletedBy = 0
+			}
+		}
+		for id, c := range s.comments {
+			if c.userID != u.id {
+				continue
+			}
+			c.content = ""
+			if c.deletedAt == nil {
+				c.deletedAt = &now
+			}
+			c.deletedBy = 0
+			delete(s.commentRevisions, id)
+		}
+	}
+	for _, t := range s.threads {
+		if t.userID == u.id {
+			t.userID = models.LeftUserID
+		}
+	}
+	for _, c := range s.comments {
+		if c.userID == u.id {
+			c.userID = models.LeftUserID
+		}
+	}
+
+	// Emulate ON DELETE CASCADE, references that are set to NULL resolve to
+	// no user once the row is gone
+	for id, sess := range s.sessions {
+		if sess.userID == u.id {
+			delete(s.sessions, id)
+		}
+	}
+	for hash, rt := range s.refreshTokens {
+		if _, ok := s.sessions[rt.sessionID]; !ok {
+			delete(s.refreshTokens, hash)
+		}
+	}
+	for id, n := range s.notifications {
+		if n.userID == u.id {
+			delete(s.notifications, id)
+		}
+	}
+	for key := range s.notificationPrefs {
+		if key.userID == u.id {
+			delete(s.notificationPrefs, key)
+		}
+	}
+	for key := range s.categoryModerators {
+		if key[0] == u.id {
+			delete(s.categoryModerators, key)
+		}
+	}
+	for id, sanction := range s.sanctions {
+		if sanction.userID == u.id {
+			delete(s.sanctions, id)
+		}
+	}
+	for id, export := range s.dataExports {
+		if export.userID == u.id {
+			delete(s.dataExports, id)
+		}
+	}
+	for hash, token := range s.userTokens {
+		if token.userID == u.id {
+			delete(s.userTokens, hash)
+		}
+	}
+	for id, token := range s.apiTokens {
+		if token.userID == u.id {
+			delete(s.apiTokens, id)
+		}
+	}
+	delete(s.recoveryCodes, u.id)
+	delete(s.users, u.id)
+	return nil
+}
+
+func (s *Store) CreateUserToken(userID int, purpose models.TokenPurpose, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	for _, token := range s.userTokens {
+		if token.userID == userID && token.purpose == purpose && token.usedAt == nil {
+			token.usedAt = &now
+		}
+	}
+	if _, ok := s.userTokens[tokenHash]; ok {
+		return fmt.Errorf("duplicate key value violates unique constraint \"user_tokens_pkey\"")
+	}
+	s.userTokens[tokenHash] = &userToken{userID: userID, purpose: purpose, email: u.email, expiresAt: expiresAt}
+	return nil
+}
+
+// usableToken looks up a token that is unused, unexpired and was issued to the
+// current address of its user, callers must hold s.mu
+func (s *Store) usableToken(purpose models.TokenPurpose, tokenHash string) (*userToken, *user, error) {
+	token, ok := s.userTokens[tokenHash]
+	if !ok || token.purpose != purpose || token.usedAt != nil || !time.Now().Before(token.expiresAt) {
+		return nil, nil, sql.ErrNoRows
+	}
+	u, ok := s.users[token.userID]
+	if !ok || u.email != token.email {
+		return nil, nil, sql.ErrNoRows
+	}
+	return token, u, nil
+}
+
+func (s *Store) ConsumeUserToken(purpose models.TokenPurpose, tokenHash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, u, err := s.usableToken(purpose, tokenHash)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	token.usedAt = &now
+	return u.username, nil
+}
+
+func (s *Store) AttemptUserToken(purpose models.TokenPurpose, tokenHash string, maxAttempts int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, u, err := s.usableToken(purpose, tokenHash)
+	if err != nil {
+		return "", err
+	}
+	if token.attempts >= maxAttempts {
+		return "", sql.ErrNoRows
+	}
+	token.attempts++
+	return u.username, nil
+}
+
+func (s *Store) SetEmailVerified(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, err := s.userByName(username); err == nil && u.emailVerifiedAt == nil {
+		now := time.Now()
+		u.emailVerifiedAt = &now
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+func (s *Store) CreateVote(v *models.Vote) (*models.Vote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(v.Username)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.threads[v.ThreadID]; !ok {
+		return nil, fmt.Errorf("thread %d does not exist", v.ThreadID)
+	}
+	if v.Vote != 1 && v.Vote != -1 {
+		return nil, fmt.Errorf("vote must be -1 or 1")
+	}
+
+	// ON CONFLICT (thread_id, user_id) DO UPDATE
+	key := pair{v.ThreadID, u.id}
+	stored, ok := s.votes[key]
+	if !ok {
+		stored = &vote{id: s.nextID("votes"), threadID: v.ThreadID, userID: u.id, createdAt: time.Now()}
+		s.votes[key] = stored
+	}
+	stored.vote = v.Vote
+
+	v.ID = stored.id
+	return v, nil
+}
+
+func (s *Store) CountVote(threadID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.netVotes(threadID), nil
+}
+
+func (s *Store) DeleteVote(threadID int, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+
+	delete(s.votes, pair{threadID, u.id})
+	return nil
+}
+
+func (s *Store) GetVoteStateByUserID(threadID int, userID int) (*models.VoteState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.votes[pair{threadID, userID}]
+	if !ok {
+		return &models.VoteState{ThreadID: threadID, Vote: 0}, nil
+	}
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &models.VoteState{ThreadID: threadID, Username: u.username, Vote: v.vote}, nil
+}
+
+func (s *Store) CreateCommentVote(v *models.CommentVote) (*models.CommentVote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(v.Username)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.comments[v.CommentID]; !ok {
+		return nil, fmt.Errorf("comment %d does not exist", v.CommentID)
+	}
+	if v.Vote != 1 && v.Vote != -1 {
+		return nil, fmt.Errorf("vote must be -1 or 1")
+	}
+
+	// ON CONFLICT (comment_id, user_id) DO UPDATE
+	key := pair{v.CommentID, u.id}
+	stored, ok := s.commentVotes[key]
+	if !ok {
+		stored = &commentVote{id: s.nextID("comment_votes"), commentID: v.CommentID, userID: u.id, createdAt: time.Now()}
+		s.commentVotes[key] = stored
+	}
+	stored.vote = v.Vote
+
+	v.ID = stored.id
+	return v, nil
+}
+
+func (s *Store) DeleteCommentVote(commentID int, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+
+	delete(s.commentVotes, pair{commentID, u.id})
+	return nil
+}
+
+func (s *Store) CountCommentVote(commentID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commentScore(commentID), nil
+}
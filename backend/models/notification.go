@@ -0,0 +1,218 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type NotificationType string
+
+const (
+	NotifyThreadReply   NotificationType = "thread_reply"   // a top-level comment on the user's thread
+	NotifyCommentReply  NotificationType = "comment_reply"  // a reply to the user's comment
+	NotifyMention       NotificationType = "mention"        // an @username in a thread or comment
+	NotifyVoteMilestone NotificationType = "vote_milestone" // the user's thread or comment reached a score
+	NotifyModeration    NotificationType = "moderation"     // a moderator edited or deleted the user's content
+)
+
+// NotificationTypes lists every type, in the order preferences are shown
+var NotificationTypes = []NotificationType{
+	NotifyThreadReply,
+	NotifyCommentReply,
+	NotifyMention,
+	NotifyVoteMilestone,
+	NotifyModeration,
+}
+
+// Valid reports whether t is a known notification type
+func (t NotificationType) Valid() bool {
+	for _, known := range NotificationTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// VoteMilestones are the scores that trigger a vote_milestone notification
+var VoteMilestones = []int{10, 25, 50, 100, 250, 500, 1000, 5000, 10000}
+
+type Notification struct {
+	ID        int              `json:"id"`
+	Username  string           `json:"-"` // the recipient
+	Type      NotificationType `json:"type"`
+	Actor     string           `json:"actor"` // empty when the actor's account is gone
+	ThreadID  *int             `json:"thread_id"`
+	CommentID *int             `json:"comment_id"`
+	Message   string           `json:"message"`
+	Read      bool             `json:"read"`
+	CreatedAt time.Time        `json:"created_at"`
+	// DedupeKey, when set, makes sure the recipient is only notified once per key
+	DedupeKey string `json:"-"`
+}
+
+// CreateNotification stores a notification unless the recipient turned its type
+// off or was already notified with the same DedupeKey. It returns false when
+// nothing was stored.
+func CreateNotification(db *sql.DB, n *Notification) (bool, error) {
+	query := `
+		INSERT INTO notifications (user_id, actor_id, type, thread_id, comment_id, message, dedupe_key)
+		SELECT u.id, (SELECT id FROM users WHERE username = $2), $3, $4, $5, $6, NULLIF($7, '')
+		FROM users u
+		WHERE u.username = $1
+			AND NOT EXISTS(
+				SELECT 1 FROM notification_preferences p
+				WHERE p.user_id = u.id AND p.type = $3 AND NOT p.enabled
+			)
+		ON CONFLICT (user_id, dedupe_key) WHERE dedupe_key IS NOT NULL DO NOTHING
+		RETURNING id, created_at
+	`
+
+	err := db.QueryRow(query, n.Username, n.Actor, n.Type, n.ThreadID, n.CommentID, n.Message, n.DedupeKey).Scan(&n.ID, &n.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error creating notification: %v", err)
+	}
+	return true, nil
+}
+
+// GetNotifications lists a user's notifications, newest first
+func GetNotifications(db *sql.DB, username string, unreadOnly bool, page, limit int) ([]Notification, error) {
+	query := `
+		SELECT n.id, n.type, COALESCE(a.username, ''), n.thread_id, n.comment_id, n.message, n.read_at IS NOT NULL, n.created_at
+		FROM notifications n
+		INNER JOIN users u ON n.user_id = u.id
+		LEFT JOIN users a ON n.actor_id = a.id
+		WHERE u.username = $1 AND (NOT $2 OR n.read_at IS NULL)
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := db.Query(query, username, unreadOnly, limit, (page-1)*limit)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving notifications: %v", err)
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		n := Notification{Username: username}
+		var threadID, commentID sql.NullInt64
+		if err := rows.Scan(&n.ID, &n.Type, &n.Actor, &threadID, &commentID, &n.Message, &n.Read, &n.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning notification: %v", err)
+		}
+		if threadID.Valid {
+			id := int(threadID.Int64)
+			n.ThreadID = &id
+		}
+		if commentID.Valid {
+			id := int(commentID.Int64)
+			n.CommentID = &id
+		}
+		notifications = append(notifications, n)
+	}
+
+	return notifications, rows.Err()
+}
+
+// CountUnreadNotifications counts a user's unread notifications
+func CountUnreadNotifications(db *sql.DB, username string) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM notifications n
+		INNER JOIN users u ON n.user_id = u.id
+		WHERE u.username = $1 AND n.read_at IS NULL
+	`
+
+	var count int
+	err := db.QueryRow(query, username).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationRead marks one of a user's notifications as read, it returns
+// sql.ErrNoRows if the user has no such notification
+func MarkNotificationRead(db *sql.DB, username string, notificationID int) error {
+	query := `
+		UPDATE notifications n
+		SET read_at = COALESCE(n.read_at, NOW())
+		FROM users u
+		WHERE n.user_id = u.id AND u.username = $1 AND n.id = $2
+	`
+
+	result, err := db.Exec(query, username, notificationID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
+	}
+	return nil
+}
+
+// MarkAllNotificationsRead marks every unread notification of a user as read
+func MarkAllNotificationsRead(db *sql.DB, username string) error {
+	query := `
+		UPDATE notifications n
+		SET read_at = NOW()
+		FROM users u
+		WHERE n.user_id = u.id AND u.username = $1 AND n.read_at IS NULL
+	`
+
+	_, err := db.Exec(query, username)
+	return err
+}
+
+// GetNotificationPreferences returns whether each notification type is enabled for a user
+func GetNotificationPreferences(db *sql.DB, username string) (map[NotificationType]bool, error) {
+	query := `
+		SELECT p.type, p.enabled
+		FROM notification_preferences p
+		INNER JOIN users u ON p.user_id = u.id
+		WHERE u.username = $1
+	`
+
+	rows, err := db.Query(query, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	preferences := map[NotificationType]bool{}
+	for _, t := range NotificationTypes {
+		preferences[t] = true
+	}
+	for rows.Next() {
+		var t NotificationType
+		var enabled bool
+		if err := rows.Scan(&t, &enabled); err != nil {
+			return nil, err
+		}
+		preferences[t] = enabled
+	}
+
+	return preferences, rows.Err()
+}
+
+// SetNotificationPreference turns a notification type on or off for a user
+func SetNotificationPreference(db *sql.DB, username string, t NotificationType, enabled bool) error {
+	query := `
+		INSERT INTO notification_preferences (user_id, type, enabled)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, type) DO UPDATE
+		SET enabled = EXCLUDED.enabled
+	`
+
+	userID, err := GetUserIDByUsername(username, db)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(query, userID, t, enabled)
+	return err
+}
@@ -0,0 +1,445 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PostgresStore implements every store on top of the Postgres database
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+// ThreadStore methods
+
+func (s *PostgresStore) CreateThread(thread *Thread) (*Thread, error) {
+	return CreateThread(s.DB, thread)
+}
+
+func (s *PostgresStore) GetThreads(page int, limit int, category string, search SearchQuery, username string, sort string, period string, viewer string) ([]Thread, error) {
+	return GetThreads(s.DB, page, limit, category, search, username, sort, period, viewer)
+}
+
+func (s *PostgresStore) GetThreadByID(threadID int) (*Thread, error) {
+	return GetThreadByID(s.DB, threadID)
+}
+
+func (s *PostgresStore) GetThreadOwnerUsername(threadID int) (string, error) {
+	return GetThreadOwnerUsername(s.DB, threadID)
+}
+
+func (s *PostgresStore) GetThreadCategory(threadID int) (string, error) {
+	return GetThreadCategory(s.DB, threadID)
+}
+
+func (s *PostgresStore) EditThread(threadID int, thread *Thread, editedBy string) error {
+	return EditThread(s.DB, threadID, thread, editedBy)
+}
+
+func (s *PostgresStore) DeleteThread(threadID int, deletedBy string) error {
+	return DeleteThread(s.DB, threadID, deletedBy)
+}
+
+func (s *PostgresStore) GetDeletedThread(threadID int) (*Thread, error) {
+	return GetDeletedThread(s.DB, threadID)
+}
+
+func (s *PostgresStore) GetDeletedThreads(username string, since time.Time) ([]Thread, error) {
+	return GetDeletedThreads(s.DB, username, since)
+}
+
+func (s *PostgresStore) RestoreThread(threadID int) error {
+	return RestoreThread(s.DB, threadID)
+}
+
+func (s *PostgresStore) GetCategoryIDByName(name string) (int, error) {
+	return GetCategoryIDByName(name, s.DB)
+}
+
+func (s *PostgresStore) SaveThread(username string, threadID int) error {
+	return SaveThread(s.DB, username, threadID)
+}
+
+func (s *PostgresStore) RemoveSavedThread(username string, threadID int) error {
+	return RemoveSavedThread(s.DB, username, threadID)
+}
+
+func (s *PostgresStore) GetSavedThreads(username string, page, limit int) ([]Thread, error) {
+	return GetSavedThreads(s.DB, username, page, limit)
+}
+
+func (s *PostgresStore) CheckSavedState(username string, threadID int) (bool, error) {
+	return CheckSavedState(s.DB, username, threadID)
+}
+
+// CommentStore methods
+
+func (s *PostgresStore) CreateComment(comment *Comment) (*Comment, error) {
+	return CreateComment(s.DB, comment)
+}
+
+func (s *PostgresStore) GetCommentsByThreadID(threadID int, viewer string) ([]Comment, error) {
+	return GetCommentsByThreadID(s.DB, threadID, viewer)
+}
+
+func (s *PostgresStore) GetCommentByID(commentID int) (*Comment, error) {
+	return GetCommentByID(s.DB, commentID)
+}
+
+func (s *PostgresStore) EditComment(commentID int, newContent string, editedBy string) error {
+	return EditComment(s.DB, commentID, newContent, editedBy)
+}
+
+func (s *PostgresStore) DeleteComment(commentID int, deletedBy string) error {
+	return DeleteComment(s.DB, commentID, deletedBy)
+}
+
+func (s *PostgresStore) RestoreComment(commentID int) error {
+	return RestoreComment(s.DB, commentID)
+}
+
+func (s *PostgresStore) GetDeletedComments(username string, since time.Time) ([]Comment, error) {
+	return GetDeletedComments(s.DB, username, since)
+}
+
+func (s *PostgresStore) GetCommentOwnerUsername(commentID int) (string, error) {
+	return GetCommentOwnerUsername(s.DB, commentID)
+}
+
+func (s *PostgresStore) GetCommentCategory(commentID int) (string, error) {
+	return GetCommentCategory(s.DB, commentID)
+}
+
+func (s *PostgresStore) CountShadowbannedComments(threadID int, viewer string) (int, error) {
+	return CountShadowbannedComments(s.DB, threadID, viewer)
+}
+
+// VoteStore methods
+
+func (s *PostgresStore) CreateVote(vote *Vote) (*Vote, error) {
+	return CreateVote(s.DB, vote)
+}
+
+func (s *PostgresStore) CountVote(threadID int) (int, error) {
+	return CountVote(s.DB, threadID)
+}
+
+func (s *PostgresStore) DeleteVote(threadID int, username string) error {
+	return DeleteVote(s.DB, threadID, username)
+}
+
+func (s *PostgresStore) GetVoteStateByUserID(threadID int, userID int) (*VoteState, error) {
+	return GetVoteStateByUserID(s.DB, threadID, userID)
+}
+
+func (s *PostgresStore) CreateCommentVote(vote *CommentVote) (*CommentVote, error) {
+	return CreateCommentVote(s.DB, vote)
+}
+
+func (s *PostgresStore) DeleteCommentVote(commentID int, username string) error {
+	return DeleteCommentVote(s.DB, commentID, username)
+}
+
+func (s *PostgresStore) CountCommentVote(commentID int) (int, error) {
+	return CountCommentVote(s.DB, commentID)
+}
+
+// UserStore methods
+
+func (s *PostgresStore) CreateUser(username, passwordHash, email string) error {
+	return CreateUser(s.DB, username, passwordHash, email)
+}
+
+func (s *PostgresStore) GetUserIDByUsername(username string) (int, error) {
+	return GetUserIDByUsername(username, s.DB)
+}
+
+func (s *PostgresStore) GetUserIDByEmail(email string) (int, error) {
+	return GetUserIDByEmail(email, s.DB)
+}
+
+func (s *PostgresStore) GetUserPasswordByUsername(username string) (string, error) {
+	return GetUserPasswordByUsername(username, s.DB)
+}
+
+func (s *PostgresStore) UpdateUserPassword(username, passwordHash string) error {
+	return UpdateUserPassword(s.DB, username, passwordHash)
+}
+
+func (s *PostgresStore) UpdateUser(oldname, newname, bio string) error {
+	return UpdateUser(s.DB, oldname, newname, bio)
+}
+
+func (s *PostgresStore) GetUserByUsername(username string) (*User, error) {
+	return GetUserByUsername(s.DB, username)
+}
+
+func (s *PostgresStore) GetUserGrants(username string) (*Grants, error) {
+	return GetUserGrants(s.DB, username)
+}
+
+func (s *PostgresStore) SetUserRole(username string, role Role) error {
+	return SetUserRole(s.DB, username, role)
+}
+
+func (s *PostgresStore) AddCategoryModerator(username, category string) error {
+	return AddCategoryModerator(s.DB, username, category)
+}
+
+func (s *PostgresStore) RemoveCategoryModerator(username, category string) error {
+	return RemoveCategoryModerator(s.DB, username, category)
+}
+
+func (s *PostgresStore) DeleteUser(username string, deleteContent bool) error {
+	return DeleteUser(s.DB, username, deleteContent)
+}
+
+func (s *PostgresStore) CreateUserToken(userID int, purpose TokenPurpose, tokenHash string, expiresAt time.Time) error {
+	return CreateUserToken(s.DB, userID, purpose, tokenHash, expiresAt)
+}
+
+func (s *PostgresStore) ConsumeUserToken(purpose TokenPurpose, tokenHash string) (string, error) {
+	return ConsumeUserToken(s.DB, purpose, tokenHash)
+}
+
+func (s *PostgresStore) AttemptUserToken(purpose TokenPurpose, tokenHash string, maxAttempts int) (string, error) {
+	return AttemptUserToken(s.DB, purpose, tokenHash, maxAttempts)
+}
+
+func (s *PostgresStore) SetEmailVerified(username string) error {
+	return SetEmailVerified(s.DB, username)
+}
+
+// TagStore methods
+
+func (s *PostgresStore) GetOrCreateTagID(tagName string) (int, error) {
+	return GetOrCreateTagID(s.DB, tagName)
+}
+
+func (s *PostgresStore) AssociateThreadTags(threadID int, tagIDs []int) error {
+	return AssociateThreadTags(s.DB, threadID, tagIDs)
+}
+
+// SessionStore methods
+
+func (s *PostgresStore) CreateSession(session *Session, refreshTokenHash string) (*Session, error) {
+	return CreateSession(s.DB, session, refreshTokenHash)
+}
+
+func (s *PostgresStore) RotateRefreshToken(oldTokenHash, newTokenHash string) (*Session, error) {
+	return RotateRefreshToken(s.DB, oldTokenHash, newTokenHash)
+}
+
+func (s *PostgresStore) IsSessionActive(sessionID, username string) (bool, error) {
+	return IsSessionActive(s.DB, sessionID, username)
+}
+
+func (s *PostgresStore) RevokeSession(sessionID string) error {
+	return RevokeSession(s.DB, sessionID)
+}
+
+func (s *PostgresStore) RevokeUserSessions(username string) error {
+	return RevokeUserSessions(s.DB, username)
+}
+
+// NotificationStore methods
+
+func (s *PostgresStore) CreateNotification(notification *Notification) (bool, error) {
+	return CreateNotification(s.DB, notification)
+}
+
+func (s *PostgresStore) GetNotifications(username string, unreadOnly bool, page, limit int) ([]Notification, error) {
+	return GetNotifications(s.DB, username, unreadOnly, page, limit)
+}
+
+func (s *PostgresStore) CountUnreadNotifications(username string) (int, error) {
+	return CountUnreadNotifications(s.DB, username)
+}
+
+func (s *PostgresStore) MarkNotificationRead(username string, notificationID int) error {
+	return MarkNotificationRead(s.DB, username, notificationID)
+}
+
+func (s *PostgresStore) MarkAllNotificationsRead(username string) error {
+	return MarkAllNotificationsRead(s.DB, username)
+}
+
+func (s *PostgresStore) GetNotificationPreferences(username string) (map[NotificationType]bool, error) {
+	return GetNotificationPreferences(s.DB, username)
+}
+
+func (s *PostgresStore) SetNotificationPreference(username string, t NotificationType, enabled bool) error {
+	return SetNotificationPreference(s.DB, username, t, enabled)
+}
+
+// ReportStore methods
+
+func (s *PostgresStore) CreateReport(report *Report) (bool, error) {
+	return CreateReport(s.DB, report)
+}
+
+func (s *PostgresStore) GetReportCases(filter ReportFilter, page, limit int) ([]ReportCase, error) {
+	return GetReportCases(s.DB, filter, page, limit)
+}
+
+func (s *PostgresStore) GetReportCase(caseID int) (*ReportCase, error) {
+	return GetReportCase(s.DB, caseID)
+}
+
+func (s *PostgresStore) ClaimReportCase(caseID int, username string) error {
+	return ClaimReportCase(s.DB, caseID, username)
+}
+
+func (s *PostgresStore) ReleaseReportCase(caseID int, username string) error {
+	return ReleaseReportCase(s.DB, caseID, username)
+}
+
+func (s *PostgresStore) ResolveReportCase(caseID int, username string, resolution ReportResolution, note string) error {
+	return ResolveReportCase(s.DB, caseID, username, resolution, note)
+}
+
+// SanctionStore methods
+
+func (s *PostgresStore) CreateSanction(sanction *Sanction) (*Sanction, error) {
+	return CreateSanction(s.DB, sanction)
+}
+
+func (s *PostgresStore) GetSanctions(username string, activeOnly bool) ([]Sanction, error) {
+	return GetSanctions(s.DB, username, activeOnly)
+}
+
+func (s *PostgresStore) GetSanction(sanctionID int) (*Sanction, error) {
+	return GetSanction(s.DB, sanctionID)
+}
+
+func (s *PostgresStore) RevokeSanction(sanctionID int, revokedBy string) error {
+	return RevokeSanction(s.DB, sanctionID, revokedBy)
+}
+
+// AuditStore methods
+
+func (s *PostgresStore) CreateAuditEntry(entry *AuditEntry) error {
+	return CreateAuditEntry(s.DB, entry)
+}
+
+func (s *PostgresStore) GetAuditEntries(filter AuditFilter, page, limit int) ([]AuditEntry, error) {
+	return GetAuditEntries(s.DB, filter, page, limit)
+}
+
+// RevisionStore methods
+
+func (s *PostgresStore) GetThreadRevisions(threadID int) ([]ThreadRevision, error) {
+	return GetThreadRevisions(s.DB, threadID)
+}
+
+func (s *PostgresStore) RevertThread(threadID, revision int, editedBy string) error {
+	return RevertThread(s.DB, threadID, revision, editedBy)
+}
+
+func (s *PostgresStore) GetCommentRevisions(commentID int) ([]CommentRevision, error) {
+	return GetCommentRevisions(s.DB, commentID)
+}
+
+func (s *PostgresStore) RevertComment(commentID, revision int, editedBy string) error {
+	return RevertComment(s.DB, commentID, revision, editedBy)
+}
+
+// ExportStore methods
+
+func (s *PostgresStore) CreateDataExport(username string) (*DataExport, error) {
+	return CreateDataExport(s.DB, username)
+}
+
+func (s *PostgresStore) GetDataExport(exportID int) (*DataExport, error) {
+	return GetDataExport(s.DB, exportID)
+}
+
+func (s *PostgresStore) GetLatestDataExport(username string) (*DataExport, error) {
+	return GetLatestDataExport(s.DB, username)
+}
+
+func (s *PostgresStore) CompleteDataExport(exportID int, archive []byte, expiresAt time.Time) error {
+	return CompleteDataExport(s.DB, exportID, archive, expiresAt)
+}
+
+func (s *PostgresStore) FailDataExport(exportID int, message string) error {
+	return FailDataExport(s.DB, exportID, message)
+}
+
+func (s *PostgresStore) GetDataExportArchive(exportID int) ([]byte, error) {
+	return GetDataExportArchive(s.DB, exportID)
+}
+
+func (s *PostgresStore) GetUserData(username string) (*UserData, error) {
+	return GetUserData(s.DB, username)
+}
+
+// TwoFactorStore methods
+
+func (s *PostgresStore) GetTwoFactor(username string) (*TwoFactor, error) {
+	return GetTwoFactor(s.DB, username)
+}
+
+func (s *PostgresStore) SetTOTPSecret(username, secret string) error {
+	return SetTOTPSecret(s.DB, username, secret)
+}
+
+func (s *PostgresStore) EnableTwoFactor(username string, step int64, codeHashes []string) error {
+	return EnableTwoFactor(s.DB, username, step, codeHashes)
+}
+
+func (s *PostgresStore) DisableTwoFactor(username string) error {
+	return DisableTwoFactor(s.DB, username)
+}
+
+func (s *PostgresStore) UseTOTPStep(username string, step int64) (bool, error) {
+	return UseTOTPStep(s.DB, username, step)
+}
+
+func (s *PostgresStore) UseRecoveryCode(username, codeHash string) (bool, error) {
+	return UseRecoveryCode(s.DB, username, codeHash)
+}
+
+func (s *PostgresStore) ReplaceRecoveryCodes(username string, codeHashes []string) error {
+	return ReplaceRecoveryCodes(s.DB, username, codeHashes)
+}
+
+// LoginFailureStore methods
+
+func (s *PostgresStore) GetLoginLock(scope LoginScope, subject string) (*time.Time, error) {
+	return GetLoginLock(s.DB, scope, subject)
+}
+
+func (s *PostgresStore) ReserveLoginAttempt(scope LoginScope, subject string) (*time.Time, error) {
+	return ReserveLoginAttempt(s.DB, scope, subject)
+}
+
+func (s *PostgresStore) RefundLoginAttempt(scope LoginScope, subject string) error {
+	return RefundLoginAttempt(s.DB, scope, subject)
+}
+
+func (s *PostgresStore) ClearLoginFailures(scope LoginScope, subject string) error {
+	return ClearLoginFailures(s.DB, scope, subject)
+}
+
+// APITokenStore methods
+
+func (s *PostgresStore) CreateAPIToken(username, name string, scopes []TokenScope, expiresAt time.Time, tokenHash string) (*APIToken, error) {
+	return CreateAPIToken(s.DB, username, name, scopes, expiresAt, tokenHash)
+}
+
+func (s *PostgresStore) GetAPITokens(username string) ([]APIToken, error) {
+	return GetAPITokens(s.DB, username)
+}
+
+func (s *PostgresStore) UseAPIToken(tokenHash string) (string, []TokenScope, error) {
+	return UseAPIToken(s.DB, tokenHash)
+}
+
+func (s *PostgresStore) DeleteAPIToken(username string, tokenID int) error {
+	return DeleteAPIToken(s.DB, username, tokenID)
+}
+
+func (s *PostgresStore) DeleteUserAPITokens(username string) error {
+	return DeleteUserAPITokens(s.DB, username)
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// ThreadRanking orders thread listings for one value of the sort query parameter.
+// Rankings are written twice, as SQL for Postgres and in Go for stores that
+// rank in memory, and both must agree.
+type ThreadRanking struct {
+	// OrderBy is an SQL expression ranking threads in descending order. It may use
+	// the columns of threads t, such as t.upvotes, t.downvotes and t.created_at.
+	OrderBy string
+	// Rank computes the same value as OrderBy
+	Rank func(upvotes, downvotes int, createdAt, now time.Time) float64
+	// MaxAge, when set, only ranks threads younger than it
+	MaxAge time.Duration
+}
+
+// DefaultThreadSort lists the newest threads first
+const DefaultThreadSort = "new"
+
+// hotEpoch is subtracted from creation times so that hot ranks stay small numbers
+var hotEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var threadRankings = map[string]ThreadRanking{
+	// new lists threads newest first
+	"new": {
+		OrderBy: `EXTRACT(EPOCH FROM t.created_at)::float8`,
+		Rank: func(upvotes, downvotes int, createdAt, now time.Time) float64 {
+			return float64(createdAt.Unix())
+		},
+	},
+
+	// top ranks threads by net votes, usually combined with a period
+	"top": {
+		OrderBy: `(t.upvotes - t.downvotes)::float8`,
+		Rank: func(upvotes, downvotes int, createdAt, now time.Time) float64 {
+			return float64(upvotes - downvotes)
+		},
+	},
+
+	// hot follows Reddit: the order of magnitude of the score plus a bonus for
+	// newer threads, so every 12.5 hours are worth ten times the votes
+	"hot": {
+		OrderBy: `SIGN((t.upvotes - t.downvotes)::float8) * LOG(GREATEST(ABS(t.upvotes - t.downvotes), 1)::float8)
+			+ EXTRACT(EPOCH FROM t.created_at - TIMESTAMP '2024-01-01 00:00:00')::float8 / 45000`,
+		Rank: func(upvotes, downvotes int, createdAt, now time.Time) float64 {
+			score := float64(upvotes - downvotes)
+			sign := 0.0
+			if score > 0 {
+				sign = 1
+			} else if score < 0 {
+				sign = -1
+			}
+			return sign*math.Log10(math.Max(math.Abs(score), 1)) + float64(createdAt.Unix()-hotEpoch.Unix())/45000
+		},
+	},
+
+	// rising follows Hacker News: the score divided by a power of the age in
+	// hours, limited to threads from the last day
+	"rising": {
+		OrderBy: `(t.upvotes - t.downvotes)::float8 / POWER(EXTRACT(EPOCH FROM LOCALTIMESTAMP - t.created_at)::float8 / 3600 + 2, 1.8)`,
+		Rank: func(upvotes, downvotes int, createdAt, now time.Time) float64 {
+			return float64(upvotes-downvotes) / math.Pow(now.Sub(createdAt).Hours()+2, 1.8)
+		},
+		MaxAge: 24 * time.Hour,
+	},
+
+	// controversial follows Reddit: many votes split evenly between up and down
+	"controversial": {
+		OrderBy: `CASE WHEN t.upvotes = 0 OR t.downvotes = 0 THEN 0
+			ELSE POWER((t.upvotes + t.downvotes)::float8, LEAST(t.upvotes, t.downvotes)::float8 / GREATEST(t.upvotes, t.downvotes)) END`,
+		Rank: func(upvotes, downvotes int, createdAt, now time.Time) float64 {
+			if upvotes == 0 || downvotes == 0 {
+				return 0
+			}
+			balance := float64(min(upvotes, downvotes)) / float64(max(upvotes, downvotes))
+			return math.Pow(float64(upvotes+downvotes), balance)
+		},
+	},
+}
+
+func init() {
+	// trending predates the ranking subsystem and means all-time top
+	RegisterThreadRanking("trending", threadRankings["top"])
+}
+
+// RegisterThreadRanking adds or replaces the ranking used for sort=name
+func RegisterThreadRanking(name string, ranking ThreadRanking) {
+	threadRankings[name] = ranking
+}
+
+// GetThreadRanking returns the ranking for a sort value, unknown and empty
+// values fall back to newest first
+func GetThreadRanking(sort string) ThreadRanking {
+	if ranking, ok := threadRankings[sort]; ok {
+		return ranking
+	}
+	return threadRankings[DefaultThreadSort]
+}
+
+// ThreadPeriods are the values of the t query parameter, limiting listings to
+// threads created within the period. Zero means no limit.
+var ThreadPeriods = map[string]time.Duration{
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+	"all":   0,
+}
+
+// ThreadMaxAge combines a ranking's own age limit with the requested period,
+// returning the tighter of the two or zero when neither applies
+func ThreadMaxAge(ranking ThreadRanking, period string) time.Duration {
+	maxAge := ThreadPeriods[period]
+	if ranking.MaxAge > 0 && (maxAge == 0 || ranking.MaxAge < maxAge) {
+		maxAge = ranking.MaxAge
+	}
+	return maxAge
+}
@@ -0,0 +1,528 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type ReportReason string
+
+const (
+	ReportSpam           ReportReason = "spam"
+	ReportHarassment     ReportReason = "harassment"
+	ReportHate           ReportReason = "hate"
+	ReportViolence       ReportReason = "violence"
+	ReportSexual         ReportReason = "sexual"
+	ReportMisinformation ReportReason = "misinformation"
+	ReportOffTopic       ReportReason = "off_topic"
+	ReportOther          ReportReason = "other" // requires details
+)
+
+// ReportReasons lists every reason users can give for a report
+var ReportReasons = []ReportReason{
+	ReportSpam,
+	ReportHarassment,
+	ReportHate,
+	ReportViolence,
+	ReportSexual,
+	ReportMisinformation,
+	ReportOffTopic,
+	ReportOther,
+}
+
+// Valid reports whether r is a known reason
+func (r ReportReason) Valid() bool {
+	for _, known := range ReportReasons {
+		if r == known {
+			return true
+		}
+	}
+	return false
+}
+
+type ReportResolution string
+
+const (
+	ResolveDismiss ReportResolution = "dismiss" // nothing wrong, the content is shown again
+	ResolveRemove  ReportResolution = "remove"  // the content is deleted
+	ResolveWarn    ReportResolution = "warn"    // the author is warned, the content is shown again
+)
+
+// Valid reports whether r is a known resolution
+func (r ReportResolution) Valid() bool {
+	return r == ResolveDismiss || r == ResolveRemove || r == ResolveWarn
+}
+
+const (
+	ReportTargetThread  = "thread"
+	ReportTargetComment = "comment"
+)
+
+const (
+	ReportStatusOpen     = "open"
+	ReportStatusResolved = "resolved"
+)
+
+// ReportHideThreshold is how many users must report the same content before it
+// is hidden until a moderator reviews it, zero never hides content
+var ReportHideThreshold = 3
+
+var (
+	ErrAlreadyReported    = errors.New("content already reported by this user")
+	ErrReportCaseClaimed  = errors.New("report case claimed by another moderator")
+	ErrReportCaseResolved = errors.New("report case already resolved")
+)
+
+// Report is one user's report of a thread, or of a comment when CommentID is set
+type Report struct {
+	ID        int          `json:"id"`
+	CaseID    int          `json:"case_id"`
+	ThreadID  int          `json:"thread_id"`
+	CommentID *int         `json:"comment_id"`
+	Reporter  string       `json:"reporter"` // empty when the reporter's account is gone
+	Reason    ReportReason `json:"reason"`
+	Details   string       `json:"details"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// ReportCase groups the reports on one thread or comment for moderators. The
+// author, category and excerpt are copied when the first report arrives.
+type ReportCase struct {
+	ID          int                  `json:"id"`
+	TargetType  string               `json:"target_type"`
+	TargetID    int                  `json:"target_id"`
+	ThreadID    *int                 `json:"thread_id"`  // nil once the thread is gone
+	CommentID   *int                 `json:"comment_id"` // nil once the comment is gone
+	Category    string               `json:"category"`
+	Author      string               `json:"author"`
+	Excerpt     string               `json:"excerpt"`
+	Hidden      bool                 `json:"hidden"`
+	Status      string               `json:"status"`
+	ReportCount int                  `json:"report_count"`
+	Reasons     map[ReportReason]int `json:"reasons"`
+	ClaimedBy   string               `json:"claimed_by"`
+	ClaimedAt   *time.Time           `json:"claimed_at"`
+	Resolution  ReportResolution     `json:"resolution"`
+	ResolvedBy  string               `json:"resolved_by"`
+	ResolvedAt  *time.Time           `json:"resolved_at"`
+	Note        string               `json:"note"`
+	CreatedAt   time.Time            `json:"created_at"`
+	Reports     []Report             `json:"reports,omitempty"`
+}
+
+// ReportFilter selects report cases for the moderation queue
+type ReportFilter struct {
+	Status     string   // open or resolved
+	Categories []string // nil for every category
+	ClaimedBy  string   // empty for any
+}
+
+// excerptLength is how much of the reported content a case keeps
+const excerptLength = 500
+
+// CreateReport files a report, opening a case for its target unless one is
+// open already, and hides the target once ReportHideThreshold users reported
+// it. It returns whether this report hid the target, sql.ErrNoRows if the
+// target does not exist and ErrAlreadyReported if the user reported it before.
+func CreateReport(db *sql.DB, report *Report) (bool, error) {
+	reporterID, err := GetUserIDByUsername(report.Reporter, db)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Lock the target so that concurrent reports share one case
+	targetType, targetID, table := ReportTargetThread, report.ThreadID, "threads"
+	target := `
+		SELECT t.user_id, t.category_id, LEFT(t.title || E'\n\n' || t.content, $2), t.hidden_at IS NOT NULL
+		FROM threads t
+		WHERE t.id = $1
+		FOR UPDATE
+	`
+	if report.CommentID != nil {
+		targetType, targetID, table = ReportTargetComment, *report.CommentID, "comments"
+		target = `
+			SELECT c.user_id, t.category_id, LEFT(c.content, $2), c.hidden_at IS NOT NULL
+			FROM comments c
+			INNER JOIN threads t ON c.thread_id = t.id
+			WHERE c.id = $1 AND c.thread_id = $3
+			FOR UPDATE OF c
+		`
+	}
+	var authorID, categoryID int
+	var excerpt string
+	var hidden bool
+	args := []interface{}{targetID, excerptLength}
+	if report.CommentID != nil {
+		args = append(args, report.ThreadID)
+	}
+	if err := tx.QueryRow(target, args...).Scan(&authorID, &categoryID, &excerpt, &hidden); err != nil {
+		return false, err
+	}
+
+	err = tx.QueryRow(`
+		SELECT id FROM report_cases
+		WHERE target_type = $1 AND target_id = $2 AND status = 'open'
+	`, targetType, targetID).Scan(&report.CaseID)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow(`
+			INSERT INTO report_cases (target_type, target_id, thread_id, comment_id, category_id, author_id, excerpt)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id
+		`, targetType, targetID, report.ThreadID, report.CommentID, categoryID, authorID, excerpt).Scan(&report.CaseID)
+	}
+	if err != nil {
+		return false, fmt.Errorf("error opening report case: %v", err)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO reports (case_id, reporter_id, reason, details)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (case_id, reporter_id) DO NOTHING
+		RETURNING id, created_at
+	`, report.CaseID, reporterID, report.Reason, report.Details).Scan(&report.ID, &report.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, ErrAlreadyReported
+	}
+	if err != nil {
+		return false, fmt.Errorf("error creating report: %v", err)
+	}
+
+	hide := false
+	if !hidden && ReportHideThreshold > 0 {
+		var count int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM reports WHERE case_id = $1`, report.CaseID).Scan(&count); err != nil {
+			return false, err
+		}
+		if count >= ReportHideThreshold {
+			hide = true
+			if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET hidden_at = NOW() WHERE id = $1`, table), targetID); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return hide, tx.Commit()
+}
+
+// reportCaseColumns selects a report case rc, without its reasons and reports
+const reportCaseColumns = `
+	rc.id, rc.target_type, rc.target_id, rc.thread_id, rc.comment_id,
+	COALESCE(cat.name, ''), COALESCE(au.username, ''), rc.excerpt,
+	COALESCE(CASE rc.target_type WHEN 'thread' THEN th.hidden_at IS NOT NULL ELSE cm.hidden_at IS NOT NULL END, FALSE),
+	rc.status, (SELECT COUNT(*) FROM reports r WHERE r.case_id = rc.id),
+	COALESCE(cu.username, ''), rc.claimed_at, COALESCE(rc.resolution, ''), COALESCE(ru.username, ''), rc.resolved_at,
+	rc.note, rc.created_at
+`
+
+// reportCaseJoins joins the tables reportCaseColumns uses
+const reportCaseJoins = `
+	FROM report_cases rc
+	LEFT JOIN categories cat ON rc.category_id = cat.id
+	LEFT JOIN users au ON rc.author_id = au.id
+	LEFT JOIN users cu ON rc.claimed_by = cu.id
+	LEFT JOIN users ru ON rc.resolved_by = ru.id
+	LEFT JOIN threads th ON rc.thread_id = th.id
+	LEFT JOIN comments cm ON rc.comment_id = cm.id
+`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReportCase(row rowScanner) (ReportCase, error) {
+	var rc ReportCase
+	var threadID, commentID sql.NullInt64
+	err := row.Scan(&rc.ID, &rc.TargetType, &rc.TargetID, &threadID, &commentID,
+		&rc.Category, &rc.Author, &rc.Excerpt, &rc.Hidden, &rc.Status, &rc.ReportCount,
+		&rc.ClaimedBy, &rc.ClaimedAt, &rc.Resolution, &rc.ResolvedBy, &rc.ResolvedAt,
+		&rc.Note, &rc.CreatedAt)
+	if threadID.Valid {
+		id := int(threadID.Int64)
+		rc.ThreadID = &id
+	}
+	if commentID.Valid {
+		id := int(commentID.Int64)
+		rc.CommentID = &id
+	}
+	rc.Reasons = map[ReportReason]int{}
+	return rc, err
+}
+
+// GetReportCases lists report cases for the moderation queue, open cases oldest
+// first and resolved cases most recently resolved first
+func GetReportCases(db *sql.DB, filter ReportFilter, page, limit int) ([]ReportCase, error) {
+	order := "rc.created_at ASC, rc.id ASC"
+	if filter.Status == ReportStatusResolved {
+		order = "rc.resolved_at DESC, rc.id DESC"
+	}
+	query := fmt.Sprintf(`
+		SELECT %s
+		%s
+		WHERE rc.status = $1
+			AND ($2::text[] IS NULL OR cat.name = ANY($2))
+			AND ($3 = '' OR cu.username = $3)
+		ORDER BY %s
+		LIMIT $4 OFFSET $5
+	`, reportCaseColumns, reportCaseJoins, order)
+
+	var categories interface{}
+	if filter.Categories != nil {
+		categories = pq.Array(filter.Categories)
+	}
+	rows, err := db.Query(query, filter.Status, categories, filter.ClaimedBy, limit, (page-1)*limit)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving report cases: %v", err)
+	}
+	defer rows.Close()
+
+	cases := []ReportCase{}
+	ids := []int64{}
+	for rows.Next() {
+		rc, err := scanReportCase(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning report case: %v", err)
+		}
+		cases = append(cases, rc)
+		ids = append(ids, int64(rc.ID))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Count the reasons given in each case
+	reasonRows, err := db.Query(`
+		SELECT case_id, reason, COUNT(*)
+		FROM reports
+		WHERE case_id = ANY($1)
+		GROUP BY case_id, reason
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("error counting report reasons: %v", err)
+	}
+	defer reasonRows.Close()
+
+	byID := map[int]*ReportCase{}
+	for i := range cases {
+		byID[cases[i].ID] = &cases[i]
+	}
+	for reasonRows.Next() {
+		var caseID, count int
+		var reason ReportReason
+		if err := reasonRows.Scan(&caseID, &reason, &count); err != nil {
+			return nil, err
+		}
+		byID[caseID].Reasons[reason] = count
+	}
+
+	return cases, reasonRows.Err()
+}
+
+// GetReportCase returns a report case with every report in it
+func GetReportCase(db *sql.DB, caseID int) (*ReportCase, error) {
+	query := fmt.Sprintf(`SELECT %s %s WHERE rc.id = $1`, reportCaseColumns, reportCaseJoins)
+	rc, err := scanReportCase(db.QueryRow(query, caseID))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT r.id, COALESCE(u.username, ''), r.reason, r.details, r.created_at
+		FROM reports r
+		LEFT JOIN users u ON r.reporter_id = u.id
+		WHERE r.case_id = $1
+		ORDER BY r.created_at ASC, r.id ASC
+	`, caseID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving reports: %v", err)
+	}
+	defer rows.Close()
+
+	rc.Reports = []Report{}
+	for rows.Next() {
+		report := Report{CaseID: rc.ID}
+		if rc.ThreadID != nil {
+			report.ThreadID = *rc.ThreadID
+		}
+		report.CommentID = rc.CommentID
+		if err := rows.Scan(&report.ID, &report.Reporter, &report.Reason, &report.Details, &report.CreatedAt); err != nil {
+			return nil, err
+		}
+		rc.Reasons[report.Reason]++
+		rc.Reports = append(rc.Reports, report)
+	}
+
+	return &rc, rows.Err()
+}
+
+// lockReportCase locks an open case for a moderator. It returns sql.ErrNoRows if
+// there is no such case, ErrReportCaseResolved if it is closed and
+// ErrReportCaseClaimed if another moderator claimed it.
+func lockReportCase(tx *sql.Tx, caseID, moderatorID int) (*ReportCase, error) {
+	var rc ReportCase
+	var claimedBy sql.NullInt64
+	err := tx.QueryRow(`
+		SELECT target_type, target_id, status, claimed_by
+		FROM report_cases
+		WHERE id = $1
+		FOR UPDATE
+	`, caseID).Scan(&rc.TargetType, &rc.TargetID, &rc.Status, &claimedBy)
+	if err != nil {
+		return nil, err
+	}
+	if rc.Status == ReportStatusResolved {
+		return nil, ErrReportCaseResolved
+	}
+	if claimedBy.Valid && int(claimedBy.Int64) != moderatorID {
+		return nil, ErrReportCaseClaimed
+	}
+	rc.ID = caseID
+	return &rc, nil
+}
+
+// ClaimReportCase assigns an open case to a moderator, see lockReportCase for the errors
+func ClaimReportCase(db *sql.DB, caseID int, username string) error {
+	moderatorID, err := GetUserIDByUsername(username, db)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockReportCase(tx, caseID, moderatorID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE report_cases
+		SET claimed_by = $1, claimed_at = COALESCE(claimed_at, NOW())
+		WHERE id = $2
+	`, moderatorID, caseID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReleaseReportCase gives up a moderator's claim on an open case, see lockReportCase for the errors
+func ReleaseReportCase(db *sql.DB, caseID int, username string) error {
+	moderatorID, err := GetUserIDByUsername(username, db)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockReportCase(tx, caseID, moderatorID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE report_cases SET claimed_by = NULL, claimed_at = NULL WHERE id = $1`, caseID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResolveReportCase closes an open case that is unclaimed or claimed by the
+// moderator, showing the content again or moving it to the trash, all in one
+// transaction so that only the moderator who closes the case removes its
+// content. See lockReportCase for the errors.
+func ResolveReportCase(db *sql.DB, caseID int, username string, resolution ReportResolution, note string) error {
+	moderatorID, err := GetUserIDByUsername(username, db)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the thread and then the comment before the case, in the order of
+	// every other writer. Neither the target of a case nor the thread of a
+	// comment ever changes, so the unlocked reads are safe.
+	var targetType string
+	var targetID int
+	var caseThreadID sql.NullInt64
+	err = tx.QueryRow(`SELECT target_type, target_id, thread_id FROM report_cases WHERE id = $1`, caseID).Scan(&targetType, &targetID, &caseThreadID)
+	if err != nil {
+		return err
+	}
+	threadID := int(caseThreadID.Int64)
+	targetExists := caseThreadID.Valid
+	if targetExists {
+		if err := lockThread(tx, threadID); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			targetExists = false
+		}
+	}
+	if targetExists && targetType == ReportTargetComment {
+		var id int
+		err := tx.QueryRow(`SELECT id FROM comments WHERE id = $1 FOR UPDATE`, targetID).Scan(&id)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			targetExists = false
+		}
+	}
+
+	if _, err := lockReportCase(tx, caseID, moderatorID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE report_cases
+		SET status = 'resolved', resolution = $1, resolved_by = $2, resolved_at = NOW(), note = $3,
+			claimed_by = COALESCE(claimed_by, $2), claimed_at = COALESCE(claimed_at, NOW())
+		WHERE id = $4
+	`, resolution, moderatorID, note, caseID)
+	if err != nil {
+		return err
+	}
+	if !targetExists {
+		return tx.Commit()
+	}
+
+	switch {
+	case resolution != ResolveRemove:
+		table := "threads"
+		if targetType == ReportTargetComment {
+			table = "comments"
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET hidden_at = NULL WHERE id = $1`, table), targetID); err != nil {
+			return err
+		}
+	case targetType == ReportTargetComment:
+		err := setCommentDeletedTx(tx, targetID, threadID, true, username)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	default:
+		_, err := tx.Exec(`UPDATE threads SET deleted_at = NOW(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL`, targetID, moderatorID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
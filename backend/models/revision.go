@@ -0,0 +1,223 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ThreadRevision is one version of a thread, revision 1 being the original
+type ThreadRevision struct {
+	Revision  int       `json:"revision"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Category  string    `json:"category"`
+	Tags      []string  `json:"tags"`
+	EditedBy  string    `json:"edited_by"` // empty when the editor's account is gone
+	CreatedAt time.Time `json:"created_at"`
+	// Diff is the unified diff from the previous revision, left out when the
+	// two are too large to diff
+	Diff         string `json:"diff,omitempty"`
+	DiffTooLarge bool   `json:"diff_too_large,omitempty"`
+}
+
+// Text renders the revision as the plain text that diffs compare
+func (r ThreadRevision) Text() string {
+	return fmt.Sprintf("Title: %s\nCategory: %s\nTags: %s\n\n%s", r.Title, r.Category, strings.Join(r.Tags, ", "), r.Content)
+}
+
+// CommentRevision is one version of a comment, revision 1 being the original
+type CommentRevision struct {
+	Revision     int       `json:"revision"`
+	Content      string    `json:"content"`
+	EditedBy     string    `json:"edited_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	Diff         string    `json:"diff,omitempty"`
+	DiffTooLarge bool      `json:"diff_too_large,omitempty"`
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// recordThreadRevision stores the current state of a thread as its next
+// revision. Edits after the first revision also set the thread's edited_at.
+func recordThreadRevision(db execer, threadID int, editedBy string) error {
+	query := `
+		INSERT INTO thread_revisions (thread_id, revision, title, content, category_id, tags, edited_by)
+		SELECT t.id,
+			COALESCE((SELECT MAX(r.revision) FROM thread_revisions r WHERE r.thread_id = t.id), 0) + 1,
+			t.title, t.content, t.category_id,
+			ARRAY(SELECT tg.name::TEXT FROM thread_tags tt INNER JOIN tags tg ON tt.tag_id = tg.id WHERE tt.thread_id = t.id ORDER BY tt.tag_id),
+			(SELECT id FROM users WHERE username = $2)
+		FROM threads t
+		WHERE t.id = $1
+	`
+	if _, err := db.Exec(query, threadID, editedBy); err != nil {
+		return fmt.Errorf("error recording thread revision: %v", err)
+	}
+	_, err := db.Exec(`
+		UPDATE threads SET edited_at = NOW()
+		WHERE id = $1 AND (SELECT COUNT(*) FROM thread_revisions WHERE thread_id = $1) > 1
+	`, threadID)
+	return err
+}
+
+// recordCommentRevision stores the current content of a comment as its next
+// revision, setting its edited_at after the first
+func recordCommentRevision(db execer, commentID int, editedBy string) error {
+	query := `
+		INSERT INTO comment_revisions (comment_id, revision, content, edited_by)
+		SELECT c.id,
+			COALESCE((SELECT MAX(r.revision) FROM comment_revisions r WHERE r.comment_id = c.id), 0) + 1,
+			c.content,
+			(SELECT id FROM users WHERE username = $2)
+		FROM comments c
+		WHERE c.id = $1
+	`
+	if _, err := db.Exec(query, commentID, editedBy); err != nil {
+		return fmt.Errorf("error recording comment revision: %v", err)
+	}
+	_, err := db.Exec(`
+		UPDATE comments SET edited_at = NOW()
+		WHERE id = $1 AND (SELECT COUNT(*) FROM comment_revisions WHERE comment_id = $1) > 1
+	`, commentID)
+	return err
+}
+
+// GetThreadRevisions lists the revisions of a thread, oldest first
+func GetThreadRevisions(db *sql.DB, threadID int) ([]ThreadRevision, error) {
+	query := `
+		SELECT r.revision, r.title, r.content, c.name, r.tags, COALESCE(u.username, ''), r.created_at
+		FROM thread_revisions r
+		INNER JOIN categories c ON r.category_id = c.id
+		LEFT JOIN users u ON r.edited_by = u.id
+		WHERE r.thread_id = $1
+		ORDER BY r.revision
+	`
+	rows, err := db.Query(query, threadID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving thread revisions: %v", err)
+	}
+	defer rows.Close()
+
+	revisions := []ThreadRevision{}
+	for rows.Next() {
+		var r ThreadRevision
+		if err := rows.Scan(&r.Revision, &r.Title, &r.Content, &r.Category, pq.Array(&r.Tags), &r.EditedBy, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning thread revision: %v", err)
+		}
+		if r.Tags == nil {
+			r.Tags = []string{}
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// GetCommentRevisions lists the revisions of a comment, oldest first
+func GetCommentRevisions(db *sql.DB, commentID int) ([]CommentRevision, error) {
+	query := `
+		SELECT r.revision, r.content, COALESCE(u.username, ''), r.created_at
+		FROM comment_revisions r
+		LEFT JOIN users u ON r.edited_by = u.id
+		WHERE r.comment_id = $1
+		ORDER BY r.revision
+	`
+	rows, err := db.Query(query, commentID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving comment revisions: %v", err)
+	}
+	defer rows.Close()
+
+	revisions := []CommentRevision{}
+	for rows.Next() {
+		var r CommentRevision
+		if err := rows.Scan(&r.Revision, &r.Content, &r.EditedBy, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning comment revision: %v", err)
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// RevertThread restores the title, content, category and tags of a thread from
+// one of its revisions, which is recorded as a new revision. It returns
+// sql.ErrNoRows if the thread has no such revision.
+func RevertThread(db *sql.DB, threadID, revision int, editedBy string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var tags []string
+	err = tx.QueryRow(`
+		UPDATE threads t
+		SET title = r.title, content = r.content, category_id = r.category_id
+		FROM thread_revisions r
+		WHERE t.id = $1 AND r.thread_id = t.id AND r.revision = $2
+		RETURNING r.tags
+	`, threadID, revision).Scan(pq.Array(&tags))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM thread_tags WHERE thread_id = $1`, threadID); err != nil {
+		return fmt.Errorf("failed to delete existing tags: %w", err)
+	}
+	for _, name := range tags {
+		var tagID int
+		err := tx.QueryRow(`
+			INSERT INTO tags (name) VALUES ($1)
+			ON CONFLICT (name) DO UPDATE SET name = tags.name
+			RETURNING id
+		`, name).Scan(&tagID)
+		if err != nil {
+			return fmt.Errorf("failed to resolve tag ID for %s: %w", name, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO thread_tags (thread_id, tag_id) VALUES ($1, $2)`, threadID, tagID); err != nil {
+			return fmt.Errorf("failed to associate tag %s: %w", name, err)
+		}
+	}
+
+	if err := recordThreadRevision(tx, threadID, editedBy); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevertComment restores the content of a comment from one of its revisions,
+// which is recorded as a new revision. It returns sql.ErrNoRows if the comment
+// has no such revision.
+func RevertComment(db *sql.DB, commentID, revision int, editedBy string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE comments c
+		SET content = r.content
+		FROM comment_revisions r
+		WHERE c.id = $1 AND r.comment_id = c.id AND r.revision = $2
+	`, commentID, revision)
+	if err != nil {
+		return fmt.Errorf("error reverting comment: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := recordCommentRevision(tx, commentID, editedBy); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
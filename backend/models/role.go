@@ -0,0 +1,166 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+type Permission string
+
+const (
+	PermEditAnyThread    Permission = "thread:edit_any"
+	PermDeleteAnyThread  Permission = "thread:delete_any"
+	PermEditAnyComment   Permission = "comment:edit_any"
+	PermDeleteAnyComment Permission = "comment:delete_any"
+	PermReviewReports    Permission = "report:review"
+	PermSanctionUsers    Permission = "user:sanction"
+	PermManageRoles      Permission = "user:manage_roles"
+	PermViewAuditLog     Permission = "audit:view"
+)
+
+// moderatorPermissions are granted site-wide to moderators and per category to category moderators
+var moderatorPermissions = []Permission{
+	PermEditAnyThread,
+	PermDeleteAnyThread,
+	PermEditAnyComment,
+	PermDeleteAnyComment,
+	PermReviewReports,
+	PermSanctionUsers,
+}
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser:      {},
+	RoleModerator: moderatorPermissions,
+	RoleAdmin:     append([]Permission{PermManageRoles, PermViewAuditLog}, moderatorPermissions...),
+}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// HasPermission reports whether r grants perm site-wide
+func (r Role) HasPermission(perm Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Grants describes what a user is allowed to do, it is carried in the JWT claims
+type Grants struct {
+	Role                Role     `json:"role"`
+	ModeratedCategories []string `json:"moderated_categories"`
+}
+
+// Can reports whether the grants allow perm on content in category
+func (g Grants) Can(perm Permission, category string) bool {
+	if g.Role.HasPermission(perm) {
+		return true
+	}
+	for _, moderated := range g.ModeratedCategories {
+		if moderated == category {
+			for _, p := range moderatorPermissions {
+				if p == perm {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Privileged reports whether the grants give any rights beyond those of users
+func (g Grants) Privileged() bool {
+	return g.Role != RoleUser || len(g.ModeratedCategories) > 0
+}
+
+// GetUserGrants returns the role and moderated categories of a user
+func GetUserGrants(db *sql.DB, username string) (*Grants, error) {
+	query := `
+		SELECT u.role, ARRAY_REMOVE(ARRAY_AGG(c.name ORDER BY c.name), NULL)
+		FROM users u
+		LEFT JOIN category_moderators cm ON u.id = cm.user_id
+		LEFT JOIN categories c ON cm.category_id = c.id
+		WHERE u.username = $1
+		GROUP BY u.id, u.role
+	`
+
+	var grants Grants
+	err := db.QueryRow(query, username).Scan(&grants.Role, pq.Array(&grants.ModeratedCategories))
+	if err != nil {
+		return nil, err
+	}
+	if grants.ModeratedCategories == nil {
+		grants.ModeratedCategories = []string{}
+	}
+	return &grants, nil
+}
+
+// SetUserRole changes the site-wide role of a user
+func SetUserRole(db *sql.DB, username string, role Role) error {
+	if !role.Valid() {
+		return fmt.Errorf("invalid role: %s", role)
+	}
+
+	result, err := db.Exec(`UPDATE users SET role = $1 WHERE username = $2`, role, username)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AddCategoryModerator makes a user moderator of a single category
+func AddCategoryModerator(db *sql.DB, username, category string) error {
+	userID, err := GetUserIDByUsername(username, db)
+	if err != nil {
+		return err
+	}
+	categoryID, err := GetCategoryIDByName(category, db)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO category_moderators (user_id, category_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	_, err = db.Exec(query, userID, categoryID)
+	return err
+}
+
+// RemoveCategoryModerator revokes a user's moderator rights in a category
+func RemoveCategoryModerator(db *sql.DB, username, category string) error {
+	userID, err := GetUserIDByUsername(username, db)
+	if err != nil {
+		return err
+	}
+	categoryID, err := GetCategoryIDByName(category, db)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`DELETE FROM category_moderators WHERE user_id = $1 AND category_id = $2`, userID, categoryID)
+	return err
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type SanctionType string
+
+const (
+	SanctionSuspension SanctionType = "suspension" // stops the user writing until it expires
+	SanctionBan        SanctionType = "ban"        // stops the user writing for good
+	SanctionShadowban  SanctionType = "shadowban"  // hides the user's content from everyone else
+)
+
+// Valid reports whether t is a known sanction type
+func (t SanctionType) Valid() bool {
+	return t == SanctionSuspension || t == SanctionBan || t == SanctionShadowban
+}
+
+var ErrSanctionInactive = errors.New("sanction already expired or revoked")
+
+// Sanction restricts a user site-wide, or in one category when Category is set
+type Sanction struct {
+	ID        int          `json:"id"`
+	Username  string       `json:"username"`
+	Type      SanctionType `json:"type"`
+	Category  string       `json:"category"` // empty for site-wide sanctions
+	Reason    string       `json:"reason"`
+	IssuedBy  string       `json:"issued_by"`  // empty when the moderator's account is gone
+	ExpiresAt *time.Time   `json:"expires_at"` // nil for permanent sanctions
+	RevokedAt *time.Time   `json:"revoked_at"`
+	RevokedBy string       `json:"revoked_by"`
+	Active    bool         `json:"active"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// Restricts reports whether the sanction stops its user writing in category
+func (s Sanction) Restricts(category string) bool {
+	if !s.Active || s.Type == SanctionShadowban {
+		return false
+	}
+	return s.Category == "" || s.Category == category
+}
+
+// RestrictingSanction returns the sanction that stops a user writing in
+// category, preferring bans over suspensions and site-wide over per category
+// sanctions, or nil if none does
+func RestrictingSanction(sanctions []Sanction, category string) *Sanction {
+	var found *Sanction
+	for i := range sanctions {
+		s := &sanctions[i]
+		if !s.Restricts(category) {
+			continue
+		}
+		switch {
+		case found == nil:
+			found = s
+		case s.Type == SanctionBan && found.Type != SanctionBan:
+			found = s
+		case s.Type == found.Type && s.Category == "" && found.Category != "":
+			found = s
+		}
+	}
+	return found
+}
+
+// Shadowbanned reports whether one of the sanctions is an active shadowban
+func Shadowbanned(sanctions []Sanction) bool {
+	for _, s := range sanctions {
+		if s.Active && s.Type == SanctionShadowban {
+			return true
+		}
+	}
+	return false
+}
+
+// shadowbannedSQL tests whether the user whose ID is in the given column is
+// shadowbanned, for use with fmt.Sprintf
+const shadowbannedSQL = `EXISTS(
+	SELECT 1 FROM user_sanctions sb
+	WHERE sb.user_id = %s AND sb.type = 'shadowban' AND sb.revoked_at IS NULL
+		AND (sb.expires_at IS NULL OR sb.expires_at > NOW())
+)`
+
+// CreateSanction stores a new sanction issued by sanction.IssuedBy. It returns
+// sql.ErrNoRows if the user or the category does not exist.
+func CreateSanction(db *sql.DB, sanction *Sanction) (*Sanction, error) {
+	userID, err := GetUserIDByUsername(sanction.Username, db)
+	if err != nil {
+		return nil, err
+	}
+	var categoryID sql.NullInt64
+	if sanction.Category != "" {
+		id, err := GetCategoryIDByName(sanction.Category, db)
+		if err != nil {
+			return nil, err
+		}
+		categoryID = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+
+	query := `
+		INSERT INTO user_sanctions (user_id, type, category_id, reason, issued_by, expires_at)
+		VALUES ($1, $2, $3, $4, (SELECT id FROM users WHERE username = $5), $6)
+		RETURNING id, created_at
+	`
+	err = db.QueryRow(query, userID, sanction.Type, categoryID, sanction.Reason, sanction.IssuedBy, sanction.ExpiresAt).Scan(&sanction.ID, &sanction.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating sanction: %v", err)
+	}
+	sanction.Active = true
+	return sanction, nil
+}
+
+// sanctionQuery selects sanctions s with their user, category and moderators
+const sanctionQuery = `
+	SELECT s.id, u.username, s.type, COALESCE(c.name, ''), s.reason, COALESCE(iu.username, ''),
+		s.expires_at, s.revoked_at, COALESCE(ru.username, ''),
+		s.revoked_at IS NULL AND (s.expires_at IS NULL OR s.expires_at > NOW()),
+		s.created_at
+	FROM user_sanctions s
+	INNER JOIN users u ON s.user_id = u.id
+	LEFT JOIN categories c ON s.category_id = c.id
+	LEFT JOIN users iu ON s.issued_by = iu.id
+	LEFT JOIN users ru ON s.revoked_by = ru.id
+`
+
+func scanSanction(row rowScanner) (Sanction, error) {
+	var s Sanction
+	err := row.Scan(&s.ID, &s.Username, &s.Type, &s.Category, &s.Reason, &s.IssuedBy,
+		&s.ExpiresAt, &s.RevokedAt, &s.RevokedBy, &s.Active, &s.CreatedAt)
+	return s, err
+}
+
+// GetSanctions lists the sanctions of a user, newest first, or only those in
+// force when activeOnly is set
+func GetSanctions(db *sql.DB, username string, activeOnly bool) ([]Sanction, error) {
+	query := sanctionQuery + `
+		WHERE u.username = $1
+			AND (NOT $2 OR (s.revoked_at IS NULL AND (s.expires_at IS NULL OR s.expires_at > NOW())))
+		ORDER BY s.created_at DESC, s.id DESC
+	`
+	rows, err := db.Query(query, username, activeOnly)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving sanctions: %v", err)
+	}
+	defer rows.Close()
+
+	sanctions := []Sanction{}
+	for rows.Next() {
+		s, err := scanSanction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning sanction: %v", err)
+		}
+		sanctions = append(sanctions, s)
+	}
+	return sanctions, rows.Err()
+}
+
+// GetSanction returns one sanction
+func GetSanction(db *sql.DB, sanctionID int) (*Sanction, error) {
+	s, err := scanSanction(db.QueryRow(sanctionQuery+` WHERE s.id = $1`, sanctionID))
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// RevokeSanction lifts a sanction early. It returns sql.ErrNoRows if there is no
+// such sanction and ErrSanctionInactive if it already expired or was revoked.
+func RevokeSanction(db *sql.DB, sanctionID int, revokedBy string) error {
+	result, err := db.Exec(`
+		UPDATE user_sanctions
+		SET revoked_at = NOW(), revoked_by = (SELECT id FROM users WHERE username = $2)
+		WHERE id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`, sanctionID, revokedBy)
+	if err != nil {
+		return fmt.Errorf("error revoking sanction: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected > 0 {
+		return err
+	}
+
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_sanctions WHERE id = $1)`, sanctionID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return ErrSanctionInactive
+}
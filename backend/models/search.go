@@ -0,0 +1,125 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SearchConfig is the Postgres text search configuration used for threads
+const SearchConfig = "english"
+
+// RelevanceSort orders searches by how well threads match the free text, it is
+// the default for searches with free text
+const RelevanceSort = "relevance"
+
+// SearchQuery is a parsed thread search. Free text is matched against the
+// title, tags and content, while the filters must all hold.
+//
+//	golang "error handling" -generics tag:go author:alice category:technology after:2024-01-01 before:2024-02-01
+type SearchQuery struct {
+	Words      []string // single words, a leading "-" excludes the word
+	Phrases    []string // quoted phrases, matched as consecutive words
+	Tags       []string // every tag must be on the thread
+	Authors    []string // the thread must be by one of the authors
+	Categories []string // the thread must be in one of the categories
+	Before     *time.Time
+	After      *time.Time
+}
+
+// ParseSearchQuery parses the search syntax. Dates in before: and after: are
+// either 2006-01-02 (midnight UTC) or RFC 3339 timestamps.
+func ParseSearchQuery(input string) (SearchQuery, error) {
+	var query SearchQuery
+
+	for _, token := range tokenizeSearch(input) {
+		if strings.HasPrefix(token, `"`) {
+			if phrase := strings.TrimSpace(strings.Trim(token, `"`)); phrase != "" {
+				query.Phrases = append(query.Phrases, phrase)
+			}
+			continue
+		}
+
+		key, value, found := strings.Cut(token, ":")
+		value = strings.TrimSpace(strings.Trim(value, `"`))
+		if found && value != "" {
+			switch strings.ToLower(key) {
+			case "tag":
+				query.Tags = append(query.Tags, value)
+				continue
+			case "author":
+				query.Authors = append(query.Authors, value)
+				continue
+			case "category":
+				query.Categories = append(query.Categories, value)
+				continue
+			case "before", "after":
+				date, err := parseSearchDate(value)
+				if err != nil {
+					return query, fmt.Errorf("invalid %s date %q", strings.ToLower(key), value)
+				}
+				if strings.ToLower(key) == "before" {
+					query.Before = &date
+				} else {
+					query.After = &date
+				}
+				continue
+			}
+		}
+
+		if word := strings.Trim(token, `"`); word != "" && word != "-" {
+			query.Words = append(query.Words, word)
+		}
+	}
+
+	return query, nil
+}
+
+// tokenizeSearch splits input on whitespace, keeping quoted sections together
+func tokenizeSearch(input string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+
+	return tokens
+}
+
+func parseSearchDate(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Text returns the free text part of the query in the websearch_to_tsquery syntax
+func (q SearchQuery) Text() string {
+	parts := append([]string{}, q.Words...)
+	for _, phrase := range q.Phrases {
+		parts = append(parts, `"`+phrase+`"`)
+	}
+	return strings.Join(parts, " ")
+}
+
+// IsEmpty reports whether the query neither matches text nor filters
+func (q SearchQuery) IsEmpty() bool {
+	return q.Text() == "" && len(q.Tags) == 0 && len(q.Authors) == 0 && len(q.Categories) == 0 && q.Before == nil && q.After == nil
+}
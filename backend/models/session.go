@@ -0,0 +1,170 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Session struct {
+	ID         string     `json:"id"`
+	Username   string     `json:"username"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenReused   = errors.New("refresh token reuse detected")
+	ErrSessionRevoked       = errors.New("session has been revoked")
+	ErrSessionExpired       = errors.New("session has expired")
+)
+
+// CreateSession starts a new login session and stores the hash of its first refresh token
+func CreateSession(db *sql.DB, session *Session, refreshTokenHash string) (*Session, error) {
+	userID, err := GetUserIDByUsername(session.Username, db)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO sessions (id, user_id, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at, last_used_at
+	`
+	err = tx.QueryRow(query, session.ID, userID, session.UserAgent, session.IPAddress, session.ExpiresAt).
+		Scan(&session.CreatedAt, &session.LastUsedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating session: %v", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO refresh_tokens (token_hash, session_id) VALUES ($1, $2)`, refreshTokenHash, session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error storing refresh token: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one within the same session.
+// Presenting a token that was already rotated revokes the whole session, since
+// it means the token was stolen or replayed.
+func RotateRefreshToken(db *sql.DB, oldTokenHash, newTokenHash string) (*Session, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT s.id, u.username, s.user_agent, s.ip_address, s.created_at, s.last_used_at, s.expires_at, s.revoked_at, rt.used_at
+		FROM refresh_tokens rt
+		INNER JOIN sessions s ON rt.session_id = s.id
+		INNER JOIN users u ON s.user_id = u.id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt, s
+	`
+
+	var session Session
+	var revokedAt, usedAt sql.NullTime
+	err = tx.QueryRow(query, oldTokenHash).Scan(
+		&session.ID,
+		&session.Username,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&revokedAt,
+		&usedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, fmt.Errorf("error querying refresh token: %v", err)
+	}
+
+	if revokedAt.Valid {
+		return nil, ErrSessionRevoked
+	}
+	if usedAt.Valid {
+		// Reuse of a rotated token, kill the session for everyone holding it
+		if _, err := tx.Exec(`UPDATE sessions SET revoked_at = NOW() WHERE id = $1`, session.ID); err != nil {
+			return nil, fmt.Errorf("error revoking session: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionExpired
+	}
+
+	if _, err := tx.Exec(`UPDATE refresh_tokens SET used_at = NOW() WHERE token_hash = $1`, oldTokenHash); err != nil {
+		return nil, fmt.Errorf("error marking refresh token as used: %v", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO refresh_tokens (token_hash, session_id) VALUES ($1, $2)`, newTokenHash, session.ID); err != nil {
+		return nil, fmt.Errorf("error storing refresh token: %v", err)
+	}
+	err = tx.QueryRow(`UPDATE sessions SET last_used_at = NOW() WHERE id = $1 RETURNING last_used_at`, session.ID).Scan(&session.LastUsedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error updating session: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// IsSessionActive reports whether a session exists for the user and is neither revoked nor expired
+func IsSessionActive(db *sql.DB, sessionID, username string) (bool, error) {
+	query := `
+		SELECT EXISTS(
+			SELECT 1
+			FROM sessions s
+			INNER JOIN users u ON s.user_id = u.id
+			WHERE s.id = $1 AND u.username = $2 AND s.revoked_at IS NULL AND s.expires_at > NOW()
+		)
+	`
+
+	var active bool
+	err := db.QueryRow(query, sessionID, username).Scan(&active)
+	if err != nil {
+		return false, err
+	}
+	return active, nil
+}
+
+// RevokeSession revokes a single session
+func RevokeSession(db *sql.DB, sessionID string) error {
+	_, err := db.Exec(`UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, sessionID)
+	return err
+}
+
+// RevokeUserSessions revokes every session of a user
+func RevokeUserSessions(db *sql.DB, username string) error {
+	userID, err := GetUserIDByUsername(username, db)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	return err
+}
@@ -0,0 +1,224 @@
+package models
+
+import (
+	"backend/auth"
+	"backend/mail"
+	"backend/realtime"
+	"database/sql"
+	"time"
+)
+
+// ThreadStore persists threads, their categories and users' saved threads.
+// Deleted threads are only found through the methods for the trash.
+type ThreadStore interface {
+	CreateThread(thread *Thread) (*Thread, error)
+	GetThreads(page int, limit int, category string, search SearchQuery, username string, sort string, period string, viewer string) ([]Thread, error)
+	GetThreadByID(threadID int) (*Thread, error)
+	GetThreadOwnerUsername(threadID int) (string, error)
+	GetThreadCategory(threadID int) (string, error)
+	EditThread(threadID int, thread *Thread, editedBy string) error
+	DeleteThread(threadID int, deletedBy string) error
+	GetDeletedThread(threadID int) (*Thread, error)
+	GetDeletedThreads(username string, since time.Time) ([]Thread, error)
+	RestoreThread(threadID int) error
+	GetCategoryIDByName(name string) (int, error)
+	SaveThread(username string, threadID int) error
+	RemoveSavedThread(username string, threadID int) error
+	GetSavedThreads(username string, page, limit int) ([]Thread, error)
+	CheckSavedState(username string, threadID int) (bool, error)
+}
+
+// CommentStore persists comments on threads
+type CommentStore interface {
+	CreateComment(comment *Comment) (*Comment, error)
+	GetCommentsByThreadID(threadID int, viewer string) ([]Comment, error)
+	GetCommentByID(commentID int) (*Comment, error)
+	EditComment(commentID int, newContent string, editedBy string) error
+	DeleteComment(commentID int, deletedBy string) error
+	RestoreComment(commentID int) error
+	GetDeletedComments(username string, since time.Time) ([]Comment, error)
+	GetCommentOwnerUsername(commentID int) (string, error)
+	GetCommentCategory(commentID int) (string, error)
+	CountShadowbannedComments(threadID int, viewer string) (int, error)
+}
+
+// VoteStore persists votes on threads and comments
+type VoteStore interface {
+	CreateVote(vote *Vote) (*Vote, error)
+	CountVote(threadID int) (int, error)
+	DeleteVote(threadID int, username string) error
+	GetVoteStateByUserID(threadID int, userID int) (*VoteState, error)
+	CreateCommentVote(vote *CommentVote) (*CommentVote, error)
+	DeleteCommentVote(commentID int, username string) error
+	CountCommentVote(commentID int) (int, error)
+}
+
+// UserStore persists user accounts and their roles
+type UserStore interface {
+	CreateUser(username, passwordHash, email string) error
+	GetUserIDByUsername(username string) (int, error)
+	GetUserIDByEmail(email string) (int, error)
+	GetUserPasswordByUsername(username string) (string, error)
+	UpdateUserPassword(username, passwordHash string) error
+	UpdateUser(oldname, newname, bio string) error
+	GetUserByUsername(username string) (*User, error)
+	GetUserGrants(username string) (*Grants, error)
+	SetUserRole(username string, role Role) error
+	AddCategoryModerator(username, category string) error
+	RemoveCategoryModerator(username, category string) error
+	DeleteUser(username string, deleteContent bool) error
+	CreateUserToken(userID int, purpose TokenPurpose, tokenHash string, expiresAt time.Time) error
+	ConsumeUserToken(purpose TokenPurpose, tokenHash string) (string, error)
+	AttemptUserToken(purpose TokenPurpose, tokenHash string, maxAttempts int) (string, error)
+	SetEmailVerified(username string) error
+}
+
+// TagStore persists tags and their association with threads
+type TagStore interface {
+	GetOrCreateTagID(tagName string) (int, error)
+	AssociateThreadTags(threadID int, tagIDs []int) error
+}
+
+// SessionStore persists login sessions and their refresh tokens
+type SessionStore interface {
+	CreateSession(session *Session, refreshTokenHash string) (*Session, error)
+	RotateRefreshToken(oldTokenHash, newTokenHash string) (*Session, error)
+	IsSessionActive(sessionID, username string) (bool, error)
+	RevokeSession(sessionID string) error
+	RevokeUserSessions(username string) error
+}
+
+// NotificationStore persists in-app notifications and which types users want
+type NotificationStore interface {
+	CreateNotification(notification *Notification) (bool, error)
+	GetNotifications(username string, unreadOnly bool, page, limit int) ([]Notification, error)
+	CountUnreadNotifications(username string) (int, error)
+	MarkNotificationRead(username string, notificationID int) error
+	MarkAllNotificationsRead(username string) error
+	GetNotificationPreferences(username string) (map[NotificationType]bool, error)
+	SetNotificationPreference(username string, t NotificationType, enabled bool) error
+}
+
+// ReportStore persists users' reports and the moderation queue of report cases
+type ReportStore interface {
+	CreateReport(report *Report) (bool, error)
+	GetReportCases(filter ReportFilter, page, limit int) ([]ReportCase, error)
+	GetReportCase(caseID int) (*ReportCase, error)
+	ClaimReportCase(caseID int, username string) error
+	ReleaseReportCase(caseID int, username string) error
+	ResolveReportCase(caseID int, username string, resolution ReportResolution, note string) error
+}
+
+// SanctionStore persists the suspensions, bans and shadowbans of users
+type SanctionStore interface {
+	CreateSanction(sanction *Sanction) (*Sanction, error)
+	GetSanctions(username string, activeOnly bool) ([]Sanction, error)
+	GetSanction(sanctionID int) (*Sanction, error)
+	RevokeSanction(sanctionID int, revokedBy string) error
+}
+
+// AuditStore persists the append-only log of privileged and destructive actions
+type AuditStore interface {
+	CreateAuditEntry(entry *AuditEntry) error
+	GetAuditEntries(filter AuditFilter, page, limit int) ([]AuditEntry, error)
+}
+
+// RevisionStore persists the edit history of threads and comments
+type RevisionStore interface {
+	GetThreadRevisions(threadID int) ([]ThreadRevision, error)
+	RevertThread(threadID, revision int, editedBy string) error
+	GetCommentRevisions(commentID int) ([]CommentRevision, error)
+	RevertComment(commentID, revision int, editedBy string) error
+}
+
+// ExportStore persists the data exports of users and collects their data
+type ExportStore interface {
+	CreateDataExport(username string) (*DataExport, error)
+	GetDataExport(exportID int) (*DataExport, error)
+	GetLatestDataExport(username string) (*DataExport, error)
+	CompleteDataExport(exportID int, archive []byte, expiresAt time.Time) error
+	FailDataExport(exportID int, message string) error
+	GetDataExportArchive(exportID int) ([]byte, error)
+	GetUserData(username string) (*UserData, error)
+}
+
+// TwoFactorStore persists the TOTP enrollments and recovery codes of users
+type TwoFactorStore interface {
+	GetTwoFactor(username string) (*TwoFactor, error)
+	SetTOTPSecret(username, secret string) error
+	EnableTwoFactor(username string, step int64, codeHashes []string) error
+	DisableTwoFactor(username string) error
+	UseTOTPStep(username string, step int64) (bool, error)
+	UseRecoveryCode(username, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(username string, codeHashes []string) error
+}
+
+// LoginFailureStore persists the failed logins that lock out password guessing
+type LoginFailureStore interface {
+	GetLoginLock(scope LoginScope, subject string) (*time.Time, error)
+	ReserveLoginAttempt(scope LoginScope, subject string) (*time.Time, error)
+	RefundLoginAttempt(scope LoginScope, subject string) error
+	ClearLoginFailures(scope LoginScope, subject string) error
+}
+
+// APITokenStore persists the personal API tokens of users
+type APITokenStore interface {
+	CreateAPIToken(username, name string, scopes []TokenScope, expiresAt time.Time, tokenHash string) (*APIToken, error)
+	GetAPITokens(username string) ([]APIToken, error)
+	UseAPIToken(tokenHash string) (string, []TokenScope, error)
+	DeleteAPIToken(username string, tokenID int) error
+	DeleteUserAPITokens(username string) error
+}
+
+// Store groups every store the controllers depend on
+type Store struct {
+	Threads       ThreadStore
+	Comments      CommentStore
+	Votes         VoteStore
+	Users         UserStore
+	Tags          TagStore
+	Sessions      SessionStore
+	Notifications NotificationStore
+	Reports       ReportStore
+	Sanctions     SanctionStore
+	Audit         AuditStore
+	Revisions     RevisionStore
+	Exports       ExportStore
+	TwoFactor     TwoFactorStore
+	LoginFailures LoginFailureStore
+	APITokens     APITokenStore
+	// Events carries real-time updates to the clients streaming them
+	Events *realtime.Hub
+	// Presence tracks who has each thread open over the WebSocket gateway
+	Presence *realtime.Presence
+	// Mailer delivers the emails sent to users
+	Mailer mail.Mailer
+	// JWT signs and verifies access tokens
+	JWT *auth.Service
+}
+
+// NewPostgresStore returns a Store backed by the Postgres database
+func NewPostgresStore(db *sql.DB) *Store {
+	pg := &PostgresStore{DB: db}
+	return &Store{
+		Threads:       pg,
+		Comments:      pg,
+		Votes:         pg,
+		Users:         pg,
+		Tags:          pg,
+		Sessions:      pg,
+		Notifications: pg,
+		Reports:       pg,
+		Sanctions:     pg,
+		Audit:         pg,
+		Revisions:     pg,
+		Exports:       pg,
+		TwoFactor:     pg,
+		LoginFailures: pg,
+		APITokens:     pg,
+		Events:        realtime.NewHub(),
+		Presence:      realtime.NewPresence(),
+		Mailer:        &mail.FileMailer{},
+		JWT:           auth.Ephemeral(auth.DefaultIssuer, auth.DefaultIssuer),
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -15,8 +16,25 @@ type Thread struct {
 	Content   string   `json:"content"`
 	Category  string   `json:"category"`
 	Tags      []string `json:"tags"`
-	Votes     int      `json:"votes"`
-	CreatedAt string   `json:"created_at"`
+	Votes     int      `json:"votes"` // net score, upvotes minus downvotes
+	Upvotes   int      `json:"upvotes"`
+	Downvotes int      `json:"downvotes"`
+	// CommentCount excludes deleted comments
+	CommentCount int    `json:"comment_count"`
+	CreatedAt    string `json:"created_at"`
+	// EditedAt is nil until the thread is first edited, RevisionCount counts
+	// the original as the first revision
+	EditedAt      *time.Time `json:"edited_at"`
+	RevisionCount int        `json:"revision_count"`
+	// Hidden threads were reported by several users and wait for a moderator
+	Hidden bool `json:"hidden"`
+	// Snippet is an excerpt of the content around the search terms, which are
+	// wrapped in <mark> tags. The content is HTML escaped, so the <mark> tags
+	// are its only markup.
+	Snippet string `json:"snippet,omitempty"`
+	// DeletedAt and DeletedBy are only set for threads in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"-"`
 }
 
 func CreateThread(db *sql.DB, thread *Thread) (*Thread, error) {
@@ -55,15 +73,60 @@ func CreateThread(db *sql.DB, thread *Thread) (*Thread, error) {
 		}
 	}
 
+	// The original is the first revision
+	if err := recordThreadRevision(db, thread.ID, thread.Username); err != nil {
+		return nil, err
+	}
+	thread.RevisionCount = 1
+
 	return thread, nil
 }
 
-func GetThreads(db *sql.DB, page int, limit int, category string, search string, username string, sort string) ([]Thread, error) {
+// escapedContentSQL is the content of the thread t with the HTML special
+// characters escaped like html.EscapeString does
+const escapedContentSQL = `replace(replace(replace(replace(replace(t.content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`
+
+// visibleCommentCountSQL is the comment count of the thread t as seen by the
+// viewer whose username is in the given placeholder, which leaves out the
+// comments of shadowbanned users other than the viewer, for use with fmt.Sprintf
+var visibleCommentCountSQL = `t.comment_count - (
+	SELECT COUNT(*) FROM comments sc
+	INNER JOIN users su ON sc.user_id = su.id
+	WHERE sc.thread_id = t.id AND sc.deleted_at IS NULL AND su.username <> %s AND ` + fmt.Sprintf(shadowbannedSQL, "sc.user_id") + `
+)`
+
+// GetThreads lists threads matching the filters, ordered by the ranking for sort.
+// Searches with free text are ordered by relevance unless another sort is given.
+// period (the t query parameter) limits the listing to recent threads. Threads of
+// shadowbanned users are only listed for viewer when they wrote them, and their
+// comments are only counted for them. Deleted threads are never listed.
+func GetThreads(db *sql.DB, page int, limit int, category string, search SearchQuery, username string, sort string, period string, viewer string) ([]Thread, error) {
 	offset := (page - 1) * limit
+	ranking := GetThreadRanking(sort)
+
+	// The viewer is always the first argument
+	whereClause := "WHERE t.hidden_at IS NULL AND t.deleted_at IS NULL"
+	args := []interface{}{viewer}
+	argCount := 2
+
+	// Match the free text against the weighted search vector
+	snippet := "''"
+	orderClause := fmt.Sprintf("ORDER BY %s DESC, t.created_at DESC, t.id DESC", ranking.OrderBy)
+	if text := search.Text(); text != "" {
+		tsquery := fmt.Sprintf("websearch_to_tsquery('%s', $%d)", SearchConfig, argCount)
+		whereClause += fmt.Sprintf(" AND t.search_vector @@ %s", tsquery)
+		// Escape the content first, so that the highlights are its only markup
+		snippet = fmt.Sprintf("ts_headline('%s', %s, %s, 'StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15')", SearchConfig, escapedContentSQL, tsquery)
+		if sort == "" || sort == RelevanceSort {
+			orderClause = fmt.Sprintf("ORDER BY ts_rank(t.search_vector, %s) DESC, t.created_at DESC, t.id DESC", tsquery)
+		}
+		args = append(args, text)
+		argCount++
+	}
 
 	// Base query for fetching threads
-	baseQuery := `
-		SELECT DISTINCT 
+	baseQuery := fmt.Sprintf(`
+		SELECT
 			t.id,
 			u.username,
 			t.title,
@@ -71,18 +134,19 @@ func GetThreads(db *sql.DB, page int, limit int, category string, search string,
 			c.name as category,
 			t.created_at,
 			ARRAY_AGG(DISTINCT tags.name) as tags,
-			COALESCE(SUM(v.vote), 0) as votes
+			t.score,
+			t.upvotes,
+			t.downvotes,
+			%s,
+			t.edited_at,
+			(SELECT COUNT(*) FROM thread_revisions r WHERE r.thread_id = t.id) as revision_count,
+			%s as snippet
 		FROM threads t
 		INNER JOIN users u ON t.user_id = u.id
 		INNER JOIN categories c ON t.category_id = c.id
 		LEFT JOIN thread_tags tt ON t.id = tt.thread_id
 		LEFT JOIN tags ON tt.tag_id = tags.id
-		LEFT JOIN votes v ON t.id = v.thread_id
-	`
-
-	whereClause := "WHERE 1=1"
-	args := []interface{}{}
-	argCount := 1
+	`, fmt.Sprintf(visibleCommentCountSQL, "$1"), snippet)
 
 	// Filter by category if provided
 	if category != "" {
@@ -91,14 +155,6 @@ func GetThreads(db *sql.DB, page int, limit int, category string, search string,
 		argCount++
 	}
 
-	// Search for threads by title or content if provided
-	if search != "" {
-		whereClause += fmt.Sprintf(" AND (t.title ILIKE $%d OR t.content ILIKE $%d)", argCount, argCount)
-		searchPattern := "%" + search + "%"
-		args = append(args, searchPattern)
-		argCount++
-	}
-
 	// Filter by username if provided
 	if username != "" {
 		whereClause += fmt.Sprintf(" AND u.username = $%d", argCount)
@@ -106,14 +162,44 @@ func GetThreads(db *sql.DB, page int, limit int, category string, search string,
 		argCount++
 	}
 
-	// Determine sorting method
-	var orderClause string
-	if sort == "trending" {
-		// Rank threads by total votes in descending order
-		orderClause = "ORDER BY votes DESC"
-	} else {
-		// Default: Sort by creation date
-		orderClause = "ORDER BY t.created_at DESC"
+	// Apply the filters of the search syntax
+	for _, tag := range search.Tags {
+		whereClause += fmt.Sprintf(` AND EXISTS(
+			SELECT 1 FROM thread_tags ftt INNER JOIN tags ftg ON ftt.tag_id = ftg.id
+			WHERE ftt.thread_id = t.id AND ftg.name = $%d
+		)`, argCount)
+		args = append(args, tag)
+		argCount++
+	}
+	if len(search.Authors) > 0 {
+		whereClause += fmt.Sprintf(" AND u.username = ANY($%d)", argCount)
+		args = append(args, pq.Array(search.Authors))
+		argCount++
+	}
+	if len(search.Categories) > 0 {
+		whereClause += fmt.Sprintf(" AND c.name = ANY($%d)", argCount)
+		args = append(args, pq.Array(search.Categories))
+		argCount++
+	}
+	if search.Before != nil {
+		whereClause += fmt.Sprintf(" AND t.created_at < $%d", argCount)
+		args = append(args, search.Before.UTC().Format("2006-01-02 15:04:05.999999"))
+		argCount++
+	}
+	if search.After != nil {
+		whereClause += fmt.Sprintf(" AND t.created_at >= $%d", argCount)
+		args = append(args, search.After.UTC().Format("2006-01-02 15:04:05.999999"))
+		argCount++
+	}
+
+	// Leave out shadowbanned users' threads unless they are the viewer's own
+	whereClause += fmt.Sprintf(" AND (u.username = $1 OR NOT "+shadowbannedSQL+")", "t.user_id")
+
+	// Only rank threads created within the period
+	if maxAge := ThreadMaxAge(ranking, period); maxAge > 0 {
+		whereClause += fmt.Sprintf(" AND t.created_at >= LOCALTIMESTAMP - $%d * INTERVAL '1 second'", argCount)
+		args = append(args, int64(maxAge.Seconds()))
+		argCount++
 	}
 
 	// Final query with filters and sorting applied
@@ -148,6 +234,12 @@ func GetThreads(db *sql.DB, page int, limit int, category string, search string,
 			&thread.CreatedAt,
 			pq.Array(&tags),
 			&thread.Votes,
+			&thread.Upvotes,
+			&thread.Downvotes,
+			&thread.CommentCount,
+			&thread.EditedAt,
+			&thread.RevisionCount,
+			&thread.Snippet,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning row: %v", err)
@@ -173,11 +265,13 @@ func GetThreads(db *sql.DB, page int, limit int, category string, search string,
 
 func GetThreadByID(db *sql.DB, threadID int) (*Thread, error) {
 	query := `
-		SELECT t.id, t.title, t.content, t.created_at, u.username, c.name as category
+		SELECT t.id, t.title, t.content, t.created_at, u.username, c.name as category,
+			t.score, t.upvotes, t.downvotes, t.comment_count, t.hidden_at IS NOT NULL,
+			t.edited_at, (SELECT COUNT(*) FROM thread_revisions r WHERE r.thread_id = t.id)
 		FROM threads t
 		INNER JOIN users u ON t.user_id = u.id
 		INNER JOIN categories c ON t.category_id = c.id
-		WHERE t.id = $1;
+		WHERE t.id = $1 AND t.deleted_at IS NULL;
 	`
 
 	var thread Thread
@@ -188,6 +282,13 @@ func GetThreadByID(db *sql.DB, threadID int) (*Thread, error) {
 		&thread.CreatedAt,
 		&thread.Username,
 		&thread.Category,
+		&thread.Votes,
+		&thread.Upvotes,
+		&thread.Downvotes,
+		&thread.CommentCount,
+		&thread.Hidden,
+		&thread.EditedAt,
+		&thread.RevisionCount,
 	)
 	if err != nil {
 		return nil, err
@@ -228,7 +329,7 @@ func GetThreadOwnerUsername(db *sql.DB, threadID int) (string, error) {
 		SELECT u.username
 		FROM threads t
 		INNER JOIN users u ON t.user_id = u.id
-		WHERE t.id = $1
+		WHERE t.id = $1 AND t.deleted_at IS NULL
 	`
 	err := db.QueryRow(query, threadID).Scan(&username)
 	if err != nil {
@@ -237,7 +338,25 @@ func GetThreadOwnerUsername(db *sql.DB, threadID int) (string, error) {
 	return username, nil
 }
 
-func EditThread(db *sql.DB, threadID int, thread *Thread) error {
+// GetThreadCategory returns the category name of a thread
+func GetThreadCategory(db *sql.DB, threadID int) (string, error) {
+	var category string
+	query := `
+		SELECT c.name
+		FROM threads t
+		INNER JOIN categories c ON t.category_id = c.id
+		WHERE t.id = $1 AND t.deleted_at IS NULL
+	`
+	err := db.QueryRow(query, threadID).Scan(&category)
+	if err != nil {
+		return "", err
+	}
+	return category, nil
+}
+
+// EditThread updates the fields of a thread that are set in thread and records
+// the result as a new revision by editedBy
+func EditThread(db *sql.DB, threadID int, thread *Thread, editedBy string) error {
 	// Store query parts and parameters
 	var setClauses []string
 	var params []interface{}
@@ -304,15 +423,89 @@ func EditThread(db *sql.DB, threadID int, thread *Thread) error {
 		}
 	}
 
-	return nil
+	return recordThreadRevision(db, threadID, editedBy)
 }
 
-func DeleteThread(db *sql.DB, threadID int) error {
-	query := "DELETE FROM threads WHERE id = $1"
-	_, err := db.Exec(query, threadID)
+// DeleteThread moves a thread to the trash. Its comments, votes, tags and saves
+// are kept until the thread is restored or purged.
+func DeleteThread(db *sql.DB, threadID int, deletedBy string) error {
+	query := `
+		UPDATE threads
+		SET deleted_at = NOW(), deleted_by = (SELECT id FROM users WHERE username = $2)
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	_, err := db.Exec(query, threadID, deletedBy)
 	return err
 }
 
+// deletedThreadQuery selects threads t in the trash with who deleted them
+const deletedThreadQuery = `
+	SELECT t.id, u.username, t.title, t.content, c.name, t.created_at,
+		t.score, t.upvotes, t.downvotes, t.comment_count, t.deleted_at, COALESCE(du.username, '')
+	FROM threads t
+	INNER JOIN users u ON t.user_id = u.id
+	INNER JOIN categories c ON t.category_id = c.id
+	LEFT JOIN users du ON t.deleted_by = du.id
+`
+
+func scanDeletedThread(row rowScanner) (Thread, error) {
+	var thread Thread
+	err := row.Scan(&thread.ID, &thread.Username, &thread.Title, &thread.Content, &thread.Category, &thread.CreatedAt,
+		&thread.Votes, &thread.Upvotes, &thread.Downvotes, &thread.CommentCount, &thread.DeletedAt, &thread.DeletedBy)
+	thread.Tags = []string{}
+	return thread, err
+}
+
+// GetDeletedThread returns a thread in the trash, or sql.ErrNoRows if there is
+// no such thread or it was not deleted
+func GetDeletedThread(db *sql.DB, threadID int) (*Thread, error) {
+	thread, err := scanDeletedThread(db.QueryRow(deletedThreadQuery+` WHERE t.id = $1 AND t.deleted_at IS NOT NULL`, threadID))
+	if err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+// GetDeletedThreads lists the threads a user deleted themselves since the
+// given time, most recently deleted first
+func GetDeletedThreads(db *sql.DB, username string, since time.Time) ([]Thread, error) {
+	query := deletedThreadQuery + `
+		WHERE u.username = $1 AND t.deleted_by = t.user_id AND t.deleted_at >= $2
+		ORDER BY t.deleted_at DESC, t.id DESC
+	`
+	rows, err := db.Query(query, username, since)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving deleted threads: %v", err)
+	}
+	defer rows.Close()
+
+	threads := []Thread{}
+	for rows.Next() {
+		thread, err := scanDeletedThread(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning deleted thread: %v", err)
+		}
+		threads = append(threads, thread)
+	}
+	return threads, rows.Err()
+}
+
+// RestoreThread takes a thread out of the trash, or returns sql.ErrNoRows if it
+// is not in the trash
+func RestoreThread(db *sql.DB, threadID int) error {
+	result, err := db.Exec(`
+		UPDATE threads SET deleted_at = NULL, deleted_by = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`, threadID)
+	if err != nil {
+		return fmt.Errorf("error restoring thread: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected > 0 {
+		return err
+	}
+	return sql.ErrNoRows
+}
+
 func GetSingleThread(db *sql.DB, threadID int) (*Thread, error) {
 	query := `
 		SELECT 
@@ -328,7 +521,7 @@ func GetSingleThread(db *sql.DB, threadID int) (*Thread, error) {
 		INNER JOIN categories c ON t.category_id = c.id
 		LEFT JOIN thread_tags tt ON t.id = tt.thread_id
 		LEFT JOIN tags ON tt.tag_id = tags.id
-		WHERE t.id = $1
+		WHERE t.id = $1 AND t.deleted_at IS NULL
 		GROUP BY t.id, u.username, t.title, t.content, c.name, t.created_at
 	`
 
@@ -393,12 +586,14 @@ func RemoveSavedThread(db *sql.DB, username string, threadID int) error {
 	return nil
 }
 
+// GetSavedThreads lists the threads a user saved, newest first, with the same
+// visibility as GetThreads for them as viewer
 func GetSavedThreads(db *sql.DB, username string, page, limit int) ([]Thread, error) {
 	// Calculate offset
 	offset := (page - 1) * limit
 
 	// SQL query to get saved threads with pagination
-	query := `
+	query := fmt.Sprintf(`
 		SELECT DISTINCT 
 			t.id,
 			u.username,
@@ -407,19 +602,24 @@ func GetSavedThreads(db *sql.DB, username string, page, limit int) ([]Thread, er
 			c.name AS category,
 			t.created_at,
 			ARRAY_AGG(DISTINCT tags.name) AS tags,
-			COALESCE(SUM(v.vote), 0) AS votes
+			t.score,
+			t.upvotes,
+			t.downvotes,
+			%s,
+			t.edited_at,
+			(SELECT COUNT(*) FROM thread_revisions r WHERE r.thread_id = t.id) AS revision_count
 		FROM threads t
 		INNER JOIN user_threads ut ON t.id = ut.thread_id
 		INNER JOIN users u ON t.user_id = u.id
 		INNER JOIN categories c ON t.category_id = c.id
 		LEFT JOIN thread_tags tt ON t.id = tt.thread_id
 		LEFT JOIN tags ON tt.tag_id = tags.id
-		LEFT JOIN votes v ON t.id = v.thread_id
-		WHERE ut.user_id = $1
+		WHERE ut.user_id = $1 AND t.deleted_at IS NULL AND t.hidden_at IS NULL
+			AND (u.username = $4 OR NOT %s)
 		GROUP BY t.id, u.username, c.name, t.created_at
 		ORDER BY t.created_at DESC
 		LIMIT $2 OFFSET $3
-	`
+	`, fmt.Sprintf(visibleCommentCountSQL, "$4"), fmt.Sprintf(shadowbannedSQL, "t.user_id"))
 
 	// Get user ID by username
 	userID, err := GetUserIDByUsername(username, db)
@@ -428,7 +628,7 @@ func GetSavedThreads(db *sql.DB, username string, page, limit int) ([]Thread, er
 	}
 
 	// Execute the query
-	rows, err := db.Query(query, userID, limit, offset)
+	rows, err := db.Query(query, userID, limit, offset, username)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving saved threads: %v", err)
 	}
@@ -449,6 +649,11 @@ func GetSavedThreads(db *sql.DB, username string, page, limit int) ([]Thread, er
 			&thread.CreatedAt,
 			pq.Array(&tags),
 			&thread.Votes,
+			&thread.Upvotes,
+			&thread.Downvotes,
+			&thread.CommentCount,
+			&thread.EditedAt,
+			&thread.RevisionCount,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning row: %v", err)
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Threads carry denormalized score, upvotes, downvotes and comment_count
+// columns so listings need no joins on votes or comments. Every write to votes
+// or comments updates the thread row first, in the same transaction, which also
+// keeps the lock order consistent with ReconcileThreadCounters.
+
+// lockThread locks a thread row until the transaction ends
+func lockThread(tx *sql.Tx, threadID int) error {
+	var id int
+	return tx.QueryRow(`SELECT id FROM threads WHERE id = $1 FOR UPDATE`, threadID).Scan(&id)
+}
+
+// adjustVoteCounters replaces a user's vote oldVote with newVote in the thread's
+// counters, where 0 means no vote
+func adjustVoteCounters(tx *sql.Tx, threadID, oldVote, newVote int) error {
+	upvotes := countsAs(newVote, 1) - countsAs(oldVote, 1)
+	downvotes := countsAs(newVote, -1) - countsAs(oldVote, -1)
+	if upvotes == 0 && downvotes == 0 {
+		return nil
+	}
+
+	query := `
+		UPDATE threads
+		SET upvotes = upvotes + $2, downvotes = downvotes + $3, score = score + $2 - $3
+		WHERE id = $1
+	`
+	_, err := tx.Exec(query, threadID, upvotes, downvotes)
+	return err
+}
+
+// countsAs returns 1 if vote equals want and 0 otherwise
+func countsAs(vote, want int) int {
+	if vote == want {
+		return 1
+	}
+	return 0
+}
+
+// adjustCommentCount adds delta to the comment count of a thread
+func adjustCommentCount(tx *sql.Tx, threadID, delta int) error {
+	_, err := tx.Exec(`UPDATE threads SET comment_count = comment_count + $2 WHERE id = $1`, threadID, delta)
+	return err
+}
+
+// ReconcileThreadCounters recomputes the counters of every thread from the votes
+// and comments tables and returns the number of threads that had drifted
+func ReconcileThreadCounters(db *sql.DB) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Block writers for the duration, threads first as every writer locks them first
+	if _, err := tx.Exec(`LOCK TABLE threads IN EXCLUSIVE MODE`); err != nil {
+		return 0, fmt.Errorf("error locking threads: %v", err)
+	}
+	if _, err := tx.Exec(`LOCK TABLE votes, comments IN SHARE MODE`); err != nil {
+		return 0, fmt.Errorf("error locking votes and comments: %v", err)
+	}
+
+	query := `
+		UPDATE threads t
+		SET upvotes = x.upvotes, downvotes = x.downvotes, score = x.upvotes - x.downvotes, comment_count = x.comment_count
+		FROM (
+			SELECT th.id,
+				(SELECT COUNT(*) FROM votes v WHERE v.thread_id = th.id AND v.vote = 1) AS upvotes,
+				(SELECT COUNT(*) FROM votes v WHERE v.thread_id = th.id AND v.vote = -1) AS downvotes,
+				(SELECT COUNT(*) FROM comments c WHERE c.thread_id = th.id AND c.deleted_at IS NULL) AS comment_count
+			FROM threads th
+		) x
+		WHERE t.id = x.id
+			AND (t.upvotes, t.downvotes, t.score, t.comment_count)
+				IS DISTINCT FROM (x.upvotes, x.downvotes, x.upvotes - x.downvotes, x.comment_count)
+	`
+	result, err := tx.Exec(query)
+	if err != nil {
+		return 0, fmt.Errorf("error reconciling thread counters: %v", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TrashRetention is how long deleted threads and comments can be restored
+// before PurgeDeleted removes them for good
+var TrashRetention = 30 * 24 * time.Hour
+
+// PurgeDeleted removes the threads and comments deleted before the given time
+// for good, with everything that depends on them. Deleted comments that still
+// have replies cannot be removed without their replies, so only their content
+// and revisions are erased and they stay as placeholders. It returns the
+// number of threads and comments removed.
+func PurgeDeleted(db *sql.DB, before time.Time) (int64, int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM threads WHERE deleted_at < $1`, before)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error purging threads: %v", err)
+	}
+	threads, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Removing a leaf can turn its deleted parent into a leaf, so repeat until
+	// only comments with replies are left
+	var comments int64
+	for {
+		result, err := tx.Exec(`
+			DELETE FROM comments c
+			WHERE c.deleted_at < $1 AND NOT EXISTS(SELECT 1 FROM comments r WHERE r.parent_id = c.id)
+		`, before)
+		if err != nil {
+			return 0, 0, fmt.Errorf("error purging comments: %v", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, 0, err
+		}
+		if affected == 0 {
+			break
+		}
+		comments += affected
+	}
+
+	_, err = tx.Exec(`UPDATE comments SET content = '' WHERE deleted_at < $1 AND content <> ''`, before)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error erasing deleted comments: %v", err)
+	}
+	_, err = tx.Exec(`
+		DELETE FROM comment_revisions r
+		USING comments c
+		WHERE r.comment_id = c.id AND c.deleted_at < $1
+	`, before)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error erasing deleted comment revisions: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return threads, comments, nil
+}
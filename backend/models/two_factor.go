@@ -0,0 +1,144 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// TwoFactor is the TOTP enrollment of a user
+type TwoFactor struct {
+	Secret            string // empty until the user starts enrolling
+	Enabled           bool
+	LastStep          int64 // the time step of the last accepted code
+	RecoveryCodesLeft int
+}
+
+// GetTwoFactor returns the TOTP enrollment of a user
+func GetTwoFactor(db *sql.DB, username string) (*TwoFactor, error) {
+	var tf TwoFactor
+	var secret sql.NullString
+	err := db.QueryRow(`
+		SELECT u.totp_secret, u.totp_enabled_at IS NOT NULL, u.totp_last_step,
+			(SELECT COUNT(*) FROM recovery_codes rc WHERE rc.user_id = u.id AND rc.used_at IS NULL)
+		FROM users u
+		WHERE u.username = $1
+	`, username).Scan(&secret, &tf.Enabled, &tf.LastStep, &tf.RecoveryCodesLeft)
+	if err != nil {
+		return nil, err
+	}
+	tf.Secret = secret.String
+	return &tf, nil
+}
+
+// SetTOTPSecret stores the secret of a user who starts enrolling, replacing
+// the one of an unfinished enrollment. It does nothing once 2FA is enabled.
+func SetTOTPSecret(db *sql.DB, username, secret string) error {
+	_, err := db.Exec(`UPDATE users SET totp_secret = $2 WHERE username = $1 AND totp_enabled_at IS NULL`, username, secret)
+	return err
+}
+
+// replaceRecoveryCodes swaps the recovery codes of a user for new ones
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %v", err)
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return fmt.Errorf("error creating recovery code: %v", err)
+		}
+	}
+	return nil
+}
+
+// EnableTwoFactor turns on 2FA for a user once they proved their authenticator
+// works with a code of the given time step, with a fresh set of recovery codes
+func EnableTwoFactor(db *sql.DB, username string, step int64, codeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(`
+		UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $2
+		WHERE username = $1 AND totp_secret IS NOT NULL
+		RETURNING id
+	`, username, step).Scan(&userID)
+	if err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DisableTwoFactor turns off 2FA for a user and forgets their secret and
+// recovery codes
+func DisableTwoFactor(db *sql.DB, username string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(`
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0
+		WHERE username = $1
+		RETURNING id
+	`, username).Scan(&userID)
+	if err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(tx, userID, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records that a code of the given time step was accepted, and
+// reports false if a code of that step or a later one already was
+func UseTOTPStep(db *sql.DB, username string, step int64) (bool, error) {
+	result, err := db.Exec(`UPDATE users SET totp_last_step = $2 WHERE username = $1 AND totp_last_step < $2`, username, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used, reporting
+// false if they have no such code
+func UseRecoveryCode(db *sql.DB, username, codeHash string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE recovery_codes rc SET used_at = NOW()
+		FROM users u
+		WHERE rc.user_id = u.id AND u.username = $1 AND rc.code_hash = $2 AND rc.used_at IS NULL
+	`, username, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ReplaceRecoveryCodes gives a user a new set of recovery codes, the previous
+// ones stop working
+func ReplaceRecoveryCodes(db *sql.DB, username string, codeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	if err := tx.QueryRow(`SELECT id FROM users WHERE username = $1`, username).Scan(&userID); err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -2,21 +2,24 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 )
 
 type User struct {
-	ID        int    `json:"id"`
-	Username  string `json:"username"`
-	Password  string `json:"password"`
-	Email     string `json:"email"`
-	Bio       string `json:"bio"`
-	CreatedAt string `json:"created_at"`
+	ID            int    `json:"id"`
+	Username      string `json:"username"`
+	Password      string `json:"password,omitempty"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Bio           string `json:"bio"`
+	Role          Role   `json:"role"`
+	CreatedAt     string `json:"created_at"`
 }
 
-// Function to create a new user in the database
-func CreateUser(db *sql.DB, username, password, email string) error {
-	_, err := db.Exec("INSERT INTO users (username, password, email) VALUES ($1, $2, $3)", username, password, email)
+// Function to create a new user in the database, password must already be hashed
+func CreateUser(db *sql.DB, username, passwordHash, email string) error {
+	_, err := db.Exec("INSERT INTO users (username, password, email) VALUES ($1, $2, $3)", username, passwordHash, email)
 	if err != nil {
 		return err
 	}
@@ -32,30 +35,40 @@ func GetUserIDByUsername(username string, db *sql.DB) (int, error) {
 	return user.ID, nil
 }
 
+// GetUserIDByEmail looks up the user with an email address, returning
+// sql.ErrNoRows if there is none
 func GetUserIDByEmail(email string, db *sql.DB) (int, error) {
 	var user User
 	err := db.QueryRow("SELECT id FROM users WHERE email = $1", email).Scan(&user.ID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return 0, fmt.Errorf("user not found")
+			return 0, err
 		}
 		return 0, fmt.Errorf("error querying database: %v", err)
 	}
 	return user.ID, nil
 }
 
+// GetUserPasswordByUsername returns the password hash of a user, or
+// sql.ErrNoRows if there is no such user
 func GetUserPasswordByUsername(username string, db *sql.DB) (string, error) {
 	var user User
 	err := db.QueryRow("SELECT password FROM users WHERE username = $1", username).Scan(&user.Password)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", fmt.Errorf("user not found")
+			return "", err
 		}
 		return "", fmt.Errorf("error querying database: %v", err)
 	}
 	return user.Password, nil
 }
 
+// UpdateUserPassword replaces the stored password hash of a user
+func UpdateUserPassword(db *sql.DB, username, passwordHash string) error {
+	_, err := db.Exec(`UPDATE users SET password = $1 WHERE username = $2`, passwordHash, username)
+	return err
+}
+
 func UpdateUser(db *sql.DB, oldname, newname, bio string) error {
 	userID, err := GetUserIDByUsername(oldname, db)
 	if err != nil {
@@ -68,14 +81,14 @@ func UpdateUser(db *sql.DB, oldname, newname, bio string) error {
 
 func GetUserByUsername(db *sql.DB, username string) (*User, error) {
 	// Query to fetch user details by username
-	query := `SELECT id, username, email, bio, created_at FROM users WHERE username = $1`
+	query := `SELECT id, username, email, email_verified_at IS NOT NULL, bio, role, created_at FROM users WHERE username = $1`
 	row := db.QueryRow(query, username)
 
 	// Map result to User struct
 	var user User
 	var bio sql.NullString
 
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &bio, &user.CreatedAt)
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerified, &bio, &user.Role, &user.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, err
@@ -92,3 +105,99 @@ func GetUserByUsername(db *sql.DB, username string) (*User, error) {
 
 	return &user, nil
 }
+
+// LeftUserID is the reserved "left" user that keeps the content of deleted accounts
+const LeftUserID = 1
+
+// ErrReservedUser is returned when trying to delete the reserved "left" user
+var ErrReservedUser = errors.New("the reserved user cannot be deleted")
+
+// DeleteUser deletes an account along with its votes, saved threads, sessions
+// and everything else that is personal to it. Its threads and comments are
+// reassigned to the "left" user, or with deleteContent its threads are moved to
+// the trash and its comments erased, staying as placeholders for their replies
+// until the trash is purged. Other users' comments on its threads go with the
+// threads when they are purged, like for any deleted thread.
+func DeleteUser(db *sql.DB, username string, deleteContent bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	if err := tx.QueryRow(`SELECT id FROM users WHERE username = $1 FOR UPDATE`, username).Scan(&userID); err != nil {
+		return err
+	}
+	if userID == LeftUserID {
+		return ErrReservedUser
+	}
+
+	// Take the votes out of the thread counters, which locks the threads first
+	_, err = tx.Exec(`
+		UPDATE threads t
+		SET upvotes = t.upvotes - x.up, downvotes = t.downvotes - x.down, score = t.score - x.up + x.down
+		FROM (
+			SELECT thread_id,
+				COUNT(*) FILTER (WHERE vote = 1) AS up,
+				COUNT(*) FILTER (WHERE vote = -1) AS down
+			FROM votes
+			WHERE user_id = $1
+			GROUP BY thread_id
+		) x
+		WHERE t.id = x.thread_id
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("error adjusting vote counters: %v", err)
+	}
+	for _, query := range []string{
+		`DELETE FROM votes WHERE user_id = $1`,
+		`DELETE FROM comment_votes WHERE user_id = $1`,
+		`DELETE FROM user_threads WHERE user_id = $1`,
+	} {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return fmt.Errorf("error removing votes and saves: %v", err)
+		}
+	}
+
+	if deleteContent {
+		_, err = tx.Exec(`
+			UPDATE threads t
+			SET comment_count = t.comment_count - x.comments
+			FROM (
+				SELECT thread_id, COUNT(*) AS comments
+				FROM comments
+				WHERE user_id = $1 AND deleted_at IS NULL
+				GROUP BY thread_id
+			) x
+			WHERE t.id = x.thread_id
+		`, userID)
+		if err != nil {
+			return fmt.Errorf("error adjusting comment counts: %v", err)
+		}
+		for _, query := range []string{
+			`UPDATE threads SET deleted_at = NOW(), deleted_by = NULL WHERE user_id = $1 AND deleted_at IS NULL`,
+			`DELETE FROM comment_revisions r USING comments c WHERE r.comment_id = c.id AND c.user_id = $1`,
+			`UPDATE comments SET content = '', deleted_at = COALESCE(deleted_at, NOW()), deleted_by = NULL WHERE user_id = $1`,
+		} {
+			if _, err := tx.Exec(query, userID); err != nil {
+				return fmt.Errorf("error deleting content: %v", err)
+			}
+		}
+	}
+
+	for _, query := range []string{
+		`UPDATE threads SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE comments SET user_id = $2 WHERE user_id = $1`,
+	} {
+		if _, err := tx.Exec(query, userID, LeftUserID); err != nil {
+			return fmt.Errorf("error reassigning content: %v", err)
+		}
+	}
+
+	// Sessions, notifications, sanctions and moderator grants go with the row
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = $1`, userID); err != nil {
+		return fmt.Errorf("error deleting user: %v", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TokenPurpose is what a token issued to a user is for
+type TokenPurpose string
+
+const (
+	TokenVerifyEmail    TokenPurpose = "verify_email"
+	TokenResetPassword  TokenPurpose = "reset_password"
+	TokenLoginChallenge TokenPurpose = "login_challenge"
+)
+
+// VerifyEmailTTL is how long an email verification link works
+var VerifyEmailTTL = 48 * time.Hour
+
+// ResetPasswordTTL is how long a password reset link works
+var ResetPasswordTTL = time.Hour
+
+// CreateUserToken stores the hash of a token emailed to a user for purpose,
+// tied to their current address. The unused tokens they were sent before for
+// the same purpose stop working.
+func CreateUserToken(db *sql.DB, userID int, purpose TokenPurpose, tokenHash string, expiresAt time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE user_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, userID, purpose)
+	if err != nil {
+		return fmt.Errorf("error invalidating user tokens: %v", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO user_tokens (token_hash, user_id, purpose, email, expires_at)
+		SELECT $1, id, $3, email, $4 FROM users WHERE id = $2
+	`, tokenHash, userID, purpose, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error creating user token: %v", err)
+	}
+	return tx.Commit()
+}
+
+// ConsumeUserToken marks a token as used and returns the username it was
+// issued to. It returns sql.ErrNoRows if the token is unknown, was already
+// used, expired or was sent to an address the user no longer has.
+func ConsumeUserToken(db *sql.DB, purpose TokenPurpose, tokenHash string) (string, error) {
+	var username string
+	err := db.QueryRow(`
+		UPDATE user_tokens t
+		SET used_at = NOW()
+		FROM users u
+		WHERE t.user_id = u.id AND t.token_hash = $1 AND t.purpose = $2
+			AND t.used_at IS NULL AND t.expires_at > NOW() AND t.email = u.email
+		RETURNING u.username
+	`, tokenHash, purpose).Scan(&username)
+	if err != nil {
+		return "", err
+	}
+	return username, nil
+}
+
+// AttemptUserToken counts an attempt to use a token that is not consumed on
+// failure, such as a login challenge, and returns the username it was issued
+// to. It returns sql.ErrNoRows once maxAttempts were made, as for tokens that
+// ConsumeUserToken would refuse.
+func AttemptUserToken(db *sql.DB, purpose TokenPurpose, tokenHash string, maxAttempts int) (string, error) {
+	var username string
+	err := db.QueryRow(`
+		UPDATE user_tokens t
+		SET attempts = t.attempts + 1
+		FROM users u
+		WHERE t.user_id = u.id AND t.token_hash = $1 AND t.purpose = $2
+			AND t.used_at IS NULL AND t.expires_at > NOW() AND t.email = u.email AND t.attempts < $3
+		RETURNING u.username
+	`, tokenHash, purpose, maxAttempts).Scan(&username)
+	if err != nil {
+		return "", err
+	}
+	return username, nil
+}
+
+// SetEmailVerified records that a user proved they own their email address
+func SetEmailVerified(db *sql.DB, username string) error {
+	_, err := db.Exec(`UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE username = $1`, username)
+	return err
+}
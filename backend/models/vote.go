@@ -16,49 +16,65 @@ type VoteState struct {
 	Vote     int    `json:"vote"` // 1 for upvote, -1 for downvote, 0 for no vote
 }
 
+// CreateVote casts a vote on a thread, replacing the user's previous vote, and
+// updates the thread's counters in the same transaction
 func CreateVote(db *sql.DB, vote *Vote) (*Vote, error) {
 	query := `
-  INSERT INTO votes (user_id, thread_id, vote)
-  values ($1, $2, $3)
-	ON CONFLICT (thread_id, user_id) DO UPDATE
-	SET vote = EXCLUDED.vote
-	RETURNING id;
- `
+		INSERT INTO votes (user_id, thread_id, vote)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (thread_id, user_id) DO UPDATE
+		SET vote = EXCLUDED.vote
+		RETURNING id
+	`
 	userID, err := GetUserIDByUsername(vote.Username, db)
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.QueryRow(query, userID, vote.ThreadID, vote.Vote).Scan(&vote.ID)
-
+	tx, err := db.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	return vote, nil
-}
+	// Lock the thread so concurrent votes cannot both count from the same previous vote
+	if err := lockThread(tx, vote.ThreadID); err != nil {
+		return nil, err
+	}
 
-func CountVote(db *sql.DB, threadID int) (int, error) {
-	var netVotes int
+	var oldVote int
+	err = tx.QueryRow(`SELECT vote FROM votes WHERE thread_id = $1 AND user_id = $2`, vote.ThreadID, userID).Scan(&oldVote)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
 
-	query := `
-			SELECT COALESCE(SUM(vote), 0) AS net_votes
-			FROM votes
-			WHERE thread_id = $1;
-	`
+	if err := tx.QueryRow(query, userID, vote.ThreadID, vote.Vote).Scan(&vote.ID); err != nil {
+		return nil, err
+	}
+	if err := adjustVoteCounters(tx, vote.ThreadID, oldVote, vote.Vote); err != nil {
+		return nil, err
+	}
 
-	err := db.QueryRow(query, threadID).Scan(&netVotes)
-	if err != nil {
-		return 0, err
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
+	return vote, nil
+}
 
-	return netVotes, nil
+// CountVote returns the net score of a thread from its denormalized counter,
+// or 0 if there is no such thread
+func CountVote(db *sql.DB, threadID int) (int, error) {
+	var score int
+	err := db.QueryRow(`SELECT COALESCE((SELECT score FROM threads WHERE id = $1), 0)`, threadID).Scan(&score)
+	return score, err
 }
 
+// DeleteVote removes the user's vote on a thread and updates the thread's counters
 func DeleteVote(db *sql.DB, threadID int, username string) error {
 	query := `
 		DELETE FROM votes
-		WHERE thread_id = $1 AND user_id = $2;
+		WHERE thread_id = $1 AND user_id = $2
+		RETURNING vote
 	`
 
 	userID, err := GetUserIDByUsername(username, db)
@@ -66,8 +82,31 @@ func DeleteVote(db *sql.DB, threadID int, username string) error {
 		return err
 	}
 
-	_, err = db.Exec(query, threadID, userID)
-	return err
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockThread(tx, threadID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	var oldVote int
+	if err := tx.QueryRow(query, threadID, userID).Scan(&oldVote); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	if err := adjustVoteCounters(tx, threadID, oldVote, 0); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func GetVoteStateByUserID(db *sql.DB, threadID int, userID int) (*VoteState, error) {
@@ -0,0 +1,144 @@
+package realtime
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Event is a message published on a topic, such as a new comment on a thread
+type Event struct {
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+	// Origin is the hub that published the event, so relayed events are not delivered twice
+	Origin string `json:"origin"`
+}
+
+// ThreadTopic is the topic of the events on a thread
+func ThreadTopic(threadID int) string {
+	return fmt.Sprintf("thread:%d", threadID)
+}
+
+// UserTopic is the topic of the events addressed to a single user
+func UserTopic(username string) string {
+	return "user:" + username
+}
+
+// Relay forwards published events to the hubs of other backend instances
+type Relay interface {
+	Send(event Event) error
+}
+
+// subscriptionBuffer is how many events a subscriber may fall behind before
+// further events are dropped for it
+const subscriptionBuffer = 32
+
+// Hub fans published events out to the subscribers of their topic
+type Hub struct {
+	id          string
+	mu          sync.RWMutex
+	subscribers map[string]map[*Subscription]struct{}
+	relay       Relay
+}
+
+// NewHub returns a hub that only delivers events within this process until a
+// relay is set
+func NewHub() *Hub {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return &Hub{
+		id:          hex.EncodeToString(id),
+		subscribers: map[string]map[*Subscription]struct{}{},
+	}
+}
+
+// ID identifies the hub in the Origin of the events it publishes
+func (h *Hub) ID() string {
+	return h.id
+}
+
+// SetRelay makes the hub forward every event it publishes through relay
+func (h *Hub) SetRelay(relay Relay) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.relay = relay
+}
+
+// Subscription receives the events of one topic until it is closed
+type Subscription struct {
+	Events <-chan Event
+	events chan Event
+	hub    *Hub
+	topic  string
+	once   sync.Once
+}
+
+// Subscribe starts receiving the events published on topic
+func (h *Hub) Subscribe(topic string) *Subscription {
+	events := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{Events: events, events: events, hub: h, topic: topic}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[topic] == nil {
+		h.subscribers[topic] = map[*Subscription]struct{}{}
+	}
+	h.subscribers[topic][sub] = struct{}{}
+	return sub
+}
+
+// Close stops the subscription and closes its Events channel
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		defer s.hub.mu.Unlock()
+		delete(s.hub.subscribers[s.topic], s)
+		if len(s.hub.subscribers[s.topic]) == 0 {
+			delete(s.hub.subscribers, s.topic)
+		}
+		close(s.events)
+	})
+}
+
+// Publish sends data, encoded as JSON, to the subscribers of topic here and,
+// through the relay, on other instances. Publishing never blocks on slow
+// subscribers, they miss the events that do not fit in their buffer.
+func (h *Hub) Publish(topic, eventType string, data any) {
+	if h == nil {
+		return
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", eventType, err)
+		return
+	}
+	event := Event{Topic: topic, Type: eventType, Data: encoded, Origin: h.id}
+	h.Deliver(event)
+
+	h.mu.RLock()
+	relay := h.relay
+	h.mu.RUnlock()
+	if relay != nil {
+		if err := relay.Send(event); err != nil {
+			log.Printf("Error relaying %s event: %v", eventType, err)
+		}
+	}
+}
+
+// Deliver hands an event to the local subscribers of its topic
+func (h *Hub) Deliver(event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subscribers[event.Topic] {
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
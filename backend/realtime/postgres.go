@@ -0,0 +1,98 @@
+package realtime
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostgresChannel is the LISTEN/NOTIFY channel instances exchange events on
+const PostgresChannel = "forum_events"
+
+// maxNotifyPayload stays under the 8000 byte limit of NOTIFY payloads
+const maxNotifyPayload = 7900
+
+// PostgresRelay keeps the hubs of several backend instances in sync through
+// Postgres LISTEN/NOTIFY
+type PostgresRelay struct {
+	db       *sql.DB
+	listener *pq.Listener
+	hub      *Hub
+}
+
+// ListenPostgres relays the events published on hub to the other instances and
+// delivers theirs to hub. connStr must point at the same database as db.
+func ListenPostgres(hub *Hub, db *sql.DB, connStr string) (*PostgresRelay, error) {
+	listener := pq.NewListener(connStr, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Error on the realtime listener: %v", err)
+		}
+	})
+	if err := listener.Listen(PostgresChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("error listening on %s: %v", PostgresChannel, err)
+	}
+
+	relay := &PostgresRelay{db: db, listener: listener, hub: hub}
+	go relay.receive()
+	hub.SetRelay(relay)
+	return relay, nil
+}
+
+// Send notifies the other instances of an event. Events too large for a NOTIFY
+// payload are sent without data, with {"truncated":true} telling clients to refetch.
+func (r *PostgresRelay) Send(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		event.Data = json.RawMessage(`{"truncated":true}`)
+		if payload, err = json.Marshal(event); err != nil {
+			return err
+		}
+	}
+
+	_, err = r.db.Exec(`SELECT pg_notify($1, $2)`, PostgresChannel, string(payload))
+	return err
+}
+
+// receive delivers the events of other instances until the listener is closed
+func (r *PostgresRelay) receive() {
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case notification, ok := <-r.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification follows a reconnect, events sent meanwhile are lost
+			if notification == nil {
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+				log.Printf("Error decoding relayed event: %v", err)
+				continue
+			}
+			if event.Origin == r.hub.ID() {
+				continue
+			}
+			r.hub.Deliver(event)
+		case <-ping.C:
+			go r.listener.Ping()
+		}
+	}
+}
+
+// Close stops relaying events
+func (r *PostgresRelay) Close() error {
+	r.hub.SetRelay(nil)
+	return r.listener.Close()
+}
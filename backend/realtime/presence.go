@@ -0,0 +1,73 @@
+package realtime
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// PresenceTopic is the topic of the presence and typing events of a thread
+func PresenceTopic(threadID int) string {
+	return fmt.Sprintf("presence:%d", threadID)
+}
+
+// Presence tracks which users have a connection open in each room. A user may
+// have several connections, such as one per browser tab, and is only counted
+// as gone once the last one leaves. Presence is local to the instance, while
+// the events announcing joins and leaves reach every instance through the hub.
+type Presence struct {
+	mu    sync.Mutex
+	rooms map[string]map[string]int
+}
+
+// NewPresence returns an empty presence tracker
+func NewPresence() *Presence {
+	return &Presence{rooms: map[string]map[string]int{}}
+}
+
+// Join records a connection of username in room, and reports whether it is the
+// user's first one
+func (p *Presence) Join(room, username string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.rooms[room] == nil {
+		p.rooms[room] = map[string]int{}
+	}
+	p.rooms[room][username]++
+	return p.rooms[room][username] == 1
+}
+
+// Leave removes a connection of username from room, and reports whether it was
+// the user's last one
+func (p *Presence) Leave(room, username string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	members := p.rooms[room]
+	if members[username] == 0 {
+		return false
+	}
+	members[username]--
+	if members[username] > 0 {
+		return false
+	}
+	delete(members, username)
+	if len(members) == 0 {
+		delete(p.rooms, room)
+	}
+	return true
+}
+
+// Members lists the users in room in alphabetical order
+func (p *Presence) Members(room string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	members := make([]string, 0, len(p.rooms[room]))
+	for username := range p.rooms[room] {
+		members = append(members, username)
+	}
+	sort.Strings(members)
+	return members
+}
@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminRoutesRequirePermission(t *testing.T) {
+	s := newTestServer(t)
+	user := s.signupAndLogin("alice")
+
+	s.expect(s.do(http.MethodPut, "/admin/users/alice/role", user, gin.H{"role": "admin"}), http.StatusForbidden)
+}
+
+func TestAdminManagesRoles(t *testing.T) {
+	s := newTestServer(t)
+	s.signup("alice")
+	admin, _ := s.login("admin", "adminpass123")
+
+	s.expect(s.do(http.MethodPut, "/admin/users/alice/role", admin, gin.H{"role": "superuser"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPut, "/admin/users/nobody/role", admin, gin.H{"role": "moderator"}), http.StatusNotFound)
+	s.expect(s.do(http.MethodPut, "/admin/users/admin/role", admin, gin.H{"role": "user"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPut, "/admin/users/alice/role", admin, gin.H{"role": "moderator"}), http.StatusOK)
+
+	s.expect(s.do(http.MethodPost, "/admin/categories/music/moderators", admin, gin.H{"username": "alice"}), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, "/admin/categories/nope/moderators", admin, gin.H{"username": "alice"}), http.StatusNotFound)
+
+	grants, err := s.store.Users.GetUserGrants("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grants.Role != "moderator" || len(grants.ModeratedCategories) != 1 || grants.ModeratedCategories[0] != "music" {
+		t.Fatalf("unexpected grants %+v", grants)
+	}
+
+	s.expect(s.do(http.MethodDelete, "/admin/categories/nothing/moderators/alice", admin, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodDelete, "/admin/categories/music/moderators/nobody", admin, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodDelete, "/admin/categories/music/moderators/alice", admin, nil), http.StatusOK)
+	grants, _ = s.store.Users.GetUserGrants("alice")
+	if len(grants.ModeratedCategories) != 0 {
+		t.Fatalf("expected moderator rights to be removed, got %+v", grants)
+	}
+}
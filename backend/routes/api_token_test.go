@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"backend/middlewares"
+	"backend/models"
+	"backend/utils"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createAPIToken creates a personal API token and returns its ID and secret
+func (s *testServer) createAPIToken(token, username, password string, scopes ...string) (int, string) {
+	s.t.Helper()
+
+	body := s.expect(s.do(http.MethodPost, "/user/"+username+"/tokens", token, gin.H{
+		"password": password,
+		"name":     "release bot",
+		"scopes":   scopes,
+	}), http.StatusCreated)
+	return int(body["token"].(map[string]interface{})["id"].(float64)), body["secret"].(string)
+}
+
+func TestAPITokens(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	path := "/user/alice/tokens"
+
+	s.expect(s.do(http.MethodPost, path, alice, gin.H{"password": "wrongpassword", "name": "bot", "scopes": []string{"post"}}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, path, alice, gin.H{"password": "password123", "name": "bot", "scopes": []string{"admin"}}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, path, alice, gin.H{"password": "password123", "name": "bot"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, path, alice, gin.H{"password": "password123", "name": "bot", "scopes": []string{"post"}, "expires_in_days": 400}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, path, alice, gin.H{"password": "password123", "name": "bot", "scopes": []string{"moderate"}}), http.StatusForbidden)
+	tokenID, bot := s.createAPIToken(alice, "alice", "password123", "post", "read", "post")
+	if !strings.HasPrefix(bot, "sfp_") {
+		t.Fatalf("unexpected token %s", bot)
+	}
+
+	// Tokens work on the routes of their scopes only
+	threadID := s.postThread(bot, "technology")
+	s.expect(s.do(http.MethodGet, "/notifications", bot, nil), http.StatusOK)
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/votes", threadID), bot, gin.H{"vote": 1}), http.StatusForbidden)
+	_, voter := s.createAPIToken(alice, "alice", "password123", "vote")
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/votes", threadID), voter, gin.H{"vote": 1}), http.StatusCreated)
+	s.expect(s.do(http.MethodGet, "/user/alice/2fa", bot, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodPost, path, bot, gin.H{"password": "password123", "name": "bot", "scopes": []string{"vote"}}), http.StatusForbidden)
+	thread := s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d", threadID), "", nil), http.StatusOK)["thread"].(map[string]interface{})
+	if thread["username"] != "alice" {
+		t.Fatalf("unexpected thread %v", thread)
+	}
+
+	// The secret is never listed again
+	tokens := s.expect(s.do(http.MethodGet, path, alice, nil), http.StatusOK)["tokens"].([]interface{})
+	listed := tokens[1].(map[string]interface{})
+	if len(tokens) != 2 || listed["name"] != "release bot" || listed["last_used_at"] == nil || listed["secret"] != nil || len(listed["scopes"].([]interface{})) != 2 {
+		t.Fatalf("unexpected tokens %v", tokens)
+	}
+
+	// Revoked tokens stop working
+	bobby := s.signupAndLogin("bobby")
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("%s/%d", path, tokenID), bobby, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/user/bobby/tokens/%d", tokenID), bobby, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("%s/%d", path, tokenID), alice, nil), http.StatusOK)
+	s.expect(s.do(http.MethodGet, "/notifications", bot, nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("%s/%d", path, tokenID), alice, nil), http.StatusNotFound)
+
+	// Expired tokens too, though they stay listed
+	expired := "sfp_expired"
+	if _, err := s.store.APITokens.CreateAPIToken("alice", "old bot", []models.TokenScope{models.ScopeRead}, time.Now().Add(-time.Minute), utils.HashToken(expired)); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(s.do(http.MethodGet, "/notifications", expired, nil), http.StatusUnauthorized)
+	if tokens := s.expect(s.do(http.MethodGet, path, alice, nil), http.StatusOK)["tokens"].([]interface{}); len(tokens) != 2 {
+		t.Fatalf("expected the expired token to be listed, got %v", tokens)
+	}
+}
+
+func TestAPITokenModerateScope(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	threadID := s.postThread(alice, "general")
+	path := fmt.Sprintf("/threads/%d", threadID)
+	s.signup("bobby")
+	admin, _ := s.login("admin", "adminpass123")
+	s.expect(s.do(http.MethodPut, "/admin/users/bobby/role", admin, gin.H{"role": "moderator"}), http.StatusOK)
+	bobby, _ := s.login("bobby", "password123")
+
+	// Without the moderate scope, tokens of moderators only carry user rights
+	_, poster := s.createAPIToken(bobby, "bobby", "password123", "post")
+	s.expect(s.do(http.MethodPut, path, poster, gin.H{"title": "Edited"}), http.StatusForbidden)
+	s.expect(s.do(http.MethodGet, "/moderation/reports", poster, nil), http.StatusForbidden)
+
+	_, moderator := s.createAPIToken(bobby, "bobby", "password123", "post", "moderate")
+	s.expect(s.do(http.MethodPut, path, moderator, gin.H{"title": "Edited"}), http.StatusOK)
+	s.expect(s.do(http.MethodGet, "/moderation/reports", moderator, nil), http.StatusOK)
+
+	// Admin routes take a login
+	_, adminBot := s.createAPIToken(admin, "admin", "adminpass123", "moderate")
+	s.expect(s.do(http.MethodGet, "/moderation/reports", adminBot, nil), http.StatusOK)
+	s.expect(s.do(http.MethodGet, "/admin/audit", adminBot, nil), http.StatusForbidden)
+
+	// Rights are those of the user at the time the token is used
+	s.expect(s.do(http.MethodPut, "/admin/users/bobby/role", admin, gin.H{"role": "user"}), http.StatusOK)
+	s.expect(s.do(http.MethodPut, path, moderator, gin.H{"title": "Edited again"}), http.StatusForbidden)
+}
+
+func TestAPITokenModerateScopeRequiresTwoFactor(t *testing.T) {
+	defer func() { middlewares.RequireTwoFactorForPrivileged = false }()
+
+	s := newTestServer(t)
+	admin, _ := s.login("admin", "adminpass123")
+	_, adminBot := s.createAPIToken(admin, "admin", "adminpass123", "moderate")
+
+	// Like access tokens, API tokens only carry user rights until 2FA is enabled
+	middlewares.RequireTwoFactorForPrivileged = true
+	s.expect(s.do(http.MethodGet, "/moderation/reports", adminBot, nil), http.StatusForbidden)
+	s.enableTwoFactor(admin, "admin", "adminpass123")
+	s.expect(s.do(http.MethodGet, "/moderation/reports", adminBot, nil), http.StatusOK)
+}
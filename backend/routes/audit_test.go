@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditLog lists the audit entries returned for query as seen by the owner of token
+func (s *testServer) auditLog(token, query string) []map[string]interface{} {
+	s.t.Helper()
+
+	body := s.expect(s.do(http.MethodGet, "/admin/audit"+query, token, nil), http.StatusOK)
+	var entries []map[string]interface{}
+	for _, item := range body["entries"].([]interface{}) {
+		entries = append(entries, item.(map[string]interface{}))
+	}
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	s.signup("bobby")
+	admin, _ := s.login("admin", "adminpass123")
+	kept := s.postThread(alice, "general")
+	removed := s.postThread(alice, "general")
+	commentID := s.reply(alice, kept, 0, "buy cheap watches")
+
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/threads/%d/comments/%d?reason=spam", kept, commentID), admin, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/threads/%d", removed), alice, nil), http.StatusOK)
+	s.expect(s.do(http.MethodPut, "/admin/users/bobby/role", admin, gin.H{"role": "moderator", "reason": "helpful"}), http.StatusOK)
+	bobby, _ := s.login("bobby", "password123")
+
+	// Only admins read the log
+	s.expect(s.do(http.MethodGet, "/admin/audit", alice, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodGet, "/admin/audit", bobby, nil), http.StatusForbidden)
+
+	entries := s.auditLog(admin, "")
+	if len(entries) != 3 || entries[0]["action"] != "user.role" || entries[1]["action"] != "thread.delete" || entries[2]["action"] != "comment.delete" {
+		t.Fatalf("unexpected audit log %v", entries)
+	}
+	if role := entries[0]; role["actor"] != "admin" || role["reason"] != "helpful" ||
+		role["before"].(map[string]interface{})["role"] != "user" || role["after"].(map[string]interface{})["role"] != "moderator" {
+		t.Fatalf("unexpected role change entry %v", role)
+	}
+
+	deleted := s.auditLog(admin, "?action=comment.delete")
+	if len(deleted) != 1 {
+		t.Fatalf("expected one comment deletion, got %v", deleted)
+	}
+	entry := deleted[0]
+	if entry["actor"] != "admin" || entry["reason"] != "spam" || entry["target_type"] != "comment" || entry["target_id"] != float64(commentID) {
+		t.Fatalf("unexpected comment deletion entry %v", entry)
+	}
+	if entry["before"].(map[string]interface{})["content"] != "buy cheap watches" || entry["after"] != nil || entry["ip"] == "" {
+		t.Fatalf("expected a snapshot of the removed comment, got %v", entry)
+	}
+	list, _ := s.notifications(alice)
+	if len(list) != 1 || list[0]["message"] != "A moderator removed your comment: spam" {
+		t.Fatalf("unexpected notifications %v", list)
+	}
+
+	// Filters combine and pages follow the same order
+	if got := s.auditLog(admin, "?actor=alice"); len(got) != 1 || got[0]["target_id"] != float64(removed) {
+		t.Fatalf("unexpected entries for alice %v", got)
+	}
+	if got := s.auditLog(admin, fmt.Sprintf("?target_type=thread&target_id=%d", kept)); len(got) != 0 {
+		t.Fatalf("expected no entries for the kept thread, got %v", got)
+	}
+	if got := s.auditLog(admin, "?limit=1&page=2"); len(got) != 1 || got[0]["action"] != "thread.delete" {
+		t.Fatalf("unexpected second page %v", got)
+	}
+	since := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	if got := s.auditLog(admin, "?since="+since); len(got) != 0 {
+		t.Fatalf("expected no entries in the future, got %v", got)
+	}
+	s.expect(s.do(http.MethodGet, "/admin/audit?since=yesterday", admin, nil), http.StatusBadRequest)
+	s.expect(s.do(http.MethodGet, "/admin/audit?target_id=x", admin, nil), http.StatusBadRequest)
+}
+
+func TestAuditModeration(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	s.signup("bobby")
+	admin, _ := s.login("admin", "adminpass123")
+	threadID := s.postThread(alice, "music")
+	commentID := s.reply(alice, threadID, 0, "spam spam spam")
+
+	s.expect(s.do(http.MethodPost, "/admin/categories/music/moderators", admin, gin.H{"username": "bobby", "reason": "music expert"}), http.StatusCreated)
+	bobby, _ := s.login("bobby", "password123")
+	s.expect(s.do(http.MethodPut, fmt.Sprintf("/threads/%d?reason=typo", threadID), bobby, gin.H{"title": "Fixed"}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/comments/%d/report", threadID, commentID), admin, gin.H{"reason": "spam"}), http.StatusCreated)
+	caseID := int(s.reportCases(bobby, "")[0]["id"].(float64))
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/moderation/reports/%d/resolve", caseID), bobby, gin.H{"action": "remove", "note": "no spam"}), http.StatusOK)
+	s.sanction(bobby, "alice", gin.H{"type": "ban", "category": "music", "reason": "spammer"})
+
+	entries := s.auditLog(admin, "?actor=bobby")
+	var actions []string
+	for _, entry := range entries {
+		actions = append(actions, entry["action"].(string))
+	}
+	if got := fmt.Sprint(actions); got != "[sanction.create report.resolve comment.delete thread.edit]" {
+		t.Fatalf("unexpected actions %s", got)
+	}
+	if edit := entries[3]; edit["reason"] != "typo" || edit["before"].(map[string]interface{})["title"] != "Hello" || edit["after"].(map[string]interface{})["title"] != "Fixed" {
+		t.Fatalf("unexpected edit entry %v", edit)
+	}
+	if resolve := entries[1]; resolve["reason"] != "no spam" || resolve["before"].(map[string]interface{})["status"] != "open" || resolve["after"].(map[string]interface{})["status"] != "resolved" {
+		t.Fatalf("unexpected resolution entry %v", resolve)
+	}
+
+	added := s.auditLog(admin, "?action=category.moderator_add")
+	if len(added) != 1 || added[0]["reason"] != "music expert" {
+		t.Fatalf("unexpected moderator entries %v", added)
+	}
+	if after := added[0]["after"].(map[string]interface{}); fmt.Sprint(after["moderated_categories"]) != "[music]" {
+		t.Fatalf("unexpected moderator snapshot %v", after)
+	}
+	banned := s.auditLog(admin, "?action=sanction.create")
+	if len(banned) != 1 || banned[0]["target_type"] != "user" || banned[0]["after"].(map[string]interface{})["username"] != "alice" {
+		t.Fatalf("unexpected sanction entries %v", banned)
+	}
+	// Entries about a user are found by their ID
+	targetID := int(banned[0]["target_id"].(float64))
+	if got := s.auditLog(admin, fmt.Sprintf("?target_type=user&target_id=%d", targetID)); len(got) != 1 {
+		t.Fatalf("expected one entry about alice, got %v", got)
+	}
+}
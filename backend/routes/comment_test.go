@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCommentLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	token := s.signupAndLogin("alice")
+	threadID := s.postThread(token, "general")
+	path := fmt.Sprintf("/threads/%d/comments", threadID)
+
+	body := s.expect(s.do(http.MethodPost, path, token, gin.H{"content": "first"}), http.StatusCreated)
+	commentID := int(body["comment"].(map[string]interface{})["id"].(float64))
+	s.expect(s.do(http.MethodPost, path, token, gin.H{"content": "second"}), http.StatusCreated)
+
+	comments := s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK)["comments"].([]interface{})
+	if len(comments) != 2 || comments[0].(map[string]interface{})["content"] != "first" {
+		t.Fatalf("expected comments in ascending order, got %v", comments)
+	}
+
+	s.expect(s.do(http.MethodPut, fmt.Sprintf("%s/%d", path, commentID), token, gin.H{"content": "edited"}), http.StatusOK)
+	comments = s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK)["comments"].([]interface{})
+	if comments[0].(map[string]interface{})["content"] != "edited" {
+		t.Fatalf("expected edited comment, got %v", comments)
+	}
+
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("%s/%d", path, commentID), token, nil), http.StatusOK)
+	comments = s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK)["comments"].([]interface{})
+	if len(comments) != 1 {
+		t.Fatalf("expected 1 comment left, got %v", comments)
+	}
+}
+
+func TestCommentPermissions(t *testing.T) {
+	s := newTestServer(t)
+	owner := s.signupAndLogin("alice")
+	other := s.signupAndLogin("bobby")
+	threadID := s.postThread(owner, "general")
+	path := fmt.Sprintf("/threads/%d/comments", threadID)
+
+	body := s.expect(s.do(http.MethodPost, path, owner, gin.H{"content": "mine"}), http.StatusCreated)
+	commentPath := fmt.Sprintf("%s/%d", path, int(body["comment"].(map[string]interface{})["id"].(float64)))
+
+	s.expect(s.do(http.MethodPut, commentPath, other, gin.H{"content": "theirs"}), http.StatusForbidden)
+	s.expect(s.do(http.MethodDelete, commentPath, other, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodPut, path+"/999", owner, gin.H{"content": "x"}), http.StatusBadRequest)
+
+	if err := s.store.Users.AddCategoryModerator("bobby", "general"); err != nil {
+		t.Fatal(err)
+	}
+	moderator, _ := s.login("bobby", "password123")
+	s.expect(s.do(http.MethodDelete, commentPath, moderator, nil), http.StatusOK)
+}
+
+func TestDeletingThreadRemovesComments(t *testing.T) {
+	s := newTestServer(t)
+	token := s.signupAndLogin("alice")
+	threadID := s.postThread(token, "general")
+	path := fmt.Sprintf("/threads/%d/comments", threadID)
+
+	s.expect(s.do(http.MethodPost, path, token, gin.H{"content": "first"}), http.StatusCreated)
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/threads/%d", threadID), token, nil), http.StatusOK)
+
+	s.expect(s.do(http.MethodGet, path, "", nil), http.StatusNotFound)
+}
+
+// reply posts a comment, optionally under parentID, and returns its ID
+func (s *testServer) reply(token string, threadID, parentID int, content string) int {
+	s.t.Helper()
+
+	payload := gin.H{"content": content}
+	if parentID != 0 {
+		payload["parent_id"] = parentID
+	}
+	body := s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/comments", threadID), token, payload), http.StatusCreated)
+	return int(body["comment"].(map[string]interface{})["id"].(float64))
+}
+
+func TestCommentReplies(t *testing.T) {
+	s := newTestServer(t)
+	token := s.signupAndLogin("alice")
+	threadID := s.postThread(token, "general")
+	path := fmt.Sprintf("/threads/%d/comments", threadID)
+
+	root := s.reply(token, threadID, 0, "root")
+	child := s.reply(token, threadID, root, "child")
+	grandchild := s.reply(token, threadID, child, "grandchild")
+	s.reply(token, threadID, 0, "second root")
+
+	// Depth-first listing with depth for client-side nesting
+	comments := s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK)["comments"].([]interface{})
+	var order []string
+	for _, comment := range comments {
+		comment := comment.(map[string]interface{})
+		order = append(order, fmt.Sprintf("%v@%v", comment["content"], comment["depth"]))
+	}
+	if fmt.Sprint(order) != "[root@0 child@1 grandchild@2 second root@0]" {
+		t.Fatalf("unexpected comment order %v", order)
+	}
+
+	// Nested view cut at depth 1 flags the truncated branch
+	comments = s.expect(s.do(http.MethodGet, path+"?nested=true&max_depth=1", "", nil), http.StatusOK)["comments"].([]interface{})
+	first := comments[0].(map[string]interface{})
+	replies := first["replies"].([]interface{})
+	cut := replies[0].(map[string]interface{})
+	if len(replies) != 1 || cut["has_more_replies"] != true || cut["replies"] != nil || cut["reply_count"] != 1.0 {
+		t.Fatalf("unexpected truncated tree %v", first)
+	}
+
+	// Loading the truncated branch keeps absolute depths
+	comments = s.expect(s.do(http.MethodGet, fmt.Sprintf("%s/%d", path, child), "", nil), http.StatusOK)["comments"].([]interface{})
+	if len(comments) != 2 || comments[1].(map[string]interface{})["depth"] != 2.0 {
+		t.Fatalf("unexpected subtree %v", comments)
+	}
+	s.expect(s.do(http.MethodGet, path+"/999", "", nil), http.StatusNotFound)
+
+	// Replies must target a comment in the same thread
+	otherThread := s.postThread(token, "general")
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/comments", otherThread), token, gin.H{"content": "x", "parent_id": root}), http.StatusBadRequest)
+
+	// Deleting a comment with replies leaves a placeholder
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("%s/%d", path, child), token, nil), http.StatusOK)
+	comments = s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK)["comments"].([]interface{})
+	placeholder := comments[1].(map[string]interface{})
+	if len(comments) != 4 || placeholder["deleted"] != true || placeholder["content"] != "[deleted]" || placeholder["username"] != "[deleted]" {
+		t.Fatalf("expected a deleted placeholder, got %v", comments)
+	}
+	s.expect(s.do(http.MethodPut, fmt.Sprintf("%s/%d", path, child), token, gin.H{"content": "back"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, path, token, gin.H{"content": "x", "parent_id": child}), http.StatusBadRequest)
+
+	// Leaf comments are left out, with the placeholders that only answered them
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("%s/%d", path, grandchild), token, nil), http.StatusOK)
+	comments = s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK)["comments"].([]interface{})
+	if len(comments) != 2 {
+		t.Fatalf("expected the leaf and its placeholder parent to be left out, got %v", comments)
+	}
+}
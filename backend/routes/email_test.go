@@ -0,0 +1,106 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/mail"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenPattern finds the token in the link of an email
+var tokenPattern = regexp.MustCompile(`\?token=(\S+)`)
+
+// awaitMail waits for the nth email with subject sent to an address, counting
+// from 1, and returns the token of its link
+func (s *testServer) awaitMail(to, subject string, n int) string {
+	s.t.Helper()
+
+	outbox := s.store.Mailer.(*mail.Outbox)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var sent []mail.Message
+		for _, msg := range outbox.Messages() {
+			if msg.To == to && msg.Subject == subject {
+				sent = append(sent, msg)
+			}
+		}
+		if len(sent) >= n {
+			match := tokenPattern.FindStringSubmatch(sent[n-1].Body)
+			if match == nil {
+				s.t.Fatalf("no link in %q", sent[n-1].Body)
+			}
+			return match[1]
+		}
+	}
+	s.t.Fatalf("no email %d to %s about %q", n, to, subject)
+	return ""
+}
+
+func TestEmailVerification(t *testing.T) {
+	defer func() { controllers.RequireVerifiedEmail = false }()
+	controllers.RequireVerifiedEmail = true
+
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	token := s.awaitMail("alice@example.com", "Verify your email address", 1)
+	if body := s.expect(s.do(http.MethodGet, "/user/alice", "", nil), http.StatusOK); body["email_verified"] != false {
+		t.Fatalf("expected an unverified address, got %v", body)
+	}
+
+	// Unverified users cannot post, the reserved users predate verification
+	s.expect(s.do(http.MethodPost, "/threads/post", alice, gin.H{"title": "Hello", "content": "World", "category": "general"}), http.StatusForbidden)
+	admin, _ := s.login("admin", "adminpass123")
+	s.postThread(admin, "general")
+
+	// Resending replaces the first link
+	s.expect(s.do(http.MethodPost, "/verify-email/resend", alice, nil), http.StatusAccepted)
+	resent := s.awaitMail("alice@example.com", "Verify your email address", 2)
+	s.expect(s.do(http.MethodPost, "/verify-email", "", gin.H{"token": token}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, "/verify-email", "", gin.H{"token": resent + "x"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, "/verify-email", "", gin.H{"token": resent}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/verify-email", "", gin.H{"token": resent}), http.StatusBadRequest)
+
+	if body := s.expect(s.do(http.MethodGet, "/user/alice", "", nil), http.StatusOK); body["email_verified"] != true {
+		t.Fatalf("expected a verified address, got %v", body)
+	}
+	s.postThread(alice, "general")
+	s.expect(s.do(http.MethodPost, "/verify-email/resend", alice, nil), http.StatusConflict)
+}
+
+func TestPasswordReset(t *testing.T) {
+	s := newTestServer(t)
+	s.signup("alice")
+	alice, refreshToken := s.login("alice", "password123")
+	_, bot := s.createAPIToken(alice, "alice", "password123", "read")
+
+	// Unknown addresses get the same answer and no email
+	s.expect(s.do(http.MethodPost, "/password/forgot", "", gin.H{"email": "nobody@example.com"}), http.StatusAccepted)
+	s.expect(s.do(http.MethodPost, "/password/forgot", "", gin.H{"email": "not-an-email"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, "/password/forgot", "", gin.H{"email": "alice@example.com"}), http.StatusAccepted)
+	token := s.awaitMail("alice@example.com", "Reset your password", 1)
+	for _, sent := range s.store.Mailer.(*mail.Outbox).Messages() {
+		if sent.To == "nobody@example.com" {
+			t.Fatalf("unexpected email to an unknown address %v", sent)
+		}
+	}
+
+	// Verification tokens do not reset passwords
+	verifyToken := s.awaitMail("alice@example.com", "Verify your email address", 1)
+	s.expect(s.do(http.MethodPost, "/password/reset", "", gin.H{"token": verifyToken, "password": "newpassword123"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, "/password/reset", "", gin.H{"token": token, "password": "short"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, "/password/reset", "", gin.H{"token": token, "password": "newpassword123"}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/password/reset", "", gin.H{"token": token, "password": "otherpassword123"}), http.StatusBadRequest)
+
+	// The old password, sessions and API tokens stop working, and the address
+	// is verified
+	s.expect(s.do(http.MethodPost, "/login", "", gin.H{"username": "alice", "password": "password123"}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/token/refresh", "", gin.H{"refresh_token": refreshToken}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodGet, "/notifications", bot, nil), http.StatusUnauthorized)
+	s.login("alice", "newpassword123")
+	if body := s.expect(s.do(http.MethodGet, "/user/alice", "", nil), http.StatusOK); body["email_verified"] != true {
+		t.Fatalf("expected a verified address, got %v", body)
+	}
+}
@@ -0,0 +1,177 @@
+package routes
+
+import (
+	"backend/models"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseEvent is one event read from a Server-Sent Events stream
+type sseEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+// eventStream reads the events of a streaming endpoint served over a real connection
+type eventStream struct {
+	t      *testing.T
+	events chan sseEvent
+}
+
+// stream opens a Server-Sent Events stream and waits for its ready event
+func (s *testServer) stream(path string) *eventStream {
+	s.t.Helper()
+
+	server := httptest.NewServer(s.router)
+	s.t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		s.t.Fatalf("open stream: %v", err)
+	}
+	s.t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		s.t.Fatalf("expected status 200 for %s, got %d", path, resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		s.t.Fatalf("unexpected content type %q", got)
+	}
+
+	stream := &eventStream{t: s.t, events: make(chan sseEvent, 16)}
+	go func() {
+		defer close(stream.events)
+		scanner := bufio.NewScanner(resp.Body)
+		var event sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				event.name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case strings.HasPrefix(line, "data:"):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &event.data)
+			case line == "":
+				if event.name != "" {
+					stream.events <- event
+				}
+				event = sseEvent{}
+			}
+		}
+	}()
+
+	stream.expect("ready")
+	return stream
+}
+
+// expect waits for the next event, which must be called name
+func (e *eventStream) expect(name string) map[string]interface{} {
+	e.t.Helper()
+
+	select {
+	case event, ok := <-e.events:
+		if !ok {
+			e.t.Fatalf("stream closed while waiting for %s", name)
+		}
+		if event.name != name {
+			e.t.Fatalf("expected event %s, got %s: %v", name, event.name, event.data)
+		}
+		return event.data
+	case <-time.After(2 * time.Second):
+		e.t.Fatalf("timed out waiting for %s", name)
+	}
+	return nil
+}
+
+func TestThreadEvents(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	base := fmt.Sprintf("/threads/%d", threadID)
+
+	s.expect(s.do(http.MethodGet, "/threads/999/events", "", nil), http.StatusNotFound)
+	events := s.stream(base + "/events")
+
+	commentID := s.reply(bobby, threadID, 0, "first")
+	created := events.expect("comment_created")
+	if created["id"] != float64(commentID) || created["content"] != "first" || created["username"] != "bobby" {
+		t.Fatalf("unexpected comment_created data %v", created)
+	}
+
+	s.expect(s.do(http.MethodPut, fmt.Sprintf("%s/comments/%d", base, commentID), bobby, gin.H{"content": "edited"}), http.StatusOK)
+	if updated := events.expect("comment_updated"); updated["content"] != "edited" {
+		t.Fatalf("unexpected comment_updated data %v", updated)
+	}
+
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("%s/comments/%d/votes", base, commentID), alice, gin.H{"vote": 1}), http.StatusCreated)
+	if votes := events.expect("comment_votes"); votes["comment_id"] != float64(commentID) || votes["score"] != float64(1) {
+		t.Fatalf("unexpected comment_votes data %v", votes)
+	}
+
+	s.expect(s.do(http.MethodPost, base+"/votes", bobby, gin.H{"vote": -1}), http.StatusCreated)
+	if votes := events.expect("thread_votes"); votes["votes"] != float64(-1) || votes["downvotes"] != float64(1) {
+		t.Fatalf("unexpected thread_votes data %v", votes)
+	}
+	s.expect(s.do(http.MethodDelete, base+"/votes", bobby, nil), http.StatusOK)
+	if votes := events.expect("thread_votes"); votes["votes"] != float64(0) {
+		t.Fatalf("unexpected thread_votes data %v", votes)
+	}
+
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("%s/comments/%d", base, commentID), bobby, nil), http.StatusOK)
+	if deleted := events.expect("comment_deleted"); deleted["id"] != float64(commentID) {
+		t.Fatalf("unexpected comment_deleted data %v", deleted)
+	}
+}
+
+func TestNotificationStream(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+
+	s.expect(s.do(http.MethodGet, "/notifications/stream", "", nil), http.StatusUnauthorized)
+	events := s.stream("/notifications/stream?access_token=" + alice)
+
+	s.reply(bobby, threadID, 0, "hello")
+	if n := events.expect("notification"); n["type"] != "thread_reply" || n["actor"] != "bobby" {
+		t.Fatalf("unexpected notification %v", n)
+	}
+	if unread := events.expect("unread_count"); unread["unread_count"] != float64(1) {
+		t.Fatalf("unexpected unread count %v", unread)
+	}
+
+	s.expect(s.do(http.MethodPost, "/notifications/read_all", alice, nil), http.StatusOK)
+	if unread := events.expect("unread_count"); unread["unread_count"] != float64(0) {
+		t.Fatalf("unexpected unread count %v", unread)
+	}
+}
+
+func TestHiddenThreadEvents(t *testing.T) {
+	defer func(threshold int) { models.ReportHideThreshold = threshold }(models.ReportHideThreshold)
+	models.ReportHideThreshold = 1
+
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	path := fmt.Sprintf("/threads/%d/events", threadID)
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/report", threadID), bobby, gin.H{"reason": "spam"}), http.StatusCreated)
+
+	// Hidden threads are only followed by their author and moderators
+	s.expect(s.do(http.MethodGet, path, "", nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodGet, path, bobby, nil), http.StatusNotFound)
+	s.stream(path + "?access_token=" + alice)
+
+	// Like the threads of shadowbanned users
+	otherID := s.postThread(alice, "general")
+	admin, _ := s.login("admin", "adminpass123")
+	s.sanction(admin, "alice", gin.H{"type": "shadowban", "reason": "spam"})
+	s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d/events", otherID), bobby, nil), http.StatusNotFound)
+}
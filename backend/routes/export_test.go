@@ -0,0 +1,116 @@
+package routes
+
+import (
+	"archive/zip"
+	"backend/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// awaitExport polls the status of an export until it is no longer pending
+func (s *testServer) awaitExport(token, username string, exportID int) map[string]interface{} {
+	s.t.Helper()
+
+	path := fmt.Sprintf("/user/%s/exports/%d", username, exportID)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		body := s.expect(s.do(http.MethodGet, path, token, nil), http.StatusOK)
+		if body["export"].(map[string]interface{})["status"] != string(models.ExportPending) {
+			return body
+		}
+	}
+	s.t.Fatalf("export %d is still pending", exportID)
+	return nil
+}
+
+// readExportFile decodes a JSON file of an export archive into v
+func readExportFile(t *testing.T, archive *zip.Reader, name string, v interface{}) {
+	t.Helper()
+
+	f, err := archive.Open(name)
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		t.Fatalf("decode %s: %v", name, err)
+	}
+}
+
+func TestDataExport(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	bobbyThread := s.postThread(bobby, "general")
+	s.reply(alice, bobbyThread, 0, "hello")
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/votes", bobbyThread), alice, gin.H{"vote": 1}), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/user/alice/save_thread/%d", bobbyThread), alice, nil), http.StatusOK)
+
+	s.expect(s.do(http.MethodPost, "/user/alice/exports", bobby, nil), http.StatusForbidden)
+	body := s.expect(s.do(http.MethodPost, "/user/alice/exports", alice, nil), http.StatusAccepted)
+	exportID := int(body["export"].(map[string]interface{})["id"].(float64))
+	s.expect(s.do(http.MethodGet, fmt.Sprintf("/user/bobby/exports/%d", exportID), bobby, nil), http.StatusNotFound)
+
+	body = s.awaitExport(alice, "alice", exportID)
+	url, _ := body["download_url"].(string)
+	if body["export"].(map[string]interface{})["status"] != "ready" || url == "" {
+		t.Fatalf("expected a ready export with a link, got %v", body)
+	}
+
+	// The link works without a login, but not once tampered with
+	s.expect(s.do(http.MethodGet, strings.Replace(url, "expires=", "expires=1", 1), "", nil), http.StatusForbidden)
+	rec := s.do(http.MethodGet, url, "", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("expected the archive, got %d: %s", rec.Code, rec.Body.String())
+	}
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var profile map[string]interface{}
+	readExportFile(t, archive, "profile.json", &profile)
+	if profile["username"] != "alice" || profile["password"] != nil {
+		t.Fatalf("unexpected profile %v", profile)
+	}
+	var threads, comments, votes, saved []map[string]interface{}
+	readExportFile(t, archive, "threads.json", &threads)
+	readExportFile(t, archive, "comments.json", &comments)
+	readExportFile(t, archive, "votes.json", &votes)
+	readExportFile(t, archive, "saved_threads.json", &saved)
+	if len(threads) != 1 || threads[0]["id"] != float64(threadID) {
+		t.Fatalf("unexpected threads %v", threads)
+	}
+	if len(comments) != 1 || comments[0]["content"] != "hello" {
+		t.Fatalf("unexpected comments %v", comments)
+	}
+	if len(votes) != 1 || votes[0]["thread_id"] != float64(bobbyThread) || len(saved) != 1 || saved[0]["thread_id"] != float64(bobbyThread) {
+		t.Fatalf("unexpected votes %v or saved threads %v", votes, saved)
+	}
+	var tags []string
+	readExportFile(t, archive, "tags.json", &tags)
+	if fmt.Sprint(tags) != "[go Testing]" {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+
+	// Expired exports have no link
+	defer func(ttl time.Duration) { models.ExportTTL = ttl }(models.ExportTTL)
+	models.ExportTTL = -time.Minute
+	body = s.expect(s.do(http.MethodPost, "/user/alice/exports", alice, nil), http.StatusAccepted)
+	body = s.awaitExport(alice, "alice", int(body["export"].(map[string]interface{})["id"].(float64)))
+	if _, ok := body["download_url"]; ok {
+		t.Fatalf("expected no link for an expired export, got %v", body)
+	}
+}
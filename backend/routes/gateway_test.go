@@ -0,0 +1,262 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/models"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// gatewayClient is a WebSocket connection to the gateway
+type gatewayClient struct {
+	t  *testing.T
+	ws *websocket.Conn
+}
+
+// gatewayURL serves the router over a real connection and returns the gateway URL
+func (s *testServer) gatewayURL() string {
+	s.t.Helper()
+
+	server := httptest.NewServer(s.router)
+	s.t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+// dial connects to the gateway as the owner of token
+func (s *testServer) dial(url, token string) *gatewayClient {
+	s.t.Helper()
+
+	ws, err := websocket.Dial(url+"?access_token="+token, "", "http://localhost:3000")
+	if err != nil {
+		s.t.Fatalf("dial gateway: %v", err)
+	}
+	s.t.Cleanup(func() { ws.Close() })
+	return &gatewayClient{t: s.t, ws: ws}
+}
+
+func (g *gatewayClient) send(msg gin.H) {
+	g.t.Helper()
+
+	if err := websocket.JSON.Send(g.ws, msg); err != nil {
+		g.t.Fatalf("send %v: %v", msg, err)
+	}
+}
+
+// expect reads the next message, which must be of type msgType
+func (g *gatewayClient) expect(msgType string) map[string]interface{} {
+	g.t.Helper()
+
+	g.ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg map[string]interface{}
+	if err := websocket.JSON.Receive(g.ws, &msg); err != nil {
+		g.t.Fatalf("waiting for %s: %v", msgType, err)
+	}
+	if msg["type"] != msgType {
+		g.t.Fatalf("expected %s message, got %v", msgType, msg)
+	}
+	return msg
+}
+
+func TestGatewayPresenceAndTyping(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	url := s.gatewayURL()
+
+	a := s.dial(url, alice)
+	a.send(gin.H{"type": "subscribe", "thread_id": 999})
+	if msg := a.expect("error"); msg["error"] != "thread not found" {
+		t.Fatalf("unexpected error %v", msg)
+	}
+	a.send(gin.H{"type": "subscribe", "thread_id": threadID})
+	if msg := a.expect("subscribed"); fmt.Sprint(msg["members"]) != "[alice]" {
+		t.Fatalf("unexpected members %v", msg["members"])
+	}
+
+	b := s.dial(url, bobby)
+	b.send(gin.H{"type": "typing", "thread_id": threadID, "typing": true})
+	b.expect("error")
+	b.send(gin.H{"type": "subscribe", "thread_id": threadID})
+	if msg := b.expect("subscribed"); fmt.Sprint(msg["members"]) != "[alice bobby]" {
+		t.Fatalf("unexpected members %v", msg["members"])
+	}
+	if msg := a.expect("presence"); msg["username"] != "bobby" || msg["status"] != "joined" {
+		t.Fatalf("unexpected presence %v", msg)
+	}
+
+	// Refreshing the indicator is not announced again
+	b.send(gin.H{"type": "typing", "thread_id": threadID, "typing": true})
+	b.send(gin.H{"type": "typing", "thread_id": threadID, "typing": true})
+	b.send(gin.H{"type": "typing", "thread_id": threadID, "typing": false})
+	if msg := a.expect("typing"); msg["username"] != "bobby" || msg["typing"] != true {
+		t.Fatalf("unexpected typing %v", msg)
+	}
+	if msg := a.expect("typing"); msg["typing"] != false {
+		t.Fatalf("unexpected typing %v", msg)
+	}
+
+	// Thread events are forwarded
+	s.reply(bobby, threadID, 0, "live")
+	msg := a.expect("comment_created")
+	if data := msg["data"].(map[string]interface{}); data["content"] != "live" || msg["thread_id"] != float64(threadID) {
+		t.Fatalf("unexpected comment_created %v", msg)
+	}
+
+	a.send(gin.H{"type": "ping"})
+	a.expect("pong")
+
+	b.ws.Close()
+	if msg := a.expect("presence"); msg["username"] != "bobby" || msg["status"] != "left" {
+		t.Fatalf("unexpected presence %v", msg)
+	}
+}
+
+func TestGatewayTypingExpires(t *testing.T) {
+	defer func(timeout time.Duration) { controllers.TypingTimeout = timeout }(controllers.TypingTimeout)
+	controllers.TypingTimeout = 50 * time.Millisecond
+
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	url := s.gatewayURL()
+
+	a := s.dial(url, alice)
+	a.send(gin.H{"type": "subscribe", "thread_id": threadID})
+	a.expect("subscribed")
+	b := s.dial(url, bobby)
+	b.send(gin.H{"type": "subscribe", "thread_id": threadID})
+	b.expect("subscribed")
+	a.expect("presence")
+
+	b.send(gin.H{"type": "typing", "thread_id": threadID, "typing": true})
+	if msg := a.expect("typing"); msg["typing"] != true {
+		t.Fatalf("unexpected typing %v", msg)
+	}
+	if msg := a.expect("typing"); msg["typing"] != false {
+		t.Fatalf("unexpected typing %v", msg)
+	}
+}
+
+func TestGatewayRequiresToken(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	url := s.gatewayURL()
+
+	if _, err := websocket.Dial(url, "", "http://localhost:3000"); err == nil {
+		t.Fatal("expected the gateway to reject connections without a token")
+	}
+	if _, err := websocket.Dial(url+"?access_token="+alice, "", "https://evil.example.com"); err == nil {
+		t.Fatal("expected the gateway to reject unknown origins")
+	}
+	s.expect(s.do(http.MethodGet, "/ws", "", nil), http.StatusUnauthorized)
+}
+
+func TestGatewayHidesHiddenThreads(t *testing.T) {
+	defer func(threshold int) { models.ReportHideThreshold = threshold }(models.ReportHideThreshold)
+	models.ReportHideThreshold = 1
+
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	otherID := s.postThread(bobby, "general")
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/report", threadID), bobby, gin.H{"reason": "spam"}), http.StatusCreated)
+	admin, _ := s.login("admin", "adminpass123")
+	url := s.gatewayURL()
+
+	b := s.dial(url, bobby)
+	b.send(gin.H{"type": "subscribe", "thread_id": threadID})
+	if msg := b.expect("error"); msg["error"] != "thread not found" {
+		t.Fatalf("unexpected error %v", msg)
+	}
+	a := s.dial(url, alice)
+	a.send(gin.H{"type": "subscribe", "thread_id": threadID})
+	a.expect("subscribed")
+
+	s.sanction(admin, "bobby", gin.H{"type": "shadowban", "reason": "spam"})
+	a.send(gin.H{"type": "subscribe", "thread_id": otherID})
+	if msg := a.expect("error"); msg["error"] != "thread not found" {
+		t.Fatalf("unexpected error %v", msg)
+	}
+}
+
+func TestGatewayHidesShadowbannedPresence(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	carol := s.signupAndLogin("carol")
+	threadID := s.postThread(alice, "general")
+	admin, _ := s.login("admin", "adminpass123")
+	s.sanction(admin, "bobby", gin.H{"type": "shadowban", "reason": "spam"})
+	url := s.gatewayURL()
+
+	a := s.dial(url, alice)
+	a.send(gin.H{"type": "subscribe", "thread_id": threadID})
+	a.expect("subscribed")
+
+	// The shadowbanned user still sees themselves in the room
+	b := s.dial(url, bobby)
+	b.send(gin.H{"type": "subscribe", "thread_id": threadID})
+	if msg := b.expect("subscribed"); fmt.Sprint(msg["members"]) != "[alice bobby]" {
+		t.Fatalf("unexpected members %v", msg["members"])
+	}
+	b.send(gin.H{"type": "typing", "thread_id": threadID, "typing": true})
+	b.send(gin.H{"type": "ping"})
+	b.expect("pong")
+
+	c := s.dial(url, carol)
+	c.send(gin.H{"type": "subscribe", "thread_id": threadID})
+	if msg := c.expect("subscribed"); fmt.Sprint(msg["members"]) != "[alice carol]" {
+		t.Fatalf("unexpected members %v", msg["members"])
+	}
+	if msg := a.expect("presence"); msg["username"] != "carol" {
+		t.Fatalf("unexpected presence %v", msg)
+	}
+	c.send(gin.H{"type": "typing", "thread_id": threadID, "typing": true})
+	if msg := a.expect("typing"); msg["username"] != "carol" {
+		t.Fatalf("unexpected typing %v", msg)
+	}
+}
+
+func TestGatewayClosesRevokedSessions(t *testing.T) {
+	defer func(heartbeat time.Duration) { controllers.GatewayHeartbeat = heartbeat }(controllers.GatewayHeartbeat)
+	controllers.GatewayHeartbeat = 100 * time.Millisecond
+
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	tokenID, secret := s.createAPIToken(alice, "alice", "password123", "read")
+	url := s.gatewayURL()
+
+	a := s.dial(url, alice)
+	bot := s.dial(url, secret)
+	a.expect("ping")
+	a.send(gin.H{"type": "pong"})
+	bot.expect("ping")
+	bot.send(gin.H{"type": "pong"})
+
+	// Connections are closed at the first heartbeat after a revocation
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/user/alice/tokens/%d", tokenID), alice, nil), http.StatusOK)
+	if msg := bot.expect("error"); msg["error"] != "session has been revoked" {
+		t.Fatalf("unexpected error %v", msg)
+	}
+	a.expect("ping")
+	a.send(gin.H{"type": "pong"})
+
+	s.expect(s.do(http.MethodPost, "/logout", alice, nil), http.StatusOK)
+	if msg := a.expect("error"); msg["error"] != "session has been revoked" {
+		t.Fatalf("unexpected error %v", msg)
+	}
+	var msg map[string]interface{}
+	if err := websocket.JSON.Receive(a.ws, &msg); err == nil {
+		t.Fatalf("expected the connection to be closed, got %v", msg)
+	}
+}
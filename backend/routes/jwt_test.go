@@ -0,0 +1,189 @@
+package routes
+
+import (
+	"backend/auth"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// useKeys makes the server sign with the key named signingKeyID and verify with keys
+func (s *testServer) useKeys(signingKeyID string, keys ...*auth.Key) {
+	s.t.Helper()
+
+	service, err := auth.NewService(auth.DefaultIssuer, auth.DefaultIssuer, signingKeyID, keys)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.store.JWT = service
+}
+
+// jwks fetches the published keys by ID
+func (s *testServer) jwks() map[string]map[string]interface{} {
+	s.t.Helper()
+
+	keys := make(map[string]map[string]interface{})
+	for _, key := range s.expect(s.do(http.MethodGet, "/.well-known/jwks.json", "", nil), http.StatusOK)["keys"].([]interface{}) {
+		jwk := key.(map[string]interface{})
+		keys[jwk["kid"].(string)] = jwk
+	}
+	return keys
+}
+
+func newEd25519Key(t *testing.T, id string) *auth.Key {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := auth.NewKey(id, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newRSAKey(t *testing.T, id string) *auth.Key {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := auth.NewKey(id, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestAccessTokenClaims(t *testing.T) {
+	s := newTestServer(t)
+	s.signup("alice")
+	token, _ := s.login("alice", "password123")
+	other, _ := s.login("alice", "password123")
+
+	// Other services verify tokens with the published key alone
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		jwk := s.jwks()[token.Header["kid"].(string)]
+		if jwk["kty"] != "OKP" || jwk["alg"] != "EdDSA" {
+			t.Fatalf("unexpected key %v", jwk)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk["x"].(string))
+		return ed25519.PublicKey(x), err
+	}, jwt.WithValidMethods([]string{"EdDSA"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["iss"] != "soforum" || !claims.VerifyAudience("soforum", true) || claims["sub"] != "alice" || claims["iat"] == nil || claims["jti"] == nil {
+		t.Fatalf("unexpected claims %v", claims)
+	}
+	otherClaims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(other, otherClaims); err != nil || otherClaims["jti"] == claims["jti"] {
+		t.Fatalf("expected a new token ID, got %v", otherClaims)
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	s := newTestServer(t)
+	s.signup("alice")
+	old, next := newRSAKey(t, "2026-09"), newEd25519Key(t, "2026-10")
+
+	s.useKeys("2026-09", old)
+	oldToken, _ := s.login("alice", "password123")
+	if jwks := s.jwks(); len(jwks) != 1 || jwks["2026-09"]["kty"] != "RSA" || jwks["2026-09"]["e"] != "AQAB" {
+		t.Fatalf("unexpected keys %v", jwks)
+	}
+
+	// Tokens signed before the rotation keep working while the old key is kept
+	s.useKeys("2026-10", old, next)
+	newToken, _ := s.login("alice", "password123")
+	s.expect(s.do(http.MethodGet, "/user/alice/2fa", oldToken, nil), http.StatusOK)
+	s.expect(s.do(http.MethodGet, "/user/alice/2fa", newToken, nil), http.StatusOK)
+	if jwks := s.jwks(); len(jwks) != 2 || jwks["2026-10"]["crv"] != "Ed25519" {
+		t.Fatalf("unexpected keys %v", jwks)
+	}
+
+	// Only the public part of a retired key is needed, until it is dropped
+	retired, err := auth.NewKey(old.ID, old.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.NewService(auth.DefaultIssuer, auth.DefaultIssuer, retired.ID, []*auth.Key{retired}); err == nil {
+		t.Fatal("expected a public key to be refused for signing")
+	}
+	s.useKeys("2026-10", retired, next)
+	s.expect(s.do(http.MethodGet, "/user/alice/2fa", oldToken, nil), http.StatusOK)
+	s.useKeys("2026-10", next)
+	s.expect(s.do(http.MethodGet, "/user/alice/2fa", oldToken, nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodGet, "/user/alice/2fa", newToken, nil), http.StatusOK)
+}
+
+func TestForeignTokensRejected(t *testing.T) {
+	s := newTestServer(t)
+	s.signup("alice")
+	token, _ := s.login("alice", "password123")
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+	key := newEd25519Key(t, "ephemeral")
+
+	sign := func(method jwt.SigningMethod, secret interface{}, change gin.H) string {
+		forged := jwt.MapClaims{}
+		for name, value := range claims {
+			forged[name] = value
+		}
+		for name, value := range change {
+			forged[name] = value
+		}
+		unsigned := jwt.NewWithClaims(method, forged)
+		unsigned.Header["kid"] = "ephemeral"
+		signed, err := unsigned.SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	// The former HS256 secret, another key of the same name and unsigned tokens
+	// are refused
+	for _, forged := range []string{
+		sign(jwt.SigningMethodHS256, []byte(os.Getenv("JWT_SECRET_KEY")), nil),
+		sign(jwt.SigningMethodEdDSA, key.Private, nil),
+		sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, nil),
+	} {
+		s.expect(s.do(http.MethodGet, "/user/alice/2fa", forged, nil), http.StatusUnauthorized)
+	}
+
+	// Tokens of another issuer or for another audience are refused too
+	s.useKeys("ephemeral", key)
+	s.expect(s.do(http.MethodGet, "/user/alice/2fa", sign(jwt.SigningMethodEdDSA, key.Private, nil), nil), http.StatusOK)
+	for _, change := range []gin.H{
+		{"iss": "elsewhere"},
+		{"aud": "elsewhere"},
+		{"exp": time.Now().Add(-time.Minute).Unix()},
+		{"exp": nil},
+	} {
+		s.expect(s.do(http.MethodGet, "/user/alice/2fa", sign(jwt.SigningMethodEdDSA, key.Private, change), nil), http.StatusUnauthorized)
+	}
+}
+
+func TestProductionRequiresJWTKeys(t *testing.T) {
+	t.Setenv("JWT_KEYS_DIR", "")
+	t.Setenv("ENV", "development")
+	if _, err := auth.FromEnv(); err != nil {
+		t.Fatalf("expected an ephemeral key in development, got %v", err)
+	}
+
+	t.Setenv("ENV", "production")
+	if _, err := auth.FromEnv(); err == nil {
+		t.Fatal("expected production to refuse an ephemeral key")
+	}
+}
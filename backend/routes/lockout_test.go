@@ -0,0 +1,163 @@
+package routes
+
+import (
+	"backend/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// failLogin makes a login attempt that is refused with status
+func (s *testServer) failLogin(username, password string, status int) map[string]interface{} {
+	s.t.Helper()
+
+	return s.expect(s.do(http.MethodPost, "/login", "", gin.H{"username": username, "password": password}), status)
+}
+
+func TestLoginDoesNotRevealAccounts(t *testing.T) {
+	s := newTestServer(t)
+	s.signup("alice")
+
+	wrong := s.failLogin("alice", "password124", http.StatusUnauthorized)
+	unknown := s.failLogin("nobody", "password124", http.StatusUnauthorized)
+	if wrong["error"] != "invalid credentials" || unknown["error"] != wrong["error"] {
+		t.Fatalf("expected the same error, got %v and %v", wrong, unknown)
+	}
+}
+
+func TestAccountLockout(t *testing.T) {
+	defer func(policy models.LoginPolicy) { models.AccountLoginPolicy = policy }(models.AccountLoginPolicy)
+	models.AccountLoginPolicy = models.LoginPolicy{FreeAttempts: 1, MaxFailures: 2, Lockout: time.Hour, Window: time.Hour}
+
+	s := newTestServer(t)
+	s.signup("alice")
+	s.signup("bobby")
+
+	// Past the free attempts even the right password is refused, for accounts
+	// that exist and those that do not alike
+	for _, username := range []string{"alice", "nobody"} {
+		s.failLogin(username, "password124", http.StatusUnauthorized)
+		s.failLogin(username, "password124", http.StatusUnauthorized)
+		rec := s.do(http.MethodPost, "/login", "", gin.H{"username": username, "password": "password123"})
+		body := s.expect(rec, http.StatusTooManyRequests)
+		if rec.Header().Get("Retry-After") == "" || body["retry_after"].(float64) < 3590 {
+			t.Fatalf("expected to retry in an hour, got %v", body)
+		}
+	}
+	s.login("bobby", "password123")
+
+	// Admins lift the lockout
+	admin, _ := s.login("admin", "adminpass123")
+	bobby, _ := s.login("bobby", "password123")
+	s.expect(s.do(http.MethodPost, "/admin/users/alice/unlock", bobby, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodPost, "/admin/users/nobody/unlock", admin, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodPost, "/admin/users/alice/unlock?reason=verified+by+email", admin, nil), http.StatusOK)
+	s.login("alice", "password123")
+	if entries := s.auditLog(admin, "?action=user.unlock"); len(entries) != 1 || entries[0]["reason"] != "verified by email" {
+		t.Fatalf("unexpected audit entries %v", entries)
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	defer func(policy models.LoginPolicy) { models.AccountLoginPolicy = policy }(models.AccountLoginPolicy)
+	models.AccountLoginPolicy = models.LoginPolicy{FreeAttempts: 1, MaxFailures: 10, Lockout: time.Hour, Window: time.Hour}
+
+	s := newTestServer(t)
+	s.signup("alice")
+	s.failLogin("alice", "password124", http.StatusUnauthorized)
+	s.failLogin("alice", "password124", http.StatusUnauthorized)
+	if body := s.failLogin("alice", "password123", http.StatusTooManyRequests); body["retry_after"] != 1.0 {
+		t.Fatalf("expected to retry in a second, got %v", body)
+	}
+	time.Sleep(time.Second)
+
+	// A success forgets the failures
+	s.login("alice", "password123")
+	s.failLogin("alice", "password124", http.StatusUnauthorized)
+	s.login("alice", "password123")
+}
+
+func TestIPLockout(t *testing.T) {
+	defer func(policy models.LoginPolicy) { models.IPLoginPolicy = policy }(models.IPLoginPolicy)
+	models.IPLoginPolicy = models.LoginPolicy{FreeAttempts: 2, MaxFailures: 3, Lockout: time.Hour, Window: time.Hour}
+
+	s := newTestServer(t)
+	s.signup("alice")
+
+	// Guessing across accounts locks out the client
+	for _, username := range []string{"bobby", "carol", "david"} {
+		s.failLogin(username, "password124", http.StatusUnauthorized)
+	}
+	s.failLogin("alice", "password123", http.StatusTooManyRequests)
+}
+
+func TestConcurrentGuessesAreCounted(t *testing.T) {
+	defer func(policy models.LoginPolicy) { models.AccountLoginPolicy = policy }(models.AccountLoginPolicy)
+	models.AccountLoginPolicy = models.LoginPolicy{FreeAttempts: 1, MaxFailures: 2, Lockout: time.Hour, Window: time.Hour}
+
+	s := newTestServer(t)
+	s.signup("alice")
+
+	// Guesses made at once cannot all pass the lockout check before the
+	// first of them is counted
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- s.do(http.MethodPost, "/login", "", gin.H{"username": "alice", "password": "password124"}).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	refused := 0
+	for code := range codes {
+		if code == http.StatusTooManyRequests {
+			refused++
+		}
+	}
+	if refused != 8 {
+		t.Fatalf("expected 8 guesses to be refused, got %d", refused)
+	}
+}
+
+func TestLockoutIgnoresForwardedFor(t *testing.T) {
+	defer func(policy models.LoginPolicy) { models.IPLoginPolicy = policy }(models.IPLoginPolicy)
+	models.IPLoginPolicy = models.LoginPolicy{FreeAttempts: 1, MaxFailures: 2, Lockout: time.Hour, Window: time.Hour}
+	defer func(proxies []string) { TrustedProxies = proxies }(TrustedProxies)
+
+	guess := func(s *testServer, username, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"`+username+`","password":"password124"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Clients cannot pass for others by sending the header themselves
+	s := newTestServer(t)
+	guess(s, "alice", "203.0.113.1")
+	guess(s, "bobby", "203.0.113.2")
+	if code := guess(s, "carol", "203.0.113.3"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the client to be locked out, got %d", code)
+	}
+
+	// Only trusted proxies tell the client IP
+	TrustedProxies = []string{"192.0.2.0/24"}
+	s = newTestServer(t)
+	guess(s, "alice", "203.0.113.1")
+	guess(s, "bobby", "203.0.113.1")
+	if code := guess(s, "carol", "203.0.113.2"); code != http.StatusUnauthorized {
+		t.Fatalf("expected another client to log in, got %d", code)
+	}
+	if code := guess(s, "david", "203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the client to be locked out, got %d", code)
+	}
+}
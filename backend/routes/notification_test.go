@@ -0,0 +1,187 @@
+package routes
+
+import (
+	"backend/models"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notifications returns the notifications of a user and their unread count
+func (s *testServer) notifications(token string) ([]map[string]interface{}, int) {
+	s.t.Helper()
+
+	body := s.expect(s.do(http.MethodGet, "/notifications", token, nil), http.StatusOK)
+	var list []map[string]interface{}
+	for _, item := range body["notifications"].([]interface{}) {
+		list = append(list, item.(map[string]interface{}))
+	}
+	return list, int(body["unread_count"].(float64))
+}
+
+// notificationTypes lists the types of a user's notifications, newest first
+func (s *testServer) notificationTypes(token string) []string {
+	s.t.Helper()
+
+	list, _ := s.notifications(token)
+	types := []string{}
+	for _, n := range list {
+		types = append(types, n["type"].(string))
+	}
+	return types
+}
+
+func TestReplyAndMentionNotifications(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	carol := s.signupAndLogin("carol")
+	threadID := s.postThread(alice, "general")
+
+	top := s.reply(bobby, threadID, 0, "nice thread")
+	answer := s.reply(alice, threadID, top, "thanks")
+	s.reply(bobby, threadID, answer, "@alice @carol what do you think? mail me at bobby@example.com")
+	s.reply(alice, threadID, 0, "commenting on my own thread")
+
+	if got := fmt.Sprint(s.notificationTypes(alice)); got != "[comment_reply thread_reply]" {
+		t.Fatalf("unexpected notifications for alice: %s", got)
+	}
+	if got := fmt.Sprint(s.notificationTypes(bobby)); got != "[comment_reply]" {
+		t.Fatalf("unexpected notifications for bobby: %s", got)
+	}
+	list, _ := s.notifications(carol)
+	if len(list) != 1 || list[0]["type"] != "mention" || list[0]["actor"] != "bobby" || list[0]["thread_id"] != float64(threadID) {
+		t.Fatalf("unexpected notifications for carol: %v", list)
+	}
+
+	// Mentions in threads notify too
+	s.expect(s.do(http.MethodPost, "/threads/post", bobby, gin.H{
+		"title":    "Question for @carol",
+		"content":  "See above",
+		"category": "general",
+	}), http.StatusCreated)
+	if got := fmt.Sprint(s.notificationTypes(carol)); got != "[mention mention]" {
+		t.Fatalf("unexpected notifications for carol: %s", got)
+	}
+}
+
+func TestMarkNotificationsRead(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	s.reply(bobby, threadID, 0, "first")
+	s.reply(bobby, threadID, 0, "second")
+
+	list, unread := s.notifications(alice)
+	if len(list) != 2 || unread != 2 {
+		t.Fatalf("expected 2 unread notifications, got %d of %v", unread, list)
+	}
+	first := int(list[0]["id"].(float64))
+
+	// Only the recipient can mark a notification
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/notifications/%d/read", first), bobby, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/notifications/%d/read", first), alice, nil), http.StatusOK)
+	if count := s.expect(s.do(http.MethodGet, "/notifications/unread_count", alice, nil), http.StatusOK)["unread_count"]; count != 1.0 {
+		t.Fatalf("expected 1 unread notification, got %v", count)
+	}
+	unreadList := s.expect(s.do(http.MethodGet, "/notifications?unread=true", alice, nil), http.StatusOK)["notifications"].([]interface{})
+	if len(unreadList) != 1 || unreadList[0].(map[string]interface{})["read"] != false {
+		t.Fatalf("expected 1 unread notification, got %v", unreadList)
+	}
+
+	s.expect(s.do(http.MethodPost, "/notifications/read_all", alice, nil), http.StatusOK)
+	if _, unread := s.notifications(alice); unread != 0 {
+		t.Fatalf("expected no unread notifications, got %d", unread)
+	}
+
+	s.expect(s.do(http.MethodGet, "/notifications", "", nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/notifications/x/read", alice, nil), http.StatusBadRequest)
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+
+	body := s.expect(s.do(http.MethodPut, "/notifications/preferences", alice, gin.H{"thread_reply": false}), http.StatusOK)
+	preferences := body["preferences"].(map[string]interface{})
+	if preferences["thread_reply"] != false || preferences["mention"] != true {
+		t.Fatalf("unexpected preferences %v", preferences)
+	}
+
+	s.reply(bobby, threadID, 0, "hello @alice")
+	if got := fmt.Sprint(s.notificationTypes(alice)); got != "[mention]" {
+		t.Fatalf("expected only the mention, got %s", got)
+	}
+
+	s.expect(s.do(http.MethodPut, "/notifications/preferences", alice, gin.H{"thread_reply": true}), http.StatusOK)
+	preferences = s.expect(s.do(http.MethodGet, "/notifications/preferences", alice, nil), http.StatusOK)["preferences"].(map[string]interface{})
+	if preferences["thread_reply"] != true {
+		t.Fatalf("unexpected preferences %v", preferences)
+	}
+
+	s.expect(s.do(http.MethodPut, "/notifications/preferences", alice, gin.H{"everything": false}), http.StatusBadRequest)
+}
+
+func TestVoteMilestoneNotifications(t *testing.T) {
+	milestones := models.VoteMilestones
+	models.VoteMilestones = []int{2}
+	defer func() { models.VoteMilestones = milestones }()
+
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	carol := s.signupAndLogin("carol")
+	threadID := s.postThread(alice, "general")
+	commentID := s.reply(alice, threadID, 0, "comment")
+	threadVotes := fmt.Sprintf("/threads/%d/votes", threadID)
+	commentVotes := fmt.Sprintf("/threads/%d/comments/%d/votes", threadID, commentID)
+
+	s.expect(s.do(http.MethodPost, threadVotes, bobby, gin.H{"vote": 1}), http.StatusCreated)
+	if types := s.notificationTypes(alice); len(types) != 0 {
+		t.Fatalf("expected no milestone yet, got %v", types)
+	}
+	s.expect(s.do(http.MethodPost, threadVotes, carol, gin.H{"vote": 1}), http.StatusCreated)
+
+	// Dropping below and reaching the milestone again does not notify twice
+	s.expect(s.do(http.MethodDelete, threadVotes, carol, nil), http.StatusOK)
+	s.expect(s.do(http.MethodPost, threadVotes, carol, gin.H{"vote": 1}), http.StatusCreated)
+
+	s.expect(s.do(http.MethodPost, commentVotes, bobby, gin.H{"vote": 1}), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, commentVotes, carol, gin.H{"vote": 1}), http.StatusCreated)
+
+	list, _ := s.notifications(alice)
+	if len(list) != 2 || list[0]["comment_id"] != float64(commentID) || list[1]["comment_id"] != nil {
+		t.Fatalf("expected a thread and a comment milestone, got %v", list)
+	}
+	if list[1]["type"] != "vote_milestone" || list[1]["message"] != "Your thread reached 2 points" {
+		t.Fatalf("unexpected milestone %v", list[1])
+	}
+}
+
+func TestModerationNotifications(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	admin, _ := s.login("admin", "adminpass123")
+	threadID := s.postThread(alice, "general")
+	commentID := s.reply(alice, threadID, 0, "comment")
+
+	s.expect(s.do(http.MethodPut, fmt.Sprintf("/threads/%d/comments/%d", threadID, commentID), admin, gin.H{"content": "edited"}), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/threads/%d", threadID), admin, nil), http.StatusOK)
+
+	list, _ := s.notifications(alice)
+	if len(list) != 2 || list[0]["message"] != `A moderator removed your thread "Hello"` || list[0]["actor"] != "admin" {
+		t.Fatalf("unexpected moderation notifications %v", list)
+	}
+
+	// Owners acting on their own content are not notified
+	otherThread := s.postThread(alice, "general")
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/threads/%d", otherThread), alice, nil), http.StatusOK)
+	if list, _ := s.notifications(alice); len(list) != 2 {
+		t.Fatalf("expected no new notifications, got %v", list)
+	}
+}
@@ -0,0 +1,190 @@
+package routes
+
+import (
+	"backend/models"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reportCases lists the moderation queue as seen by the owner of token
+func (s *testServer) reportCases(token, query string) []map[string]interface{} {
+	s.t.Helper()
+
+	body := s.expect(s.do(http.MethodGet, "/moderation/reports"+query, token, nil), http.StatusOK)
+	var cases []map[string]interface{}
+	for _, item := range body["reports"].([]interface{}) {
+		cases = append(cases, item.(map[string]interface{}))
+	}
+	return cases
+}
+
+func TestReportContent(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	commentID := s.reply(alice, threadID, 0, "buy cheap watches")
+	threadPath := fmt.Sprintf("/threads/%d/report", threadID)
+	commentPath := fmt.Sprintf("/threads/%d/comments/%d/report", threadID, commentID)
+
+	s.expect(s.do(http.MethodPost, threadPath, "", gin.H{"reason": "spam"}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, threadPath, bobby, gin.H{"reason": "boring"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, threadPath, bobby, gin.H{"reason": "other"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, threadPath, alice, gin.H{"reason": "spam"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, "/threads/999/report", bobby, gin.H{"reason": "spam"}), http.StatusNotFound)
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/comments/999/report", threadID), bobby, gin.H{"reason": "spam"}), http.StatusNotFound)
+
+	body := s.expect(s.do(http.MethodPost, threadPath, bobby, gin.H{"reason": "off_topic"}), http.StatusCreated)
+	if report := body["report"].(map[string]interface{}); report["reason"] != "off_topic" || report["reporter"] != "bobby" {
+		t.Fatalf("unexpected report %v", report)
+	}
+	s.expect(s.do(http.MethodPost, threadPath, bobby, gin.H{"reason": "spam"}), http.StatusConflict)
+	s.expect(s.do(http.MethodPost, commentPath, bobby, gin.H{"reason": "other", "details": "advertising"}), http.StatusCreated)
+
+	admin, _ := s.login("admin", "adminpass123")
+	cases := s.reportCases(admin, "")
+	if len(cases) != 2 || cases[0]["target_type"] != "thread" || cases[1]["target_type"] != "comment" {
+		t.Fatalf("unexpected queue %v", cases)
+	}
+	if cases[1]["author"] != "alice" || cases[1]["excerpt"] != "buy cheap watches" || cases[1]["report_count"] != float64(1) {
+		t.Fatalf("unexpected comment case %v", cases[1])
+	}
+
+	body = s.expect(s.do(http.MethodGet, fmt.Sprintf("/moderation/reports/%d", int(cases[1]["id"].(float64))), admin, nil), http.StatusOK)
+	reports := body["report"].(map[string]interface{})["reports"].([]interface{})
+	if len(reports) != 1 || reports[0].(map[string]interface{})["details"] != "advertising" {
+		t.Fatalf("unexpected reports %v", reports)
+	}
+}
+
+func TestReportsHideContent(t *testing.T) {
+	defer func(threshold int) { models.ReportHideThreshold = threshold }(models.ReportHideThreshold)
+	models.ReportHideThreshold = 2
+
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	carol := s.signupAndLogin("carol")
+	threadID := s.postThread(alice, "general")
+	commentID := s.reply(alice, threadID, 0, "rude words")
+	threadPath := fmt.Sprintf("/threads/%d", threadID)
+	commentPath := fmt.Sprintf("/threads/%d/comments/%d/report", threadID, commentID)
+
+	s.expect(s.do(http.MethodPost, commentPath, bobby, gin.H{"reason": "harassment"}), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, commentPath, carol, gin.H{"reason": "harassment"}), http.StatusCreated)
+
+	_, byID := s.commentsByID(threadID, bobby, "")
+	if got := byID[commentID]; got["content"] != "[hidden]" || got["hidden"] != true {
+		t.Fatalf("expected the comment to be hidden from readers, got %v", got)
+	}
+	_, byID = s.commentsByID(threadID, alice, "")
+	if got := byID[commentID]; got["content"] != "rude words" {
+		t.Fatalf("expected the author to still see the comment, got %v", got)
+	}
+	if got := fmt.Sprint(s.notificationTypes(alice)); got != "[moderation]" {
+		t.Fatalf("expected the author to be told, got %s", got)
+	}
+
+	s.expect(s.do(http.MethodPost, threadPath+"/report", bobby, gin.H{"reason": "spam"}), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, threadPath+"/report", carol, gin.H{"reason": "spam"}), http.StatusCreated)
+
+	if ids := s.threadIDs(""); len(ids) != 0 {
+		t.Fatalf("expected the thread to leave listings, got %v", ids)
+	}
+	s.expect(s.do(http.MethodGet, threadPath, "", nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodGet, threadPath, bobby, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodGet, threadPath, alice, nil), http.StatusOK)
+	admin, _ := s.login("admin", "adminpass123")
+	s.expect(s.do(http.MethodGet, threadPath, admin, nil), http.StatusOK)
+
+	// Dismissing the report shows the thread again
+	cases := s.reportCases(admin, "")
+	if len(cases) != 2 || cases[1]["hidden"] != true {
+		t.Fatalf("unexpected queue %v", cases)
+	}
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/moderation/reports/%d/resolve", int(cases[1]["id"].(float64))), admin, gin.H{"action": "dismiss"}), http.StatusOK)
+	if ids := s.threadIDs(""); len(ids) != 1 {
+		t.Fatalf("expected the thread to be listed again, got %v", ids)
+	}
+}
+
+func TestModerationQueue(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	s.signup("carol")
+	s.signup("dave")
+	admin, _ := s.login("admin", "adminpass123")
+	s.expect(s.do(http.MethodPost, "/admin/categories/music/moderators", admin, gin.H{"username": "carol"}), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, "/admin/categories/music/moderators", admin, gin.H{"username": "dave"}), http.StatusCreated)
+	carol, _ := s.login("carol", "password123")
+	dave, _ := s.login("dave", "password123")
+
+	musicThread := s.postThread(alice, "music")
+	generalThread := s.postThread(alice, "general")
+	commentID := s.reply(alice, musicThread, 0, "spam spam spam")
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/comments/%d/report", musicThread, commentID), bobby, gin.H{"reason": "spam"}), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/report", generalThread), bobby, gin.H{"reason": "spam"}), http.StatusCreated)
+
+	// Only moderators see the queue, category moderators only for their categories
+	s.expect(s.do(http.MethodGet, "/moderation/reports", bobby, nil), http.StatusForbidden)
+	if cases := s.reportCases(admin, ""); len(cases) != 2 {
+		t.Fatalf("expected admins to see every case, got %v", cases)
+	}
+	cases := s.reportCases(carol, "")
+	if len(cases) != 1 || cases[0]["category"] != "music" {
+		t.Fatalf("expected carol to only see music, got %v", cases)
+	}
+	caseID := int(cases[0]["id"].(float64))
+	generalCase := int(s.reportCases(admin, "")[1]["id"].(float64))
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/moderation/reports/%d/claim", generalCase), carol, nil), http.StatusForbidden)
+
+	// Claims keep other moderators out until released
+	base := fmt.Sprintf("/moderation/reports/%d", caseID)
+	s.expect(s.do(http.MethodPost, base+"/claim", carol, nil), http.StatusOK)
+	s.expect(s.do(http.MethodPost, base+"/claim", dave, nil), http.StatusConflict)
+	s.expect(s.do(http.MethodPost, base+"/resolve", dave, gin.H{"action": "dismiss"}), http.StatusConflict)
+	s.expect(s.do(http.MethodPost, base+"/resolve", dave, gin.H{"action": "remove"}), http.StatusConflict)
+	if _, byID := s.commentsByID(musicThread, "", ""); byID[commentID] == nil {
+		t.Fatal("expected the comment to be kept for the moderator who claimed its case")
+	}
+	if cases := s.reportCases(carol, "?claimed_by=carol"); len(cases) != 1 || cases[0]["claimed_by"] != "carol" {
+		t.Fatalf("unexpected claimed cases %v", cases)
+	}
+	s.expect(s.do(http.MethodDelete, base+"/claim", carol, nil), http.StatusOK)
+	s.expect(s.do(http.MethodPost, base+"/claim", dave, nil), http.StatusOK)
+
+	// Removing the content deletes it and tells its author
+	s.expect(s.do(http.MethodPost, base+"/resolve", dave, gin.H{"action": "ban"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, base+"/resolve", dave, gin.H{"action": "remove", "note": "no spam"}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, base+"/resolve", dave, gin.H{"action": "remove"}), http.StatusConflict)
+	if _, byID := s.commentsByID(musicThread, "", ""); byID[commentID] != nil {
+		t.Fatal("expected the comment to be removed")
+	}
+	list, _ := s.notifications(alice)
+	if len(list) != 1 || list[0]["message"] != "A moderator removed your comment after it was reported: no spam" {
+		t.Fatalf("unexpected notifications %v", list)
+	}
+
+	resolved := s.reportCases(carol, "?status=resolved")
+	if len(resolved) != 1 || resolved[0]["resolution"] != "remove" || resolved[0]["resolved_by"] != "dave" || resolved[0]["comment_id"] != float64(commentID) {
+		t.Fatalf("unexpected resolved cases %v", resolved)
+	}
+	if cases := s.reportCases(carol, ""); len(cases) != 0 {
+		t.Fatalf("expected no open cases for carol, got %v", cases)
+	}
+
+	// Warnings keep the content and tell its author
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/moderation/reports/%d/resolve", generalCase), admin, gin.H{"action": "warn", "note": "stay on topic"}), http.StatusOK)
+	if got := s.notificationTypes(alice); len(got) != 2 {
+		t.Fatalf("expected a warning notification, got %v", got)
+	}
+	s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d", generalThread), "", nil), http.StatusOK)
+
+	// Closed cases no longer remove their content
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/moderation/reports/%d/resolve", generalCase), admin, gin.H{"action": "remove"}), http.StatusConflict)
+	s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d", generalThread), "", nil), http.StatusOK)
+}
@@ -0,0 +1,140 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// revisions lists the revisions at path, oldest first
+func (s *testServer) revisions(path, token string) []map[string]interface{} {
+	s.t.Helper()
+
+	body := s.expect(s.do(http.MethodGet, path, token, nil), http.StatusOK)
+	var revisions []map[string]interface{}
+	for _, item := range body["revisions"].([]interface{}) {
+		revisions = append(revisions, item.(map[string]interface{}))
+	}
+	return revisions
+}
+
+func TestThreadRevisions(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	path := fmt.Sprintf("/threads/%d", threadID)
+
+	thread := s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK)["thread"].(map[string]interface{})
+	if thread["revision_count"] != 1.0 || thread["edited_at"] != nil {
+		t.Fatalf("expected an unedited thread, got %v", thread)
+	}
+
+	s.expect(s.do(http.MethodPut, path, alice, gin.H{"title": "Edited"}), http.StatusOK)
+	thread = s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK)["thread"].(map[string]interface{})
+	if thread["revision_count"] != 2.0 || thread["edited_at"] == nil {
+		t.Fatalf("expected an edited thread, got %v", thread)
+	}
+
+	// Each revision carries its diff from the previous one
+	diff := "--- revision 1\n+++ revision 2\n@@ -1,4 +1,4 @@\n-Title: Hello\n+Title: Edited\n Category: general\n Tags: go, Testing\n \n"
+	revisions := s.revisions(path+"/revisions", "")
+	if len(revisions) != 2 || revisions[0]["diff"] != nil || revisions[1]["diff"] != diff || revisions[1]["edited_by"] != "alice" {
+		t.Fatalf("unexpected revisions %v", revisions)
+	}
+	body := s.expect(s.do(http.MethodGet, path+"/revisions?from=1&to=2", "", nil), http.StatusOK)
+	if body["diff"] != diff {
+		t.Fatalf("unexpected diff %q", body["diff"])
+	}
+	s.expect(s.do(http.MethodGet, path+"/revisions?from=1&to=3", "", nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodGet, path+"/revisions?from=one&to=2", "", nil), http.StatusBadRequest)
+
+	// Only moderators revert, and the revert becomes a new revision
+	admin, _ := s.login("admin", "adminpass123")
+	s.expect(s.do(http.MethodPost, path+"/revisions/1/revert", alice, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodPost, path+"/revisions/1/revert", bobby, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodPost, path+"/revisions/9/revert", admin, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodPost, path+"/revisions/1/revert?reason=vandalism", admin, nil), http.StatusOK)
+	thread = s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK)["thread"].(map[string]interface{})
+	if thread["title"] != "Hello" || thread["revision_count"] != 3.0 {
+		t.Fatalf("expected the original title back, got %v", thread)
+	}
+	if revisions := s.revisions(path+"/revisions", ""); len(revisions) != 3 || revisions[2]["edited_by"] != "admin" || revisions[2]["title"] != "Hello" {
+		t.Fatalf("unexpected revisions %v", revisions)
+	}
+
+	list, _ := s.notifications(alice)
+	if len(list) != 1 || list[0]["message"] != "A moderator reverted your thread to revision 1" {
+		t.Fatalf("unexpected notifications %v", list)
+	}
+	reverts := s.auditLog(admin, "?action=thread.revert")
+	if len(reverts) != 1 || reverts[0]["reason"] != "vandalism" || reverts[0]["before"].(map[string]interface{})["title"] != "Edited" {
+		t.Fatalf("unexpected audit entries %v", reverts)
+	}
+
+	// Deleted threads take their history with them
+	s.expect(s.do(http.MethodDelete, path, alice, nil), http.StatusOK)
+	s.expect(s.do(http.MethodGet, path+"/revisions", "", nil), http.StatusNotFound)
+}
+
+func TestCommentRevisions(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	threadID := s.postThread(alice, "general")
+	commentID := s.reply(alice, threadID, 0, "first")
+	path := fmt.Sprintf("/threads/%d/comments/%d", threadID, commentID)
+
+	s.expect(s.do(http.MethodPut, path, alice, gin.H{"content": "second"}), http.StatusOK)
+	if _, byID := s.commentsByID(threadID, "", ""); byID[commentID]["revision_count"] != 2.0 || byID[commentID]["edited_at"] == nil {
+		t.Fatalf("expected an edited comment, got %v", byID[commentID])
+	}
+	revisions := s.revisions(path+"/revisions", "")
+	if len(revisions) != 2 || revisions[1]["diff"] != "--- revision 1\n+++ revision 2\n@@ -1 +1 @@\n-first\n+second\n" {
+		t.Fatalf("unexpected revisions %v", revisions)
+	}
+	s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d/comments/%d/revisions", s.postThread(alice, "general"), commentID), "", nil), http.StatusNotFound)
+
+	admin, _ := s.login("admin", "adminpass123")
+	s.expect(s.do(http.MethodPost, path+"/revisions/1/revert", alice, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodPost, path+"/revisions/1/revert", admin, nil), http.StatusOK)
+	if _, byID := s.commentsByID(threadID, "", ""); byID[commentID]["content"] != "first" || byID[commentID]["revision_count"] != 3.0 {
+		t.Fatalf("expected the original content back, got %v", byID[commentID])
+	}
+	if reverts := s.auditLog(admin, "?action=comment.revert"); len(reverts) != 1 {
+		t.Fatalf("unexpected audit entries %v", reverts)
+	}
+
+	// Only moderators see the history of deleted comments
+	s.expect(s.do(http.MethodDelete, path, alice, nil), http.StatusOK)
+	s.expect(s.do(http.MethodGet, path+"/revisions", alice, nil), http.StatusNotFound)
+	if revisions := s.revisions(path+"/revisions", admin); len(revisions) != 3 {
+		t.Fatalf("unexpected revisions %v", revisions)
+	}
+	s.expect(s.do(http.MethodPost, path+"/revisions/1/revert", admin, nil), http.StatusBadRequest)
+}
+
+func TestLargeRevisions(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	threadID := s.postThread(alice, "general")
+	path := fmt.Sprintf("/threads/%d/comments", threadID)
+
+	s.expect(s.do(http.MethodPost, path, alice, gin.H{"content": strings.Repeat("x", 10001)}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPut, fmt.Sprintf("/threads/%d", threadID), alice, gin.H{"content": strings.Repeat("x", 20001)}), http.StatusBadRequest)
+
+	// Revisions with too many lines are listed without their diff
+	commentID := s.reply(alice, threadID, 0, strings.Repeat("a\n", 2500))
+	commentPath := fmt.Sprintf("%s/%d", path, commentID)
+	s.expect(s.do(http.MethodPut, commentPath, alice, gin.H{"content": strings.Repeat("b\n", 2500)}), http.StatusOK)
+	revisions := s.revisions(commentPath+"/revisions", "")
+	if len(revisions) != 2 || revisions[1]["diff"] != nil || revisions[1]["diff_too_large"] != true {
+		t.Fatalf("unexpected revisions %v", revisions)
+	}
+	body := s.expect(s.do(http.MethodGet, commentPath+"/revisions?from=1&to=2", "", nil), http.StatusOK)
+	if body["diff"] != "" || body["diff_too_large"] != true {
+		t.Fatalf("unexpected diff %v", body)
+	}
+}
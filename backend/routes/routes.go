@@ -0,0 +1,298 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middlewares"
+	"backend/models"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrustedProxies are the addresses or CIDR ranges of the reverse proxies whose
+// X-Forwarded-For headers give the client IP. By default none are trusted and
+// the client IP is the address of the connection, as anyone can send the
+// header.
+var TrustedProxies []string
+
+// SetupRouter builds the Gin router with every API route wired to store
+func SetupRouter(store *models.Store) *gin.Engine {
+	// Set up the Gin router
+	router := gin.Default()
+	if err := router.SetTrustedProxies(TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+
+	// Enable CORS for frontend localhost
+	router.Use(middlewares.SetupCORS())
+
+	// Define routes and pass the store
+	router.GET("/", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"message": "Welcome to the API!",
+		})
+	})
+	userGroup := router.Group("/user")
+	{
+		userGroup.PUT("/:username", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.UpdateUser(c, store)
+		})
+		userGroup.DELETE("/:username", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.DeleteUser(c, store)
+		})
+		userGroup.POST("/:username/exports", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.RequestDataExport(c, store)
+		})
+		userGroup.GET("/:username/exports/:export_id", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.GetDataExport(c, store)
+		})
+		userGroup.GET("/:username/2fa", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.GetTwoFactorStatus(c, store)
+		})
+		userGroup.POST("/:username/2fa", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.StartTwoFactorEnrollment(c, store)
+		})
+		userGroup.POST("/:username/2fa/enable", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.EnableTwoFactor(c, store)
+		})
+		userGroup.DELETE("/:username/2fa", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.DisableTwoFactor(c, store)
+		})
+		userGroup.POST("/:username/2fa/recovery-codes", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.RegenerateRecoveryCodes(c, store)
+		})
+		userGroup.GET("/:username/tokens", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.GetAPITokens(c, store)
+		})
+		userGroup.POST("/:username/tokens", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.CreateAPIToken(c, store)
+		})
+		userGroup.DELETE("/:username/tokens/:token_id", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.DeleteAPIToken(c, store)
+		})
+		userGroup.GET("/:username", func(c *gin.Context) {
+			controllers.GetUser(c, store)
+		})
+		userGroup.GET("/:username/saved_threads", middlewares.JWTAuthMiddleware(store, models.ScopeRead), func(c *gin.Context) {
+			controllers.GetSavedThreads(c, store)
+		})
+		userGroup.GET("/:username/saved_state/:thread_id", middlewares.JWTAuthMiddleware(store, models.ScopeRead), func(c *gin.Context) {
+			controllers.CheckSavedState(c, store)
+		})
+		userGroup.POST("/:username/save_thread/:thread_id", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.SaveThread(c, store)
+		})
+		userGroup.DELETE("/:username/unsave_thread/:thread_id", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+			controllers.RemoveSavedThread(c, store)
+		})
+	}
+	threadGroup := router.Group("/threads")
+	threadGroup.Use(middlewares.JWTAuthMiddleware(store, models.ScopePost))
+	{
+		threadGroup.POST("/post", func(c *gin.Context) {
+			controllers.PostThread(c, store)
+		})
+		threadGroup.PUT("/:thread_id", func(c *gin.Context) {
+			controllers.EditThread(c, store)
+		})
+		threadGroup.DELETE("/:thread_id", func(c *gin.Context) {
+			controllers.DeleteThread(c, store)
+		})
+		threadGroup.POST("/:thread_id/report", func(c *gin.Context) {
+			controllers.ReportThread(c, store)
+		})
+		threadGroup.POST("/:thread_id/restore", func(c *gin.Context) {
+			controllers.RestoreThread(c, store)
+		})
+		threadGroup.POST("/:thread_id/revisions/:revision/revert", func(c *gin.Context) {
+			controllers.RevertThreadRevision(c, store)
+		})
+	}
+	commentGroup := router.Group("/threads/:thread_id/comments")
+	commentGroup.Use(middlewares.JWTAuthMiddleware(store, models.ScopePost))
+	{
+		commentGroup.POST("", func(c *gin.Context) {
+			controllers.AddComment(c, store)
+		})
+		commentGroup.PUT("/:comment_id", func(c *gin.Context) {
+			controllers.EditComment(c, store)
+		})
+		commentGroup.DELETE("/:comment_id", func(c *gin.Context) {
+			controllers.DeleteComment(c, store)
+		})
+		commentGroup.POST("/:comment_id/report", func(c *gin.Context) {
+			controllers.ReportComment(c, store)
+		})
+		commentGroup.POST("/:comment_id/restore", func(c *gin.Context) {
+			controllers.RestoreComment(c, store)
+		})
+		commentGroup.POST("/:comment_id/revisions/:revision/revert", func(c *gin.Context) {
+			controllers.RevertCommentRevision(c, store)
+		})
+	}
+	commentVoteGroup := router.Group("/threads/:thread_id/comments/:comment_id/votes")
+	commentVoteGroup.Use(middlewares.JWTAuthMiddleware(store, models.ScopeVote))
+	{
+		commentVoteGroup.POST("", func(c *gin.Context) {
+			controllers.CastCommentVote(c, store)
+		})
+		commentVoteGroup.DELETE("", func(c *gin.Context) {
+			controllers.DeleteCommentVote(c, store)
+		})
+	}
+	voteGroup := router.Group("/threads/:thread_id/votes")
+	voteGroup.Use(middlewares.JWTAuthMiddleware(store, models.ScopeVote))
+	{
+		voteGroup.POST("", func(c *gin.Context) {
+			controllers.CastVote(c, store)
+		})
+		voteGroup.DELETE("", func(c *gin.Context) {
+			controllers.DeleteVote(c, store)
+		})
+	}
+	notificationGroup := router.Group("/notifications")
+	notificationGroup.Use(middlewares.JWTAuthMiddleware(store, models.ScopeRead))
+	{
+		notificationGroup.GET("", func(c *gin.Context) {
+			controllers.GetNotifications(c, store)
+		})
+		notificationGroup.GET("/unread_count", func(c *gin.Context) {
+			controllers.GetUnreadNotificationCount(c, store)
+		})
+		notificationGroup.POST("/:notification_id/read", func(c *gin.Context) {
+			controllers.MarkNotificationRead(c, store)
+		})
+		notificationGroup.POST("/read_all", func(c *gin.Context) {
+			controllers.MarkAllNotificationsRead(c, store)
+		})
+		notificationGroup.GET("/preferences", func(c *gin.Context) {
+			controllers.GetNotificationPreferences(c, store)
+		})
+		notificationGroup.PUT("/preferences", func(c *gin.Context) {
+			controllers.UpdateNotificationPreferences(c, store)
+		})
+	}
+	moderationGroup := router.Group("/moderation")
+	moderationGroup.Use(middlewares.JWTAuthMiddleware(store, models.ScopeModerate))
+	{
+		moderationGroup.GET("/reports", func(c *gin.Context) {
+			controllers.GetReportCases(c, store)
+		})
+		moderationGroup.GET("/reports/:case_id", func(c *gin.Context) {
+			controllers.GetReportCase(c, store)
+		})
+		moderationGroup.POST("/reports/:case_id/claim", func(c *gin.Context) {
+			controllers.ClaimReportCase(c, store)
+		})
+		moderationGroup.DELETE("/reports/:case_id/claim", func(c *gin.Context) {
+			controllers.ReleaseReportCase(c, store)
+		})
+		moderationGroup.POST("/reports/:case_id/resolve", func(c *gin.Context) {
+			controllers.ResolveReportCase(c, store)
+		})
+		moderationGroup.GET("/users/:username/sanctions", func(c *gin.Context) {
+			controllers.GetUserSanctions(c, store)
+		})
+		moderationGroup.POST("/users/:username/sanctions", func(c *gin.Context) {
+			controllers.IssueSanction(c, store)
+		})
+		moderationGroup.DELETE("/sanctions/:sanction_id", func(c *gin.Context) {
+			controllers.RevokeSanction(c, store)
+		})
+	}
+	adminGroup := router.Group("/admin")
+	adminGroup.Use(middlewares.JWTAuthMiddleware(store), middlewares.RequirePermission(models.PermManageRoles))
+	{
+		adminGroup.PUT("/users/:username/role", func(c *gin.Context) {
+			controllers.SetUserRole(c, store)
+		})
+		adminGroup.POST("/users/:username/unlock", func(c *gin.Context) {
+			controllers.UnlockUser(c, store)
+		})
+		adminGroup.POST("/categories/:category/moderators", func(c *gin.Context) {
+			controllers.AddCategoryModerator(c, store)
+		})
+		adminGroup.DELETE("/categories/:category/moderators/:username", func(c *gin.Context) {
+			controllers.RemoveCategoryModerator(c, store)
+		})
+		adminGroup.GET("/audit", middlewares.RequirePermission(models.PermViewAuditLog), func(c *gin.Context) {
+			controllers.GetAuditLog(c, store)
+		})
+	}
+	router.POST("/signup", func(c *gin.Context) {
+		controllers.UserSignup(c, store)
+	})
+	router.POST("/login", func(c *gin.Context) {
+		controllers.UserLogin(c, store)
+	})
+	router.POST("/login/2fa", func(c *gin.Context) {
+		controllers.CompleteTwoFactorLogin(c, store)
+	})
+	router.POST("/verify-email", func(c *gin.Context) {
+		controllers.VerifyEmail(c, store)
+	})
+	router.POST("/verify-email/resend", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+		controllers.ResendVerificationEmail(c, store)
+	})
+	router.POST("/password/forgot", func(c *gin.Context) {
+		controllers.ForgotPassword(c, store)
+	})
+	router.POST("/password/reset", func(c *gin.Context) {
+		controllers.ResetPassword(c, store)
+	})
+	router.POST("/token/refresh", func(c *gin.Context) {
+		controllers.RefreshToken(c, store)
+	})
+	router.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		controllers.GetJWKS(c, store)
+	})
+	router.POST("/logout", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+		controllers.Logout(c, store)
+	})
+	router.POST("/logout-all", middlewares.JWTAuthMiddleware(store), func(c *gin.Context) {
+		controllers.LogoutAll(c, store)
+	})
+	router.GET("/trash", middlewares.JWTAuthMiddleware(store, models.ScopeRead), func(c *gin.Context) {
+		controllers.GetTrash(c, store)
+	})
+	// Export downloads are authorized by their signed link
+	router.GET("/exports/:export_id/download", func(c *gin.Context) {
+		controllers.DownloadDataExport(c, store)
+	})
+	router.GET("/threads", middlewares.OptionalJWTAuthMiddleware(store, models.ScopeRead), func(c *gin.Context) {
+		controllers.GetThreads(c, store)
+	})
+	router.GET("/threads/:thread_id", middlewares.OptionalJWTAuthMiddleware(store, models.ScopeRead), func(c *gin.Context) {
+		controllers.GetSingleThread(c, store)
+	})
+	router.GET("/threads/:thread_id/revisions", middlewares.OptionalJWTAuthMiddleware(store, models.ScopeRead), func(c *gin.Context) {
+		controllers.GetThreadRevisions(c, store)
+	})
+	router.GET("/threads/:thread_id/comments", middlewares.OptionalJWTAuthMiddleware(store, models.ScopeRead), func(c *gin.Context) {
+		controllers.GetComments(c, store)
+	})
+	router.GET("/threads/:thread_id/comments/:comment_id", middlewares.OptionalJWTAuthMiddleware(store, models.ScopeRead), func(c *gin.Context) {
+		controllers.GetCommentReplies(c, store)
+	})
+	router.GET("/threads/:thread_id/comments/:comment_id/revisions", middlewares.OptionalJWTAuthMiddleware(store, models.ScopeRead), func(c *gin.Context) {
+		controllers.GetCommentRevisions(c, store)
+	})
+	// EventSource and WebSocket cannot send headers, so streams also take the token as ?access_token=
+	router.GET("/threads/:thread_id/events", middlewares.TokenFromQuery(), middlewares.OptionalJWTAuthMiddleware(store, models.ScopeRead), func(c *gin.Context) {
+		controllers.StreamThreadEvents(c, store)
+	})
+	router.GET("/notifications/stream", middlewares.TokenFromQuery(), middlewares.JWTAuthMiddleware(store, models.ScopeRead), func(c *gin.Context) {
+		controllers.StreamNotifications(c, store)
+	})
+	router.GET("/ws", middlewares.TokenFromQuery(), middlewares.JWTAuthMiddleware(store, models.ScopeRead), func(c *gin.Context) {
+		controllers.ServeGateway(c, store)
+	})
+	router.GET("/threads/:thread_id/votes", func(c *gin.Context) {
+		controllers.CountVotes(c, store)
+	})
+	router.GET("/:username/:thread_id/vote_state", func(c *gin.Context) {
+		controllers.GetVoteState(c, store)
+	})
+
+	return router
+}
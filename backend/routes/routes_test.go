@@ -0,0 +1,150 @@
+package routes
+
+import (
+	"backend/models"
+	"backend/models/memory"
+	"backend/utils"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	os.Setenv("JWT_SECRET_KEY", "test-secret")
+	utils.SetPasswordHasher(utils.BcryptHasher{Cost: bcrypt.MinCost})
+	os.Exit(m.Run())
+}
+
+// testServer is the full router backed by a fresh in-memory store
+type testServer struct {
+	t      *testing.T
+	router *gin.Engine
+	store  *models.Store
+}
+
+func newTestServer(t *testing.T) *testServer {
+	store := memory.NewStore()
+
+	// The reserved "admin" user has no usable password until an operator sets
+	// one and promotes it, as they would with promote-admin
+	passwordHash, err := utils.HashPassword("adminpass123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Users.UpdateUserPassword("admin", passwordHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Users.SetUserRole("admin", models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{t: t, router: SetupRouter(store), store: store}
+}
+
+// do sends a request with an optional JSON body and bearer token
+func (s *testServer) do(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatalf("marshal body: %v", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// expect fails the test unless the response has the wanted status, and decodes its body
+func (s *testServer) expect(rec *httptest.ResponseRecorder, status int) map[string]interface{} {
+	s.t.Helper()
+
+	if rec.Code != status {
+		s.t.Fatalf("expected status %d, got %d: %s", status, rec.Code, rec.Body.String())
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		s.t.Fatalf("decode body %q: %v", rec.Body.String(), err)
+	}
+	return body
+}
+
+// signup creates a user with a valid password
+func (s *testServer) signup(username string) {
+	s.t.Helper()
+
+	s.expect(s.do(http.MethodPost, "/signup", "", gin.H{
+		"username": username,
+		"password": "password123",
+		"email":    username + "@example.com",
+	}), http.StatusCreated)
+}
+
+// login returns the access and refresh tokens of a user
+func (s *testServer) login(username, password string) (string, string) {
+	s.t.Helper()
+
+	body := s.expect(s.do(http.MethodPost, "/login", "", gin.H{
+		"username": username,
+		"password": password,
+	}), http.StatusOK)
+	return body["token"].(string), body["refresh_token"].(string)
+}
+
+// signupAndLogin creates a user and returns its access token
+func (s *testServer) signupAndLogin(username string) string {
+	s.t.Helper()
+
+	s.signup(username)
+	token, _ := s.login(username, "password123")
+	return token
+}
+
+// postThread creates a thread in category and returns its ID
+func (s *testServer) postThread(token, category string) int {
+	s.t.Helper()
+
+	body := s.expect(s.do(http.MethodPost, "/threads/post", token, gin.H{
+		"title":    "Hello",
+		"content":  "World",
+		"category": category,
+		"tags":     []string{"go", "Testing"},
+	}), http.StatusCreated)
+	return int(body["thread"].(map[string]interface{})["id"].(float64))
+}
+
+func TestRoot(t *testing.T) {
+	s := newTestServer(t)
+
+	body := s.expect(s.do(http.MethodGet, "/", "", nil), http.StatusOK)
+	if body["message"] != "Welcome to the API!" {
+		t.Fatalf("unexpected message %v", body["message"])
+	}
+}
+
+func TestProtectedRoutesRequireToken(t *testing.T) {
+	s := newTestServer(t)
+
+	s.expect(s.do(http.MethodPost, "/threads/post", "", gin.H{"title": "x"}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/threads/post", "not-a-jwt", gin.H{"title": "x"}), http.StatusUnauthorized)
+}
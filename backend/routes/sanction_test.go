@@ -0,0 +1,158 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sanction issues a sanction as the owner of token and returns its ID
+func (s *testServer) sanction(token, username string, body gin.H) int {
+	s.t.Helper()
+
+	created := s.expect(s.do(http.MethodPost, "/moderation/users/"+username+"/sanctions", token, body), http.StatusCreated)
+	return int(created["sanction"].(map[string]interface{})["id"].(float64))
+}
+
+func TestSuspensionsAndBans(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	s.signup("carol")
+	admin, _ := s.login("admin", "adminpass123")
+	s.expect(s.do(http.MethodPost, "/admin/categories/music/moderators", admin, gin.H{"username": "carol"}), http.StatusCreated)
+	carol, _ := s.login("carol", "password123")
+	musicThread := s.postThread(alice, "music")
+	generalThread := s.postThread(alice, "general")
+	musicComment := s.reply(alice, musicThread, 0, "tune")
+	tomorrow := time.Now().Add(24 * time.Hour)
+
+	// Category moderators only ban in their categories, and nobody sanctions moderators
+	s.expect(s.do(http.MethodPost, "/moderation/users/bobby/sanctions", alice, gin.H{"type": "ban", "reason": "spam"}), http.StatusForbidden)
+	s.expect(s.do(http.MethodPost, "/moderation/users/bobby/sanctions", carol, gin.H{"type": "ban", "reason": "spam"}), http.StatusForbidden)
+	s.expect(s.do(http.MethodPost, "/moderation/users/bobby/sanctions", carol, gin.H{"type": "ban", "category": "music"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, "/moderation/users/bobby/sanctions", carol, gin.H{"type": "suspension", "category": "music", "reason": "spam"}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, "/moderation/users/carol/sanctions", admin, gin.H{"type": "ban", "category": "music", "reason": "spam"}), http.StatusForbidden)
+	s.expect(s.do(http.MethodPost, "/moderation/users/nobody/sanctions", admin, gin.H{"type": "ban", "reason": "spam"}), http.StatusNotFound)
+	banID := s.sanction(carol, "bobby", gin.H{"type": "ban", "category": "music", "reason": "spam"})
+
+	// The ban covers every write path in music, and nothing elsewhere
+	for _, write := range []struct {
+		method, path string
+		body         gin.H
+	}{
+		{http.MethodPost, "/threads/post", gin.H{"title": "Hi", "content": "There", "category": "music"}},
+		{http.MethodPost, fmt.Sprintf("/threads/%d/comments", musicThread), gin.H{"content": "hi"}},
+		{http.MethodPost, fmt.Sprintf("/threads/%d/votes", musicThread), gin.H{"vote": 1}},
+		{http.MethodDelete, fmt.Sprintf("/threads/%d/votes", musicThread), nil},
+		{http.MethodDelete, fmt.Sprintf("/threads/%d/comments/%d/votes", musicThread, musicComment), nil},
+		{http.MethodPost, fmt.Sprintf("/user/bobby/save_thread/%d", musicThread), nil},
+	} {
+		body := s.expect(s.do(write.method, write.path, bobby, write.body), http.StatusForbidden)
+		if body["error"] != "you are banned from music: spam" {
+			t.Fatalf("unexpected error for %s %s: %v", write.method, write.path, body)
+		}
+	}
+	s.postThread(bobby, "general")
+	s.reply(bobby, generalThread, 0, "hello")
+	if got := fmt.Sprint(s.notificationTypes(bobby)); got != "[moderation]" {
+		t.Fatalf("expected bobby to be told about the ban, got %s", got)
+	}
+
+	// A site-wide suspension covers every category until it is lifted
+	suspensionID := s.sanction(admin, "bobby", gin.H{"type": "suspension", "reason": "cool off", "expires_at": tomorrow})
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/votes", generalThread), bobby, gin.H{"vote": 1}), http.StatusForbidden)
+	s.expect(s.do(http.MethodPost, "/threads/999/votes", bobby, gin.H{"vote": 1}), http.StatusNotFound)
+
+	body := s.expect(s.do(http.MethodGet, "/moderation/users/bobby/sanctions?active=true", bobby, nil), http.StatusOK)
+	if sanctions := body["sanctions"].([]interface{}); len(sanctions) != 2 {
+		t.Fatalf("expected bobby to see both sanctions, got %v", sanctions)
+	}
+	s.expect(s.do(http.MethodGet, "/moderation/users/bobby/sanctions", alice, nil), http.StatusForbidden)
+
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/moderation/sanctions/%d", suspensionID), carol, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/moderation/sanctions/%d", suspensionID), admin, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/moderation/sanctions/%d", suspensionID), admin, nil), http.StatusConflict)
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/votes", generalThread), bobby, gin.H{"vote": 1}), http.StatusCreated)
+
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/moderation/sanctions/%d", banID), carol, nil), http.StatusOK)
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/votes", musicThread), bobby, gin.H{"vote": 1}), http.StatusCreated)
+
+	body = s.expect(s.do(http.MethodGet, "/moderation/users/bobby/sanctions", carol, nil), http.StatusOK)
+	sanctions := body["sanctions"].([]interface{})
+	if len(sanctions) != 2 {
+		t.Fatalf("expected the history to keep both sanctions, got %v", sanctions)
+	}
+	if ban := sanctions[1].(map[string]interface{}); ban["active"] != false || ban["revoked_by"] != "carol" || ban["issued_by"] != "carol" {
+		t.Fatalf("unexpected revoked ban %v", ban)
+	}
+}
+
+func TestShadowban(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	admin, _ := s.login("admin", "adminpass123")
+	threadID := s.postThread(alice, "general")
+	top := s.reply(alice, threadID, 0, "top")
+	savedThread := s.postThread(bobby, "general")
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/user/alice/save_thread/%d", savedThread), alice, nil), http.StatusOK)
+
+	s.expect(s.do(http.MethodPost, "/moderation/users/bobby/sanctions", admin, gin.H{"type": "shadowban", "category": "music", "reason": "troll"}), http.StatusBadRequest)
+	s.sanction(admin, "bobby", gin.H{"type": "shadowban", "reason": "troll"})
+	if got := s.notificationTypes(bobby); len(got) != 0 {
+		t.Fatalf("expected bobby not to be told, got %v", got)
+	}
+
+	// Bobby can still write, but nobody else sees it
+	bobbyThread := s.postThread(bobby, "general")
+	alone := s.reply(bobby, threadID, top, "@alice you are wrong")
+	answered := s.reply(bobby, threadID, 0, "first!")
+	answer := s.reply(alice, threadID, answered, "no")
+
+	if ids := s.threadIDs(""); len(ids) != 1 || ids[0] != threadID {
+		t.Fatalf("expected bobby's thread to be left out, got %v", ids)
+	}
+	items := s.expect(s.do(http.MethodGet, "/threads", bobby, nil), http.StatusOK)["threads"].([]interface{})
+	if len(items) != 3 {
+		t.Fatalf("expected bobby to see their own threads, got %v", items)
+	}
+	s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d", bobbyThread), alice, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d/comments", bobbyThread), alice, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d", bobbyThread), bobby, nil), http.StatusOK)
+	if saved := s.expect(s.do(http.MethodGet, "/user/alice/saved_threads", alice, nil), http.StatusOK)["threads"]; saved != nil {
+		t.Fatalf("expected bobby's saved thread to be left out, got %v", saved)
+	}
+
+	// Comment counts leave out bobby's comments for everyone else
+	for viewer, want := range map[string]float64{alice: 2, bobby: 4} {
+		thread := s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d", threadID), viewer, nil), http.StatusOK)["thread"].(map[string]interface{})
+		if thread["comment_count"] != want {
+			t.Fatalf("expected %v comments, got %v", want, thread["comment_count"])
+		}
+	}
+
+	_, byID := s.commentsByID(threadID, alice, "")
+	if byID[alone] != nil {
+		t.Fatalf("expected bobby's reply to be left out, got %v", byID[alone])
+	}
+	if got := byID[answered]; got == nil || got["content"] != "[deleted]" || got["username"] != "[deleted]" || byID[answer] == nil {
+		t.Fatalf("expected bobby's answered comment to stay as a placeholder, got %v", got)
+	}
+	_, byID = s.commentsByID(threadID, bobby, "")
+	if byID[alone] == nil || byID[answered]["content"] != "first!" {
+		t.Fatalf("expected bobby to see their own comments, got %v", byID)
+	}
+	if got := s.notificationTypes(alice); len(got) != 0 {
+		t.Fatalf("expected no notifications from bobby, got %v", got)
+	}
+
+	// Users are not shown their own shadowbans
+	body := s.expect(s.do(http.MethodGet, "/moderation/users/bobby/sanctions", bobby, nil), http.StatusOK)
+	if sanctions := body["sanctions"].([]interface{}); len(sanctions) != 0 {
+		t.Fatalf("expected bobby not to see the shadowban, got %v", sanctions)
+	}
+}
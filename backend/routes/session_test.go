@@ -0,0 +1,63 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := newTestServer(t)
+	s.signup("alice")
+	_, refreshToken := s.login("alice", "password123")
+
+	body := s.expect(s.do(http.MethodPost, "/token/refresh", "", gin.H{"refresh_token": refreshToken}), http.StatusOK)
+	token := body["token"].(string)
+	rotated := body["refresh_token"].(string)
+	if rotated == refreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+	s.expect(s.do(http.MethodGet, "/user/alice/saved_threads", token, nil), http.StatusOK)
+
+	// Replaying the old token revokes the whole session
+	s.expect(s.do(http.MethodPost, "/token/refresh", "", gin.H{"refresh_token": refreshToken}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/token/refresh", "", gin.H{"refresh_token": rotated}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodGet, "/user/alice/saved_threads", token, nil), http.StatusUnauthorized)
+}
+
+func TestRefreshTokenValidation(t *testing.T) {
+	s := newTestServer(t)
+
+	s.expect(s.do(http.MethodPost, "/token/refresh", "", gin.H{}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, "/token/refresh", "", gin.H{"refresh_token": "unknown"}), http.StatusUnauthorized)
+}
+
+func TestLogout(t *testing.T) {
+	s := newTestServer(t)
+	s.signup("alice")
+	first, firstRefresh := s.login("alice", "password123")
+	second, _ := s.login("alice", "password123")
+
+	s.expect(s.do(http.MethodPost, "/logout", first, nil), http.StatusOK)
+	s.expect(s.do(http.MethodGet, "/user/alice/saved_threads", first, nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/token/refresh", "", gin.H{"refresh_token": firstRefresh}), http.StatusUnauthorized)
+
+	// Other sessions survive a single logout
+	s.expect(s.do(http.MethodGet, "/user/alice/saved_threads", second, nil), http.StatusOK)
+}
+
+func TestLogoutAll(t *testing.T) {
+	s := newTestServer(t)
+	s.signup("alice")
+	first, _ := s.login("alice", "password123")
+	second, _ := s.login("alice", "password123")
+	_, bot := s.createAPIToken(first, "alice", "password123", "read")
+
+	// API tokens are revoked along with the sessions
+	s.expect(s.do(http.MethodPost, "/logout-all", bot, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodPost, "/logout-all", first, nil), http.StatusOK)
+	s.expect(s.do(http.MethodGet, "/user/alice/saved_threads", first, nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodGet, "/user/alice/saved_threads", second, nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodGet, "/notifications", bot, nil), http.StatusUnauthorized)
+}
@@ -0,0 +1,290 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestThreadLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	token := s.signupAndLogin("alice")
+	threadID := s.postThread(token, "technology")
+	path := fmt.Sprintf("/threads/%d", threadID)
+
+	body := s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK)
+	thread := body["thread"].(map[string]interface{})
+	if thread["title"] != "Hello" || thread["username"] != "alice" || thread["category"] != "technology" {
+		t.Fatalf("unexpected thread %v", thread)
+	}
+	if tags := thread["tags"].([]interface{}); len(tags) != 2 {
+		t.Fatalf("expected 2 tags, got %v", tags)
+	}
+
+	s.expect(s.do(http.MethodPut, path, token, gin.H{"title": "Edited", "tags": []string{"new"}}), http.StatusOK)
+	thread = s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK)["thread"].(map[string]interface{})
+	if thread["title"] != "Edited" || thread["content"] != "World" {
+		t.Fatalf("unexpected edited thread %v", thread)
+	}
+	if tags := thread["tags"].([]interface{}); len(tags) != 1 || tags[0] != "new" {
+		t.Fatalf("expected tags to be replaced, got %v", tags)
+	}
+
+	s.expect(s.do(http.MethodDelete, path, token, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, path, token, nil), http.StatusBadRequest)
+}
+
+func TestPostThreadUnknownCategory(t *testing.T) {
+	s := newTestServer(t)
+	token := s.signupAndLogin("alice")
+
+	s.expect(s.do(http.MethodPost, "/threads/post", token, gin.H{
+		"title":    "Hello",
+		"content":  "World",
+		"category": "nope",
+	}), http.StatusInternalServerError)
+}
+
+func TestGetThreadsFiltersAndSorts(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+
+	first := s.postThread(alice, "technology")
+	s.postThread(bobby, "music")
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/votes", first), bobby, gin.H{"vote": 1}), http.StatusCreated)
+
+	threads := s.expect(s.do(http.MethodGet, "/threads", "", nil), http.StatusOK)["threads"].([]interface{})
+	if len(threads) != 2 || threads[0].(map[string]interface{})["username"] != "bobby" {
+		t.Fatalf("expected newest thread first, got %v", threads)
+	}
+
+	threads = s.expect(s.do(http.MethodGet, "/threads?sort=trending", "", nil), http.StatusOK)["threads"].([]interface{})
+	top := threads[0].(map[string]interface{})
+	if top["username"] != "alice" || top["votes"].(float64) != 1 {
+		t.Fatalf("expected most voted thread first, got %v", threads)
+	}
+
+	threads = s.expect(s.do(http.MethodGet, "/threads?category=music", "", nil), http.StatusOK)["threads"].([]interface{})
+	if len(threads) != 1 {
+		t.Fatalf("expected 1 music thread, got %v", threads)
+	}
+
+	threads = s.expect(s.do(http.MethodGet, "/threads?username=alice&search=WORLD", "", nil), http.StatusOK)["threads"].([]interface{})
+	if len(threads) != 1 {
+		t.Fatalf("expected 1 matching thread, got %v", threads)
+	}
+
+	threads, _ = s.expect(s.do(http.MethodGet, "/threads?page=2&limit=1", "", nil), http.StatusOK)["threads"].([]interface{})
+	if len(threads) != 1 {
+		t.Fatalf("expected 1 thread on page 2, got %v", threads)
+	}
+
+	s.expect(s.do(http.MethodGet, "/threads?page=x", "", nil), http.StatusBadRequest)
+}
+
+// threadIDs lists the IDs of the threads returned for query
+func (s *testServer) threadIDs(query string) []int {
+	s.t.Helper()
+
+	var ids []int
+	items, _ := s.expect(s.do(http.MethodGet, "/threads"+query, "", nil), http.StatusOK)["threads"].([]interface{})
+	for _, item := range items {
+		ids = append(ids, int(item.(map[string]interface{})["id"].(float64)))
+	}
+	return ids
+}
+
+func TestThreadRankings(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	carol := s.signupAndLogin("carol")
+	vote := func(token string, threadID, value int) {
+		s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/votes", threadID), token, gin.H{"vote": value}), http.StatusCreated)
+	}
+
+	// split is evenly divided, popular only has upvotes, leaning is mostly upvoted
+	split := s.postThread(alice, "general")
+	popular := s.postThread(alice, "general")
+	leaning := s.postThread(alice, "general")
+	vote(alice, split, 1)
+	vote(bobby, split, -1)
+	vote(alice, popular, 1)
+	vote(bobby, popular, 1)
+	vote(carol, popular, 1)
+	vote(alice, leaning, 1)
+	vote(bobby, leaning, 1)
+	vote(carol, leaning, -1)
+
+	for _, tc := range []struct {
+		query string
+		want  []int
+	}{
+		{"", []int{leaning, popular, split}},
+		{"?sort=new", []int{leaning, popular, split}},
+		{"?sort=top", []int{popular, leaning, split}},
+		{"?sort=top&t=day", []int{popular, leaning, split}},
+		{"?sort=trending", []int{popular, leaning, split}},
+		{"?sort=hot", []int{popular, leaning, split}},
+		{"?sort=rising", []int{popular, leaning, split}},
+		{"?sort=controversial", []int{split, leaning, popular}},
+	} {
+		if got := s.threadIDs(tc.query); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.query, tc.want, got)
+		}
+	}
+
+	s.expect(s.do(http.MethodGet, "/threads?sort=top&t=decade", "", nil), http.StatusBadRequest)
+}
+
+func TestThreadCounters(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	votes := fmt.Sprintf("/threads/%d/votes", threadID)
+
+	s.expect(s.do(http.MethodPost, votes, alice, gin.H{"vote": 1}), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, votes, bobby, gin.H{"vote": 1}), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, votes, bobby, gin.H{"vote": -1}), http.StatusCreated)
+	root := s.reply(alice, threadID, 0, "root")
+	s.reply(bobby, threadID, root, "reply")
+	leaf := s.reply(bobby, threadID, 0, "leaf")
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/threads/%d/comments/%d", threadID, root), alice, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/threads/%d/comments/%d", threadID, leaf), bobby, nil), http.StatusOK)
+
+	check := func(thread map[string]interface{}, votes, upvotes, downvotes, comments float64) {
+		t.Helper()
+		if thread["votes"] != votes || thread["upvotes"] != upvotes || thread["downvotes"] != downvotes || thread["comment_count"] != comments {
+			t.Fatalf("unexpected counters %v", thread)
+		}
+	}
+
+	listed := s.expect(s.do(http.MethodGet, "/threads", "", nil), http.StatusOK)["threads"].([]interface{})
+	check(listed[0].(map[string]interface{}), 0, 1, 1, 1)
+	single := s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d", threadID), "", nil), http.StatusOK)["thread"]
+	check(single.(map[string]interface{}), 0, 1, 1, 1)
+
+	s.expect(s.do(http.MethodDelete, votes, alice, nil), http.StatusOK)
+	listed = s.expect(s.do(http.MethodGet, "/threads", "", nil), http.StatusOK)["threads"].([]interface{})
+	check(listed[0].(map[string]interface{}), -1, 0, 1, 1)
+}
+
+func TestThreadSearch(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	post := func(token, category, title, content string, tags ...string) int {
+		body := s.expect(s.do(http.MethodPost, "/threads/post", token, gin.H{
+			"title":    title,
+			"content":  content,
+			"category": category,
+			"tags":     tags,
+		}), http.StatusCreated)
+		return int(body["thread"].(map[string]interface{})["id"].(float64))
+	}
+
+	inContent := post(alice, "technology", "Weekend project", "I finally learned how error handling works in golang <img src=x onerror=alert(1)>", "go")
+	inTitle := post(bobby, "technology", "Golang error handling", "Wrapping errors with fmt", "errors")
+	unrelated := post(bobby, "music", "Guitar tips", "Practice every day", "guitar")
+
+	for _, tc := range []struct {
+		search string
+		want   []int
+	}{
+		// Title matches outrank content matches
+		{"golang", []int{inTitle, inContent}},
+		{`"error handling"`, []int{inTitle, inContent}},
+		{"golang -weekend", []int{inTitle}},
+		{"tag:go", []int{inContent}},
+		{"tag:GO golang", []int{inContent}},
+		{"author:bobby", []int{unrelated, inTitle}},
+		{"author:bobby golang", []int{inTitle}},
+		{"category:music", []int{unrelated}},
+		{"after:2000-01-01 category:technology", []int{inTitle, inContent}},
+		{"before:2000-01-01", nil},
+		{"kubernetes", nil},
+	} {
+		got := s.threadIDs("?search=" + url.QueryEscape(tc.search))
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.search, tc.want, got)
+		}
+	}
+
+	// An explicit sort replaces relevance
+	if got := s.threadIDs("?sort=new&search=golang"); fmt.Sprint(got) != fmt.Sprint([]int{inTitle, inContent}) {
+		t.Errorf("expected newest first, got %v", got)
+	}
+
+	threads := s.expect(s.do(http.MethodGet, "/threads?search=golang", "", nil), http.StatusOK)["threads"].([]interface{})
+	snippet := threads[1].(map[string]interface{})["snippet"].(string)
+	if !strings.Contains(snippet, "<mark>golang</mark>") {
+		t.Fatalf("expected highlighted snippet, got %q", snippet)
+	}
+	if strings.Contains(snippet, "<img") || !strings.Contains(snippet, "&lt;img") {
+		t.Fatalf("expected the content to be escaped, got %q", snippet)
+	}
+
+	s.expect(s.do(http.MethodGet, "/threads?search=before:yesterday", "", nil), http.StatusBadRequest)
+}
+
+func TestEditThreadPermissions(t *testing.T) {
+	s := newTestServer(t)
+	owner := s.signupAndLogin("alice")
+	other := s.signupAndLogin("bobby")
+	threadID := s.postThread(owner, "technology")
+	path := fmt.Sprintf("/threads/%d", threadID)
+
+	s.expect(s.do(http.MethodPut, path, other, gin.H{"title": "Mine now"}), http.StatusForbidden)
+	s.expect(s.do(http.MethodDelete, path, other, nil), http.StatusForbidden)
+
+	// Category moderators can act on threads in their own category only
+	if err := s.store.Users.AddCategoryModerator("bobby", "technology"); err != nil {
+		t.Fatal(err)
+	}
+	moderator, _ := s.login("bobby", "password123")
+	s.expect(s.do(http.MethodPut, path, moderator, gin.H{"title": "Moderated"}), http.StatusOK)
+	s.expect(s.do(http.MethodPut, path, moderator, gin.H{"title": "Moved", "category": "music"}), http.StatusForbidden)
+	s.expect(s.do(http.MethodPut, path, moderator, gin.H{"title": "Kept", "category": "technology"}), http.StatusOK)
+
+	otherThread := s.postThread(owner, "music")
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/threads/%d", otherThread), moderator, nil), http.StatusForbidden)
+
+	// Site-wide moderators can act everywhere
+	if err := s.store.Users.SetUserRole("bobby", "moderator"); err != nil {
+		t.Fatal(err)
+	}
+	moderator, _ = s.login("bobby", "password123")
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/threads/%d", otherThread), moderator, nil), http.StatusOK)
+}
+
+func TestSavedThreads(t *testing.T) {
+	s := newTestServer(t)
+	token := s.signupAndLogin("alice")
+	other := s.signupAndLogin("bobby")
+	threadID := s.postThread(token, "general")
+
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/user/alice/save_thread/%d", threadID), token, nil), http.StatusOK)
+
+	body := s.expect(s.do(http.MethodGet, fmt.Sprintf("/user/alice/saved_state/%d", threadID), token, nil), http.StatusOK)
+	if body["saved"] != true {
+		t.Fatalf("expected thread to be saved, got %v", body)
+	}
+
+	body = s.expect(s.do(http.MethodGet, "/user/alice/saved_threads", token, nil), http.StatusOK)
+	if threads := body["threads"].([]interface{}); len(threads) != 1 {
+		t.Fatalf("expected 1 saved thread, got %v", threads)
+	}
+	s.expect(s.do(http.MethodGet, "/user/alice/saved_threads", other, nil), http.StatusBadRequest)
+
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/user/alice/unsave_thread/%d", threadID), token, nil), http.StatusOK)
+	body = s.expect(s.do(http.MethodGet, fmt.Sprintf("/user/alice/saved_state/%d", threadID), token, nil), http.StatusOK)
+	if body["saved"] != false {
+		t.Fatalf("expected thread to be unsaved, got %v", body)
+	}
+}
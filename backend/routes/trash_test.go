@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"backend/models"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trash lists the IDs of the threads and comments in the trash of the owner of token
+func (s *testServer) trash(token string) ([]int, []int) {
+	s.t.Helper()
+
+	body := s.expect(s.do(http.MethodGet, "/trash", token, nil), http.StatusOK)
+	ids := func(key string) []int {
+		var ids []int
+		for _, item := range body[key].([]interface{}) {
+			ids = append(ids, int(item.(map[string]interface{})["id"].(float64)))
+		}
+		return ids
+	}
+	return ids("threads"), ids("comments")
+}
+
+func TestRestoreComment(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	root := s.reply(alice, threadID, 0, "root")
+	s.reply(bobby, threadID, root, "reply")
+	base := fmt.Sprintf("/threads/%d/comments/%d", threadID, root)
+
+	s.expect(s.do(http.MethodPost, base+"/restore", alice, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodDelete, base, alice, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, base, alice, nil), http.StatusBadRequest)
+	if _, byID := s.commentsByID(threadID, "", ""); byID[root]["content"] != "[deleted]" {
+		t.Fatalf("expected a placeholder, got %v", byID[root])
+	}
+
+	// Only the owner sees their deleted content, and others cannot restore it
+	if threads, comments := s.trash(alice); len(threads) != 0 || fmt.Sprint(comments) != fmt.Sprintf("[%d]", root) {
+		t.Fatalf("unexpected trash %v %v", threads, comments)
+	}
+	if _, comments := s.trash(bobby); len(comments) != 0 {
+		t.Fatalf("expected an empty trash for bobby, got %v", comments)
+	}
+	s.expect(s.do(http.MethodPost, base+"/restore", bobby, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/comments/%d/restore", s.postThread(alice, "general"), root), alice, nil), http.StatusNotFound)
+
+	s.expect(s.do(http.MethodPost, base+"/restore", alice, nil), http.StatusOK)
+	if _, byID := s.commentsByID(threadID, "", ""); byID[root]["content"] != "root" || byID[root]["deleted"] != false {
+		t.Fatalf("expected the comment back, got %v", byID[root])
+	}
+	thread := s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d", threadID), "", nil), http.StatusOK)["thread"].(map[string]interface{})
+	if thread["comment_count"] != 2.0 {
+		t.Fatalf("expected the comment to count again, got %v", thread)
+	}
+	if _, comments := s.trash(alice); len(comments) != 0 {
+		t.Fatalf("expected an empty trash, got %v", comments)
+	}
+
+	// Owners cannot undo a moderator's removal, moderators can
+	admin, _ := s.login("admin", "adminpass123")
+	s.expect(s.do(http.MethodDelete, base+"?reason=rude", admin, nil), http.StatusOK)
+	if _, comments := s.trash(alice); len(comments) != 0 {
+		t.Fatalf("expected removed comments to stay out of the trash, got %v", comments)
+	}
+	s.expect(s.do(http.MethodPost, base+"/restore", alice, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodPost, base+"/restore?reason=appealed", admin, nil), http.StatusOK)
+	list, _ := s.notifications(alice)
+	if len(list) != 3 || list[0]["message"] != "A moderator restored your comment" {
+		t.Fatalf("unexpected notifications %v", list)
+	}
+	// Restores are audited like deletions, whoever restores
+	restores := s.auditLog(admin, "?action=comment.restore")
+	if len(restores) != 2 || restores[0]["actor"] != "admin" || restores[0]["reason"] != "appealed" || restores[0]["after"].(map[string]interface{})["content"] != "root" {
+		t.Fatalf("unexpected audit entries %v", restores)
+	}
+}
+
+func TestRestoreThread(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	commentID := s.reply(bobby, threadID, 0, "reply")
+	path := fmt.Sprintf("/threads/%d", threadID)
+
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("%s/comments/%d", path, commentID), bobby, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, path, alice, nil), http.StatusOK)
+
+	// Deleted threads are gone everywhere but the owner's trash
+	s.expect(s.do(http.MethodGet, path, "", nil), http.StatusNotFound)
+	if ids := s.threadIDs(""); len(ids) != 0 {
+		t.Fatalf("expected no threads, got %v", ids)
+	}
+	s.expect(s.do(http.MethodPost, path+"/comments", bobby, gin.H{"content": "late"}), http.StatusNotFound)
+	s.expect(s.do(http.MethodPut, path, alice, gin.H{"title": "Edited"}), http.StatusBadRequest)
+	if threads, _ := s.trash(alice); fmt.Sprint(threads) != fmt.Sprintf("[%d]", threadID) {
+		t.Fatalf("unexpected trash %v", threads)
+	}
+	if _, comments := s.trash(bobby); len(comments) != 0 {
+		t.Fatalf("expected the comments of deleted threads to leave the trash, got %v", comments)
+	}
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("%s/comments/%d/restore", path, commentID), bobby, nil), http.StatusConflict)
+	s.expect(s.do(http.MethodPost, path+"/restore", bobby, nil), http.StatusForbidden)
+
+	// Restoring brings the thread back with its comments
+	s.expect(s.do(http.MethodPost, path+"/restore", alice, nil), http.StatusOK)
+	s.expect(s.do(http.MethodPost, path+"/restore", alice, nil), http.StatusNotFound)
+	if ids := s.threadIDs(""); fmt.Sprint(ids) != fmt.Sprintf("[%d]", threadID) {
+		t.Fatalf("expected the thread back, got %v", ids)
+	}
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("%s/comments/%d/restore", path, commentID), bobby, nil), http.StatusOK)
+	if order, _ := s.commentsByID(threadID, "", ""); fmt.Sprint(order) != fmt.Sprintf("[%d]", commentID) {
+		t.Fatalf("expected the comment back, got %v", order)
+	}
+
+	// Past the retention window nothing can be restored
+	defer func(retention time.Duration) { models.TrashRetention = retention }(models.TrashRetention)
+	models.TrashRetention = 0
+	s.expect(s.do(http.MethodDelete, path, alice, nil), http.StatusOK)
+	if threads, _ := s.trash(alice); len(threads) != 0 {
+		t.Fatalf("expected expired threads to leave the trash, got %v", threads)
+	}
+	s.expect(s.do(http.MethodPost, path+"/restore", alice, nil), http.StatusGone)
+}
@@ -0,0 +1,175 @@
+package routes
+
+import (
+	"backend/middlewares"
+	"backend/models"
+	"backend/utils"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// totpCode returns the code of secret offset steps from now
+func (s *testServer) totpCode(secret string, offset int) string {
+	s.t.Helper()
+
+	code, err := utils.TOTPCode(secret, time.Now().Add(time.Duration(offset)*30*time.Second))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return code
+}
+
+// enableTwoFactor enrolls a user and returns their secret and recovery codes
+func (s *testServer) enableTwoFactor(token, username, password string) (string, []string) {
+	s.t.Helper()
+
+	path := "/user/" + username + "/2fa"
+	secret := s.expect(s.do(http.MethodPost, path, token, gin.H{"password": password}), http.StatusOK)["secret"].(string)
+	body := s.expect(s.do(http.MethodPost, path+"/enable", token, gin.H{"code": s.totpCode(secret, 0)}), http.StatusOK)
+	var codes []string
+	for _, code := range body["recovery_codes"].([]interface{}) {
+		codes = append(codes, code.(string))
+	}
+	return secret, codes
+}
+
+// loginChallenge logs in with a password and returns the 2FA challenge token
+func (s *testServer) loginChallenge(username, password string) string {
+	s.t.Helper()
+
+	body := s.expect(s.do(http.MethodPost, "/login", "", gin.H{"username": username, "password": password}), http.StatusOK)
+	if body["two_factor_required"] != true || body["token"] != nil {
+		s.t.Fatalf("expected a 2FA challenge, got %v", body)
+	}
+	return body["challenge_token"].(string)
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	defer func(policy models.LoginPolicy) { models.AccountLoginPolicy = policy }(models.AccountLoginPolicy)
+	models.AccountLoginPolicy = models.LoginPolicy{FreeAttempts: 20, MaxFailures: 20, Lockout: time.Hour, Window: time.Hour}
+
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	path := "/user/alice/2fa"
+
+	s.expect(s.do(http.MethodPost, path, alice, gin.H{"password": "wrongpassword"}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, path+"/enable", alice, gin.H{"code": "123456"}), http.StatusBadRequest)
+	body := s.expect(s.do(http.MethodPost, path, alice, gin.H{"password": "password123"}), http.StatusOK)
+	secret := body["secret"].(string)
+	if uri := body["otpauth_uri"].(string); !strings.HasPrefix(uri, "otpauth://totp/Soforum:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("unexpected URI %s", uri)
+	}
+	s.expect(s.do(http.MethodPost, path+"/enable", alice, gin.H{"code": "000000"}), http.StatusBadRequest)
+	recovery := s.expect(s.do(http.MethodPost, path+"/enable", alice, gin.H{"code": s.totpCode(secret, 0)}), http.StatusOK)["recovery_codes"].([]interface{})
+	body = s.expect(s.do(http.MethodGet, path, alice, nil), http.StatusOK)
+	if body["enabled"] != true || body["recovery_codes_left"] != 10.0 {
+		t.Fatalf("unexpected status %v", body)
+	}
+
+	// The password alone no longer logs in, and a code works once
+	challenge := s.loginChallenge("alice", "password123")
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "code": "000000"}), http.StatusUnauthorized)
+	code := s.totpCode(secret, 1)
+	body = s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "code": code}), http.StatusOK)
+	s.expect(s.do(http.MethodGet, path, body["token"].(string), nil), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "code": code}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": s.loginChallenge("alice", "password123"), "code": code}), http.StatusUnauthorized)
+
+	// A challenge allows a few attempts
+	challenge = s.loginChallenge("alice", "password123")
+	for i := 0; i < 5; i++ {
+		s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "recovery_code": "nope"}), http.StatusUnauthorized)
+	}
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "recovery_code": recovery[0]}), http.StatusUnauthorized)
+	if body := s.expect(s.do(http.MethodGet, path, alice, nil), http.StatusOK); body["recovery_codes_left"] != 10.0 {
+		t.Fatalf("expected the recovery code to be left unused, got %v", body)
+	}
+}
+
+func TestTwoFactorRecoveryCodes(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	_, codes := s.enableTwoFactor(alice, "alice", "password123")
+
+	// Recovery codes work once, whatever their case and dashes
+	challenge := s.loginChallenge("alice", "password123")
+	recovery := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "recovery_code": recovery}), http.StatusOK)
+	challenge = s.loginChallenge("alice", "password123")
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "recovery_code": codes[0]}), http.StatusUnauthorized)
+
+	// New codes replace the old ones
+	s.expect(s.do(http.MethodPost, "/user/alice/2fa/recovery-codes", alice, gin.H{"recovery_code": codes[1]}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, "/user/alice/2fa/recovery-codes", alice, gin.H{"password": "wrongpassword", "recovery_code": codes[1]}), http.StatusUnauthorized)
+	body := s.expect(s.do(http.MethodPost, "/user/alice/2fa/recovery-codes", alice, gin.H{"password": "password123", "recovery_code": codes[1]}), http.StatusOK)
+	fresh := body["recovery_codes"].([]interface{})
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "recovery_code": codes[2]}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "recovery_code": fresh[0]}), http.StatusOK)
+
+	// Turning 2FA off takes the password and a second factor
+	s.expect(s.do(http.MethodDelete, "/user/alice/2fa", alice, gin.H{"password": "password123", "recovery_code": codes[3]}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodDelete, "/user/alice/2fa", alice, gin.H{"password": "wrongpassword", "recovery_code": fresh[1]}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodDelete, "/user/alice/2fa", alice, gin.H{"password": "password123", "recovery_code": fresh[1]}), http.StatusOK)
+	s.login("alice", "password123")
+}
+
+func TestTwoFactorRequiredForPrivileged(t *testing.T) {
+	defer func() { middlewares.RequireTwoFactorForPrivileged = false }()
+	middlewares.RequireTwoFactorForPrivileged = true
+
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	if body := s.expect(s.do(http.MethodGet, "/user/alice/2fa", alice, nil), http.StatusOK); body["required"] != false {
+		t.Fatalf("expected 2FA to be optional for users, got %v", body)
+	}
+
+	// Admins without 2FA log in with user rights until they enable it
+	body := s.expect(s.do(http.MethodPost, "/login", "", gin.H{"username": "admin", "password": "adminpass123"}), http.StatusOK)
+	admin, refreshToken := body["token"].(string), body["refresh_token"].(string)
+	if body["two_factor_setup_required"] != true {
+		t.Fatalf("expected a 2FA setup reminder, got %v", body)
+	}
+	s.expect(s.do(http.MethodGet, "/admin/audit", admin, nil), http.StatusForbidden)
+	secret, codes := s.enableTwoFactor(admin, "admin", "adminpass123")
+	body = s.expect(s.do(http.MethodPost, "/token/refresh", "", gin.H{"refresh_token": refreshToken}), http.StatusOK)
+	s.expect(s.do(http.MethodGet, "/admin/audit", body["token"].(string), nil), http.StatusOK)
+
+	challenge := s.loginChallenge("admin", "adminpass123")
+	body = s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "code": s.totpCode(secret, 1)}), http.StatusOK)
+	if _, ok := body["two_factor_setup_required"]; ok {
+		t.Fatalf("unexpected 2FA setup reminder %v", body)
+	}
+	s.expect(s.do(http.MethodDelete, "/user/admin/2fa", admin, gin.H{"password": "adminpass123", "recovery_code": codes[0]}), http.StatusForbidden)
+}
+
+func TestTwoFactorCodesCountAgainstLockout(t *testing.T) {
+	defer func(policy models.LoginPolicy) { models.AccountLoginPolicy = policy }(models.AccountLoginPolicy)
+	models.AccountLoginPolicy = models.LoginPolicy{FreeAttempts: 4, MaxFailures: 5, Lockout: time.Hour, Window: time.Hour}
+
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	secret, codes := s.enableTwoFactor(alice, "alice", "password123")
+
+	// A complete login forgets the failures
+	challenge := s.loginChallenge("alice", "password123")
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "code": "000000"}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "code": s.totpCode(secret, 1)}), http.StatusOK)
+
+	// Logging in again for fresh challenges does not give codes more tries
+	for i := 0; i < 2; i++ {
+		challenge = s.loginChallenge("alice", "password123")
+		s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "code": "000000"}), http.StatusUnauthorized)
+	}
+	challenge = s.loginChallenge("alice", "password123")
+	s.failLogin("alice", "password123", http.StatusTooManyRequests)
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": challenge, "code": s.totpCode(secret, 0)}), http.StatusTooManyRequests)
+
+	// Nor does guessing them with an access token
+	path := "/user/alice/2fa/recovery-codes"
+	s.expect(s.do(http.MethodPost, path, alice, gin.H{"password": "password123", "recovery_code": codes[0]}), http.StatusTooManyRequests)
+	s.expect(s.do(http.MethodDelete, "/user/alice/2fa", alice, gin.H{"password": "password123", "recovery_code": codes[0]}), http.StatusTooManyRequests)
+}
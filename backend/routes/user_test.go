@@ -0,0 +1,220 @@
+package routes
+
+import (
+	"backend/models"
+	"backend/models/memory"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSignupHashesPassword(t *testing.T) {
+	s := newTestServer(t)
+
+	body := s.expect(s.do(http.MethodPost, "/signup", "", gin.H{
+		"username": "alice",
+		"password": "password123",
+		"email":    "alice@example.com",
+	}), http.StatusCreated)
+	if _, ok := body["password"]; ok {
+		t.Fatalf("signup response must not echo the password: %v", body)
+	}
+
+	stored, err := s.store.Users.GetUserPasswordByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, "$2a$") {
+		t.Fatalf("expected a bcrypt hash, got %q", stored)
+	}
+}
+
+func TestSignupValidation(t *testing.T) {
+	s := newTestServer(t)
+	s.signup("alice")
+
+	cases := []gin.H{
+		{"username": "al", "password": "password123", "email": "al@example.com"},
+		{"username": "bob", "password": "short1", "email": "bob@example.com"},
+		{"username": "bob", "password": "password123", "email": "not-an-email"},
+		{"username": "alice", "password": "password123", "email": "other@example.com"},
+		{"username": "bob", "password": "password123", "email": "alice@example.com"},
+	}
+	for _, payload := range cases {
+		s.expect(s.do(http.MethodPost, "/signup", "", payload), http.StatusBadRequest)
+	}
+}
+
+func TestLoginRehashesLegacyPassword(t *testing.T) {
+	s := newTestServer(t)
+
+	// The reserved admin user is seeded with a plaintext password
+	s.login("admin", "adminpass123")
+
+	stored, err := s.store.Users.GetUserPasswordByUsername("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, "$2a$") {
+		t.Fatalf("expected the legacy password to be rehashed, got %q", stored)
+	}
+
+	// And the upgraded hash keeps working
+	s.login("admin", "adminpass123")
+}
+
+func TestLoginAcceptsPasswordsFromOlderRules(t *testing.T) {
+	s := newTestServer(t)
+
+	// Legacy rows may hold passwords the signup rules would refuse today
+	long := strings.Repeat("legacy", 15)
+	if err := s.store.Users.UpdateUserPassword("admin", long); err != nil {
+		t.Fatal(err)
+	}
+	s.login("admin", long)
+	s.expect(s.do(http.MethodPost, "/login", "", gin.H{"username": "admin", "password": ""}), http.StatusBadRequest)
+
+	// New passwords are capped at bcrypt's 72 bytes
+	body := s.expect(s.do(http.MethodPost, "/signup", "", gin.H{
+		"username": "alice",
+		"email":    "alice@example.com",
+		"password": strings.Repeat("a1", 37),
+	}), http.StatusBadRequest)
+	if body["error"] != "password must be at most 72 bytes" {
+		t.Fatalf("unexpected error %v", body["error"])
+	}
+}
+
+func TestLoginRejectsWrongPassword(t *testing.T) {
+	s := newTestServer(t)
+	s.signup("alice")
+
+	s.expect(s.do(http.MethodPost, "/login", "", gin.H{
+		"username": "alice",
+		"password": "password124",
+	}), http.StatusUnauthorized)
+}
+
+func TestGetAndUpdateUser(t *testing.T) {
+	s := newTestServer(t)
+	token := s.signupAndLogin("alice")
+	other := s.signupAndLogin("bobby")
+
+	s.expect(s.do(http.MethodPut, "/user/alice", other, gin.H{"username": "alice", "bio": "hacked"}), http.StatusForbidden)
+	s.expect(s.do(http.MethodPut, "/user/alice", token, gin.H{"username": "alice", "bio": "hello"}), http.StatusOK)
+
+	body := s.expect(s.do(http.MethodGet, "/user/alice", "", nil), http.StatusOK)
+	if body["bio"] != "hello" || body["role"] != "user" {
+		t.Fatalf("unexpected profile %v", body)
+	}
+
+	s.expect(s.do(http.MethodGet, "/user/nobody", "", nil), http.StatusNotFound)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	ownThread := s.postThread(alice, "general")
+	bobbyThread := s.postThread(bobby, "general")
+	commentID := s.reply(alice, bobbyThread, 0, "hello")
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/votes", bobbyThread), alice, gin.H{"vote": 1}), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/user/alice/save_thread/%d", bobbyThread), alice, nil), http.StatusOK)
+
+	s.expect(s.do(http.MethodDelete, "/user/alice", bobby, gin.H{"password": "password123"}), http.StatusForbidden)
+	s.expect(s.do(http.MethodDelete, "/user/alice", alice, nil), http.StatusBadRequest)
+	s.expect(s.do(http.MethodDelete, "/user/alice", alice, gin.H{"password": "password124"}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodDelete, "/user/alice", alice, gin.H{"password": "password123"}), http.StatusOK)
+
+	// The account and its sessions are gone
+	s.expect(s.do(http.MethodGet, "/user/alice", "", nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodGet, "/notifications", alice, nil), http.StatusUnauthorized)
+
+	// Content stays under the reserved user, votes do not
+	thread := s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d", ownThread), "", nil), http.StatusOK)["thread"].(map[string]interface{})
+	if thread["username"] != "left" {
+		t.Fatalf("expected the thread to be reassigned, got %v", thread)
+	}
+	if _, byID := s.commentsByID(bobbyThread, "", ""); byID[commentID]["username"] != "left" || byID[commentID]["content"] != "hello" {
+		t.Fatalf("expected the comment to be reassigned, got %v", byID[commentID])
+	}
+	if votes := s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d/votes", bobbyThread), "", nil), http.StatusOK)["votes"]; votes != 0.0 {
+		t.Fatalf("expected the vote to be removed, got %v", votes)
+	}
+
+	// The name is free again
+	s.signup("alice")
+
+	if err := s.store.Users.DeleteUser("left", false); !errors.Is(err, models.ErrReservedUser) {
+		t.Fatalf("expected the left user to be reserved, got %v", err)
+	}
+}
+
+func TestLeftUserCannotLogIn(t *testing.T) {
+	s := newTestServer(t)
+
+	s.expect(s.do(http.MethodPost, "/login", "", gin.H{"username": "left", "password": "leftpass123"}), http.StatusUnauthorized)
+
+	// Not even with a password set behind the API's back
+	hash, err := utils.HashPassword("password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.store.Users.UpdateUserPassword("left", hash); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(s.do(http.MethodPost, "/login", "", gin.H{"username": "left", "password": "password123"}), http.StatusUnauthorized)
+}
+
+func TestSeededUsersCannotLogIn(t *testing.T) {
+	store := memory.NewStore()
+	s := &testServer{t: t, router: SetupRouter(store), store: store}
+
+	// The passwords once published with the seed data no longer work, and the
+	// reserved admin only has user rights until it is promoted
+	s.expect(s.do(http.MethodPost, "/login", "", gin.H{"username": "admin", "password": "adminpass123"}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/login", "", gin.H{"username": "guest", "password": "guestpass123"}), http.StatusUnauthorized)
+	if grants, err := store.Users.GetUserGrants("admin"); err != nil || grants.Role != models.RoleUser {
+		t.Fatalf("expected the admin to be a user, got %v %v", grants, err)
+	}
+}
+
+func TestDeleteAccountWithContent(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	ownThread := s.postThread(alice, "general")
+	answer := s.reply(bobby, ownThread, 0, "answer")
+	bobbyThread := s.postThread(bobby, "general")
+	root := s.reply(alice, bobbyThread, 0, "root")
+	s.reply(bobby, bobbyThread, root, "reply")
+	leaf := s.reply(alice, bobbyThread, 0, "leaf")
+
+	s.expect(s.do(http.MethodDelete, "/user/alice", alice, gin.H{"password": "password123", "delete_content": true}), http.StatusOK)
+
+	// Threads go to the trash with the comments of others
+	s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d", ownThread), "", nil), http.StatusNotFound)
+	if trashed, err := s.store.Threads.GetDeletedThread(ownThread); err != nil || trashed.Username != "left" {
+		t.Fatalf("expected the thread to be in the trash, got %v, %v", trashed, err)
+	}
+	if comment, err := s.store.Comments.GetCommentByID(answer); err != nil || comment.Username != "bobby" {
+		t.Fatalf("expected bobby's comment to be kept, got %v, %v", comment, err)
+	}
+	order, byID := s.commentsByID(bobbyThread, "", "")
+	if len(order) != 2 || byID[root]["content"] != "[deleted]" || byID[leaf] != nil {
+		t.Fatalf("expected only a placeholder for the comment with replies, got %v", byID)
+	}
+	thread := s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d", bobbyThread), "", nil), http.StatusOK)["thread"].(map[string]interface{})
+	if thread["comment_count"] != 1.0 {
+		t.Fatalf("expected the deleted comments not to count, got %v", thread)
+	}
+	admin, _ := s.login("admin", "adminpass123")
+	if revisions := s.revisions(fmt.Sprintf("/threads/%d/comments/%d/revisions", bobbyThread, root), admin); revisions != nil {
+		t.Fatalf("expected no revisions, got %v", revisions)
+	}
+}
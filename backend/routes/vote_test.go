@@ -0,0 +1,146 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestVoting(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	path := fmt.Sprintf("/threads/%d/votes", threadID)
+
+	s.expect(s.do(http.MethodPost, path, alice, gin.H{"vote": 1}), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, path, bobby, gin.H{"vote": 1}), http.StatusCreated)
+	if votes := s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK)["votes"]; votes != 2.0 {
+		t.Fatalf("expected 2 votes, got %v", votes)
+	}
+
+	// Voting again replaces the previous vote
+	s.expect(s.do(http.MethodPost, path, bobby, gin.H{"vote": -1}), http.StatusCreated)
+	if votes := s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK)["votes"]; votes != 0.0 {
+		t.Fatalf("expected 0 votes, got %v", votes)
+	}
+
+	state := s.expect(s.do(http.MethodGet, fmt.Sprintf("/bobby/%d/vote_state", threadID), "", nil), http.StatusOK)
+	if state["vote"] != -1.0 {
+		t.Fatalf("expected downvote state, got %v", state)
+	}
+
+	s.expect(s.do(http.MethodDelete, path, bobby, nil), http.StatusOK)
+	state = s.expect(s.do(http.MethodGet, fmt.Sprintf("/bobby/%d/vote_state", threadID), "", nil), http.StatusOK)
+	if state["vote"] != 0.0 {
+		t.Fatalf("expected no vote, got %v", state)
+	}
+
+	s.expect(s.do(http.MethodPost, path, alice, gin.H{"vote": 5}), http.StatusInternalServerError)
+}
+
+// commentsByID fetches the flat comment list of a thread as seen by token
+func (s *testServer) commentsByID(threadID int, token, query string) ([]int, map[int]map[string]interface{}) {
+	s.t.Helper()
+
+	body := s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d/comments%s", threadID, query), token, nil), http.StatusOK)
+	var order []int
+	byID := map[int]map[string]interface{}{}
+	for _, item := range body["comments"].([]interface{}) {
+		comment := item.(map[string]interface{})
+		id := int(comment["id"].(float64))
+		order = append(order, id)
+		byID[id] = comment
+	}
+	return order, byID
+}
+
+func TestCommentVoting(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	first := s.reply(alice, threadID, 0, "first")
+	second := s.reply(alice, threadID, 0, "second")
+	nested := s.reply(bobby, threadID, first, "nested")
+	path := func(commentID int) string {
+		return fmt.Sprintf("/threads/%d/comments/%d/votes", threadID, commentID)
+	}
+
+	s.expect(s.do(http.MethodPost, path(second), alice, gin.H{"vote": 1}), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, path(second), bobby, gin.H{"vote": 1}), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, path(first), bobby, gin.H{"vote": 1}), http.StatusCreated)
+
+	// Voting again replaces the previous vote
+	s.expect(s.do(http.MethodPost, path(first), bobby, gin.H{"vote": -1}), http.StatusCreated)
+
+	_, comments := s.commentsByID(threadID, bobby, "")
+	if comments[first]["score"] != -1.0 || comments[first]["user_vote"] != -1.0 {
+		t.Fatalf("unexpected first comment %v", comments[first])
+	}
+	if comments[second]["score"] != 2.0 || comments[second]["user_vote"] != 1.0 {
+		t.Fatalf("unexpected second comment %v", comments[second])
+	}
+	if comments[nested]["score"] != 0.0 || comments[nested]["user_vote"] != 0.0 {
+		t.Fatalf("unexpected nested comment %v", comments[nested])
+	}
+
+	// Anonymous readers see scores but no vote state
+	_, comments = s.commentsByID(threadID, "", "")
+	if comments[second]["score"] != 2.0 || comments[second]["user_vote"] != 0.0 {
+		t.Fatalf("unexpected anonymous view %v", comments[second])
+	}
+
+	s.expect(s.do(http.MethodDelete, path(first), bobby, nil), http.StatusOK)
+	_, comments = s.commentsByID(threadID, bobby, "")
+	if comments[first]["score"] != 0.0 || comments[first]["user_vote"] != 0.0 {
+		t.Fatalf("expected vote to be removed, got %v", comments[first])
+	}
+
+	s.expect(s.do(http.MethodPost, path(first), alice, gin.H{"vote": 5}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, path(first), "", gin.H{"vote": 1}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, path(9999), alice, gin.H{"vote": 1}), http.StatusNotFound)
+
+	// Comments can only be voted on through their own thread
+	otherThread := s.postThread(alice, "general")
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/comments/%d/votes", otherThread, first), alice, gin.H{"vote": 1}), http.StatusNotFound)
+
+	// Deleted placeholders cannot be voted on
+	s.expect(s.do(http.MethodDelete, fmt.Sprintf("/threads/%d/comments/%d", threadID, first), alice, nil), http.StatusOK)
+	s.expect(s.do(http.MethodPost, path(first), bobby, gin.H{"vote": 1}), http.StatusBadRequest)
+}
+
+func TestCommentSorting(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signupAndLogin("alice")
+	bobby := s.signupAndLogin("bobby")
+	threadID := s.postThread(alice, "general")
+	first := s.reply(alice, threadID, 0, "first")
+	firstReplyA := s.reply(alice, threadID, first, "reply a")
+	firstReplyB := s.reply(alice, threadID, first, "reply b")
+	second := s.reply(alice, threadID, 0, "second")
+	vote := func(token string, commentID, value int) {
+		s.expect(s.do(http.MethodPost, fmt.Sprintf("/threads/%d/comments/%d/votes", threadID, commentID), token, gin.H{"vote": value}), http.StatusCreated)
+	}
+	vote(alice, second, 1)
+	vote(bobby, second, 1)
+	vote(alice, firstReplyB, 1)
+	vote(bobby, first, -1)
+
+	order, _ := s.commentsByID(threadID, "", "?sort=score")
+	if fmt.Sprint(order) != fmt.Sprint([]int{second, first, firstReplyB, firstReplyA}) {
+		t.Fatalf("unexpected score order %v", order)
+	}
+	order, _ = s.commentsByID(threadID, "", "?sort=new")
+	if fmt.Sprint(order) != fmt.Sprint([]int{second, first, firstReplyB, firstReplyA}) {
+		t.Fatalf("unexpected new order %v", order)
+	}
+	order, _ = s.commentsByID(threadID, "", "")
+	if fmt.Sprint(order) != fmt.Sprint([]int{first, firstReplyA, firstReplyB, second}) {
+		t.Fatalf("unexpected default order %v", order)
+	}
+
+	s.expect(s.do(http.MethodGet, fmt.Sprintf("/threads/%d/comments?sort=random", threadID), "", nil), http.StatusBadRequest)
+}
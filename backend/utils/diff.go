@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// diffContext is how many unchanged lines surround each hunk of a diff
+const diffContext = 3
+
+// MaxDiffLines is how many lines the two texts of a diff may have together,
+// which bounds the time spent on texts that have little in common
+const MaxDiffLines = 4000
+
+// ErrDiffTooLarge is returned for texts of more than MaxDiffLines lines
+var ErrDiffTooLarge = errors.New("too large to diff")
+
+// diffLine is one line of a diff, op being ' ', '-' or '+'
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// UnifiedDiff returns the line-based unified diff turning a into b, with the
+// given names in its header, or an empty string if they have the same lines.
+// It returns ErrDiffTooLarge if they have more than MaxDiffLines lines together.
+func UnifiedDiff(fromName, toName, a, b string) (string, error) {
+	aLines, bLines := splitLines(a), splitLines(b)
+	if slices.Equal(aLines, bLines) {
+		return "", nil
+	}
+	if len(aLines)+len(bLines) > MaxDiffLines {
+		return "", ErrDiffTooLarge
+	}
+	lines := diffLines(aLines, bLines)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for start := 0; start < len(lines); {
+		// Find the next change and extend the hunk while the changes after it
+		// are close enough for their context to overlap
+		first := start
+		for first < len(lines) && lines[first].op == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		last := first
+		for i := first + 1; i < len(lines) && i <= last+2*diffContext; i++ {
+			if lines[i].op != ' ' {
+				last = i
+			}
+		}
+		from := max(first-diffContext, start)
+		to := min(last+1+diffContext, len(lines))
+
+		// Count the lines of each side before and within the hunk
+		aStart, bStart := 0, 0
+		for _, l := range lines[:from] {
+			if l.op != '+' {
+				aStart++
+			}
+			if l.op != '-' {
+				bStart++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, l := range lines[from:to] {
+			if l.op != '+' {
+				aCount++
+			}
+			if l.op != '-' {
+				bCount++
+			}
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, l := range lines[from:to] {
+			sb.WriteByte(l.op)
+			sb.WriteString(l.text)
+			sb.WriteByte('\n')
+		}
+		start = to
+	}
+	return sb.String(), nil
+}
+
+// splitLines splits text into lines, ignoring a final newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// hunkRange formats the range of a hunk header the way diff -u does, where
+// before is the number of lines preceding the hunk
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	default:
+		return fmt.Sprintf("%d,%d", before+1, count)
+	}
+}
+
+// diffLines computes a shortest edit script from a to b with Myers' algorithm.
+// It uses the linear space variant, which splits the problem at the middle of
+// a shortest path and solves both halves on their own.
+func diffLines(a, b []string) []diffLine {
+	maxD := (len(a) + len(b) + 1) / 2
+	d := &differ{
+		a:      a,
+		b:      b,
+		vf:     make([]int, 2*maxD+2),
+		vb:     make([]int, 2*maxD+2),
+		offset: maxD,
+		lines:  make([]diffLine, 0, len(a)+len(b)),
+	}
+	d.compare(0, len(a), 0, len(b))
+	return d.lines
+}
+
+// differ holds the state of diffLines, where vf and vb keep the furthest x
+// reached on each diagonal going forward from the start and backward from the
+// end of the current subproblem
+type differ struct {
+	a, b   []string
+	vf, vb []int
+	offset int
+	lines  []diffLine
+}
+
+// compare appends the edit script from a[aLo:aHi] to b[bLo:bHi]
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.lines = append(d.lines, diffLine{' ', d.a[aLo]})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-1-suffix] == d.b[bHi-1-suffix] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi:
+		for _, line := range d.b[bLo:bHi] {
+			d.lines = append(d.lines, diffLine{'+', line})
+		}
+	case bLo == bHi:
+		for _, line := range d.a[aLo:aHi] {
+			d.lines = append(d.lines, diffLine{'-', line})
+		}
+	default:
+		x, y := d.split(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.compare(x, aHi, y, bHi)
+	}
+
+	for _, line := range d.a[aHi : aHi+suffix] {
+		d.lines = append(d.lines, diffLine{' ', line})
+	}
+}
+
+// split finds where the forward and backward searches of a shortest path from
+// a[aLo:aHi] to b[bLo:bHi] meet, and returns the point of the forward path
+// there. Both sequences must be non-empty.
+func (d *differ) split(aLo, aHi, bLo, bHi int) (int, int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	// With an odd delta the paths meet in a forward round, else in a backward one
+	odd := delta%2 != 0
+	maxD := (n + m + 1) / 2
+	for i := d.offset - maxD; i <= d.offset+maxD+1; i++ {
+		d.vf[i] = -1
+		d.vb[i] = -1
+	}
+	d.vf[d.offset+1] = 0
+	d.vb[d.offset+1] = 0
+
+	// Diagonals whose paths left the edit graph are not searched again
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+	for D := 0; D <= maxD; D++ {
+		for k := -D + fStart; k <= D-fEnd; k += 2 {
+			var x int
+			if k == -D || (k != D && d.vf[d.offset+k-1] < d.vf[d.offset+k+1]) {
+				x = d.vf[d.offset+k+1]
+			} else {
+				x = d.vf[d.offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			d.vf[d.offset+k] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				// The backward path on the same diagonal, counted from the end
+				if back := d.offset + delta - k; back >= d.offset-maxD && back <= d.offset+maxD && d.vb[back] != -1 && x >= n-d.vb[back] {
+					return aLo + x, bLo + y
+				}
+			}
+		}
+
+		for k := -D + bStart; k <= D-bEnd; k += 2 {
+			var x int
+			if k == -D || (k != D && d.vb[d.offset+k-1] < d.vb[d.offset+k+1]) {
+				x = d.vb[d.offset+k+1]
+			} else {
+				x = d.vb[d.offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			d.vb[d.offset+k] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				if fwd := d.offset + delta - k; fwd >= d.offset-maxD && fwd <= d.offset+maxD && d.vf[fwd] != -1 && d.vf[fwd] >= n-x {
+					fx := d.vf[fwd]
+					return aLo + fx, bLo + fx - (fwd - d.offset)
+				}
+			}
+		}
+	}
+
+	// The paths only miss each other when the sequences have no line in common
+	return aLo + n, bLo
+}
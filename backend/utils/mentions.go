@@ -0,0 +1,25 @@
+package utils
+
+import "regexp"
+
+// MaxMentions caps how many users a single post can notify
+const MaxMentions = 10
+
+// mentionPattern matches @username where the @ does not follow a word character, so emails are skipped
+var mentionPattern = regexp.MustCompile(`(?:^|[^a-zA-Z0-9_@])@([a-zA-Z0-9_]{3,20})\b`)
+
+// ExtractMentions returns the distinct usernames mentioned in text, in order of appearance
+func ExtractMentions(text string) []string {
+	var usernames []string
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		if username := match[1]; !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+		if len(usernames) == MaxMentions {
+			break
+		}
+	}
+	return usernames
+}
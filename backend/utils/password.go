@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes and verifies passwords with a single algorithm.
+// Every hash it produces carries its algorithm and cost parameters as a
+// prefix, so hashes made with older settings can still be verified.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of password
+	Hash(password string) (string, error)
+	// Verify reports whether password matches the encoded hash
+	Verify(hash, password string) (bool, error)
+	// Owns reports whether the encoded hash was produced by this algorithm
+	Owns(hash string) bool
+	// NeedsRehash reports whether hash was produced with different parameters
+	NeedsRehash(hash string) bool
+}
+
+// BcryptHasher hashes passwords with bcrypt ($2a$<cost>$...)
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h BcryptHasher) Verify(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h BcryptHasher) Owns(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	if !h.Owns(hash) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2Hasher hashes passwords with argon2id in the PHC string format
+// ($argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>)
+type Argon2Hasher struct {
+	Memory  uint32 // in KiB
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+const argon2Prefix = "$argon2id$"
+
+func (h Argon2Hasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix, argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2Hasher) Verify(hash, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return false, err
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, candidate) == 1, nil
+}
+
+func (h Argon2Hasher) Owns(hash string) bool {
+	return strings.HasPrefix(hash, argon2Prefix)
+}
+
+func (h Argon2Hasher) NeedsRehash(hash string) bool {
+	params, _, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.Memory || params.Time != h.Time || params.Threads != h.Threads || uint32(len(key)) != h.KeyLen
+}
+
+// decodeArgon2Hash splits a PHC encoded argon2id hash into its parts
+func decodeArgon2Hash(hash string) (Argon2Hasher, []byte, []byte, error) {
+	var params Argon2Hasher
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id version: %v", err)
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %v", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %v", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id key: %v", err)
+	}
+	params.SaltLen = uint32(len(salt))
+	params.KeyLen = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+var (
+	// DefaultBcryptHasher is used when no algorithm is configured
+	DefaultBcryptHasher = BcryptHasher{Cost: bcrypt.DefaultCost}
+
+	// DefaultArgon2Hasher follows the OWASP recommended argon2id parameters
+	DefaultArgon2Hasher = Argon2Hasher{Memory: 64 * 1024, Time: 3, Threads: 2, SaltLen: 16, KeyLen: 32}
+
+	// passwordHasher hashes new passwords, knownHashers verify existing ones
+	passwordHasher PasswordHasher = DefaultBcryptHasher
+	knownHashers                  = []PasswordHasher{DefaultBcryptHasher, DefaultArgon2Hasher}
+)
+
+// InitPasswordHasher selects the password hasher from PASSWORD_HASH_ALGORITHM
+// ("bcrypt" or "argon2id") and BCRYPT_COST
+func InitPasswordHasher() {
+	switch strings.ToLower(os.Getenv("PASSWORD_HASH_ALGORITHM")) {
+	case "argon2id", "argon2":
+		SetPasswordHasher(DefaultArgon2Hasher)
+	case "", "bcrypt":
+		hasher := DefaultBcryptHasher
+		if costStr := os.Getenv("BCRYPT_COST"); costStr != "" {
+			cost, err := strconv.Atoi(costStr)
+			if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+				log.Fatalf("Invalid BCRYPT_COST: %s", costStr)
+			}
+			hasher.Cost = cost
+		}
+		SetPasswordHasher(hasher)
+	default:
+		log.Fatalf("Unknown PASSWORD_HASH_ALGORITHM: %s", os.Getenv("PASSWORD_HASH_ALGORITHM"))
+	}
+}
+
+// SetPasswordHasher replaces the hasher used for new passwords. Hashes from
+// the previous hasher keep verifying and are upgraded on the next login.
+func SetPasswordHasher(hasher PasswordHasher) {
+	passwordHasher = hasher
+	knownHashers = append([]PasswordHasher{hasher}, knownHashers...)
+}
+
+// HashPassword hashes a password with the configured hasher
+func HashPassword(password string) (string, error) {
+	return passwordHasher.Hash(password)
+}
+
+// MaxPasswordBytes is the longest password the configured hasher can tell
+// apart from its prefix, or 0 when there is no limit
+func MaxPasswordBytes() int {
+	if _, ok := passwordHasher.(BcryptHasher); ok {
+		return 72
+	}
+	return 0
+}
+
+// LockedPassword is stored in place of a hash for accounts that nobody may log
+// in to. It matches no password, not even as a legacy plaintext row.
+const LockedPassword = "!"
+
+// VerifyPassword checks password against a stored hash. needsRehash is true
+// when the password matched but the stored value should be replaced, which
+// includes legacy rows that still hold the plaintext password.
+func VerifyPassword(stored, password string) (match bool, needsRehash bool, err error) {
+	if stored == LockedPassword {
+		return false, false, nil
+	}
+	for _, hasher := range knownHashers {
+		if !hasher.Owns(stored) {
+			continue
+		}
+		match, err = hasher.Verify(stored, password)
+		if err != nil || !match {
+			return false, false, err
+		}
+		return true, passwordHasher.NeedsRehash(stored), nil
+	}
+
+	// Legacy plaintext row
+	match = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+	return match, match, nil
+}
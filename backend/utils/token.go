@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RefreshTokenTTL is the lifetime of a login session and its refresh tokens
+const RefreshTokenTTL = time.Hour * 24 * 30
+
+// GenerateRandomToken returns a URL safe random string with n bytes of entropy
+func GenerateRandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the SHA-256 hex digest of an opaque token, used so that
+// bearer secrets such as refresh tokens are never stored in plaintext
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sign returns the HMAC-SHA256 of message keyed by the JWT secret
+func sign(message string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_SECRET_KEY")))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignLink signs a path with an expiry as a Unix timestamp, so that links to
+// it can be handed out without a login and stop working once they expire
+func SignLink(path string, expires int64) string {
+	return sign(fmt.Sprintf("%s\n%d", path, expires))
+}
+
+// VerifyLink reports whether signature was made by SignLink for path and expires
+func VerifyLink(path string, expires int64, signature string) bool {
+	return hmac.Equal([]byte(SignLink(path, expires)), []byte(signature))
+}
+
+// SignToken returns a token for purpose that expires at the given time, made of
+// a random nonce, the expiry and their signature. Callers store its hash to
+// make it single-use.
+func SignToken(purpose string, expires time.Time) (string, error) {
+	nonce, err := GenerateRandomToken(24)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s.%d.%s", nonce, expires.Unix(), sign(fmt.Sprintf("%s\n%s\n%d", purpose, nonce, expires.Unix()))), nil
+}
+
+// VerifyToken reports whether token was made by SignToken for purpose and has
+// not expired yet
+func VerifyToken(purpose, token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return false
+	}
+	return hmac.Equal([]byte(sign(fmt.Sprintf("%s\n%s\n%d", purpose, parts[0], expires))), []byte(parts[2]))
+}
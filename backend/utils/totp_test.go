@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 key of the RFC 6238 test vectors, "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfc6238Vectors are the SHA1 test vectors of RFC 6238 Appendix B, cut to the
+// last six digits of their eight digit codes
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCode(t *testing.T) {
+	for _, tc := range rfc6238Vectors {
+		code, err := TOTPCode(rfc6238Secret, time.Unix(tc.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tc.code {
+			t.Errorf("%d: expected %s, got %s", tc.unix, tc.code, code)
+		}
+	}
+
+	// Secrets are accepted in any case, with padding and spaces
+	if code, err := TOTPCode("gezd gnbv gy3t qojq gezd gnbv gy3t qojq====", time.Unix(59, 0)); err != nil || code != "287082" {
+		t.Errorf("expected 287082, got %s %v", code, err)
+	}
+	if _, err := TOTPCode("not base32!", time.Now()); err == nil {
+		t.Error("expected an invalid secret to be refused")
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	for _, tc := range rfc6238Vectors {
+		at := time.Unix(tc.unix, 0)
+		step := TOTPStep(at)
+
+		// The codes of the steps around the current one are accepted
+		for _, skew := range []time.Duration{-totpPeriod * time.Second, 0, totpPeriod * time.Second} {
+			got, ok := VerifyTOTP(rfc6238Secret, tc.code, at.Add(skew))
+			if !ok || got != step {
+				t.Errorf("%d%+v: expected step %d, got %d %v", tc.unix, skew, step, got, ok)
+			}
+		}
+		if _, ok := VerifyTOTP(rfc6238Secret, tc.code, at.Add(2*totpPeriod*time.Second)); ok {
+			t.Errorf("%d: expected a code two steps old to be refused", tc.unix)
+		}
+	}
+
+	if _, ok := VerifyTOTP(rfc6238Secret, "94287082", time.Unix(59, 0)); ok {
+		t.Error("expected an eight digit code to be refused")
+	}
+}
@@ -20,12 +20,18 @@ func ValidateUsername(username string) error {
 	return nil
 }
 
-// ValidatePassword checks if the password is valid
+// ValidatePassword checks if a new password is valid. It is not applied at
+// login, so passwords set under older rules keep working.
 func ValidatePassword(password string) error {
 	if len(password) < 8 {
 		return fmt.Errorf("password must be at least 8 characters")
 	}
 
+	// bcrypt only looks at the first 72 bytes
+	if max := MaxPasswordBytes(); max > 0 && len(password) > max {
+		return fmt.Errorf("password must be at most %d bytes", max)
+	}
+
 	// Check for at least one letter AND one number
 	var letters = regexp.MustCompile(`[a-zA-Z]`)
 	var numbers = regexp.MustCompile(`[0-9]`)